@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kong"
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog/log"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/output"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/pricing"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/report"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/tracing"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+)
+
+// showCostEstimate prints the estimated cost and savings of nuking `bucket`, based on the CloudWatch storage
+// metrics of each storage type. `objectCount` is the estimated number of object versions to delete.
+//
+// returns the estimate, or nil if the storage metrics are not available
+func showCostEstimate(ctx context.Context, kongCtx *kong.Context, prices *pricing.Table, bucket string, bucketRegion string, objectCount int64) *pricing.Estimate {
+	loadingSpinner := startSpinner(kongCtx, "fetching storage metrics...")
+	spanCtx, span := tracing.Start(ctx, "fetch storage metrics", attribute.String("bucket", bucket), attribute.String("region", bucketRegion))
+	bytes, err := latestByteCounts(spanCtx, bucket, bucketRegion)
+	tracing.End(span, err)
+	loadingSpinner.Stop()
+	if err != nil {
+		log.Debug().Err(err).Str("bucket", bucket).Msg("could not fetch storage metrics for cost estimate")
+		return nil
+	}
+	if len(bytes) == 0 {
+		log.Debug().Str("bucket", bucket).Msg("storage metrics were not available for cost estimate")
+		return nil
+	}
+
+	estimate := prices.Estimate(bucketRegion, pricing.Usage{Bytes: bytes, ObjectVersions: objectCount})
+	_ = events.Emit(output.EventCost, output.Cost{Bucket: bucket, Basis: output.CostBasisEstimate, Estimate: estimate})
+
+	fmt.Printf("💰 estimated cost and savings (%s prices, from CloudWatch storage metrics):\n", estimate.PricedRegion)
+	if cli.Prefix != "" {
+		fmt.Println("   (covers the whole bucket, not just the selected prefix)")
+	}
+	printCostEstimate(estimate)
+	fmt.Println("")
+
+	return &estimate
+}
+
+// showCostSavings prints the estimated savings of the object versions deleted by a nuke, as recorded in `runReport`
+func showCostSavings(prices *pricing.Table, runReport *report.Report, listed int64) {
+	usage := pricing.Usage{Bytes: map[cloudwatch.StorageType]int64{}, ObjectVersions: listed}
+	for _, class := range runReport.ByStorageClass {
+		usage.Bytes[pricing.StorageTypeForClass(class.StorageClass)] += class.Bytes
+	}
+
+	estimate := prices.Estimate(runReport.Region, usage)
+	_ = events.Emit(output.EventCost, output.Cost{Bucket: runReport.Bucket, Basis: output.CostBasisDeleted, Estimate: estimate})
+
+	fmt.Printf("💰 estimated cost and savings of the deleted object versions (%s prices):\n", estimate.PricedRegion)
+	printCostEstimate(estimate)
+}
+
+// printCostEstimate prints the lines of a cost estimate
+func printCostEstimate(estimate pricing.Estimate) {
+	fmt.Printf("   storage savings.......: %s/month\n", formatCost(estimate.MonthlySavings, estimate.Currency))
+	for _, storage := range estimate.Storage {
+		fmt.Printf("      %-32s %10s  %s/month\n", storage.StorageType, humanize.IBytes(uint64(storage.Bytes)), formatCost(storage.MonthlyCost, estimate.Currency))
+	}
+	fmt.Printf("   request charges.......: %s (%s list, %s delete requests)\n",
+		formatCost(estimate.RequestCost(), estimate.Currency), humanize.Comma(estimate.ListRequests), humanize.Comma(estimate.DeleteRequests))
+	if len(estimate.EarlyDeletion) > 0 {
+		storageTypes := make([]string, 0, len(estimate.EarlyDeletion))
+		for _, early := range estimate.EarlyDeletion {
+			storageTypes = append(storageTypes, fmt.Sprintf("%s %d days", early.StorageType, early.MinimumDays))
+		}
+		fmt.Printf("   early deletion charge.: up to %s (minimum storage duration: %s)\n",
+			formatCost(estimate.EarlyDeletionCost, estimate.Currency), strings.Join(storageTypes, ", "))
+	}
+}
+
+// formatCost formats an amount of money, e.g. $1,234.50
+func formatCost(amount float64, currency string) string {
+	formatted := humanize.FormatFloat("#,###.##", amount)
+	if currency == "USD" {
+		return "$" + formatted
+	}
+	return formatted + " " + currency
+}
+
+// latestByteCounts returns the most recent BucketSizeBytes metric of every storage type stored in `bucket`.
+// Storage types without any bytes stored are left out.
+func latestByteCounts(ctx context.Context, bucket string, bucketRegion string) (map[cloudwatch.StorageType]int64, error) {
+	cloudwatchSvc := cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(bucketRegion), cloudwatch.WithProfile(cli.Profile), cloudwatch.WithAssumeRole(assumeRole))
+
+	var mu sync.Mutex
+	bytes := map[cloudwatch.StorageType]int64{}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(5)
+	for _, storageType := range cloudwatch.StorageTypes {
+		g.Go(func() error {
+			// BucketSizeBytes is reported daily, so the last 3 days always include the most recent value
+			results, err := cloudwatchSvc.GetS3ByteCount(ctx, bucket, storageType, 72, 86400)
+			if err != nil {
+				return err
+			}
+			if len(results.Values) > 0 && results.Values[0] > 0 {
+				mu.Lock()
+				bytes[storageType] = int64(results.Values[0])
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return bytes, nil
+}
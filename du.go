@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/alecthomas/kong"
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/du"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/protection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/scan"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type duCmd struct {
+	Bucket string `arg:"" optional:"" help:"bucket to report on (selected interactively if not given)"`
+	Depth  int    `help:"number of prefix levels to show, deeper prefixes are added up in their parent" short:"d" default:"2"`
+	SortBy string `help:"order of the prefixes at each level (bytes, objects, noncurrent, delete-markers, name)" enum:"bytes,objects,noncurrent,delete-markers,name" default:"bytes"`
+	Top    int    `help:"only show the N largest prefixes at each level, adding up the rest (0 shows every prefix)" placeholder:"N"`
+	JSON   string `help:"also write the prefix tree to this file as JSON for treemap tools" name:"json" type:"path" placeholder:"FILE"`
+}
+
+// runDu lists every object version in the target bucket (under --prefix) and prints how much space each prefix uses
+func runDu(ctx context.Context, kongCtx *kong.Context, s3svc s3.Service, policy protection.Policy) {
+	expectedOwner = bucketOwner(callerIdentity(ctx, kongCtx))
+	bucket := cli.Du.Bucket
+	if bucket == "" {
+		// nothing is deleted, so protected buckets can be picked too
+		bucket, _ = pickBucket(ctx, kongCtx, s3svc, policy, true)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("bucket", bucket))
+	bucketRegion := detectBucketRegion(ctx, kongCtx, bucket)
+
+	name := bucket
+	if cli.Prefix != "" {
+		name = bucket + "/" + cli.Prefix
+	}
+	tree := du.NewTree(name, cli.Prefix, cli.Du.Depth)
+
+	loadingSpinner := startSpinner(kongCtx, "listing object versions...")
+	var mu sync.Mutex
+	listed := int64(0)
+	regionalS3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+	err := scan.Walk(ctx, regionalS3svc, bucket, cli.Prefix, cli.Concurrency, func(versions []s3.ObjectVersion) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, version := range versions {
+			tree.Add(version)
+		}
+		listed += int64(len(versions))
+		loadingSpinner.Lock()
+		loadingSpinner.Suffix = fmt.Sprintf(" listing object versions... (%s listed)", humanize.Comma(listed))
+		loadingSpinner.Unlock()
+	})
+	loadingSpinner.Stop()
+	if err != nil {
+		fmt.Println("Error listing object versions!", err)
+		exit(1)
+	}
+
+	root := tree.Root(cli.Du.SortBy, cli.Du.Top)
+	if err := du.WriteTable(os.Stdout, root); err != nil {
+		fmt.Println("Error printing prefixes!", err)
+		exit(1)
+	}
+
+	if cli.Du.JSON != "" {
+		f, err := os.Create(cli.Du.JSON)
+		if err == nil {
+			err = du.WriteJSON(f, root)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Println("Error writing JSON file!", err)
+			exit(1)
+		}
+		fmt.Println("")
+		fmt.Println("Prefix tree written to", cli.Du.JSON)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/output"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/pricing"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/tracing"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/ui/tui"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// earlyDeletionAsk scans the bucket for object versions inside their minimum storage duration and asks what to do
+// with them (the default for --early-deletion)
+const earlyDeletionAsk = "ask"
+
+// checkEarlyDeletion decides what to do with object versions which are still inside the minimum storage duration of
+// their storage class, and would be charged for early deletion. Unless an action was given with --early-deletion,
+// the object versions in `set` are listed to find them, and the user is asked what to do if there are any.
+// The scan is skipped when `estimate` shows that no storage types with a minimum storage duration are in use.
+//
+// returns one of the tui.EarlyDeletion actions
+func checkEarlyDeletion(ctx context.Context, kongCtx *kong.Context, prices *pricing.Table, bucket string, bucketRegion string, set selection.Set, estimate *pricing.Estimate) string {
+	if cli.EarlyDeletion != earlyDeletionAsk {
+		printEarlyDeletionAction(cli.EarlyDeletion)
+		return cli.EarlyDeletion
+	}
+	if estimate != nil && len(estimate.EarlyDeletion) == 0 {
+		return tui.EarlyDeletionDelete
+	}
+
+	loadingSpinner := startSpinner(kongCtx, "checking for early deletion charges...")
+	spanCtx, span := tracing.Start(ctx, "scan early deletion", attribute.String("bucket", bucket), attribute.String("region", bucketRegion))
+	scan := prices.NewEarlyDeletionScan(bucketRegion, time.Now())
+	err := listVersions(spanCtx, loadingSpinner, bucket, bucketRegion, set, func(version s3.ObjectVersion) { scan.Add(version) })
+	tracing.End(span, err)
+	loadingSpinner.Stop()
+	if err != nil {
+		fmt.Println("Error checking for early deletion charges!", err)
+		exit(1)
+	}
+
+	total := scan.Total()
+	if total.Objects == 0 {
+		fmt.Println("✅ no object versions are inside their minimum storage duration")
+		fmt.Println("")
+		return tui.EarlyDeletionDelete
+	}
+
+	fmt.Printf("⏳ %s object versions (%s) are still inside their minimum storage duration\n", humanize.Comma(total.Objects), humanize.IBytes(uint64(total.Bytes)))
+	fmt.Printf("   deleting them now adds an early deletion charge of about %s:\n", formatCost(total.Charge, prices.Currency))
+	for _, early := range scan.Results() {
+		fmt.Printf("      %-32s %3d days %12s %10s  %s  (all free to delete after %s)\n",
+			early.StorageType, early.MinimumDays, humanize.Comma(early.Objects), humanize.IBytes(uint64(early.Bytes)),
+			formatCost(early.Charge, prices.Currency), early.FreeAfter.Local().Format(time.DateOnly))
+	}
+	fmt.Println("")
+
+	action, err := tui.SelectEarlyDeletionAction()
+	if err != nil {
+		fmt.Println("Command aborted!")
+		exit(1)
+	}
+	_ = events.Emit(output.EventEarlyDeletion, output.EarlyDeletion{
+		Bucket:       bucket,
+		Currency:     prices.Currency,
+		Total:        total,
+		StorageTypes: scan.Results(),
+		Action:       action,
+	})
+	fmt.Println("")
+	printEarlyDeletionAction(action)
+
+	return action
+}
+
+// printEarlyDeletionAction prints what will happen to object versions inside their minimum storage duration, and
+// exits if postponed object versions cannot be recorded
+func printEarlyDeletionAction(action string) {
+	switch action {
+	case tui.EarlyDeletionSkip:
+		fmt.Println("⏭️  object versions inside their minimum storage duration will be skipped")
+	case tui.EarlyDeletionPostpone:
+		if _, err := os.Stat(cli.PostponeFile); err == nil {
+			fmt.Println("error: postpone file", cli.PostponeFile, "already exists")
+			exit(1)
+		}
+		fmt.Println("⏭️  object versions inside their minimum storage duration will be skipped and listed in", cli.PostponeFile)
+	default:
+		return
+	}
+	fmt.Println("")
+}
+
+// postponedVersion is a line of the postpone file
+type postponedVersion struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id"`
+	StorageClass string    `json:"storage_class"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	// FreeAfter is when the object version can be deleted without an early deletion charge
+	FreeAfter time.Time `json:"free_after"`
+}
+
+// postponeFile lists object versions whose deletion was postponed to avoid early deletion charges, one JSON object
+// per line. All methods on a nil *postponeFile are no-ops.
+type postponeFile struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+}
+
+// createPostponeFile creates a postpone file at `path`, refusing to overwrite an existing file
+func createPostponeFile(path string) (*postponeFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &postponeFile{file: f, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Add records `version` of `bucket`, which can be deleted without an early deletion charge after `freeAfter`
+func (p *postponeFile) Add(bucket string, version s3.ObjectVersion, freeAfter time.Time) error {
+	if p == nil {
+		return nil
+	}
+	return p.enc.Encode(postponedVersion{
+		Bucket:       bucket,
+		Key:          aws.ToString(version.Key),
+		VersionID:    aws.ToString(version.VersionID),
+		StorageClass: version.StorageClass,
+		Size:         version.Size,
+		LastModified: aws.ToTime(version.LastModified).UTC(),
+		FreeAfter:    freeAfter.UTC(),
+	})
+}
+
+// Close flushes and closes the postpone file
+func (p *postponeFile) Close() error {
+	if p == nil {
+		return nil
+	}
+	if err := p.buf.Flush(); err != nil {
+		_ = p.file.Close()
+		return err
+	}
+	return p.file.Close()
+}
@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format defines the compression format of an archive
+type Format string
+
+// Supported archive formats
+const (
+	FormatGzip Format = "gzip"
+	FormatZstd Format = "zstd"
+)
+
+// compressor is implemented by both gzip.Writer and zstd.Encoder
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Writer writes S3 objects into a compressed tarball on the local disk.
+//
+// Writer is safe for concurrent use, entries are written to the tarball one at a time.
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+	comp compressor
+	tar  *tar.Writer
+}
+
+// FormatFromPath returns the archive format based on the file extension of `path`
+//
+// supported extensions are `.tar.gz`, `.tgz`, `.tar.zst` and `.tzst`
+func FormatFromPath(path string) (Format, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return FormatGzip, nil
+	case strings.HasSuffix(path, ".tar.zst"), strings.HasSuffix(path, ".tzst"):
+		return FormatZstd, nil
+	}
+
+	return "", fmt.Errorf("unsupported archive extension for %s (use .tar.gz or .tar.zst)", path)
+}
+
+// Create creates a new archive at `path`, the compression format is chosen based on the file extension.
+// Create will not overwrite an existing file.
+func Create(path string) (*Writer, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	var comp compressor
+	switch format {
+	case FormatGzip:
+		comp = gzip.NewWriter(f)
+	case FormatZstd:
+		comp, err = zstd.NewWriter(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	return &Writer{
+		file: f,
+		comp: comp,
+		tar:  tar.NewWriter(comp),
+	}, nil
+}
+
+// Add writes a new entry called `name` to the archive, reading exactly `size` bytes from `body`
+func (w *Writer) Add(name string, size int64, modTime time.Time, body io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0600,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(w.tar, body)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("archive: wrote %d bytes for %s, expected %d", n, name, size)
+	}
+
+	return nil
+}
+
+// Sync flushes all buffered data to the archive file and commits it to stable storage.
+// Entries added before a successful call to Sync are guaranteed to be on disk.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.tar.Flush(); err != nil {
+		return err
+	}
+	if err := w.comp.Flush(); err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+// Close finalizes the archive, syncs it to disk and closes the underlying file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.tar.Close(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	if err := w.comp.Close(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
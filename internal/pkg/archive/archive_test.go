@@ -0,0 +1,159 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    Format
+		wantErr bool
+	}{
+		{name: "tar.gz", path: "backup.tar.gz", want: FormatGzip},
+		{name: "tgz", path: "/tmp/backup.tgz", want: FormatGzip},
+		{name: "tar.zst", path: "backup.tar.zst", want: FormatZstd},
+		{name: "tzst", path: "backup.tzst", want: FormatZstd},
+		{name: "zip", path: "backup.zip", wantErr: true},
+		{name: "plain tar", path: "backup.tar", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatFromPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FormatFromPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FormatFromPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	entries := map[string]string{
+		"file1":         "contents of file1",
+		"dir/file2":     "contents of file2",
+		"dir/sub/empty": "",
+	}
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "gzip", file: "archive.tar.gz"},
+		{name: "zstd", file: "archive.tar.zst"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			w, err := Create(path)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			for name, body := range entries {
+				if err := w.Add(name, int64(len(body)), time.Now(), strings.NewReader(body)); err != nil {
+					t.Fatalf("Writer.Add() error = %v", err)
+				}
+			}
+			if err := w.Sync(); err != nil {
+				t.Fatalf("Writer.Sync() error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Writer.Close() error = %v", err)
+			}
+
+			got := readArchive(t, path)
+			if len(got) != len(entries) {
+				t.Errorf("archive contains %d entries, want %d", len(got), len(entries))
+			}
+			for name, body := range entries {
+				if got[name] != body {
+					t.Errorf("archive entry %s = %q, want %q", name, got[name], body)
+				}
+			}
+		})
+	}
+}
+
+func TestWriter_AddSizeMismatch(t *testing.T) {
+	w, err := Create(filepath.Join(t.TempDir(), "archive.tar.gz"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Add("short", 100, time.Now(), strings.NewReader("too short")); err == nil {
+		t.Errorf("Writer.Add() expected error when body is shorter than size")
+	}
+}
+
+func TestCreate_Exists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := os.WriteFile(path, []byte("existing"), 0600); err != nil {
+		t.Fatalf("could not set up existing file: %v", err)
+	}
+
+	if _, err := Create(path); err == nil {
+		t.Errorf("Create() expected error when archive already exists")
+	}
+}
+
+func readArchive(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open archive: %v", err)
+	}
+	defer f.Close()
+
+	var r io.Reader
+	format, _ := FormatFromPath(path)
+	switch format {
+	case FormatGzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("could not open gzip reader: %v", err)
+		}
+		r = gz
+	case FormatZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			t.Fatalf("could not open zstd reader: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	result := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read tar entry: %v", err)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("could not read tar entry body: %v", err)
+		}
+		result[hdr.Name] = string(body)
+	}
+
+	return result
+}
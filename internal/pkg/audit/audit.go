@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Log appends audit records to a file, one JSON object per line
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	user string
+	host string
+}
+
+// Record is a single entry in the audit log
+type Record struct {
+	Time   time.Time              `json:"time"`
+	User   string                 `json:"user"`
+	Host   string                 `json:"host"`
+	Event  string                 `json:"event"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Open opens (or creates) the audit log at `path` for appending. Parent directories are created if needed.
+//
+// A nil *Log is returned if path is empty, all methods on a nil *Log are no-ops.
+func Open(path string) (*Log, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{file: f}
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	}
+	l.host, _ = os.Hostname()
+
+	return l, nil
+}
+
+// Write appends a record for `event` to the audit log and syncs it to disk
+func (l *Log) Write(event string, fields map[string]interface{}) error {
+	if l == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(Record{
+		Time:   time.Now().UTC(),
+		User:   l.user,
+		Host:   l.host,
+		Event:  event,
+		Fields: fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Close closes the audit log file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "audit.log")
+
+	for i := 0; i < 2; i++ {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		if err := l.Write("nuke started", map[string]interface{}{"bucket": "test-bucket"}); err != nil {
+			t.Fatalf("Log.Write() error = %v", err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatalf("Log.Close() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open audit log: %v", err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit record is not valid JSON: %v", err)
+		}
+		if record.Event != "nuke started" || record.Fields["bucket"] != "test-bucket" || record.Time.IsZero() {
+			t.Errorf("unexpected audit record: %+v", record)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("audit log contains %d records, want 2 (log should be appended to)", lines)
+	}
+}
+
+func TestLog_Nil(t *testing.T) {
+	l, err := Open("")
+	if err != nil || l != nil {
+		t.Fatalf("Open(\"\") = %v, %v, want nil log", l, err)
+	}
+	if err := l.Write("event", nil); err != nil {
+		t.Errorf("nil Log.Write() error = %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("nil Log.Close() error = %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package browse
+
+import (
+	"context"
+	"sync"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// maxListPages is the number of ListObjectsV2 pages read when listing a prefix, so prefixes with millions of objects
+// directly under them can still be browsed
+const maxListPages = 10
+
+// Listing is the contents of a prefix, one level deep
+type Listing struct {
+	// Prefixes are the common prefixes directly under the listed prefix, including the trailing "/"
+	Prefixes []string
+	// Objects are the objects directly under the listed prefix
+	Objects []s3.ObjectSummary
+	// Truncated is set if there were more prefixes or objects than could be listed
+	Truncated bool
+}
+
+// Estimate is the estimated number of objects under a prefix
+type Estimate struct {
+	// Loaded is set once the objects have been counted
+	Loaded bool
+	// Objects is the number of objects counted
+	Objects int
+	// More is set if there are more objects than were counted
+	More bool
+	// Err is set if the objects could not be counted
+	Err error
+}
+
+// Source lists the prefixes of a bucket for the prefix browser, and estimates the number of objects under each prefix
+// in the background
+type Source struct {
+	ctx    context.Context
+	s3svc  s3.Service
+	bucket string
+	slots  chan struct{}
+
+	mu        sync.Mutex
+	estimates map[string]*Estimate
+}
+
+// NewSource returns a Source listing `bucket` with `s3svc`, counting the objects of at most `concurrency` prefixes at
+// a time. Counting stops when `ctx` is canceled.
+func NewSource(ctx context.Context, s3svc s3.Service, bucket string, concurrency int) *Source {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Source{
+		ctx:       ctx,
+		s3svc:     s3svc,
+		bucket:    bucket,
+		slots:     make(chan struct{}, concurrency),
+		estimates: map[string]*Estimate{},
+	}
+}
+
+// List lists the prefixes and objects directly under `prefix`, and starts estimating the number of objects under each
+// prefix found
+func (s *Source) List(prefix string) (Listing, error) {
+	listing := Listing{Prefixes: []string{}, Objects: []s3.ObjectSummary{}}
+
+	var continuationToken *string
+	for page := 0; ; page++ {
+		if page == maxListPages {
+			listing.Truncated = true
+			break
+		}
+		result, err := s.s3svc.ListPrefix(s.ctx, s.bucket, prefix, continuationToken)
+		if err != nil {
+			return listing, err
+		}
+		listing.Prefixes = append(listing.Prefixes, result.Prefixes...)
+		listing.Objects = append(listing.Objects, result.Objects...)
+
+		if result.NextContinuationToken == nil {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	for _, p := range listing.Prefixes {
+		s.Estimate(p)
+	}
+
+	return listing, nil
+}
+
+// Estimate returns the estimated number of objects under `prefix` found so far without waiting for it. The objects
+// are counted in the background the first time a prefix is asked for.
+func (s *Source) Estimate(prefix string) Estimate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.estimates[prefix]
+	if !ok {
+		e = &Estimate{}
+		s.estimates[prefix] = e
+		go s.count(prefix, e)
+	}
+	return *e
+}
+
+// count counts the objects under `prefix` into `e`, giving up after the first page of (up to 1,000) objects
+func (s *Source) count(prefix string, e *Estimate) {
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-s.ctx.Done():
+		s.mu.Lock()
+		e.Loaded, e.Err = true, s.ctx.Err()
+		s.mu.Unlock()
+		return
+	}
+
+	keys, continuationToken, err := s.s3svc.ListObjects(s.ctx, s.bucket, nil, &prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Loaded = true
+	if err != nil {
+		e.Err = err
+		return
+	}
+	e.Objects = len(keys)
+	e.More = continuationToken != nil
+}
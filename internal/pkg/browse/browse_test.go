@@ -0,0 +1,140 @@
+package browse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// s3ServiceMock implements the listings used by Source, the embedded Service is nil
+type s3ServiceMock struct {
+	s3.Service
+	// pages is the number of pages listed under "paged/"
+	pages int
+}
+
+func (s s3ServiceMock) ListPrefix(ctx context.Context, bucketName string, prefix string, continuationToken *string) (*s3.PrefixListing, error) {
+	switch prefix {
+	case "":
+		return &s3.PrefixListing{
+			Prefixes: []string{"big/", "logs/", "missing/"},
+			Objects:  []s3.ObjectSummary{{Key: "index.html", Size: 10}},
+		}, nil
+	case "paged/":
+		page := 0
+		if continuationToken != nil {
+			fmt.Sscan(*continuationToken, &page)
+		}
+		listing := &s3.PrefixListing{Objects: []s3.ObjectSummary{{Key: fmt.Sprintf("paged/%d", page)}}}
+		if page+1 < s.pages {
+			listing.NextContinuationToken = aws.String(fmt.Sprint(page + 1))
+		}
+		return listing, nil
+	}
+	return nil, errors.New("AccessDenied")
+}
+
+func (s s3ServiceMock) ListObjects(ctx context.Context, bucketName string, continuationToken *string, prefix *string) ([]string, *string, error) {
+	switch aws.ToString(prefix) {
+	case "big/":
+		return make([]string, 1000), aws.String("next"), nil
+	case "logs/":
+		return []string{"logs/a", "logs/b"}, nil, nil
+	}
+	return nil, nil, errors.New("AccessDenied")
+}
+
+func TestSource_List(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		pages   int
+		want    Listing
+		wantErr bool
+	}{
+		{
+			name:   "root",
+			prefix: "",
+			want: Listing{
+				Prefixes: []string{"big/", "logs/", "missing/"},
+				Objects:  []s3.ObjectSummary{{Key: "index.html", Size: 10}},
+			},
+		},
+		{
+			name:   "follows pages",
+			prefix: "paged/",
+			pages:  3,
+			want: Listing{
+				Prefixes: []string{},
+				Objects:  []s3.ObjectSummary{{Key: "paged/0"}, {Key: "paged/1"}, {Key: "paged/2"}},
+			},
+		},
+		{
+			name:   "truncated",
+			prefix: "paged/",
+			pages:  maxListPages + 1,
+			want:   Listing{Prefixes: []string{}, Truncated: true},
+		},
+		{
+			name:    "failure",
+			prefix:  "denied/",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewSource(context.Background(), s3ServiceMock{pages: tt.pages}, "bucket", 2)
+			got, err := source.List(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Source.List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want.Truncated {
+				if !got.Truncated || len(got.Objects) != maxListPages {
+					t.Errorf("Source.List() listed %d objects, truncated = %v", len(got.Objects), got.Truncated)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Source.List() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_Estimate(t *testing.T) {
+	source := NewSource(context.Background(), s3ServiceMock{}, "bucket", 2)
+	if _, err := source.List(""); err != nil {
+		t.Fatalf("Source.List() error = %v", err)
+	}
+
+	wait := func(prefix string) Estimate {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			e := source.Estimate(prefix)
+			if e.Loaded || time.Now().After(deadline) {
+				return e
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if got := wait("big/"); !got.Loaded || got.Objects != 1000 || !got.More {
+		t.Errorf("Source.Estimate(big/) = %+v, want 1000 objects and more", got)
+	}
+	if got := wait("logs/"); !got.Loaded || got.Objects != 2 || got.More {
+		t.Errorf("Source.Estimate(logs/) = %+v, want 2 objects", got)
+	}
+	if got := wait("missing/"); got.Err == nil || !strings.Contains(got.Err.Error(), "AccessDenied") {
+		t.Errorf("Source.Estimate(missing/) = %+v, want error", got)
+	}
+}
@@ -0,0 +1,311 @@
+package bucketinfo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// Details describes a bucket for the bucket picker
+type Details struct {
+	// Loaded is set once all of the details have been looked up
+	Loaded bool
+	Region string
+	// Versioning is the versioning status of the bucket: Enabled, Suspended, or empty if it was never enabled
+	Versioning string
+	MFADelete  bool
+	Tags       map[string]string
+	ObjectLock bool
+	// MetricsAvailable is set if CloudWatch metrics were found for the bucket. Objects and Bytes are 0 otherwise.
+	MetricsAvailable bool
+	Objects          int64
+	Bytes            int64
+	// Errors lists the details which could not be looked up
+	Errors []string
+}
+
+// Services creates the clients used to look up bucket details
+type Services struct {
+	// S3 returns an S3 service for `region`. An empty region is used to look up the region of buckets.
+	S3 func(region string) s3.Service
+	// CloudWatch returns a CloudWatch service for `region`
+	CloudWatch func(region string) cloudwatch.Service
+}
+
+type entry struct {
+	details Details
+	started bool
+	done    chan struct{}
+}
+
+// Loader looks up the details of buckets in parallel in the background. Details are looked up at most once per
+// bucket, and a bucket asked for with Get is looked up straight away, ahead of those waiting in the background.
+type Loader struct {
+	ctx         context.Context
+	services    Services
+	concurrency int
+
+	mu       sync.Mutex
+	buckets  map[string]*entry
+	s3       map[string]s3.Service
+	watchers map[string]cloudwatch.Service
+}
+
+// NewLoader returns a Loader using `services`, looking up at most `concurrency` buckets at a time in the background.
+// Lookups stop when `ctx` is canceled.
+func NewLoader(ctx context.Context, services Services, concurrency int) *Loader {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Loader{
+		ctx:         ctx,
+		services:    services,
+		concurrency: concurrency,
+		buckets:     map[string]*entry{},
+		s3:          map[string]s3.Service{},
+		watchers:    map[string]cloudwatch.Service{},
+	}
+}
+
+// Start looks up the details of `buckets` in the background, in order
+func (l *Loader) Start(buckets []string) {
+	go func() {
+		g := new(errgroup.Group)
+		g.SetLimit(l.concurrency)
+		for _, bucket := range buckets {
+			if l.ctx.Err() != nil {
+				break
+			}
+			e, claimed := l.claim(bucket)
+			if !claimed {
+				continue
+			}
+			g.Go(func() error {
+				l.load(bucket, e)
+				return nil
+			})
+		}
+		_ = g.Wait()
+	}()
+}
+
+// Get returns the details of `bucket` found so far without waiting for them
+func (l *Loader) Get(bucket string) Details {
+	e, claimed := l.claim(bucket)
+	if claimed {
+		go l.load(bucket, e)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return e.details
+}
+
+// Wait waits until the details of `buckets` have been looked up (or the Loader's context is canceled), looking up
+// any which have not been started yet
+func (l *Loader) Wait(buckets []string) {
+	g := new(errgroup.Group)
+	g.SetLimit(l.concurrency)
+	for _, bucket := range buckets {
+		e, claimed := l.claim(bucket)
+		g.Go(func() error {
+			if claimed {
+				l.load(bucket, e)
+				return nil
+			}
+			select {
+			case <-e.done:
+			case <-l.ctx.Done():
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// claim returns the entry of `bucket`, and true if the caller must look it up
+func (l *Loader) claim(bucket string) (*entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.buckets[bucket]
+	if !ok {
+		e = &entry{done: make(chan struct{})}
+		l.buckets[bucket] = e
+	}
+	if e.started {
+		return e, false
+	}
+	e.started = true
+	return e, true
+}
+
+// update applies `f` to the details of `e`
+func (l *Loader) update(e *entry, f func(d *Details)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f(&e.details)
+}
+
+// clients returns the S3 and CloudWatch services for `region`, creating them the first time
+func (l *Loader) clients(region string) (s3.Service, cloudwatch.Service) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s3svc, ok := l.s3[region]
+	if !ok {
+		s3svc = l.services.S3(region)
+		l.s3[region] = s3svc
+	}
+	if region == "" {
+		return s3svc, nil
+	}
+	watcher, ok := l.watchers[region]
+	if !ok {
+		watcher = l.services.CloudWatch(region)
+		l.watchers[region] = watcher
+	}
+	return s3svc, watcher
+}
+
+// load looks up the details of `bucket` into `e`
+func (l *Loader) load(bucket string, e *entry) {
+	defer close(e.done)
+	defer l.update(e, func(d *Details) { d.Loaded = true })
+	ctx := l.ctx
+
+	locator, _ := l.clients("")
+	region, err := locator.GetBucketRegion(ctx, bucket)
+	if err != nil {
+		l.update(e, func(d *Details) { d.Errors = append(d.Errors, fmt.Sprintf("region: %v", err)) })
+		return
+	}
+	l.update(e, func(d *Details) { d.Region = region })
+	s3svc, cloudwatchSvc := l.clients(region)
+
+	fail := func(detail string, err error) {
+		l.update(e, func(d *Details) { d.Errors = append(d.Errors, fmt.Sprintf("%s: %v", detail, err)) })
+	}
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	run(func() {
+		versioning, err := s3svc.GetBucketVersioning(ctx, bucket)
+		if err != nil {
+			fail("versioning", err)
+			return
+		}
+		l.update(e, func(d *Details) { d.Versioning, d.MFADelete = versioning.Status, versioning.MFADelete })
+	})
+	run(func() {
+		tags, err := s3svc.GetBucketTags(ctx, bucket)
+		if err != nil {
+			fail("tags", err)
+			return
+		}
+		l.update(e, func(d *Details) { d.Tags = tags })
+	})
+	run(func() {
+		enabled, err := s3svc.IsObjectLockEnabled(ctx, bucket)
+		if err != nil {
+			fail("object lock", err)
+			return
+		}
+		l.update(e, func(d *Details) { d.ObjectLock = enabled })
+	})
+	run(func() {
+		// NumberOfObjects is reported daily, so the last 3 days always include the most recent value
+		results, err := cloudwatchSvc.GetS3ObjectCount(ctx, bucket, 72, 86400)
+		if err != nil {
+			fail("object count", err)
+			return
+		}
+		if len(results.Values) > 0 {
+			l.update(e, func(d *Details) { d.Objects, d.MetricsAvailable = int64(results.Values[0]), true })
+		}
+	})
+	run(func() {
+		bytes, found, err := bucketSize(ctx, cloudwatchSvc, bucket)
+		if err != nil {
+			fail("size", err)
+			return
+		}
+		if found {
+			l.update(e, func(d *Details) { d.Bytes, d.MetricsAvailable = bytes, true })
+		}
+	})
+	wg.Wait()
+}
+
+// bucketSize adds up the latest BucketSizeBytes metric of every storage type in `bucket`, in a single request
+//
+// returns:
+//   `int64` - size of the bucket in bytes
+//   `bool`  - true if a metric was found for any storage type
+//   `error` - error, if any
+func bucketSize(ctx context.Context, cloudwatchSvc cloudwatch.Service, bucket string) (int64, bool, error) {
+	queries := make([]cloudwatch.MetricQuery, 0, len(cloudwatch.StorageTypes))
+	for _, storageType := range cloudwatch.StorageTypes {
+		queries = append(queries, cloudwatch.MetricQuery{Bucket: bucket, Metric: cloudwatch.BucketSizeBytes, StorageType: storageType})
+	}
+	results, err := cloudwatchSvc.GetS3Metrics(ctx, queries, 72, 86400)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var total int64
+	found := false
+	for _, result := range results {
+		if len(result.Values) > 0 {
+			total += int64(result.Values[0])
+			found = true
+		}
+	}
+	return total, found, nil
+}
+
+// Orders the bucket picker can be sorted in
+const (
+	// SortName sorts buckets by name, as they are listed by S3
+	SortName = "name"
+	// SortAge sorts buckets newest first
+	SortAge = "age"
+	// SortSize sorts buckets largest first, by their CloudWatch size metric
+	SortSize = "size"
+)
+
+// Sort sorts `buckets` in the order `by`, one of the Sort constants. Sorting by size waits for the details of every
+// bucket to be looked up by `loader`. Buckets which cannot be told apart keep their order.
+func Sort(buckets []s3.Bucket, by string, loader *Loader) {
+	switch by {
+	case SortAge:
+		sort.SliceStable(buckets, func(i, j int) bool {
+			return aws.ToTime(buckets[i].CreationDate).After(aws.ToTime(buckets[j].CreationDate))
+		})
+	case SortSize:
+		names := make([]string, 0, len(buckets))
+		for _, b := range buckets {
+			names = append(names, aws.ToString(b.Name))
+		}
+		loader.Wait(names)
+		sizes := map[string]int64{}
+		for _, name := range names {
+			sizes[name] = loader.Get(name).Bytes
+		}
+		sort.SliceStable(buckets, func(i, j int) bool {
+			return sizes[aws.ToString(buckets[i].Name)] > sizes[aws.ToString(buckets[j].Name)]
+		})
+	}
+}
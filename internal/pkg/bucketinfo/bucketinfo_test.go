@@ -0,0 +1,188 @@
+package bucketinfo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// s3ServiceMock implements the bucket lookups used by Loader, the embedded Service is nil
+type s3ServiceMock struct {
+	s3.Service
+	mu      sync.Mutex
+	regions map[string]string
+	lookups map[string]int
+}
+
+func (s *s3ServiceMock) GetBucketRegion(ctx context.Context, bucketName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups[bucketName]++
+	region, ok := s.regions[bucketName]
+	if !ok {
+		return "", errors.New("NoSuchBucket")
+	}
+	return region, nil
+}
+
+func (s *s3ServiceMock) GetBucketVersioning(ctx context.Context, bucketName string) (*s3.BucketVersioning, error) {
+	if bucketName == "versioned" {
+		return &s3.BucketVersioning{Status: "Enabled", MFADelete: true}, nil
+	}
+	return &s3.BucketVersioning{}, nil
+}
+
+func (s *s3ServiceMock) GetBucketTags(ctx context.Context, bucketName string) (map[string]string, error) {
+	if bucketName == "versioned" {
+		return nil, errors.New("AccessDenied")
+	}
+	return map[string]string{"env": "dev"}, nil
+}
+
+func (s *s3ServiceMock) IsObjectLockEnabled(ctx context.Context, bucketName string) (bool, error) {
+	return bucketName == "versioned", nil
+}
+
+// cloudwatchServiceMock reports `objects` objects and 100 bytes of each storage type in `sizes` for each bucket
+type cloudwatchServiceMock struct {
+	objects map[string]float64
+	sizes   map[string]map[cloudwatch.StorageType]float64
+}
+
+func (c cloudwatchServiceMock) GetS3ObjectCount(ctx context.Context, bucketName string, startTimeDiff int, period int32) (*cloudwatch.S3ObjectCountResults, error) {
+	results := &cloudwatch.S3ObjectCountResults{}
+	if count, ok := c.objects[bucketName]; ok {
+		results.Timestamps = []time.Time{time.Now()}
+		results.Values = []float64{count}
+	}
+	return results, nil
+}
+
+func (c cloudwatchServiceMock) GetS3ByteCount(ctx context.Context, bucketName string, storageType cloudwatch.StorageType, startTimeDiff int, period int32) (*cloudwatch.S3ByteCountResults, error) {
+	results := &cloudwatch.S3ByteCountResults{}
+	if size, ok := c.sizes[bucketName][storageType]; ok {
+		results.Timestamps = []time.Time{time.Now()}
+		results.Values = []float64{size}
+	}
+	return results, nil
+}
+
+func (c cloudwatchServiceMock) GetS3Metrics(ctx context.Context, queries []cloudwatch.MetricQuery, startTimeDiff int, period int32) (map[cloudwatch.MetricQuery]*cloudwatch.MetricResults, error) {
+	results := map[cloudwatch.MetricQuery]*cloudwatch.MetricResults{}
+	for _, q := range queries {
+		value, ok := c.sizes[q.Bucket][q.StorageType]
+		if q.Metric == cloudwatch.NumberOfObjects {
+			value, ok = c.objects[q.Bucket]
+		}
+		results[q] = &cloudwatch.MetricResults{}
+		if ok {
+			results[q].Timestamps = []time.Time{time.Now()}
+			results[q].Values = []float64{value}
+		}
+	}
+	return results, nil
+}
+
+func newTestLoader(t *testing.T) (*Loader, *s3ServiceMock) {
+	t.Helper()
+	s3svc := &s3ServiceMock{
+		regions: map[string]string{"versioned": "eu-west-1", "plain": "us-east-1", "empty": "us-east-1"},
+		lookups: map[string]int{},
+	}
+	cloudwatchSvc := cloudwatchServiceMock{
+		objects: map[string]float64{"versioned": 10, "plain": 2000},
+		sizes: map[string]map[cloudwatch.StorageType]float64{
+			"versioned": {cloudwatch.StandardStorage: 100, cloudwatch.GlacierStorage: 50},
+			"plain":     {cloudwatch.StandardStorage: 20},
+		},
+	}
+	services := Services{
+		S3:         func(region string) s3.Service { return s3svc },
+		CloudWatch: func(region string) cloudwatch.Service { return cloudwatchSvc },
+	}
+	return NewLoader(context.Background(), services, 2), s3svc
+}
+
+func TestLoader(t *testing.T) {
+	loader, s3svc := newTestLoader(t)
+	buckets := []string{"versioned", "plain", "empty", "missing"}
+	loader.Start(buckets)
+	loader.Wait(buckets)
+
+	tests := []struct {
+		bucket string
+		want   Details
+	}{
+		{
+			bucket: "versioned",
+			want: Details{Loaded: true, Region: "eu-west-1", Versioning: "Enabled", MFADelete: true, ObjectLock: true,
+				MetricsAvailable: true, Objects: 10, Bytes: 150, Errors: []string{"tags: AccessDenied"}},
+		},
+		{
+			bucket: "plain",
+			want:   Details{Loaded: true, Region: "us-east-1", Tags: map[string]string{"env": "dev"}, MetricsAvailable: true, Objects: 2000, Bytes: 20},
+		},
+		{
+			bucket: "empty",
+			want:   Details{Loaded: true, Region: "us-east-1", Tags: map[string]string{"env": "dev"}},
+		},
+		{
+			bucket: "missing",
+			want:   Details{Loaded: true, Errors: []string{"region: NoSuchBucket"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			if got := loader.Get(tt.bucket); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Loader.Get() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, bucket := range buckets {
+		if s3svc.lookups[bucket] != 1 {
+			t.Errorf("bucket %s was looked up %d times, want once", bucket, s3svc.lookups[bucket])
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	day := func(d int) *time.Time { return aws.Time(time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)) }
+	buckets := func() []s3.Bucket {
+		return []s3.Bucket{
+			{Name: aws.String("empty"), CreationDate: day(3)},
+			{Name: aws.String("plain"), CreationDate: day(1)},
+			{Name: aws.String("versioned"), CreationDate: day(2)},
+		}
+	}
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{by: SortName, want: []string{"empty", "plain", "versioned"}},
+		{by: SortAge, want: []string{"empty", "versioned", "plain"}},
+		{by: SortSize, want: []string{"versioned", "plain", "empty"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			loader, _ := newTestLoader(t)
+			sorted := buckets()
+			Sort(sorted, tt.by, loader)
+			got := []string{}
+			for _, b := range sorted {
+				got = append(got, *b.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package confirm
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/generators"
+)
+
+// Challenge strategies
+const (
+	// Phrase asks for a randomized "fakelish" phrase to be retyped
+	Phrase = "phrase"
+	// BucketName asks for the name of the bucket to be retyped
+	BucketName = "bucket-name"
+	// BucketNameReversed asks for the name of the bucket to be typed backwards
+	BucketNameReversed = "bucket-name-reversed"
+	// ObjectCount asks for the object count shown from the CloudWatch metrics to be retyped
+	ObjectCount = "object-count"
+	// Arithmetic asks for the answer to a multiplication
+	Arithmetic = "arithmetic"
+	// TOTP asks for the current time-based one-time password generated from a secret shared by the team
+	TOTP = "totp"
+)
+
+// Names lists the challenge strategies, weakest first
+var Names = []string{Phrase, BucketName, BucketNameReversed, ObjectCount, Arithmetic, TOTP}
+
+// Target describes the bucket about to be nuked
+type Target struct {
+	Bucket string
+	// ObjectCount is the number of objects in the bucket
+	ObjectCount int64
+	// ObjectCountUnknown is set if the number of objects could not be determined (e.g. the metrics are not available)
+	ObjectCountUnknown bool
+	// Bytes is the size of the bucket
+	Bytes int64
+	// BytesUnknown is set if the size of the bucket could not be determined
+	BytesUnknown bool
+	// Tags are the tags set on the bucket, nil if they could not be read
+	Tags map[string]string
+}
+
+// Options configures how challenges are created
+type Options struct {
+	// TOTPSecret is the base32 encoded secret shared by the team, required by the TOTP challenge
+	TOTPSecret string
+	// Now returns the current time, time.Now is used if nil
+	Now func() time.Time
+}
+
+// Challenge is a question which has to be answered correctly to confirm a nuke
+type Challenge struct {
+	// Name is the challenge strategy
+	Name string
+	// Instruction tells the user what to enter
+	Instruction string
+	// Label is the label of the prompt
+	Label string
+
+	check func(answer string) bool
+}
+
+// Check returns true if `answer` is the correct answer to the challenge
+func (c Challenge) Check(answer string) bool {
+	if c.check == nil {
+		return false
+	}
+	return c.check(answer)
+}
+
+// intn returns a random number in [0, n) for arithmetic challenges, it is replaced in tests
+var intn = rand.Intn
+
+// New creates a challenge using the strategy `name` for `target`.
+//
+// The ObjectCount challenge falls back to BucketNameReversed when the object count is not known.
+func New(name string, target Target, opts Options) (Challenge, error) {
+	switch name {
+	case Phrase, "":
+		phrase := generators.GeneratePhrase(4)
+		return Challenge{
+			Name:        Phrase,
+			Instruction: fmt.Sprintf("Please enter the following phrase to continue: %s", phrase),
+			Label:       "Enter phrase",
+			check: func(answer string) bool {
+				return strings.ToLower(answer) == phrase
+			},
+		}, nil
+	case BucketName:
+		return Challenge{
+			Name:        BucketName,
+			Instruction: fmt.Sprintf("Please enter the name of the bucket to continue: %s", target.Bucket),
+			Label:       "Enter bucket name",
+			check: func(answer string) bool {
+				return answer == target.Bucket
+			},
+		}, nil
+	case BucketNameReversed:
+		return Challenge{
+			Name:        BucketNameReversed,
+			Instruction: fmt.Sprintf("Please enter the name of the bucket backwards to continue: %s", target.Bucket),
+			Label:       "Enter bucket name backwards",
+			check: func(answer string) bool {
+				return answer == reverse(target.Bucket)
+			},
+		}, nil
+	case ObjectCount:
+		if target.ObjectCount <= 0 {
+			return New(BucketNameReversed, target, opts)
+		}
+		return Challenge{
+			Name:        ObjectCount,
+			Instruction: fmt.Sprintf("Please enter the number of objects in the bucket to continue: %s", humanize.Comma(target.ObjectCount)),
+			Label:       "Enter object count",
+			check: func(answer string) bool {
+				count, err := strconv.ParseInt(strings.NewReplacer(",", "", "_", "", " ", "").Replace(answer), 10, 64)
+				return err == nil && count == target.ObjectCount
+			},
+		}, nil
+	case Arithmetic:
+		a, b := 12+intn(88), 12+intn(88)
+		return Challenge{
+			Name:        Arithmetic,
+			Instruction: fmt.Sprintf("Please solve the following to continue: %d × %d", a, b),
+			Label:       "Enter answer",
+			check: func(answer string) bool {
+				product, err := strconv.Atoi(strings.TrimSpace(answer))
+				return err == nil && product == a*b
+			},
+		}, nil
+	case TOTP:
+		if opts.TOTPSecret == "" {
+			return Challenge{}, errors.New("the totp challenge requires a shared secret")
+		}
+		secret, err := decodeSecret(opts.TOTPSecret)
+		if err != nil {
+			return Challenge{}, err
+		}
+		now := opts.Now
+		if now == nil {
+			now = time.Now
+		}
+		return Challenge{
+			Name:        TOTP,
+			Instruction: "Please enter the current code from the team's s3-nuke authenticator to continue",
+			Label:       "Enter code",
+			check: func(answer string) bool {
+				return validateTOTP(secret, strings.TrimSpace(answer), now())
+			},
+		}, nil
+	default:
+		return Challenge{}, fmt.Errorf("unknown confirmation challenge %q (available challenges: %v)", name, Names)
+	}
+}
+
+// reverse returns `s` backwards
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
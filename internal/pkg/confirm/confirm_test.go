@@ -0,0 +1,198 @@
+package confirm
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the base32 encoding of the RFC 6238 SHA1 test key "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestNew(t *testing.T) {
+	defer func(original func(int) int) { intn = original }(intn)
+	intn = func(n int) int { return 1 }
+
+	now := time.Unix(59, 0)
+	target := Target{Bucket: "my-bucket", ObjectCount: 1234567}
+
+	tests := []struct {
+		name     string
+		strategy string
+		target   Target
+		wantName string
+		right    []string
+		wrong    []string
+	}{
+		{name: "bucket name", strategy: BucketName, target: target, wantName: BucketName, right: []string{"my-bucket"}, wrong: []string{"My-Bucket", "tekcub-ym", ""}},
+		{name: "bucket name reversed", strategy: BucketNameReversed, target: target, wantName: BucketNameReversed, right: []string{"tekcub-ym"}, wrong: []string{"my-bucket", ""}},
+		{name: "object count", strategy: ObjectCount, target: target, wantName: ObjectCount, right: []string{"1,234,567", "1234567", "1_234_567"}, wrong: []string{"1234568", "lots"}},
+		{name: "object count unknown", strategy: ObjectCount, target: Target{Bucket: "my-bucket"}, wantName: BucketNameReversed, right: []string{"tekcub-ym"}, wrong: []string{"0"}},
+		{name: "arithmetic", strategy: Arithmetic, target: target, wantName: Arithmetic, right: []string{"169", " 169 "}, wrong: []string{"170", "13 × 13"}},
+		{name: "totp", strategy: TOTP, target: target, wantName: TOTP, right: []string{"287082"}, wrong: []string{"287083", "94287082", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, err := New(tt.strategy, tt.target, Options{TOTPSecret: rfcSecret, Now: func() time.Time { return now }})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if challenge.Name != tt.wantName || challenge.Instruction == "" || challenge.Label == "" {
+				t.Errorf("New() = %+v, want a %s challenge", challenge, tt.wantName)
+			}
+			for _, answer := range tt.right {
+				if !challenge.Check(answer) {
+					t.Errorf("Check(%q) = false, want true", answer)
+				}
+			}
+			for _, answer := range tt.wrong {
+				if challenge.Check(answer) {
+					t.Errorf("Check(%q) = true, want false", answer)
+				}
+			}
+		})
+	}
+
+	t.Run("phrase", func(t *testing.T) {
+		challenge, err := New(Phrase, target, Options{})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		phrase := strings.TrimPrefix(challenge.Instruction, "Please enter the following phrase to continue: ")
+		if !challenge.Check(strings.ToUpper(phrase)) || challenge.Check(phrase+"x") {
+			t.Errorf("phrase challenge %q did not check answers correctly", phrase)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, opts := range []Options{{}, {TOTPSecret: "not base32!"}} {
+			if _, err := New(TOTP, target, opts); err == nil {
+				t.Errorf("New(totp, %+v) error = nil, want error", opts)
+			}
+		}
+		if _, err := New("riddle", target, Options{}); err == nil {
+			t.Error("New(riddle) error = nil, want error")
+		}
+		if (Challenge{}).Check("") {
+			t.Error("zero Challenge.Check() = true, want false")
+		}
+	})
+}
+
+func Test_validateTOTP(t *testing.T) {
+	key, err := decodeSecret(strings.ToLower(rfcSecret[:16]) + " " + rfcSecret[16:])
+	if err != nil {
+		t.Fatalf("decodeSecret() error = %v", err)
+	}
+
+	// RFC 6238 appendix B test vectors, truncated to 6 digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, code := range vectors {
+		if got := totpCode(key, time.Unix(unix, 0)); got != code {
+			t.Errorf("totpCode(%d) = %s, want %s", unix, got, code)
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	if !validateTOTP(key, totpCode(key, now.Add(-totpPeriod)), now) || !validateTOTP(key, totpCode(key, now.Add(totpPeriod)), now) {
+		t.Error("validateTOTP() rejected a code from an adjacent period")
+	}
+	if validateTOTP(key, totpCode(key, now.Add(-3*totpPeriod)), now) {
+		t.Error("validateTOTP() accepted an expired code")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy{Rules: []Rule{
+		{Challenge: TOTP, Tags: map[string]string{"env": "prod"}},
+		{Challenge: Arithmetic, MinObjects: 1000000},
+		{Challenge: ObjectCount, MinSize: "1 TiB"},
+		{Challenge: BucketName, Tags: map[string]string{"team": "*"}},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Policy.Validate() error = %v", err)
+	}
+
+	const tib = 1 << 40
+	tests := []struct {
+		name   string
+		target Target
+		want   string
+	}{
+		{name: "small untagged", target: Target{ObjectCount: 10, Tags: map[string]string{}}, want: Phrase},
+		{name: "production", target: Target{Tags: map[string]string{"env": "prod"}}, want: TOTP},
+		{name: "staging", target: Target{Tags: map[string]string{"env": "staging"}}, want: Phrase},
+		{name: "many objects", target: Target{ObjectCount: 1000000, Tags: map[string]string{}}, want: Arithmetic},
+		{name: "large", target: Target{Bytes: 2 * tib, Tags: map[string]string{}}, want: ObjectCount},
+		{name: "any tag value", target: Target{Tags: map[string]string{"team": "data"}}, want: BucketName},
+		{name: "unknown tags", target: Target{ObjectCount: 10}, want: TOTP},
+		{name: "unknown object count", target: Target{ObjectCountUnknown: true, Bytes: 10, Tags: map[string]string{}}, want: Arithmetic},
+		{name: "unknown size", target: Target{ObjectCount: 10, BytesUnknown: true, Tags: map[string]string{}}, want: ObjectCount},
+		{name: "unknown object count and size", target: Target{ObjectCountUnknown: true, BytesUnknown: true, Tags: map[string]string{}}, want: Arithmetic},
+		{name: "several rules", target: Target{ObjectCount: 1000000, Bytes: 2 * tib, Tags: map[string]string{"env": "prod", "team": "data"}}, want: TOTP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Select(Phrase, tt.target); got != tt.want {
+				t.Errorf("Policy.Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a matching rule never downgrades a stronger --confirmation
+	for _, tt := range []struct {
+		target Target
+		want   string
+	}{
+		{target: Target{Tags: map[string]string{"team": "data"}}, want: Arithmetic},
+		{target: Target{Tags: map[string]string{"env": "prod"}}, want: TOTP},
+		{target: Target{ObjectCount: 10, Tags: map[string]string{}}, want: Arithmetic},
+	} {
+		if got := policy.Select(Arithmetic, tt.target); got != tt.want {
+			t.Errorf("Policy.Select(%s, %+v) = %v, want %v", Arithmetic, tt.target, got, tt.want)
+		}
+	}
+
+	// the strongest matching rule wins, wherever it is listed
+	weakFirst := Policy{Rules: []Rule{
+		{Challenge: BucketName, Tags: map[string]string{"team": "*"}},
+		{Challenge: TOTP, Tags: map[string]string{"env": "prod"}},
+	}}
+	if got := weakFirst.Select(Phrase, Target{Tags: map[string]string{"team": "data", "env": "prod"}}); got != TOTP {
+		t.Errorf("Policy.Select() with a weak rule listed first = %v, want %v", got, TOTP)
+	}
+
+	for _, invalid := range []Policy{
+		{Rules: []Rule{{Challenge: "riddle"}}},
+		{Rules: []Rule{{Challenge: TOTP, MinSize: "huge"}}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Policy.Validate(%+v) error = nil, want error", invalid)
+		}
+	}
+}
+
+func TestStronger(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want string
+	}{
+		{a: Phrase, b: TOTP, want: TOTP},
+		{a: Arithmetic, b: BucketName, want: Arithmetic},
+		{a: ObjectCount, b: ObjectCount, want: ObjectCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := Stronger(tt.a, tt.b); got != tt.want {
+				t.Errorf("Stronger() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
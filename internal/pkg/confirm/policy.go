@@ -0,0 +1,103 @@
+package confirm
+
+import (
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Policy selects a stronger confirmation challenge for riskier buckets
+type Policy struct {
+	// Rules are all checked, the strongest challenge of the matching rules is used unless the default is stronger
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule requires `Challenge` for buckets matching all of its conditions. A rule without conditions matches every bucket.
+type Rule struct {
+	// Challenge is the challenge strategy to use, one of Names
+	Challenge string `yaml:"challenge"`
+	// MinObjects matches buckets with at least this many objects
+	MinObjects int64 `yaml:"min_objects"`
+	// MinSize matches buckets at least this large, e.g. `500 GiB`
+	MinSize string `yaml:"min_size"`
+	// Tags matches buckets with all of these tags, a value of "*" matches any value
+	Tags map[string]string `yaml:"tags"`
+}
+
+// Validate returns an error if any of the rules use an unknown challenge or a malformed size
+func (p Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if !known(rule.Challenge) {
+			return fmt.Errorf("confirmation rule %d: unknown challenge %q (available challenges: %v)", i+1, rule.Challenge, Names)
+		}
+		if rule.MinSize != "" {
+			if _, err := humanize.ParseBytes(rule.MinSize); err != nil {
+				return fmt.Errorf("confirmation rule %d: invalid min_size %q: %w", i+1, rule.MinSize, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Select returns the strongest challenge (the latest in Names) of the rules matching `target`, or `defaultChallenge`
+// if none match. A rule never weakens the challenge: `defaultChallenge` is used if it is stronger than every matching
+// rule's challenge.
+func (p Policy) Select(defaultChallenge string, target Target) string {
+	challenge := defaultChallenge
+	for _, rule := range p.Rules {
+		if rule.Matches(target) {
+			challenge = Stronger(challenge, rule.Challenge)
+		}
+	}
+	return challenge
+}
+
+// Matches returns true if `target` meets all of the rule's conditions.
+//
+// Conditions on the object count, size or tags match when they are unknown (Target.ObjectCountUnknown,
+// Target.BytesUnknown or Target.Tags is nil), so that a bucket is never given a weaker challenge because of missing
+// metrics or tags.
+func (r Rule) Matches(target Target) bool {
+	if r.MinObjects > 0 && !target.ObjectCountUnknown && target.ObjectCount < r.MinObjects {
+		return false
+	}
+	if r.MinSize != "" && !target.BytesUnknown {
+		size, err := humanize.ParseBytes(r.MinSize)
+		if err != nil || uint64(target.Bytes) < size {
+			return false
+		}
+	}
+	if target.Tags == nil {
+		return true
+	}
+	for key, value := range r.Tags {
+		tag, ok := target.Tags[key]
+		if !ok || (value != "*" && tag != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stronger returns whichever of the challenges `a` and `b` comes later in Names
+func Stronger(a string, b string) string {
+	if strength(b) > strength(a) {
+		return b
+	}
+	return a
+}
+
+// known returns true if `name` is a challenge strategy
+func known(name string) bool {
+	return strength(name) >= 0
+}
+
+// strength returns the position of `name` in Names, which are ordered weakest first, or -1 if it is unknown
+func strength(name string) int {
+	for i, n := range Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,58 @@
+package confirm
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults, as used by authenticator apps)
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	// totpSkew is the number of periods before and after the current one which are also accepted
+	totpSkew = 1
+)
+
+// decodeSecret decodes a base32 TOTP secret, ignoring case, spaces and padding
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp secret: %w", err)
+	}
+	return key, nil
+}
+
+// totpCode returns the code for `key` at `t`
+func totpCode(key []byte, t time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(totpPeriod/time.Second)))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000)
+}
+
+// validateTOTP returns true if `code` is the code for `key` at `now`, allowing for clock skew
+func validateTOTP(key []byte, code string, now time.Time) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		want := totpCode(key, now.Add(time.Duration(skew)*totpPeriod))
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package du
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// Delimiter separates the levels of the prefix tree
+const Delimiter = "/"
+
+// Orders the children of a prefix can be sorted in, largest first except for name
+const (
+	SortBytes           = "bytes"
+	SortObjects         = "objects"
+	SortNoncurrentBytes = "noncurrent"
+	SortDeleteMarkers   = "delete-markers"
+	SortName            = "name"
+)
+
+// Usage adds up the object versions under a prefix
+type Usage struct {
+	// Objects is the number of object versions, not counting delete markers
+	Objects int64 `json:"objects"`
+	// Bytes is the size of every object version, current and noncurrent
+	Bytes           int64 `json:"bytes"`
+	NoncurrentBytes int64 `json:"noncurrent_bytes"`
+	DeleteMarkers   int64 `json:"delete_markers"`
+}
+
+func (u *Usage) add(version s3.ObjectVersion) {
+	if version.IsDeleteMarker {
+		u.DeleteMarkers++
+		return
+	}
+	u.Objects++
+	u.Bytes += version.Size
+	if !version.IsLatest {
+		u.NoncurrentBytes += version.Size
+	}
+}
+
+func (u *Usage) merge(other Usage) {
+	u.Objects += other.Objects
+	u.Bytes += other.Bytes
+	u.NoncurrentBytes += other.NoncurrentBytes
+	u.DeleteMarkers += other.DeleteMarkers
+}
+
+// Node is a prefix in the tree, with the usage of everything under it
+type Node struct {
+	// Name is the last level of the prefix, e.g. "2024/", or a placeholder in parentheses for the files directly
+	// under a prefix and the prefixes left out by Root(). The root is named when the tree is created.
+	Name string
+	// Prefix is the full prefix, for placeholders it is the prefix of the parent
+	Prefix string
+	Usage
+	// Children are the prefixes one level below, set by Tree.Root()
+	Children []*Node
+
+	// files is the usage of the keys directly under the prefix, which are not in any child
+	files    Usage
+	children map[string]*Node
+	// placeholder is set for the files directly under a prefix and the prefixes left out by Root()
+	placeholder bool
+}
+
+// Placeholder names of nodes which are not prefixes
+const (
+	filesName = "(files)"
+	otherName = "(%d more)"
+)
+
+// Tree adds up object versions into a tree of prefixes, a fixed number of levels deep. Versions under deeper prefixes
+// are added to their ancestor at the deepest level.
+//
+// A Tree is not safe for concurrent use.
+type Tree struct {
+	root  *Node
+	depth int
+}
+
+// NewTree returns an empty tree of the prefixes under `prefix`, `depth` levels deep. The root of the tree is called
+// `name`, e.g. the name of the bucket.
+func NewTree(name string, prefix string, depth int) *Tree {
+	return &Tree{root: newNode(name, prefix), depth: max(depth, 0)}
+}
+
+func newNode(name string, prefix string) *Node {
+	return &Node{Name: name, Prefix: prefix, children: map[string]*Node{}}
+}
+
+// Add adds `version` to the root of the tree and to each prefix it is under, down to the depth of the tree
+func (t *Tree) Add(version s3.ObjectVersion) {
+	key := ""
+	if version.Key != nil {
+		key = *version.Key
+	}
+	rest, ok := strings.CutPrefix(key, t.root.Prefix)
+	if !ok {
+		return
+	}
+
+	node := t.root
+	node.add(version)
+	for level := 0; level < t.depth; level++ {
+		name, after, found := strings.Cut(rest, Delimiter)
+		if !found {
+			node.files.add(version)
+			return
+		}
+		name += Delimiter
+		child, ok := node.children[name]
+		if !ok {
+			child = newNode(name, node.Prefix+name)
+			node.children[name] = child
+		}
+		child.add(version)
+		node, rest = child, after
+	}
+}
+
+// Root returns the root of the tree, with its children sorted in the order `sortBy` and pruned to the `top` largest
+// in that order (0 keeps every child). The files directly under a prefix with children are listed as a child of
+// their own, so the usage of the children of every prefix adds up to the usage of the prefix.
+func (t *Tree) Root(sortBy string, top int) *Node {
+	t.root.build(sortBy, top)
+	return t.root
+}
+
+func (n *Node) build(sortBy string, top int) {
+	n.Children = make([]*Node, 0, len(n.children)+1)
+	if len(n.children) == 0 {
+		return
+	}
+	for _, child := range n.children {
+		child.build(sortBy, top)
+		n.Children = append(n.Children, child)
+	}
+	if n.files != (Usage{}) {
+		n.Children = append(n.Children, &Node{Name: filesName, Prefix: n.Prefix, Usage: n.files, Children: []*Node{}, placeholder: true})
+	}
+	sortNodes(n.Children, sortBy)
+
+	if top > 0 && len(n.Children) > top {
+		other := &Node{Name: fmt.Sprintf(otherName, len(n.Children)-top), Prefix: n.Prefix, Children: []*Node{}, placeholder: true}
+		for _, child := range n.Children[top:] {
+			other.merge(child.Usage)
+		}
+		n.Children = append(n.Children[:top:top], other)
+	}
+}
+
+// sortNodes sorts `nodes` in the order `sortBy`, by name between nodes of the same size
+func sortNodes(nodes []*Node, sortBy string) {
+	key := func(n *Node) int64 {
+		switch sortBy {
+		case SortObjects:
+			return n.Objects
+		case SortNoncurrentBytes:
+			return n.NoncurrentBytes
+		case SortDeleteMarkers:
+			return n.DeleteMarkers
+		}
+		return n.Bytes
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if sortBy != SortName && key(nodes[i]) != key(nodes[j]) {
+			return key(nodes[i]) > key(nodes[j])
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+}
+
+// WriteTable writes `root` and every prefix under it to `w`, one line per prefix like du(1), indented by level
+func WriteTable(w io.Writer, root *Node) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Size\tObjects\tNoncurrent\tDelete markers\t Prefix")
+	var write func(n *Node, level int)
+	write = func(n *Node, level int) {
+		name := n.Prefix
+		if level == 0 {
+			name = n.Name
+		} else if n.placeholder {
+			name = n.Prefix + n.Name
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t %s%s\n", humanize.IBytes(uint64(n.Bytes)), humanize.Comma(n.Objects),
+			humanize.IBytes(uint64(n.NoncurrentBytes)), humanize.Comma(n.DeleteMarkers), strings.Repeat("  ", level), name)
+		for _, child := range n.Children {
+			write(child, level+1)
+		}
+	}
+	write(root, 0)
+	return tw.Flush()
+}
+
+// treemapNode is a Node in the JSON export. Every node has a name and a value (its bytes), and the values of the
+// children of a node add up to its value, which is the shape treemap tools such as d3-hierarchy and ECharts expect.
+type treemapNode struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Value int64  `json:"value"`
+	Usage
+	Children []treemapNode `json:"children,omitempty"`
+}
+
+func newTreemapNode(n *Node) treemapNode {
+	node := treemapNode{Name: n.Name, Path: n.Prefix, Value: n.Bytes, Usage: n.Usage}
+	for _, child := range n.Children {
+		node.Children = append(node.Children, newTreemapNode(child))
+	}
+	return node
+}
+
+// WriteJSON writes `root` and every prefix under it to `w` as a nested JSON object for treemap tools
+func WriteJSON(w io.Writer, root *Node) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newTreemapNode(root))
+}
@@ -0,0 +1,181 @@
+package du
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func version(key string, latest bool, size int64) s3.ObjectVersion {
+	return s3.ObjectVersion{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key)}, IsLatest: latest, Size: size}
+}
+
+func deleteMarker(key string) s3.ObjectVersion {
+	return s3.ObjectVersion{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key)}, IsLatest: true, IsDeleteMarker: true}
+}
+
+func newTestTree(depth int) *Tree {
+	tree := NewTree("bucket", "", depth)
+	for _, v := range []s3.ObjectVersion{
+		version("index.html", true, 1),
+		version("logs/a.log", true, 10),
+		version("logs/a.log", false, 20),
+		deleteMarker("logs/b.log"),
+		version("logs/2024/01/c.log", true, 300),
+		version("logs/2023/d.log", false, 400),
+		version("images/x.png", true, 5000),
+		version("tmp/y", true, 50),
+	} {
+		tree.Add(v)
+	}
+	return tree
+}
+
+// names returns the names of the children of `n`
+func names(n *Node) []string {
+	got := []string{}
+	for _, child := range n.Children {
+		got = append(got, child.Name)
+	}
+	return got
+}
+
+func TestTree(t *testing.T) {
+	root := newTestTree(2).Root(SortBytes, 0)
+	if root.Usage != (Usage{Objects: 7, Bytes: 5781, NoncurrentBytes: 420, DeleteMarkers: 1}) {
+		t.Errorf("Tree.Root() usage = %+v", root.Usage)
+	}
+	if got := names(root); !reflect.DeepEqual(got, []string{"images/", "logs/", "tmp/", "(files)"}) {
+		t.Errorf("Tree.Root() children = %v", got)
+	}
+
+	logs := root.Children[1]
+	if logs.Prefix != "logs/" || logs.Usage != (Usage{Objects: 4, Bytes: 730, NoncurrentBytes: 420, DeleteMarkers: 1}) {
+		t.Errorf("Tree.Root() logs/ = %+v", logs)
+	}
+	if got := names(logs); !reflect.DeepEqual(got, []string{"2023/", "2024/", "(files)"}) {
+		t.Errorf("Tree.Root() logs/ children = %v", got)
+	}
+	// logs/2024/01/ is deeper than the tree, so it is added up in logs/2024/
+	if deepest := logs.Children[1]; deepest.Prefix != "logs/2024/" || deepest.Bytes != 300 || len(deepest.Children) != 0 {
+		t.Errorf("Tree.Root() logs/2024/ = %+v", deepest)
+	}
+	if files := logs.Children[2]; files.Usage != (Usage{Objects: 2, Bytes: 30, NoncurrentBytes: 20, DeleteMarkers: 1}) {
+		t.Errorf("Tree.Root() logs/ files = %+v", files.Usage)
+	}
+
+	// the children of every prefix add up to the prefix
+	var check func(n *Node)
+	check = func(n *Node) {
+		if len(n.Children) == 0 {
+			return
+		}
+		sum := Usage{}
+		for _, child := range n.Children {
+			sum.merge(child.Usage)
+			check(child)
+		}
+		if sum != n.Usage {
+			t.Errorf("children of %q add up to %+v, want %+v", n.Prefix, sum, n.Usage)
+		}
+	}
+	check(root)
+}
+
+func TestTree_Root(t *testing.T) {
+	tests := []struct {
+		name   string
+		sortBy string
+		top    int
+		want   []string
+	}{
+		{name: "name", sortBy: SortName, want: []string{"(files)", "images/", "logs/", "tmp/"}},
+		{name: "noncurrent", sortBy: SortNoncurrentBytes, want: []string{"logs/", "(files)", "images/", "tmp/"}},
+		{name: "delete markers", sortBy: SortDeleteMarkers, want: []string{"logs/", "(files)", "images/", "tmp/"}},
+		{name: "objects", sortBy: SortObjects, want: []string{"logs/", "(files)", "images/", "tmp/"}},
+		{name: "top 2", sortBy: SortBytes, top: 2, want: []string{"images/", "logs/", "(2 more)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTestTree(1).Root(tt.sortBy, tt.top)
+			if got := names(root); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tree.Root() children = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	root := newTestTree(1).Root(SortBytes, 2)
+	if other := root.Children[2]; other.Usage != (Usage{Objects: 2, Bytes: 51}) {
+		t.Errorf("Tree.Root() (2 more) = %+v", other.Usage)
+	}
+
+	// keys outside the prefix of the tree are left out
+	tree := NewTree("bucket/logs/", "logs/", 1)
+	tree.Add(version("logs/2024/a", true, 1))
+	tree.Add(version("images/b", true, 2))
+	if root := tree.Root(SortBytes, 0); root.Bytes != 1 || !reflect.DeepEqual(names(root), []string{"2024/"}) {
+		t.Errorf("Tree.Root() with prefix = %+v", root)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteTable(&out, newTestTree(2).Root(SortBytes, 0)); err != nil {
+		t.Fatalf("WriteTable() error = %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	for i, want := range []string{
+		"Size Objects Noncurrent Delete markers Prefix",
+		"5.6 KiB 7 420 B 1 bucket",
+		"4.9 KiB 1 0 B 0 images/",
+		"730 B 4 420 B 1 logs/",
+		"400 B 1 400 B 0 logs/2023/",
+		"300 B 1 0 B 0 logs/2024/",
+		"30 B 2 20 B 1 logs/(files)",
+	} {
+		if got := strings.Join(strings.Fields(lines[i]), " "); got != want {
+			t.Errorf("WriteTable() line %d = %q, want %q", i, got, want)
+		}
+	}
+	// each level is indented by two more spaces
+	if !strings.HasSuffix(lines[2], "0   images/") || !strings.HasSuffix(lines[4], "0     logs/2023/") {
+		t.Errorf("WriteTable() does not indent prefixes by level:\n%s", out.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJSON(&out, newTestTree(1).Root(SortBytes, 0)); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	var root struct {
+		Name     string `json:"name"`
+		Value    int64  `json:"value"`
+		Children []struct {
+			Name            string        `json:"name"`
+			Path            string        `json:"path"`
+			Value           int64         `json:"value"`
+			NoncurrentBytes int64         `json:"noncurrent_bytes"`
+			Children        []interface{} `json:"children"`
+		} `json:"children"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &root); err != nil {
+		t.Fatalf("WriteJSON() wrote invalid JSON: %v", err)
+	}
+	if root.Name != "bucket" || root.Value != 5781 || len(root.Children) != 4 {
+		t.Fatalf("WriteJSON() = %s", out.String())
+	}
+	sum := int64(0)
+	for _, child := range root.Children {
+		sum += child.Value
+	}
+	logs := root.Children[1]
+	if sum != root.Value || logs.Path != "logs/" || logs.NoncurrentBytes != 420 || logs.Children != nil {
+		t.Errorf("WriteJSON() = %s", out.String())
+	}
+}
@@ -0,0 +1,218 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/pricing"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/scan"
+)
+
+// SchemaVersion is the version of the JSON event schema. It is increased whenever a field is removed or changes
+// meaning; new fields and event types may be added without changing the version.
+const SchemaVersion = 1
+
+// Formats are the supported output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Event types
+const (
+	EventBuckets  = "buckets"
+	EventRegion   = "region"
+	EventMetrics  = "metrics"
+	EventProgress = "progress"
+	EventSummary  = "summary"
+	EventCost     = "cost"
+	EventScan     = "scan"
+
+	EventEarlyDeletion = "early_deletion"
+)
+
+// Bases of a cost estimate
+const (
+	// CostBasisEstimate is an estimate made before a nuke from CloudWatch metrics
+	CostBasisEstimate = "estimate"
+	// CostBasisDeleted is an estimate made after a nuke from the object versions deleted
+	CostBasisDeleted = "deleted"
+)
+
+// Event is a single line of JSON output
+type Event struct {
+	SchemaVersion int         `json:"schema_version"`
+	Type          string      `json:"type"`
+	Time          time.Time   `json:"time"`
+	Data          interface{} `json:"data"`
+}
+
+// Bucket is an entry in a Buckets event
+type Bucket struct {
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Protected lists the reasons the bucket is protected from being nuked, if any
+	Protected []string `json:"protected,omitempty"`
+}
+
+// Buckets is the data of an EventBuckets event
+type Buckets struct {
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Region is the data of an EventRegion event
+type Region struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+}
+
+// Datapoint is a single CloudWatch metric value
+type Datapoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Metric is a CloudWatch metric series, newest datapoint first
+type Metric struct {
+	Name        string      `json:"name"`
+	StorageType string      `json:"storage_type"`
+	Latest      *Datapoint  `json:"latest,omitempty"`
+	Datapoints  []Datapoint `json:"datapoints"`
+}
+
+// Metrics is the data of an EventMetrics event
+type Metrics struct {
+	Bucket  string   `json:"bucket"`
+	Region  string   `json:"region"`
+	Metrics []Metric `json:"metrics"`
+}
+
+// Progress is the data of an EventProgress event
+type Progress struct {
+	Bucket      string `json:"bucket"`
+	Listed      int64  `json:"listed"`
+	Deleted     int64  `json:"deleted"`
+	Failed      int64  `json:"failed"`
+	ListingDone bool   `json:"listing_done"`
+	// Estimated is the estimated number of object versions to delete, 0 if unknown
+	Estimated int64 `json:"estimated,omitempty"`
+}
+
+// Cost is the data of an EventCost event
+type Cost struct {
+	Bucket string `json:"bucket"`
+	// Basis is what the estimate is based on, CostBasisEstimate or CostBasisDeleted
+	Basis string `json:"basis"`
+	pricing.Estimate
+}
+
+// Scan is the data of an EventScan event, the exact contents of a bucket counted from its object versions
+type Scan struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+	scan.Tally
+}
+
+// EarlyDeletion is the data of an EventEarlyDeletion event, describing the object versions which are still inside
+// the minimum storage duration of their storage class
+type EarlyDeletion struct {
+	Bucket   string `json:"bucket"`
+	Currency string `json:"currency"`
+	// Total has the totals across all storage types, its StorageType and MinimumDays are not set
+	Total        pricing.EarlyVersions   `json:"total"`
+	StorageTypes []pricing.EarlyVersions `json:"storage_types"`
+	// Action is what is done with the object versions: delete, skip or postpone
+	Action string `json:"action"`
+}
+
+// Summary is the data of the EventSummary event written at the end of a nuke
+type Summary struct {
+	Bucket           string  `json:"bucket"`
+	Region           string  `json:"region"`
+	Prefix           string  `json:"prefix,omitempty"`
+	Listed           int64   `json:"listed"`
+	Deleted          int64   `json:"deleted"`
+	Failed           int64   `json:"failed"`
+	DurationSeconds  float64 `json:"duration_seconds"`
+	ObjectsPerSecond float64 `json:"objects_per_second"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// Writer writes events to an io.Writer, one JSON object per line.
+//
+// A nil *Writer is used for text output, all methods on a nil *Writer are no-ops.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// New returns a Writer for `format` writing to `w`. A nil *Writer is returned for text output.
+func New(w io.Writer, format string) (*Writer, error) {
+	switch format {
+	case FormatText, "":
+		return nil, nil
+	case FormatJSON:
+		return &Writer{enc: json.NewEncoder(w), now: time.Now}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// Enabled returns true if events are being written
+func (w *Writer) Enabled() bool {
+	return w != nil
+}
+
+// Emit writes an event of type `eventType` with `data`
+func (w *Writer) Emit(eventType string, data interface{}) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.enc.Encode(Event{
+		SchemaVersion: SchemaVersion,
+		Type:          eventType,
+		Time:          w.now().UTC(),
+		Data:          data,
+	})
+}
+
+// NewSummary returns the summary of a nuke which deleted `deleted` object versions in `duration`
+func NewSummary(bucket string, region string, prefix string, listed int64, deleted int64, failed int64, duration time.Duration) Summary {
+	summary := Summary{
+		Bucket:          bucket,
+		Region:          region,
+		Prefix:          prefix,
+		Listed:          listed,
+		Deleted:         deleted,
+		Failed:          failed,
+		DurationSeconds: duration.Seconds(),
+	}
+	if duration > 0 {
+		summary.ObjectsPerSecond = float64(deleted) / duration.Seconds()
+	}
+	return summary
+}
+
+// NewMetric returns a Metric from CloudWatch results, which are ordered newest first
+func NewMetric(name string, storageType string, timestamps []time.Time, values []float64) Metric {
+	metric := Metric{Name: name, StorageType: storageType, Datapoints: []Datapoint{}}
+	for i := range values {
+		if i >= len(timestamps) {
+			break
+		}
+		metric.Datapoints = append(metric.Datapoints, Datapoint{Timestamp: timestamps[i].UTC(), Value: values[i]})
+	}
+	if len(metric.Datapoints) > 0 {
+		latest := metric.Datapoints[0]
+		metric.Latest = &latest
+	}
+	return metric
+}
@@ -0,0 +1,102 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{name: "default", format: "", wantEnabled: false},
+		{name: "text", format: FormatText, wantEnabled: false},
+		{name: "json", format: FormatJSON, wantEnabled: true},
+		{name: "unknown", format: "yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := New(&bytes.Buffer{}, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if w.Enabled() != tt.wantEnabled {
+				t.Errorf("Writer.Enabled() = %v, want %v", w.Enabled(), tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestWriter_Emit(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, FormatJSON)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	w.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	if err := w.Emit(EventRegion, Region{Bucket: "scratch", Region: "us-west-2"}); err != nil {
+		t.Fatalf("Writer.Emit() error = %v", err)
+	}
+	if err := w.Emit(EventSummary, NewSummary("scratch", "us-west-2", "", 10, 8, 2, 4*time.Second)); err != nil {
+		t.Fatalf("Writer.Emit() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Writer.Emit() wrote %d lines, want 2", len(lines))
+	}
+	want := `{"schema_version":1,"type":"region","time":"2024-05-01T12:00:00Z","data":{"bucket":"scratch","region":"us-west-2"}}`
+	if lines[0] != want {
+		t.Errorf("Writer.Emit() = %s, want %s", lines[0], want)
+	}
+
+	var summary struct {
+		Type string                 `json:"type"`
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &summary); err != nil {
+		t.Fatalf("could not parse summary event: %v", err)
+	}
+	if summary.Type != EventSummary || summary.Data["deleted"] != 8.0 || summary.Data["failed"] != 2.0 || summary.Data["objects_per_second"] != 2.0 {
+		t.Errorf("Writer.Emit() summary = %s", lines[1])
+	}
+	if _, ok := summary.Data["prefix"]; ok {
+		t.Errorf("Writer.Emit() summary should omit an empty prefix")
+	}
+
+	var nilWriter *Writer
+	if err := nilWriter.Emit(EventRegion, Region{}); err != nil {
+		t.Errorf("nil Writer.Emit() error = %v", err)
+	}
+}
+
+func TestNewSummary(t *testing.T) {
+	summary := NewSummary("scratch", "us-west-2", "logs/", 0, 0, 0, 0)
+	if summary.ObjectsPerSecond != 0 || math.IsNaN(summary.ObjectsPerSecond) {
+		t.Errorf("NewSummary() ObjectsPerSecond = %v, want 0 for a zero duration", summary.ObjectsPerSecond)
+	}
+}
+
+func TestNewMetric(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	metric := NewMetric("BucketSizeBytes", "StandardStorage", []time.Time{now, now.Add(-24 * time.Hour)}, []float64{20, 10})
+	if metric.Latest == nil || metric.Latest.Value != 20 || !metric.Latest.Timestamp.Equal(now) {
+		t.Errorf("NewMetric() Latest = %+v, want newest datapoint", metric.Latest)
+	}
+	if len(metric.Datapoints) != 2 {
+		t.Errorf("NewMetric() Datapoints = %+v", metric.Datapoints)
+	}
+
+	empty := NewMetric("NumberOfObjects", "AllStorageTypes", nil, nil)
+	if empty.Latest != nil || empty.Datapoints == nil {
+		t.Errorf("NewMetric() = %+v, want no latest value and an empty datapoint list", empty)
+	}
+}
@@ -0,0 +1,197 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// FormatVersion is the version of the plan file format written by this package
+const FormatVersion = 1
+
+// DefaultTTL is how long a plan may be applied for after it was created
+const DefaultTTL = 24 * time.Hour
+
+// digestPrefix identifies the algorithm used for manifest digests
+const digestPrefix = "sha256:"
+
+// Filters limit which object versions in the bucket are nuked
+type Filters struct {
+	// Prefix only includes keys starting with the prefix
+	Prefix string `json:"prefix"`
+}
+
+// Estimate contains the object version counts found while planning
+type Estimate struct {
+	// Objects is the number of current object versions
+	Objects int64 `json:"objects"`
+	// NoncurrentVersions is the number of noncurrent object versions
+	NoncurrentVersions int64 `json:"noncurrent_versions"`
+	// DeleteMarkers is the number of delete markers
+	DeleteMarkers int64 `json:"delete_markers"`
+	// Bytes is the total size of all object versions
+	Bytes int64 `json:"bytes"`
+}
+
+// Total returns the number of object versions (including delete markers) which will be deleted
+func (e Estimate) Total() int64 {
+	return e.Objects + e.NoncurrentVersions + e.DeleteMarkers
+}
+
+// Plan describes a nuke which has been reviewed ahead of time and can later be applied
+type Plan struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	AccountID     string    `json:"account_id"`
+	Bucket        string    `json:"bucket"`
+	// BucketCreatedAt distinguishes the bucket from one deleted and recreated with the same name
+	BucketCreatedAt time.Time `json:"bucket_created_at"`
+	Region          string    `json:"region"`
+	Filters         Filters   `json:"filters"`
+	Estimate        Estimate  `json:"estimate"`
+	// ManifestDigest is a digest of every object version listed while planning, see Manifest
+	ManifestDigest string `json:"manifest_digest"`
+}
+
+// Target identifies what is about to be nuked when a plan is applied
+type Target struct {
+	AccountID       string
+	Bucket          string
+	BucketCreatedAt time.Time
+	Region          string
+	Filters         Filters
+}
+
+// Write saves the plan as JSON to `path`, refusing to overwrite an existing file
+func (p *Plan) Write(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read loads a plan written by Plan.Write from `path`
+func Read(path string) (*Plan, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	p := &Plan{}
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(p); err != nil {
+		return nil, fmt.Errorf("could not parse plan file %s: %w", path, err)
+	}
+	if p.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported plan format version %d (expected %d)", p.FormatVersion, FormatVersion)
+	}
+	if p.Bucket == "" || p.AccountID == "" || !strings.HasPrefix(p.ManifestDigest, digestPrefix) {
+		return nil, fmt.Errorf("plan file %s is incomplete", path)
+	}
+
+	return p, nil
+}
+
+// Verify returns an error if the plan may not be applied to `target`: the account, bucket (including its creation
+// date), bucket region and filters must match the plan exactly, and the plan must be no older than `ttl` at `now`.
+func (p *Plan) Verify(target Target, ttl time.Duration, now time.Time) error {
+	problems := []string{}
+	if target.AccountID != p.AccountID {
+		problems = append(problems, fmt.Sprintf("account %s does not match planned account %s", target.AccountID, p.AccountID))
+	}
+	if target.Bucket != p.Bucket {
+		problems = append(problems, fmt.Sprintf("bucket %s does not match planned bucket %s", target.Bucket, p.Bucket))
+	} else if !target.BucketCreatedAt.Equal(p.BucketCreatedAt) {
+		problems = append(problems, fmt.Sprintf("bucket %s was created at %s, but the planned bucket was created at %s", target.Bucket, target.BucketCreatedAt, p.BucketCreatedAt))
+	}
+	if target.Region != p.Region {
+		problems = append(problems, fmt.Sprintf("bucket region %s does not match planned region %s", target.Region, p.Region))
+	}
+	if target.Filters != p.Filters {
+		problems = append(problems, fmt.Sprintf("filters %+v do not match planned filters %+v", target.Filters, p.Filters))
+	}
+	if age := now.Sub(p.CreatedAt); age > ttl {
+		problems = append(problems, fmt.Sprintf("plan was created %s ago, which is older than the %s limit", age.Round(time.Second), ttl))
+	}
+	if p.CreatedAt.After(now) {
+		problems = append(problems, fmt.Sprintf("plan creation time %s is in the future", p.CreatedAt))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("plan cannot be applied: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// VerifyManifest returns an error if `manifest`, a listing of the target taken when the plan is applied, does not
+// match the listing the plan was created from
+func (p *Plan) VerifyManifest(manifest *Manifest) error {
+	if digest := manifest.Digest(); digest != p.ManifestDigest {
+		return fmt.Errorf("plan cannot be applied: the bucket contents changed since the plan was created, planned %d object versions (%s), found %d (%s)",
+			p.Estimate.Total(), p.ManifestDigest, manifest.Estimate().Total(), digest)
+	}
+	return nil
+}
+
+// Manifest accumulates the object versions of a bucket listing into a digest and an Estimate.
+//
+// The digest depends on the order versions are added in, which is stable for ListObjectVersions.
+// A Manifest is not safe for concurrent use.
+type Manifest struct {
+	hash     hash.Hash
+	estimate Estimate
+}
+
+// NewManifest returns an empty Manifest
+func NewManifest() *Manifest {
+	return &Manifest{hash: sha256.New()}
+}
+
+// Add records an object version in the manifest
+func (m *Manifest) Add(version s3.ObjectVersion) {
+	kind := "current"
+	switch {
+	case version.IsDeleteMarker:
+		kind = "delete-marker"
+		m.estimate.DeleteMarkers++
+	case version.IsLatest:
+		m.estimate.Objects++
+	default:
+		kind = "noncurrent"
+		m.estimate.NoncurrentVersions++
+	}
+	m.estimate.Bytes += version.Size
+
+	fmt.Fprintf(m.hash, "%s\x00%s\x00%s\x00%d\n", aws.ToString(version.Key), aws.ToString(version.VersionID), kind, version.Size)
+}
+
+// Digest returns the digest of all object versions added so far
+func (m *Manifest) Digest() string {
+	return digestPrefix + hex.EncodeToString(m.hash.Sum(nil))
+}
+
+// Estimate returns the counts of all object versions added so far
+func (m *Manifest) Estimate() Estimate {
+	return m.estimate
+}
@@ -0,0 +1,157 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+var testVersions = []s3.ObjectVersion{
+	{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("a"), VersionID: aws.String("2")}, IsLatest: true, Size: 10},
+	{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("a"), VersionID: aws.String("1")}, Size: 5},
+	{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("b"), VersionID: aws.String("3")}, IsLatest: true, IsDeleteMarker: true},
+}
+
+func testPlan() *Plan {
+	m := NewManifest()
+	for _, v := range testVersions {
+		m.Add(v)
+	}
+	return &Plan{
+		FormatVersion:   FormatVersion,
+		CreatedAt:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		AccountID:       "123456789012",
+		Bucket:          "scratch",
+		BucketCreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Region:          "us-west-2",
+		Filters:         Filters{Prefix: "logs/"},
+		Estimate:        m.Estimate(),
+		ManifestDigest:  m.Digest(),
+	}
+}
+
+func TestManifest(t *testing.T) {
+	m := NewManifest()
+	empty := m.Digest()
+	for _, v := range testVersions {
+		m.Add(v)
+	}
+
+	want := Estimate{Objects: 1, NoncurrentVersions: 1, DeleteMarkers: 1, Bytes: 15}
+	if got := m.Estimate(); got != want {
+		t.Errorf("Manifest.Estimate() = %+v, want %+v", got, want)
+	}
+	if m.Estimate().Total() != 3 {
+		t.Errorf("Estimate.Total() = %d, want 3", m.Estimate().Total())
+	}
+	if !strings.HasPrefix(m.Digest(), "sha256:") || m.Digest() == empty {
+		t.Errorf("Manifest.Digest() = %s", m.Digest())
+	}
+
+	other := NewManifest()
+	for _, v := range testVersions[:2] {
+		other.Add(v)
+	}
+	if other.Digest() == m.Digest() {
+		t.Errorf("Manifest.Digest() should differ for different listings")
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nuke.plan.json")
+	p := testPlan()
+
+	if err := p.Write(path); err != nil {
+		t.Fatalf("Plan.Write() error = %v", err)
+	}
+	if err := p.Write(path); err == nil {
+		t.Errorf("Plan.Write() should refuse to overwrite an existing plan")
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Read() = %+v, want %+v", got, p)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid json", content: "{"},
+		{name: "unknown field", content: `{"format_version": 1, "bucket": "a", "account_id": "1", "manifest_digest": "sha256:00", "extra": true}`},
+		{name: "wrong version", content: `{"format_version": 99, "bucket": "a", "account_id": "1", "manifest_digest": "sha256:00"}`},
+		{name: "incomplete", content: `{"format_version": 1, "bucket": "a"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("could not write plan: %v", err)
+			}
+			if _, err := Read(path); err == nil {
+				t.Errorf("Read() expected error")
+			}
+		})
+	}
+}
+
+func TestPlan_Verify(t *testing.T) {
+	p := testPlan()
+	matching := Target{AccountID: "123456789012", Bucket: "scratch", BucketCreatedAt: p.BucketCreatedAt, Region: "us-west-2", Filters: Filters{Prefix: "logs/"}}
+
+	tests := []struct {
+		name    string
+		target  Target
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "matching", target: matching, now: p.CreatedAt.Add(time.Hour)},
+		{name: "different account", target: Target{AccountID: "210987654321", Bucket: "scratch", BucketCreatedAt: p.BucketCreatedAt, Region: matching.Region, Filters: matching.Filters}, now: p.CreatedAt, wantErr: true},
+		{name: "different bucket", target: Target{AccountID: matching.AccountID, Bucket: "other", BucketCreatedAt: p.BucketCreatedAt, Region: matching.Region, Filters: matching.Filters}, now: p.CreatedAt, wantErr: true},
+		{name: "recreated bucket", target: Target{AccountID: matching.AccountID, Bucket: "scratch", BucketCreatedAt: p.BucketCreatedAt.Add(time.Hour), Region: matching.Region, Filters: matching.Filters}, now: p.CreatedAt, wantErr: true},
+		{name: "different region", target: Target{AccountID: matching.AccountID, Bucket: "scratch", BucketCreatedAt: p.BucketCreatedAt, Region: "eu-west-1", Filters: matching.Filters}, now: p.CreatedAt, wantErr: true},
+		{name: "different filters", target: Target{AccountID: matching.AccountID, Bucket: "scratch", BucketCreatedAt: p.BucketCreatedAt, Region: matching.Region}, now: p.CreatedAt, wantErr: true},
+		{name: "expired", target: matching, now: p.CreatedAt.Add(DefaultTTL + time.Minute), wantErr: true},
+		{name: "from the future", target: matching, now: p.CreatedAt.Add(-time.Hour), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Verify(tt.target, DefaultTTL, tt.now); (err != nil) != tt.wantErr {
+				t.Errorf("Plan.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlan_VerifyManifest(t *testing.T) {
+	p := testPlan()
+	tests := []struct {
+		name     string
+		versions []s3.ObjectVersion
+		wantErr  bool
+	}{
+		{name: "unchanged", versions: testVersions},
+		{name: "object deleted", versions: testVersions[:2], wantErr: true},
+		{name: "object written", versions: append(append([]s3.ObjectVersion{}, testVersions...), s3.ObjectVersion{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("c"), VersionID: aws.String("4")}, IsLatest: true, Size: 1}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManifest()
+			for _, v := range tt.versions {
+				m.Add(v)
+			}
+			if err := p.VerifyManifest(m); (err != nil) != tt.wantErr {
+				t.Errorf("Plan.VerifyManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package pricing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// MinimumDurationEnd returns when `version` will have been stored for the minimum storage duration of its
+// storage class. The zero time is returned for delete markers, versions of storage classes without a minimum
+// storage duration and versions whose creation time is unknown.
+func (t *Table) MinimumDurationEnd(version s3.ObjectVersion) time.Time {
+	if version.IsDeleteMarker || version.LastModified == nil {
+		return time.Time{}
+	}
+	days := t.MinimumStorageDays[StorageTypeForClass(version.StorageClass)]
+	if days <= 0 {
+		return time.Time{}
+	}
+	return version.LastModified.AddDate(0, 0, days)
+}
+
+// EarlyVersions counts the object versions of a storage type which are still inside its minimum storage duration
+type EarlyVersions struct {
+	StorageType cloudwatch.StorageType `json:"storage_type"`
+	MinimumDays int                    `json:"minimum_days"`
+	Objects     int64                  `json:"objects"`
+	Bytes       int64                  `json:"bytes"`
+	// Charge is the early deletion charge for deleting the object versions now
+	Charge float64 `json:"charge"`
+	// FreeAfter is when the last of the object versions leaves the minimum storage duration
+	FreeAfter time.Time `json:"free_after"`
+}
+
+// EarlyDeletionScan finds object versions which are still inside the minimum storage duration of their storage class,
+// and adds up the early deletion charge for deleting them. It is not safe for concurrent use.
+type EarlyDeletionScan struct {
+	table  *Table
+	region string
+	now    time.Time
+	byType map[cloudwatch.StorageType]*EarlyVersions
+}
+
+// NewEarlyDeletionScan returns an EarlyDeletionScan pricing early deletions in `region` as of `now`
+func (t *Table) NewEarlyDeletionScan(region string, now time.Time) *EarlyDeletionScan {
+	return &EarlyDeletionScan{
+		table:  t,
+		region: region,
+		now:    now,
+		byType: map[cloudwatch.StorageType]*EarlyVersions{},
+	}
+}
+
+// Add checks `version`, returning true (and counting it) if deleting it now would be charged for early deletion
+func (s *EarlyDeletionScan) Add(version s3.ObjectVersion) bool {
+	freeAfter := s.table.MinimumDurationEnd(version)
+	if !freeAfter.After(s.now) {
+		return false
+	}
+
+	storageType := StorageTypeForClass(version.StorageClass)
+	early, ok := s.byType[storageType]
+	if !ok {
+		early = &EarlyVersions{StorageType: storageType, MinimumDays: s.table.MinimumStorageDays[storageType]}
+		s.byType[storageType] = early
+	}
+	ageDays := int(s.now.Sub(*version.LastModified).Hours() / 24)
+	early.Objects++
+	early.Bytes += version.Size
+	early.Charge += s.table.EarlyDeletionCharge(s.region, storageType, version.Size, ageDays)
+	if freeAfter.After(early.FreeAfter) {
+		early.FreeAfter = freeAfter
+	}
+	return true
+}
+
+// Results returns the object versions found inside their minimum storage duration by storage type, highest charge first
+func (s *EarlyDeletionScan) Results() []EarlyVersions {
+	results := make([]EarlyVersions, 0, len(s.byType))
+	for _, early := range s.byType {
+		results = append(results, *early)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Charge != results[j].Charge {
+			return results[i].Charge > results[j].Charge
+		}
+		return results[i].StorageType < results[j].StorageType
+	})
+	return results
+}
+
+// Total returns the object versions found inside their minimum storage duration across all storage types
+func (s *EarlyDeletionScan) Total() EarlyVersions {
+	var total EarlyVersions
+	for _, early := range s.byType {
+		total.Objects += early.Objects
+		total.Bytes += early.Bytes
+		total.Charge += early.Charge
+		if early.FreeAfter.After(total.FreeAfter) {
+			total.FreeAfter = early.FreeAfter
+		}
+	}
+	return total
+}
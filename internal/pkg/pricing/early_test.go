@@ -0,0 +1,97 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func storedVersion(key string, class string, size int64, lastModified time.Time) s3.ObjectVersion {
+	return s3.ObjectVersion{
+		ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key), VersionID: aws.String("1")},
+		Size:             size,
+		StorageClass:     class,
+		LastModified:     aws.Time(lastModified),
+	}
+}
+
+func TestTable_MinimumDurationEnd(t *testing.T) {
+	table := Default()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		version s3.ObjectVersion
+		want    time.Time
+	}{
+		{name: "standard", version: storedVersion("a", "STANDARD", 10, created)},
+		{name: "standard-ia", version: storedVersion("a", "STANDARD_IA", 10, created), want: created.AddDate(0, 0, 30)},
+		{name: "glacier", version: storedVersion("a", "GLACIER", 10, created), want: created.AddDate(0, 0, 90)},
+		{name: "deep archive", version: storedVersion("a", "DEEP_ARCHIVE", 10, created), want: created.AddDate(0, 0, 180)},
+		{name: "delete marker", version: s3.ObjectVersion{IsDeleteMarker: true, LastModified: aws.Time(created)}},
+		{name: "unknown age", version: s3.ObjectVersion{StorageClass: "GLACIER"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.MinimumDurationEnd(tt.version); !got.Equal(tt.want) {
+				t.Errorf("Table.MinimumDurationEnd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEarlyDeletionScan(t *testing.T) {
+	table := Default()
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	scan := table.NewEarlyDeletionScan("us-east-1", now)
+
+	versions := []struct {
+		version s3.ObjectVersion
+		early   bool
+	}{
+		{version: storedVersion("standard", "STANDARD", bytesPerGB, now.AddDate(0, 0, -1)), early: false},
+		{version: storedVersion("old-glacier", "GLACIER", bytesPerGB, now.AddDate(0, 0, -100)), early: false},
+		{version: storedVersion("glacier-1", "GLACIER", bytesPerGB, now.AddDate(0, 0, -60)), early: true},
+		{version: storedVersion("glacier-2", "GLACIER", bytesPerGB, now.AddDate(0, 0, -30)), early: true},
+		{version: storedVersion("deep", "DEEP_ARCHIVE", 2*bytesPerGB, now.AddDate(0, 0, -90)), early: true},
+	}
+	for _, v := range versions {
+		if got := scan.Add(v.version); got != v.early {
+			t.Errorf("EarlyDeletionScan.Add(%s) = %v, want %v", *v.version.Key, got, v.early)
+		}
+	}
+
+	results := scan.Results()
+	if len(results) != 2 {
+		t.Fatalf("EarlyDeletionScan.Results() = %+v, want 2 storage types", results)
+	}
+
+	// 30 + 60 remaining days of 1 GB each at 0.0036 per GB-month
+	glacier := results[0]
+	if glacier.StorageType != cloudwatch.GlacierStorage || glacier.Objects != 2 || glacier.Bytes != 2*bytesPerGB || glacier.MinimumDays != 90 {
+		t.Errorf("EarlyDeletionScan.Results()[0] = %+v", glacier)
+	}
+	if want := 0.0036 * 90 / 30; !approxEqual(glacier.Charge, want) {
+		t.Errorf("glacier charge = %v, want %v", glacier.Charge, want)
+	}
+	if want := now.AddDate(0, 0, 60); !glacier.FreeAfter.Equal(want) {
+		t.Errorf("glacier free after = %v, want %v", glacier.FreeAfter, want)
+	}
+
+	// 90 remaining days of 2 GB at 0.00099 per GB-month
+	deep := results[1]
+	if want := 2 * 0.00099 * 90 / 30; deep.StorageType != cloudwatch.DeepArchiveStorage || !approxEqual(deep.Charge, want) {
+		t.Errorf("EarlyDeletionScan.Results()[1] = %+v, want a charge of %v", deep, want)
+	}
+
+	total := scan.Total()
+	if total.Objects != 3 || total.Bytes != 4*bytesPerGB || !approxEqual(total.Charge, glacier.Charge+deep.Charge) {
+		t.Errorf("EarlyDeletionScan.Total() = %+v", total)
+	}
+	if want := now.AddDate(0, 0, 90); !total.FreeAfter.Equal(want) {
+		t.Errorf("EarlyDeletionScan.Total() FreeAfter = %v, want %v", total.FreeAfter, want)
+	}
+}
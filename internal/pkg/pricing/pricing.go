@@ -0,0 +1,326 @@
+package pricing
+
+import (
+	_ "embed" // for the default pricing table
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed pricing.yaml
+var defaultTable []byte
+
+// Request types priced per 1,000 requests
+const (
+	RequestList   = "list"
+	RequestDelete = "delete"
+)
+
+// bytesPerGB is the size of a GB as billed by AWS
+const bytesPerGB = 1 << 30
+
+// daysPerMonth is the length of a month used to prorate minimum storage duration charges
+const daysPerMonth = 30
+
+// requestsPerPage is the number of object versions listed or deleted by a single request
+const requestsPerPage = 1000
+
+// billedAs maps the overhead and staging storage types reported by CloudWatch to the storage type they are billed as
+var billedAs = map[cloudwatch.StorageType]cloudwatch.StorageType{
+	cloudwatch.StandardIASizeOverhead:      cloudwatch.StandardIAStorage,
+	cloudwatch.StandardIAObjectOverhead:    cloudwatch.StandardIAStorage,
+	cloudwatch.OneZoneIASizeOverhead:       cloudwatch.OneZoneIAStorage,
+	cloudwatch.GlacierStagingStorage:       cloudwatch.StandardStorage,
+	cloudwatch.GlacierObjectOverhead:       cloudwatch.GlacierStorage,
+	cloudwatch.GlacierS3ObjectOverhead:     cloudwatch.StandardStorage,
+	cloudwatch.DeepArchiveObjectOverhead:   cloudwatch.DeepArchiveStorage,
+	cloudwatch.DeepArchiveS3ObjectOverhead: cloudwatch.StandardStorage,
+	cloudwatch.DeepArchiveStagingStorage:   cloudwatch.StandardStorage,
+}
+
+// storageClasses maps the storage classes returned by ListObjectVersions to the storage type they are billed as.
+// Intelligent-Tiering objects are priced as the frequent access tier, as the tier of each object is not listed.
+var storageClasses = map[string]cloudwatch.StorageType{
+	"STANDARD":            cloudwatch.StandardStorage,
+	"INTELLIGENT_TIERING": cloudwatch.IntelligentTieringFAStorage,
+	"STANDARD_IA":         cloudwatch.StandardIAStorage,
+	"ONEZONE_IA":          cloudwatch.OneZoneIAStorage,
+	"REDUCED_REDUNDANCY":  cloudwatch.ReducedRedundancyStorage,
+	"GLACIER_IR":          cloudwatch.GlacierInstantRetrievalStorage,
+	"GLACIER":             cloudwatch.GlacierStorage,
+	"DEEP_ARCHIVE":        cloudwatch.DeepArchiveStorage,
+}
+
+// StorageTypeForClass returns the storage type an object version of storage `class` is billed as.
+// Unknown storage classes are billed as StandardStorage.
+func StorageTypeForClass(class string) cloudwatch.StorageType {
+	if storageType, ok := storageClasses[class]; ok {
+		return storageType
+	}
+	return cloudwatch.StandardStorage
+}
+
+// RegionPrices contains the prices for a single region
+type RegionPrices struct {
+	// Storage is the price per GB-month of each storage type
+	Storage map[cloudwatch.StorageType]float64 `yaml:"storage"`
+	// Requests is the price per 1,000 requests of each request type (see RequestList and RequestDelete)
+	Requests map[string]float64 `yaml:"requests"`
+}
+
+// Table contains the S3 prices used to estimate costs
+type Table struct {
+	Currency string `yaml:"currency"`
+	// DefaultRegion is the region whose prices are used for regions missing from the table
+	DefaultRegion string `yaml:"default_region"`
+	// MinimumStorageDays is the minimum storage duration charged for each storage type, if any
+	MinimumStorageDays map[cloudwatch.StorageType]int `yaml:"minimum_storage_days"`
+	Regions            map[string]*RegionPrices      `yaml:"regions"`
+}
+
+// Default returns the pricing table embedded in s3-nuke
+func Default() *Table {
+	table := &Table{}
+	if err := yaml.Unmarshal(defaultTable, table); err != nil {
+		panic(fmt.Sprintf("invalid embedded pricing table: %v", err))
+	}
+	return table
+}
+
+// LoadFile reads a pricing table from a YAML file at `path` on top of `table`.
+// Prices missing from the file keep their values from `table`. If `path` is empty, `table` is returned.
+func LoadFile(path string, table *Table) (*Table, error) {
+	if path == "" {
+		return table, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return table, err
+	}
+
+	override := &Table{}
+	if err := yaml.Unmarshal(data, override); err != nil {
+		return table, fmt.Errorf("could not parse pricing file %s: %w", path, err)
+	}
+	table.merge(override)
+
+	return table, table.Validate()
+}
+
+// merge applies the prices from `other` on top of t
+func (t *Table) merge(other *Table) {
+	if other.Currency != "" {
+		t.Currency = other.Currency
+	}
+	if other.DefaultRegion != "" {
+		t.DefaultRegion = other.DefaultRegion
+	}
+	if t.MinimumStorageDays == nil {
+		t.MinimumStorageDays = map[cloudwatch.StorageType]int{}
+	}
+	for storageType, days := range other.MinimumStorageDays {
+		t.MinimumStorageDays[storageType] = days
+	}
+	if t.Regions == nil {
+		t.Regions = map[string]*RegionPrices{}
+	}
+	for name, prices := range other.Regions {
+		if prices == nil {
+			continue
+		}
+		existing, ok := t.Regions[name]
+		if !ok {
+			existing = &RegionPrices{}
+			t.Regions[name] = existing
+		}
+		if existing.Storage == nil {
+			existing.Storage = map[cloudwatch.StorageType]float64{}
+		}
+		for storageType, price := range prices.Storage {
+			existing.Storage[storageType] = price
+		}
+		if existing.Requests == nil {
+			existing.Requests = map[string]float64{}
+		}
+		for request, price := range prices.Requests {
+			existing.Requests[request] = price
+		}
+	}
+}
+
+// Validate returns an error if the default region is missing or any price is negative
+func (t *Table) Validate() error {
+	if _, ok := t.Regions[t.DefaultRegion]; !ok {
+		return fmt.Errorf("pricing table has no prices for the default region %q", t.DefaultRegion)
+	}
+	for name, prices := range t.Regions {
+		for storageType, price := range prices.Storage {
+			if price < 0 {
+				return fmt.Errorf("negative %s price for %s", storageType, name)
+			}
+		}
+		for request, price := range prices.Requests {
+			if price < 0 {
+				return fmt.Errorf("negative %s request price for %s", request, name)
+			}
+		}
+	}
+	for storageType, days := range t.MinimumStorageDays {
+		if days < 0 {
+			return fmt.Errorf("negative minimum storage duration for %s", storageType)
+		}
+	}
+	return nil
+}
+
+// prices returns the prices for `region`, falling back to the default region
+//
+// returns:
+//   `string` - the region the prices are for
+//   `*RegionPrices` - the prices
+func (t *Table) prices(region string) (string, *RegionPrices) {
+	if prices, ok := t.Regions[region]; ok {
+		return region, prices
+	}
+	return t.DefaultRegion, t.Regions[t.DefaultRegion]
+}
+
+// StoragePrice returns the price per GB-month of `storageType` in `region`
+func (t *Table) StoragePrice(region string, storageType cloudwatch.StorageType) float64 {
+	if billed, ok := billedAs[storageType]; ok {
+		storageType = billed
+	}
+	_, prices := t.prices(region)
+	if prices == nil {
+		return 0
+	}
+	return prices.Storage[storageType]
+}
+
+// RequestPrice returns the price per 1,000 requests of type `request` in `region`
+func (t *Table) RequestPrice(region string, request string) float64 {
+	_, prices := t.prices(region)
+	if prices == nil {
+		return 0
+	}
+	return prices.Requests[request]
+}
+
+// EarlyDeletionCharge returns the charge for deleting `bytes` of `storageType` in `region` which have been stored
+// for `ageDays` days, before the minimum storage duration of the storage type has passed
+func (t *Table) EarlyDeletionCharge(region string, storageType cloudwatch.StorageType, bytes int64, ageDays int) float64 {
+	remaining := t.MinimumStorageDays[storageType] - ageDays
+	if remaining <= 0 {
+		return 0
+	}
+	return float64(bytes) / bytesPerGB * t.StoragePrice(region, storageType) * float64(remaining) / daysPerMonth
+}
+
+// Usage describes the contents of a bucket which will be deleted
+type Usage struct {
+	// Bytes is the number of bytes stored by storage type
+	Bytes map[cloudwatch.StorageType]int64
+	// ObjectVersions is the number of object versions, used to estimate how many requests are needed
+	ObjectVersions int64
+}
+
+// StorageCost is the monthly cost of storing the bytes of a storage type
+type StorageCost struct {
+	StorageType cloudwatch.StorageType `json:"storage_type"`
+	Bytes       int64                  `json:"bytes"`
+	MonthlyCost float64                `json:"monthly_cost"`
+}
+
+// EarlyDeletionCost is the charge for deleting the bytes of a storage type before its minimum storage duration
+type EarlyDeletionCost struct {
+	StorageType cloudwatch.StorageType `json:"storage_type"`
+	Bytes       int64                  `json:"bytes"`
+	MinimumDays int                    `json:"minimum_days"`
+	Cost        float64                `json:"cost"`
+}
+
+// Estimate contains the estimated costs and savings of a nuke
+type Estimate struct {
+	Currency string `json:"currency"`
+	Region   string `json:"region"`
+	// PricedRegion is the region whose prices were used, which differs from Region if Region is not in the table
+	PricedRegion string `json:"priced_region"`
+
+	Storage        []StorageCost `json:"storage"`
+	MonthlySavings float64       `json:"monthly_savings"`
+
+	ListRequests   int64   `json:"list_requests"`
+	ListCost       float64 `json:"list_cost"`
+	DeleteRequests int64   `json:"delete_requests"`
+	DeleteCost     float64 `json:"delete_cost"`
+
+	// EarlyDeletion is the worst case early deletion charge per storage type, assuming every object was stored today
+	EarlyDeletion []EarlyDeletionCost `json:"early_deletion"`
+	// EarlyDeletionCost is the worst case total early deletion charge
+	EarlyDeletionCost float64 `json:"early_deletion_cost"`
+}
+
+// RequestCost returns the total cost of the list and delete requests
+func (e *Estimate) RequestCost() float64 {
+	return e.ListCost + e.DeleteCost
+}
+
+// Estimate returns the estimated costs and savings of deleting `usage` in `region`
+func (t *Table) Estimate(region string, usage Usage) Estimate {
+	pricedRegion, _ := t.prices(region)
+	estimate := Estimate{
+		Currency:      t.Currency,
+		Region:        region,
+		PricedRegion:  pricedRegion,
+		Storage:       []StorageCost{},
+		EarlyDeletion: []EarlyDeletionCost{},
+	}
+
+	for storageType, bytes := range usage.Bytes {
+		if bytes <= 0 {
+			continue
+		}
+		cost := StorageCost{
+			StorageType: storageType,
+			Bytes:       bytes,
+			MonthlyCost: float64(bytes) / bytesPerGB * t.StoragePrice(region, storageType),
+		}
+		estimate.Storage = append(estimate.Storage, cost)
+		estimate.MonthlySavings += cost.MonthlyCost
+
+		if days := t.MinimumStorageDays[storageType]; days > 0 {
+			early := EarlyDeletionCost{
+				StorageType: storageType,
+				Bytes:       bytes,
+				MinimumDays: days,
+				Cost:        t.EarlyDeletionCharge(region, storageType, bytes, 0),
+			}
+			estimate.EarlyDeletion = append(estimate.EarlyDeletion, early)
+			estimate.EarlyDeletionCost += early.Cost
+		}
+	}
+	sort.Slice(estimate.Storage, func(i, j int) bool {
+		if estimate.Storage[i].MonthlyCost != estimate.Storage[j].MonthlyCost {
+			return estimate.Storage[i].MonthlyCost > estimate.Storage[j].MonthlyCost
+		}
+		return estimate.Storage[i].StorageType < estimate.Storage[j].StorageType
+	})
+	sort.Slice(estimate.EarlyDeletion, func(i, j int) bool {
+		if estimate.EarlyDeletion[i].Cost != estimate.EarlyDeletion[j].Cost {
+			return estimate.EarlyDeletion[i].Cost > estimate.EarlyDeletion[j].Cost
+		}
+		return estimate.EarlyDeletion[i].StorageType < estimate.EarlyDeletion[j].StorageType
+	})
+
+	requests := (usage.ObjectVersions + requestsPerPage - 1) / requestsPerPage
+	estimate.ListRequests = requests
+	estimate.ListCost = float64(requests) / 1000 * t.RequestPrice(region, RequestList)
+	estimate.DeleteRequests = requests
+	estimate.DeleteCost = float64(requests) / 1000 * t.RequestPrice(region, RequestDelete)
+
+	return estimate
+}
@@ -0,0 +1,187 @@
+package pricing
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+)
+
+func approxEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestDefault(t *testing.T) {
+	table := Default()
+	if err := table.Validate(); err != nil {
+		t.Fatalf("embedded pricing table is invalid: %v", err)
+	}
+	if table.Currency != "USD" {
+		t.Errorf("Default() currency = %s, want USD", table.Currency)
+	}
+
+	// every region must price every storage type which has its own price
+	for name, prices := range table.Regions {
+		for _, storageType := range cloudwatch.StorageTypes {
+			if _, ok := billedAs[storageType]; ok {
+				continue
+			}
+			if _, ok := prices.Storage[storageType]; !ok {
+				t.Errorf("region %s has no price for %s", name, storageType)
+			}
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("could not write pricing file: %v", err)
+		}
+		return path
+	}
+
+	t.Run("override", func(t *testing.T) {
+		path := write("override.yaml", "regions:\n  us-east-1:\n    storage:\n      StandardStorage: 0.02\n  mars-north-1:\n    storage:\n      StandardStorage: 1\n")
+		table, err := LoadFile(path, Default())
+		if err != nil {
+			t.Fatalf("LoadFile() error = %v", err)
+		}
+		if got := table.StoragePrice("us-east-1", cloudwatch.StandardStorage); got != 0.02 {
+			t.Errorf("StoragePrice() = %v, want overridden price 0.02", got)
+		}
+		if got := table.StoragePrice("us-east-2", cloudwatch.StandardStorage); got != 0.023 {
+			t.Errorf("StoragePrice() = %v, want regions sharing prices in the embedded table to be overridden separately", got)
+		}
+		if got := table.StoragePrice("us-east-1", cloudwatch.GlacierStorage); got != 0.0036 {
+			t.Errorf("StoragePrice() = %v, want embedded price 0.0036 to be kept", got)
+		}
+		if got := table.StoragePrice("mars-north-1", cloudwatch.StandardStorage); got != 1 {
+			t.Errorf("StoragePrice() = %v, want new region price 1", got)
+		}
+	})
+
+	t.Run("empty path", func(t *testing.T) {
+		table := Default()
+		if got, err := LoadFile("", table); err != nil || got != table {
+			t.Errorf("LoadFile() = %v, %v, want the table unchanged", got, err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid yaml", content: "regions: ["},
+		{name: "negative price", content: "regions:\n  us-east-1:\n    requests:\n      list: -1\n"},
+		{name: "unknown default region", content: "default_region: mars-north-1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadFile(write(tt.name+".yaml", tt.content), Default()); err == nil {
+				t.Errorf("LoadFile() expected error")
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "missing.yaml"), Default()); err == nil {
+		t.Errorf("LoadFile() expected error for a missing file")
+	}
+}
+
+func TestTable_StoragePrice(t *testing.T) {
+	table := Default()
+	tests := []struct {
+		name        string
+		region      string
+		storageType cloudwatch.StorageType
+		want        float64
+	}{
+		{name: "standard", region: "us-east-1", storageType: cloudwatch.StandardStorage, want: 0.023},
+		{name: "overhead billed as glacier", region: "us-east-1", storageType: cloudwatch.GlacierObjectOverhead, want: 0.0036},
+		{name: "overhead billed as standard", region: "us-east-1", storageType: cloudwatch.DeepArchiveS3ObjectOverhead, want: 0.023},
+		{name: "other region", region: "us-west-1", storageType: cloudwatch.StandardStorage, want: 0.026},
+		{name: "unknown region uses default", region: "mars-north-1", storageType: cloudwatch.StandardStorage, want: 0.023},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.StoragePrice(tt.region, tt.storageType); got != tt.want {
+				t.Errorf("Table.StoragePrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTable_EarlyDeletionCharge(t *testing.T) {
+	table := Default()
+	tests := []struct {
+		name        string
+		storageType cloudwatch.StorageType
+		ageDays     int
+		want        float64
+	}{
+		{name: "deep archive stored today", storageType: cloudwatch.DeepArchiveStorage, ageDays: 0, want: 0.00099 * 6},
+		{name: "glacier stored 60 days", storageType: cloudwatch.GlacierStorage, ageDays: 60, want: 0.0036},
+		{name: "glacier past minimum", storageType: cloudwatch.GlacierStorage, ageDays: 120, want: 0},
+		{name: "standard has no minimum", storageType: cloudwatch.StandardStorage, ageDays: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.EarlyDeletionCharge("us-east-1", tt.storageType, bytesPerGB, tt.ageDays); !approxEqual(got, tt.want) {
+				t.Errorf("Table.EarlyDeletionCharge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTable_Estimate(t *testing.T) {
+	table := Default()
+	estimate := table.Estimate("ap-southeast-2", Usage{
+		Bytes: map[cloudwatch.StorageType]int64{
+			cloudwatch.StandardStorage:    100 * bytesPerGB,
+			cloudwatch.DeepArchiveStorage: 1000 * bytesPerGB,
+			cloudwatch.StandardIAStorage:  0,
+		},
+		ObjectVersions: 2500,
+	})
+
+	if estimate.PricedRegion != "ap-southeast-2" || estimate.Currency != "USD" {
+		t.Errorf("Table.Estimate() region = %s, currency = %s", estimate.PricedRegion, estimate.Currency)
+	}
+	if len(estimate.Storage) != 2 || estimate.Storage[0].StorageType != cloudwatch.StandardStorage {
+		t.Errorf("Table.Estimate() storage = %+v, want 2 storage types, most expensive first", estimate.Storage)
+	}
+	if want := 100*0.025 + 1000*0.002; !approxEqual(estimate.MonthlySavings, want) {
+		t.Errorf("Table.Estimate() monthly savings = %v, want %v", estimate.MonthlySavings, want)
+	}
+	if estimate.ListRequests != 3 || estimate.DeleteRequests != 3 {
+		t.Errorf("Table.Estimate() requests = %d list, %d delete, want 3 each", estimate.ListRequests, estimate.DeleteRequests)
+	}
+	if want := 3.0 / 1000 * 0.0047; !approxEqual(estimate.RequestCost(), want) {
+		t.Errorf("Estimate.RequestCost() = %v, want %v", estimate.RequestCost(), want)
+	}
+	if len(estimate.EarlyDeletion) != 1 || estimate.EarlyDeletion[0].MinimumDays != 180 {
+		t.Errorf("Table.Estimate() early deletion = %+v, want deep archive only", estimate.EarlyDeletion)
+	}
+	if want := 1000 * 0.002 * 6; !approxEqual(estimate.EarlyDeletionCost, want) {
+		t.Errorf("Table.Estimate() early deletion cost = %v, want %v", estimate.EarlyDeletionCost, want)
+	}
+
+	fallback := table.Estimate("mars-north-1", Usage{})
+	if fallback.PricedRegion != "us-east-1" || fallback.Region != "mars-north-1" {
+		t.Errorf("Table.Estimate() = %s priced as %s, want default region prices", fallback.Region, fallback.PricedRegion)
+	}
+}
+
+func TestStorageTypeForClass(t *testing.T) {
+	if got := StorageTypeForClass("DEEP_ARCHIVE"); got != cloudwatch.DeepArchiveStorage {
+		t.Errorf("StorageTypeForClass(DEEP_ARCHIVE) = %s", got)
+	}
+	if got := StorageTypeForClass("EXPRESS_ONEZONE"); got != cloudwatch.StandardStorage {
+		t.Errorf("StorageTypeForClass(EXPRESS_ONEZONE) = %s, want StandardStorage", got)
+	}
+}
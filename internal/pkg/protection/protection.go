@@ -0,0 +1,187 @@
+package protection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProtectTag is the bucket tag key which marks a bucket as protected when set to "true"
+const DefaultProtectTag = "s3-nuke:protect"
+
+// Policy defines which buckets s3-nuke must refuse to nuke
+type Policy struct {
+	// DenyPatterns are glob patterns (see path.Match) matched against bucket names, e.g. `prod-*`
+	DenyPatterns []string `yaml:"deny_patterns"`
+	// ProtectTag is the tag key that protects a bucket when its value is "true"
+	ProtectTag string `yaml:"protect_tag"`
+	// ReplicationSource protects buckets which replicate to another bucket
+	ReplicationSource bool `yaml:"protect_replication_source"`
+	// ObjectLock protects buckets with Object Lock enabled
+	ObjectLock bool `yaml:"protect_object_lock"`
+}
+
+// BucketInfo contains the bucket settings a Policy is evaluated against
+type BucketInfo struct {
+	Name              string
+	Tags              map[string]string
+	ReplicationSource bool
+	ObjectLockEnabled bool
+	// InspectError is set if the bucket settings could not be retrieved
+	InspectError error
+}
+
+// DefaultPolicy returns the policy used when no policy file exists
+func DefaultPolicy() Policy {
+	return Policy{
+		ProtectTag:        DefaultProtectTag,
+		ReplicationSource: true,
+		ObjectLock:        true,
+	}
+}
+
+// LoadPolicy reads a policy from a YAML file at `path`.
+// Settings missing from the file keep their DefaultPolicy values. If the file does not exist, DefaultPolicy is returned.
+func LoadPolicy(path string) (Policy, error) {
+	return LoadPolicyFile(path, DefaultPolicy())
+}
+
+// LoadPolicyFile reads a policy from a YAML file at `path` on top of `policy`.
+// Settings missing from the file keep their values from `policy`. If the file does not exist, `policy` is returned.
+func LoadPolicyFile(path string, policy Policy) (Policy, error) {
+	if path == "" {
+		return policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, err
+	}
+
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("could not parse protection policy %s: %w", path, err)
+	}
+
+	return policy, policy.Validate()
+}
+
+// ConfigPolicy decodes the protection settings of an s3-nuke config file on top of Policy. Unlike a protection policy
+// file, a config file (which may be found in the current directory) can only add to the policy: its deny patterns are
+// added to those of the policy, and it is an error to change the protect tag or turn off a protection.
+type ConfigPolicy struct {
+	Policy *Policy
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (c ConfigPolicy) UnmarshalYAML(value *yaml.Node) error {
+	settings := struct {
+		DenyPatterns      []string `yaml:"deny_patterns"`
+		ProtectTag        *string  `yaml:"protect_tag"`
+		ReplicationSource *bool    `yaml:"protect_replication_source"`
+		ObjectLock        *bool    `yaml:"protect_object_lock"`
+	}{}
+	if err := value.Decode(&settings); err != nil {
+		return err
+	}
+
+	if settings.ProtectTag != nil && *settings.ProtectTag != c.Policy.ProtectTag {
+		return errors.New("protect_tag cannot be changed in a config file, set it in the protection policy file")
+	}
+	if settings.ReplicationSource != nil && !*settings.ReplicationSource && c.Policy.ReplicationSource {
+		return errors.New("protect_replication_source cannot be turned off in a config file")
+	}
+	if settings.ObjectLock != nil && !*settings.ObjectLock && c.Policy.ObjectLock {
+		return errors.New("protect_object_lock cannot be turned off in a config file")
+	}
+
+	c.Policy.DenyPatterns = append(c.Policy.DenyPatterns, settings.DenyPatterns...)
+	if settings.ReplicationSource != nil && *settings.ReplicationSource {
+		c.Policy.ReplicationSource = true
+	}
+	if settings.ObjectLock != nil && *settings.ObjectLock {
+		c.Policy.ObjectLock = true
+	}
+
+	return c.Policy.Validate()
+}
+
+// Validate returns an error if any of the deny patterns are malformed
+func (p Policy) Validate() error {
+	for _, pattern := range p.DenyPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the reasons `bucket` is protected by the policy. A bucket is not protected if no reasons are returned.
+//
+// Buckets whose settings could not be inspected are treated as protected.
+func (p Policy) Evaluate(bucket BucketInfo) []string {
+	reasons := p.EvaluateName(bucket.Name)
+
+	if bucket.InspectError != nil {
+		reasons = append(reasons, fmt.Sprintf("could not verify bucket settings: %v", bucket.InspectError))
+	}
+	if p.ProtectTag != "" && strings.EqualFold(bucket.Tags[p.ProtectTag], "true") {
+		reasons = append(reasons, fmt.Sprintf("tagged %s=true", p.ProtectTag))
+	}
+	if p.ReplicationSource && bucket.ReplicationSource {
+		reasons = append(reasons, "bucket is a replication source")
+	}
+	if p.ObjectLock && bucket.ObjectLockEnabled {
+		reasons = append(reasons, "Object Lock is enabled")
+	}
+
+	return reasons
+}
+
+// EvaluateName returns the reasons a bucket called `name` is protected based on the deny patterns alone
+func (p Policy) EvaluateName(name string) []string {
+	reasons := []string{}
+	for _, pattern := range p.DenyPatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			reasons = append(reasons, fmt.Sprintf("matches deny pattern %q", pattern))
+		}
+	}
+	return reasons
+}
+
+// Inspect retrieves the settings of `bucket` which are needed to evaluate a policy.
+// `s3svc` should be configured for the bucket's region.
+//
+// Errors are recorded in BucketInfo.InspectError rather than returned, so the bucket is treated as protected.
+func Inspect(ctx context.Context, s3svc s3.Service, bucket string) BucketInfo {
+	info := BucketInfo{Name: bucket}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		tags, err := s3svc.GetBucketTags(ctx, bucket)
+		info.Tags = tags
+		return err
+	})
+	g.Go(func() error {
+		replicated, err := s3svc.IsReplicationSource(ctx, bucket)
+		info.ReplicationSource = replicated
+		return err
+	})
+	g.Go(func() error {
+		locked, err := s3svc.IsObjectLockEnabled(ctx, bucket)
+		info.ObjectLockEnabled = locked
+		return err
+	})
+	info.InspectError = g.Wait()
+
+	return info
+}
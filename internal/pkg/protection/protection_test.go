@@ -0,0 +1,219 @@
+package protection
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	full := filepath.Join(dir, "full.yaml")
+	err := os.WriteFile(full, []byte(`
+deny_patterns:
+  - "prod-*"
+  - "*-backups"
+protect_tag: "team:keep"
+protect_replication_source: false
+protect_object_lock: true
+`), 0600)
+	if err != nil {
+		t.Fatalf("could not write policy file: %v", err)
+	}
+
+	partial := filepath.Join(dir, "partial.yaml")
+	if err := os.WriteFile(partial, []byte("deny_patterns: [\"prod-*\"]\n"), 0600); err != nil {
+		t.Fatalf("could not write policy file: %v", err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("deny_patterns: [\"prod-[\"]\n"), 0600); err != nil {
+		t.Fatalf("could not write policy file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "no path",
+			path: "",
+			want: DefaultPolicy(),
+		},
+		{
+			name: "missing file",
+			path: filepath.Join(dir, "missing.yaml"),
+			want: DefaultPolicy(),
+		},
+		{
+			name: "full policy",
+			path: full,
+			want: Policy{
+				DenyPatterns:      []string{"prod-*", "*-backups"},
+				ProtectTag:        "team:keep",
+				ReplicationSource: false,
+				ObjectLock:        true,
+			},
+		},
+		{
+			name: "partial policy keeps defaults",
+			path: partial,
+			want: Policy{
+				DenyPatterns:      []string{"prod-*"},
+				ProtectTag:        DefaultProtectTag,
+				ReplicationSource: true,
+				ObjectLock:        true,
+			},
+		},
+		{
+			name:    "invalid pattern",
+			path:    invalid,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadPolicy(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.DenyPatterns = []string{"prod-*"}
+
+	tests := []struct {
+		name        string
+		bucket      BucketInfo
+		wantReasons int
+	}{
+		{
+			name:        "unprotected",
+			bucket:      BucketInfo{Name: "scratch", Tags: map[string]string{"s3-nuke:protect": "false"}},
+			wantReasons: 0,
+		},
+		{
+			name:        "deny pattern",
+			bucket:      BucketInfo{Name: "prod-logs"},
+			wantReasons: 1,
+		},
+		{
+			name:        "protect tag",
+			bucket:      BucketInfo{Name: "scratch", Tags: map[string]string{"s3-nuke:protect": "TRUE"}},
+			wantReasons: 1,
+		},
+		{
+			name:        "replication source",
+			bucket:      BucketInfo{Name: "scratch", ReplicationSource: true},
+			wantReasons: 1,
+		},
+		{
+			name:        "object lock",
+			bucket:      BucketInfo{Name: "scratch", ObjectLockEnabled: true},
+			wantReasons: 1,
+		},
+		{
+			name:        "inspect error",
+			bucket:      BucketInfo{Name: "scratch", InspectError: errors.New("access denied")},
+			wantReasons: 1,
+		},
+		{
+			name: "everything",
+			bucket: BucketInfo{
+				Name:              "prod-data",
+				Tags:              map[string]string{"s3-nuke:protect": "true"},
+				ReplicationSource: true,
+				ObjectLockEnabled: true,
+			},
+			wantReasons: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Evaluate(tt.bucket); len(got) != tt.wantReasons {
+				t.Errorf("Policy.Evaluate() = %v, want %d reasons", got, tt.wantReasons)
+			}
+		})
+	}
+
+	t.Run("disabled settings", func(t *testing.T) {
+		p := Policy{}
+		bucket := BucketInfo{Name: "prod-data", ReplicationSource: true, ObjectLockEnabled: true, Tags: map[string]string{DefaultProtectTag: "true"}}
+		if got := p.Evaluate(bucket); len(got) != 0 {
+			t.Errorf("Policy.Evaluate() = %v, want no reasons", got)
+		}
+	})
+}
+
+func TestInspect(t *testing.T) {
+	t.Run("successful", func(t *testing.T) {
+		svc := s3ServiceMock{tags: map[string]string{"env": "prod"}, replicated: true}
+		got := Inspect(context.TODO(), svc, "bucket")
+		if got.InspectError != nil {
+			t.Errorf("Inspect() InspectError = %v", got.InspectError)
+		}
+		if got.Name != "bucket" || got.Tags["env"] != "prod" || !got.ReplicationSource || got.ObjectLockEnabled {
+			t.Errorf("Inspect() = %+v", got)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		svc := s3ServiceMock{err: errors.New("access denied")}
+		got := Inspect(context.TODO(), svc, "bucket")
+		if got.InspectError == nil {
+			t.Errorf("Inspect() expected InspectError")
+		}
+		if len(DefaultPolicy().Evaluate(got)) == 0 {
+			t.Errorf("Inspect() bucket with error should be protected")
+		}
+	})
+}
+
+// ====
+
+type s3ServiceMock struct {
+	s3.Service
+	tags       map[string]string
+	replicated bool
+	locked     bool
+	err        error
+}
+
+func (s s3ServiceMock) GetBucketTags(ctx context.Context, bucketName string) (map[string]string, error) {
+	return s.tags, s.err
+}
+
+func (s s3ServiceMock) IsReplicationSource(ctx context.Context, bucketName string) (bool, error) {
+	return s.replicated, s.err
+}
+
+func (s s3ServiceMock) IsObjectLockEnabled(ctx context.Context, bucketName string) (bool, error) {
+	return s.locked, s.err
+}
+
+func (s s3ServiceMock) ListPrefix(ctx context.Context, bucketName string, prefix string, continuationToken *string) (*s3.PrefixListing, error) {
+	return &s3.PrefixListing{}, s.err
+}
+
+func (s s3ServiceMock) ListVersionPrefix(ctx context.Context, bucketName string, prefix string, keyMarker *string, versionIDMarker *string) (*s3.VersionListing, error) {
+	return &s3.VersionListing{}, s.err
+}
+
+func (s s3ServiceMock) GetBucketVersioning(ctx context.Context, bucketName string) (*s3.BucketVersioning, error) {
+	return &s3.BucketVersioning{Status: "Enabled"}, s.err
+}
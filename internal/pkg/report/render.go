@@ -0,0 +1,313 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/guptarohit/asciigraph"
+)
+
+// Format defines the file format of a report
+type Format string
+
+// Supported report formats
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+// FormatFromPath returns the report format based on the file extension of `path`
+//
+// supported extensions are `.md`, `.markdown`, `.html` and `.htm`
+func FormatFromPath(path string) (Format, error) {
+	switch {
+	case strings.HasSuffix(path, ".md"), strings.HasSuffix(path, ".markdown"):
+		return FormatMarkdown, nil
+	case strings.HasSuffix(path, ".html"), strings.HasSuffix(path, ".htm"):
+		return FormatHTML, nil
+	}
+
+	return "", fmt.Errorf("unsupported report extension for %s (use .md or .html)", path)
+}
+
+// WriteFile writes the report to `path`, the format is chosen based on the file extension.
+// WriteFile will not overwrite an existing file.
+func (r *Report) WriteFile(path string) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatHTML:
+		err = r.WriteHTML(f)
+	default:
+		err = r.WriteMarkdown(f)
+	}
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// row is a line of a report table
+type row struct {
+	Label   string
+	Objects string
+	Bytes   string
+}
+
+func totalsRow(label string, t Totals) row {
+	return row{Label: label, Objects: humanize.Comma(t.Objects), Bytes: humanize.IBytes(uint64(t.Bytes))}
+}
+
+// versionRows returns the table of deleted object versions by kind
+func (r *Report) versionRows() []row {
+	return []row{
+		totalsRow("current", r.Current),
+		totalsRow("noncurrent", r.Noncurrent),
+		totalsRow("delete markers", r.DeleteMarkers),
+		totalsRow("total", r.Deleted),
+	}
+}
+
+// classRows returns the table of deleted object versions by storage class
+func (r *Report) classRows() []row {
+	rows := make([]row, 0, len(r.ByStorageClass))
+	for _, class := range r.ByStorageClass {
+		rows = append(rows, totalsRow(class.StorageClass, class.Totals))
+	}
+	return rows
+}
+
+// throughputRow is a line of the throughput table
+type throughputRow struct {
+	Elapsed   string
+	Deleted   string
+	PerSecond string
+	// Percent is the throughput relative to the busiest interval
+	Percent float64
+}
+
+func (r *Report) throughputRows() []throughputRow {
+	var peak int64
+	for _, sample := range r.Throughput {
+		if sample.Deleted > peak {
+			peak = sample.Deleted
+		}
+	}
+
+	rows := make([]throughputRow, 0, len(r.Throughput))
+	for _, sample := range r.Throughput {
+		tr := throughputRow{
+			Elapsed:   sample.Elapsed.String(),
+			Deleted:   humanize.Comma(sample.Deleted),
+			PerSecond: humanize.CommafWithDigits(float64(sample.Deleted)/r.Interval.Seconds(), 1),
+		}
+		if peak > 0 {
+			tr.Percent = float64(sample.Deleted) * 100 / float64(peak)
+		}
+		rows = append(rows, tr)
+	}
+	return rows
+}
+
+// prefixLabel returns the prefix the nuke was limited to, for display
+func (r *Report) prefixLabel() string {
+	if r.Prefix == "" {
+		return "(entire bucket)"
+	}
+	return r.Prefix
+}
+
+// WriteText writes the report as plain text tables, for printing at the end of a run
+func (r *Report) WriteText(w io.Writer) error {
+	versions, classes := r.versionRows(), r.classRows()
+
+	// Numbers are right aligned, so labels are padded to keep them left aligned
+	width := len("storage class")
+	for _, rw := range append(append([]row{}, versions...), classes...) {
+		width = max(width, len(rw.Label))
+	}
+	for _, f := range r.FailuresByCode {
+		width = max(width, len(f.Code))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%-*s\tobjects\tsize\t\n", width, "deleted")
+	for _, rw := range versions {
+		fmt.Fprintf(tw, "%-*s\t%s\t%s\t\n", width, rw.Label, rw.Objects, rw.Bytes)
+	}
+	if len(classes) > 0 {
+		fmt.Fprintln(tw, "\t\t\t")
+		fmt.Fprintf(tw, "%-*s\tobjects\tsize\t\n", width, "storage class")
+		for _, rw := range classes {
+			fmt.Fprintf(tw, "%-*s\t%s\t%s\t\n", width, rw.Label, rw.Objects, rw.Bytes)
+		}
+	}
+	if len(r.FailuresByCode) > 0 {
+		fmt.Fprintln(tw, "\t\t\t")
+		fmt.Fprintf(tw, "%-*s\tobjects\t\t\n", width, "failed")
+		for _, f := range r.FailuresByCode {
+			fmt.Fprintf(tw, "%-*s\t%s\t\t\n", width, f.Code, humanize.Comma(f.Count))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, "Duration: %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Throughput: %s objects/s average, %s objects/s peak\n",
+		humanize.CommafWithDigits(r.ObjectsPerSecond(), 1), humanize.CommafWithDigits(r.PeakObjectsPerSecond(), 1))
+	fmt.Fprintf(w, "Concurrency: %d peak, %.1f average DeleteObjects requests in flight\n", r.PeakConcurrency, r.AverageConcurrency)
+
+	if len(r.Throughput) > 1 {
+		values := make([]float64, 0, len(r.Throughput))
+		for _, sample := range r.Throughput {
+			values = append(values, float64(sample.Deleted)/r.Interval.Seconds())
+		}
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, asciigraph.Plot(values, asciigraph.Width(60), asciigraph.Height(8), asciigraph.Caption("Objects deleted per second")))
+	}
+
+	return nil
+}
+
+var markdownTemplate = texttemplate.Must(texttemplate.New("markdown").Parse(`# s3-nuke report: {{ .Report.Bucket }}
+
+| | |
+| --- | --- |
+| Bucket | {{ .Report.Bucket }} |
+| Region | {{ .Report.Region }} |
+| Prefix | {{ .Prefix }} |
+| Started | {{ .Report.StartedAt.UTC.Format "2006-01-02 15:04:05 MST" }} |
+| Duration | {{ .Duration }} |
+| Throughput | {{ .ObjectsPerSecond }} objects/s average, {{ .PeakObjectsPerSecond }} objects/s peak |
+| Concurrency | {{ .Report.PeakConcurrency }} peak, {{ printf "%.1f" .Report.AverageConcurrency }} average DeleteObjects requests in flight |
+
+## Deleted object versions
+
+| | Objects | Size |
+| --- | ---: | ---: |
+{{ range .Versions }}| {{ .Label }} | {{ .Objects }} | {{ .Bytes }} |
+{{ end }}
+## By storage class
+
+| Storage class | Objects | Size |
+| --- | ---: | ---: |
+{{ range .Classes }}| {{ .Label }} | {{ .Objects }} | {{ .Bytes }} |
+{{ end }}
+## Failures
+
+{{ if .Report.FailuresByCode }}| Error code | Objects |
+| --- | ---: |
+{{ range .Report.FailuresByCode }}| {{ .Code }} | {{ .Count }} |
+{{ end }}{{ else }}No object versions failed to delete.
+{{ end }}
+## Throughput
+
+| Elapsed | Deleted | Objects/s |
+| --- | ---: | ---: |
+{{ range .Throughput }}| {{ .Elapsed }} | {{ .Deleted }} | {{ .PerSecond }} |
+{{ end }}`))
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>s3-nuke report: {{ .Report.Bucket }}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 60em; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.8em; }
+th { background: #f6f8fa; text-align: left; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { background: #d1242f; height: 0.8em; }
+</style>
+</head>
+<body>
+<h1>💣 s3-nuke report: {{ .Report.Bucket }}</h1>
+<table>
+<tr><th>Bucket</th><td>{{ .Report.Bucket }}</td></tr>
+<tr><th>Region</th><td>{{ .Report.Region }}</td></tr>
+<tr><th>Prefix</th><td>{{ .Prefix }}</td></tr>
+<tr><th>Started</th><td>{{ .Report.StartedAt.UTC.Format "2006-01-02 15:04:05 MST" }}</td></tr>
+<tr><th>Duration</th><td>{{ .Duration }}</td></tr>
+<tr><th>Throughput</th><td>{{ .ObjectsPerSecond }} objects/s average, {{ .PeakObjectsPerSecond }} objects/s peak</td></tr>
+<tr><th>Concurrency</th><td>{{ .Report.PeakConcurrency }} peak, {{ printf "%.1f" .Report.AverageConcurrency }} average DeleteObjects requests in flight</td></tr>
+</table>
+
+<h2>Deleted object versions</h2>
+<table>
+<tr><th></th><th>Objects</th><th>Size</th></tr>
+{{ range .Versions }}<tr><td>{{ .Label }}</td><td class="n">{{ .Objects }}</td><td class="n">{{ .Bytes }}</td></tr>
+{{ end }}</table>
+
+<h2>By storage class</h2>
+<table>
+<tr><th>Storage class</th><th>Objects</th><th>Size</th></tr>
+{{ range .Classes }}<tr><td>{{ .Label }}</td><td class="n">{{ .Objects }}</td><td class="n">{{ .Bytes }}</td></tr>
+{{ end }}</table>
+
+<h2>Failures</h2>
+{{ if .Report.FailuresByCode }}<table>
+<tr><th>Error code</th><th>Objects</th></tr>
+{{ range .Report.FailuresByCode }}<tr><td>{{ .Code }}</td><td class="n">{{ .Count }}</td></tr>
+{{ end }}</table>
+{{ else }}<p>No object versions failed to delete.</p>
+{{ end }}
+<h2>Throughput</h2>
+<table>
+<tr><th>Elapsed</th><th>Deleted</th><th>Objects/s</th><th style="width: 20em"></th></tr>
+{{ range .Throughput }}<tr><td>{{ .Elapsed }}</td><td class="n">{{ .Deleted }}</td><td class="n">{{ .PerSecond }}</td><td><div class="bar" style="width: {{ printf "%.1f" .Percent }}%"></div></td></tr>
+{{ end }}</table>
+</body>
+</html>
+`))
+
+// templateData returns the values used by the report file templates
+func (r *Report) templateData() interface{} {
+	return struct {
+		Report               *Report
+		Prefix               string
+		Duration             time.Duration
+		ObjectsPerSecond     string
+		PeakObjectsPerSecond string
+		Versions             []row
+		Classes              []row
+		Throughput           []throughputRow
+	}{
+		Report:               r,
+		Prefix:               r.prefixLabel(),
+		Duration:             r.Duration.Round(time.Millisecond),
+		ObjectsPerSecond:     humanize.CommafWithDigits(r.ObjectsPerSecond(), 1),
+		PeakObjectsPerSecond: humanize.CommafWithDigits(r.PeakObjectsPerSecond(), 1),
+		Versions:             r.versionRows(),
+		Classes:              r.classRows(),
+		Throughput:           r.throughputRows(),
+	}
+}
+
+// WriteMarkdown writes the report as a Markdown document
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	return markdownTemplate.Execute(w, r.templateData())
+}
+
+// WriteHTML writes the report as a self-contained HTML document
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r.templateData())
+}
@@ -0,0 +1,269 @@
+package report
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// maxThroughputSamples is the largest number of throughput samples in a report, longer runs use longer intervals
+const maxThroughputSamples = 60
+
+// Totals counts object versions and their size
+type Totals struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func (t *Totals) add(version s3.ObjectVersion) {
+	t.Objects++
+	t.Bytes += version.Size
+}
+
+// ClassTotals counts the object versions deleted from a storage class
+type ClassTotals struct {
+	StorageClass string `json:"storage_class"`
+	Totals
+}
+
+// FailureCount counts the object versions which could not be deleted because of an error code
+type FailureCount struct {
+	Code  string `json:"code"`
+	Count int64  `json:"count"`
+}
+
+// ThroughputSample is the number of object versions deleted during one interval of a run
+type ThroughputSample struct {
+	// Elapsed is the time from the start of the run to the start of the interval
+	Elapsed time.Duration `json:"elapsed"`
+	Deleted int64         `json:"deleted"`
+}
+
+// Report contains the statistics of a single nuke
+type Report struct {
+	Bucket    string        `json:"bucket"`
+	Region    string        `json:"region"`
+	Prefix    string        `json:"prefix,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+
+	// Deleted counts every object version deleted, which are also counted as exactly one of Current, Noncurrent or DeleteMarkers
+	Deleted        Totals        `json:"deleted"`
+	Current        Totals        `json:"current"`
+	Noncurrent     Totals        `json:"noncurrent"`
+	DeleteMarkers  Totals        `json:"delete_markers"`
+	ByStorageClass []ClassTotals `json:"by_storage_class"`
+
+	Failed         int64          `json:"failed"`
+	FailuresByCode []FailureCount `json:"failures_by_code"`
+
+	// Interval is the length of each throughput sample
+	Interval   time.Duration      `json:"interval"`
+	Throughput []ThroughputSample `json:"throughput"`
+
+	// PeakConcurrency is the largest number of DeleteObjects requests in flight at once
+	PeakConcurrency int `json:"peak_concurrency"`
+	// AverageConcurrency is the average number of DeleteObjects requests in flight over the run
+	AverageConcurrency float64 `json:"average_concurrency"`
+}
+
+// ObjectsPerSecond returns the average number of object versions deleted per second
+func (r *Report) ObjectsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Deleted.Objects) / r.Duration.Seconds()
+}
+
+// PeakObjectsPerSecond returns the number of object versions deleted per second during the busiest interval
+func (r *Report) PeakObjectsPerSecond() float64 {
+	var peak int64
+	for _, sample := range r.Throughput {
+		if sample.Deleted > peak {
+			peak = sample.Deleted
+		}
+	}
+	if r.Interval <= 0 {
+		return 0
+	}
+	return float64(peak) / r.Interval.Seconds()
+}
+
+// Collector gathers the statistics of a nuke while it runs. Object versions are passed to Queued when they are
+// queued for deletion, and Collector implements workers.DeleteRecorder to learn which of them were deleted.
+//
+// Only object versions waiting for deletion are held in memory. Collector is safe for concurrent use.
+type Collector struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	report  Report
+	pending map[string]s3.ObjectVersion
+	classes map[string]*Totals
+	codes   map[string]int64
+	// deletedPerSecond counts deletions during each second of the run
+	deletedPerSecond []int64
+
+	inFlight   int
+	lastChange time.Time
+	// busy is the sum of requests in flight multiplied by how long they were in flight, in seconds
+	busy float64
+}
+
+// NewCollector returns a Collector for a nuke of `bucket` starting now
+func NewCollector(bucket string, region string, prefix string) *Collector {
+	return newCollector(bucket, region, prefix, time.Now)
+}
+
+func newCollector(bucket string, region string, prefix string, now func() time.Time) *Collector {
+	start := now()
+	return &Collector{
+		now: now,
+		report: Report{
+			Bucket:    bucket,
+			Region:    region,
+			Prefix:    prefix,
+			StartedAt: start,
+		},
+		pending:    map[string]s3.ObjectVersion{},
+		classes:    map[string]*Totals{},
+		codes:      map[string]int64{},
+		lastChange: start,
+	}
+}
+
+// versionKey identifies an object version in the pending map
+func versionKey(object s3.ObjectIdentifier) string {
+	return aws.ToString(object.Key) + "\x00" + aws.ToString(object.VersionID)
+}
+
+// Queued records that `version` has been queued for deletion
+func (c *Collector) Queued(version s3.ObjectVersion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending[versionKey(version.ObjectIdentifier)] = version
+}
+
+// DeleteStarted implements workers.DeleteRecorder
+func (c *Collector) DeleteStarted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.concurrencyChanged(1)
+}
+
+// DeleteFinished implements workers.DeleteRecorder
+func (c *Collector) DeleteFinished(deleted []s3.ObjectIdentifier, failed []s3.DeleteError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.concurrencyChanged(-1)
+
+	second := int(c.now().Sub(c.report.StartedAt) / time.Second)
+	for len(c.deletedPerSecond) <= second {
+		c.deletedPerSecond = append(c.deletedPerSecond, 0)
+	}
+	c.deletedPerSecond[second] += int64(len(deleted))
+
+	for _, object := range deleted {
+		key := versionKey(object)
+		// Object versions which were never queued (which should not happen) are still counted, without a size
+		version, ok := c.pending[key]
+		if !ok {
+			version = s3.ObjectVersion{ObjectIdentifier: object}
+		}
+		delete(c.pending, key)
+
+		c.report.Deleted.add(version)
+		switch {
+		case version.IsDeleteMarker:
+			c.report.DeleteMarkers.add(version)
+			continue
+		case version.IsLatest:
+			c.report.Current.add(version)
+		default:
+			c.report.Noncurrent.add(version)
+		}
+
+		class := version.StorageClass
+		if class == "" {
+			class = "UNKNOWN"
+		}
+		if c.classes[class] == nil {
+			c.classes[class] = &Totals{}
+		}
+		c.classes[class].add(version)
+	}
+
+	for _, f := range failed {
+		delete(c.pending, versionKey(f.ObjectIdentifier))
+		c.report.Failed++
+		c.codes[f.Code]++
+	}
+}
+
+// concurrencyChanged adds `delta` to the number of requests in flight. c.mu must be held.
+func (c *Collector) concurrencyChanged(delta int) {
+	now := c.now()
+	c.busy += float64(c.inFlight) * now.Sub(c.lastChange).Seconds()
+	c.lastChange = now
+	c.inFlight += delta
+	if c.inFlight > c.report.PeakConcurrency {
+		c.report.PeakConcurrency = c.inFlight
+	}
+}
+
+// Report returns the statistics gathered so far
+func (c *Collector) Report() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	r := c.report
+	r.Duration = now.Sub(r.StartedAt)
+	if r.Duration > 0 {
+		busy := c.busy + float64(c.inFlight)*now.Sub(c.lastChange).Seconds()
+		r.AverageConcurrency = busy / r.Duration.Seconds()
+	}
+
+	r.ByStorageClass = make([]ClassTotals, 0, len(c.classes))
+	for class, totals := range c.classes {
+		r.ByStorageClass = append(r.ByStorageClass, ClassTotals{StorageClass: class, Totals: *totals})
+	}
+	sort.Slice(r.ByStorageClass, func(i, j int) bool {
+		if r.ByStorageClass[i].Bytes != r.ByStorageClass[j].Bytes {
+			return r.ByStorageClass[i].Bytes > r.ByStorageClass[j].Bytes
+		}
+		return r.ByStorageClass[i].StorageClass < r.ByStorageClass[j].StorageClass
+	})
+
+	r.FailuresByCode = make([]FailureCount, 0, len(c.codes))
+	for code, count := range c.codes {
+		r.FailuresByCode = append(r.FailuresByCode, FailureCount{Code: code, Count: count})
+	}
+	sort.Slice(r.FailuresByCode, func(i, j int) bool {
+		if r.FailuresByCode[i].Count != r.FailuresByCode[j].Count {
+			return r.FailuresByCode[i].Count > r.FailuresByCode[j].Count
+		}
+		return r.FailuresByCode[i].Code < r.FailuresByCode[j].Code
+	})
+
+	// Merge the per second counts into at most maxThroughputSamples intervals
+	seconds := int(r.Duration/time.Second) + 1
+	perSample := (seconds + maxThroughputSamples - 1) / maxThroughputSamples
+	r.Interval = time.Duration(perSample) * time.Second
+	r.Throughput = []ThroughputSample{}
+	for start := 0; start < seconds; start += perSample {
+		sample := ThroughputSample{Elapsed: time.Duration(start) * time.Second}
+		for s := start; s < start+perSample && s < len(c.deletedPerSecond); s++ {
+			sample.Deleted += c.deletedPerSecond[s]
+		}
+		r.Throughput = append(r.Throughput, sample)
+	}
+
+	return &r
+}
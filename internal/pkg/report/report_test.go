@@ -0,0 +1,211 @@
+package report
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// fakeClock is advanced manually by tests
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func version(key string, versionID string, latest bool, deleteMarker bool, size int64, class string) s3.ObjectVersion {
+	return s3.ObjectVersion{
+		ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key), VersionID: aws.String(versionID)},
+		IsLatest:         latest,
+		IsDeleteMarker:   deleteMarker,
+		Size:             size,
+		StorageClass:     class,
+	}
+}
+
+func testCollector() (*Collector, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c := newCollector("scratch", "us-west-2", "logs/", clock.Now)
+
+	versions := []s3.ObjectVersion{
+		version("a", "2", true, false, 100, "STANDARD"),
+		version("a", "1", false, false, 50, "STANDARD"),
+		version("b", "1", true, false, 1000, "GLACIER"),
+		version("c", "2", true, true, 0, ""),
+		version("c", "1", false, false, 10, "STANDARD"),
+	}
+	for _, v := range versions {
+		c.Queued(v)
+	}
+
+	// two requests overlap for the first second, then one more request runs alone
+	c.DeleteStarted()
+	c.DeleteStarted()
+	clock.now = clock.now.Add(time.Second)
+	c.DeleteFinished([]s3.ObjectIdentifier{versions[0].ObjectIdentifier, versions[1].ObjectIdentifier}, nil)
+	c.DeleteFinished([]s3.ObjectIdentifier{versions[2].ObjectIdentifier}, []s3.DeleteError{{ObjectIdentifier: versions[4].ObjectIdentifier, Code: "AccessDenied"}})
+	c.DeleteStarted()
+	clock.now = clock.now.Add(time.Second)
+	c.DeleteFinished([]s3.ObjectIdentifier{versions[3].ObjectIdentifier}, nil)
+	clock.now = clock.now.Add(2 * time.Second)
+
+	return c, clock
+}
+
+func TestCollector_Report(t *testing.T) {
+	c, _ := testCollector()
+	r := c.Report()
+
+	if r.Duration != 4*time.Second {
+		t.Errorf("Report.Duration = %v, want 4s", r.Duration)
+	}
+	if want := (Totals{Objects: 4, Bytes: 1150}); r.Deleted != want {
+		t.Errorf("Report.Deleted = %+v, want %+v", r.Deleted, want)
+	}
+	if want := (Totals{Objects: 2, Bytes: 1100}); r.Current != want {
+		t.Errorf("Report.Current = %+v, want %+v", r.Current, want)
+	}
+	if want := (Totals{Objects: 1, Bytes: 50}); r.Noncurrent != want {
+		t.Errorf("Report.Noncurrent = %+v, want %+v", r.Noncurrent, want)
+	}
+	if want := (Totals{Objects: 1}); r.DeleteMarkers != want {
+		t.Errorf("Report.DeleteMarkers = %+v, want %+v", r.DeleteMarkers, want)
+	}
+
+	wantClasses := []ClassTotals{
+		{StorageClass: "GLACIER", Totals: Totals{Objects: 1, Bytes: 1000}},
+		{StorageClass: "STANDARD", Totals: Totals{Objects: 2, Bytes: 150}},
+	}
+	if !reflect.DeepEqual(r.ByStorageClass, wantClasses) {
+		t.Errorf("Report.ByStorageClass = %+v, want %+v", r.ByStorageClass, wantClasses)
+	}
+
+	if r.Failed != 1 || !reflect.DeepEqual(r.FailuresByCode, []FailureCount{{Code: "AccessDenied", Count: 1}}) {
+		t.Errorf("Report failures = %d %+v", r.Failed, r.FailuresByCode)
+	}
+
+	wantThroughput := []ThroughputSample{
+		{Elapsed: 0, Deleted: 0},
+		{Elapsed: time.Second, Deleted: 3},
+		{Elapsed: 2 * time.Second, Deleted: 1},
+		{Elapsed: 3 * time.Second, Deleted: 0},
+		{Elapsed: 4 * time.Second, Deleted: 0},
+	}
+	if r.Interval != time.Second || !reflect.DeepEqual(r.Throughput, wantThroughput) {
+		t.Errorf("Report.Throughput = %v %+v, want %+v", r.Interval, r.Throughput, wantThroughput)
+	}
+	if r.ObjectsPerSecond() != 1 || r.PeakObjectsPerSecond() != 3 {
+		t.Errorf("Report throughput = %v average, %v peak, want 1 and 3", r.ObjectsPerSecond(), r.PeakObjectsPerSecond())
+	}
+
+	// 2 requests for 1s, then 1 request for 1s, over 4s
+	if r.PeakConcurrency != 2 || r.AverageConcurrency != 0.75 {
+		t.Errorf("Report concurrency = %d peak, %v average, want 2 and 0.75", r.PeakConcurrency, r.AverageConcurrency)
+	}
+
+	if len(c.pending) != 0 {
+		t.Errorf("Collector should not keep deleted or failed object versions, %d pending", len(c.pending))
+	}
+}
+
+func TestCollector_Report_LongRun(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c := newCollector("scratch", "us-west-2", "", clock.Now)
+	for i := 0; i < 600; i++ {
+		c.DeleteStarted()
+		clock.now = clock.now.Add(time.Second)
+		c.DeleteFinished([]s3.ObjectIdentifier{{Key: aws.String("key"), VersionID: aws.String("version")}}, nil)
+	}
+
+	r := c.Report()
+	if len(r.Throughput) > maxThroughputSamples {
+		t.Errorf("Report.Throughput has %d samples, want at most %d", len(r.Throughput), maxThroughputSamples)
+	}
+	var deleted int64
+	for _, sample := range r.Throughput {
+		deleted += sample.Deleted
+	}
+	if deleted != 600 {
+		t.Errorf("Report.Throughput adds up to %d, want 600", deleted)
+	}
+	if r.Deleted.Objects != 600 {
+		t.Errorf("Report.Deleted = %+v, want 600 objects", r.Deleted)
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    Format
+		wantErr bool
+	}{
+		{path: "report.md", want: FormatMarkdown},
+		{path: "report.markdown", want: FormatMarkdown},
+		{path: "report.html", want: FormatHTML},
+		{path: "report.htm", want: FormatHTML},
+		{path: "report.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := FormatFromPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FormatFromPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FormatFromPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	c, _ := testCollector()
+	r := c.Report()
+
+	var text bytes.Buffer
+	if err := r.WriteText(&text); err != nil {
+		t.Fatalf("Report.WriteText() error = %v", err)
+	}
+	for _, want := range []string{"GLACIER", "AccessDenied", "delete markers", "2 peak, 0.8 average", "Objects deleted per second"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Report.WriteText() does not contain %q:\n%s", want, text.String())
+		}
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: filepath.Join(dir, "report.md"), want: []string{"# s3-nuke report: scratch", "| GLACIER | 1 | 1000 B |", "| AccessDenied | 1 |", "| logs/ |"}},
+		{path: filepath.Join(dir, "report.html"), want: []string{"<!DOCTYPE html>", "<td>GLACIER</td>", "<td>AccessDenied</td>", "width: 100.0%"}},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Ext(tt.path), func(t *testing.T) {
+			if err := r.WriteFile(tt.path); err != nil {
+				t.Fatalf("Report.WriteFile() error = %v", err)
+			}
+			data, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatalf("could not read report: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("Report.WriteFile() does not contain %q:\n%s", want, data)
+				}
+			}
+			if err := r.WriteFile(tt.path); err == nil {
+				t.Errorf("Report.WriteFile() should refuse to overwrite an existing report")
+			}
+		})
+	}
+}
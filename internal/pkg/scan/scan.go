@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"context"
+	"sort"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// Counts is the number and size of some object versions
+type Counts struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func (c *Counts) add(objects int64, bytes int64) {
+	c.Objects += objects
+	c.Bytes += bytes
+}
+
+// Tally is the exact contents of a bucket or prefix, added up from its object versions
+type Tally struct {
+	// Current are the latest versions of objects that have not been deleted
+	Current Counts `json:"current"`
+	// Noncurrent are the versions of objects that have been overwritten or deleted
+	Noncurrent    Counts `json:"noncurrent"`
+	DeleteMarkers int64  `json:"delete_markers"`
+	// StorageClasses adds up current and noncurrent versions by their storage class, e.g. STANDARD
+	StorageClasses map[string]Counts `json:"storage_classes"`
+}
+
+// NewTally returns an empty tally
+func NewTally() *Tally {
+	return &Tally{StorageClasses: map[string]Counts{}}
+}
+
+// Add counts `version` in the tally
+func (t *Tally) Add(version s3.ObjectVersion) {
+	if version.IsDeleteMarker {
+		t.DeleteMarkers++
+		return
+	}
+	if version.IsLatest {
+		t.Current.add(1, version.Size)
+	} else {
+		t.Noncurrent.add(1, version.Size)
+	}
+	class := t.StorageClasses[version.StorageClass]
+	class.add(1, version.Size)
+	t.StorageClasses[version.StorageClass] = class
+}
+
+// Merge adds the counts of `other` to the tally
+func (t *Tally) Merge(other *Tally) {
+	t.Current.add(other.Current.Objects, other.Current.Bytes)
+	t.Noncurrent.add(other.Noncurrent.Objects, other.Noncurrent.Bytes)
+	t.DeleteMarkers += other.DeleteMarkers
+	for storageClass, counts := range other.StorageClasses {
+		class := t.StorageClasses[storageClass]
+		class.add(counts.Objects, counts.Bytes)
+		t.StorageClasses[storageClass] = class
+	}
+}
+
+// Versions returns the number of object versions in the tally, including delete markers
+func (t *Tally) Versions() int64 {
+	return t.Current.Objects + t.Noncurrent.Objects + t.DeleteMarkers
+}
+
+// Bytes returns the size of every object version in the tally
+func (t *Tally) Bytes() int64 {
+	return t.Current.Bytes + t.Noncurrent.Bytes
+}
+
+// SortedStorageClasses returns the storage classes in the tally, largest first
+func (t *Tally) SortedStorageClasses() []string {
+	classes := make([]string, 0, len(t.StorageClasses))
+	for storageClass := range t.StorageClasses {
+		classes = append(classes, storageClass)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		a, b := t.StorageClasses[classes[i]], t.StorageClasses[classes[j]]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return classes[i] < classes[j]
+	})
+	return classes
+}
+
+// Walk lists every object version and delete marker under `prefix` in `bucket`, calling `fn` with each page of
+// versions. The listing is sharded by the prefixes directly under `prefix`, which are listed by up to `concurrency`
+// goroutines at once, so `fn` must be safe to call concurrently.
+func Walk(ctx context.Context, s3svc s3.Service, bucket string, prefix string, concurrency int, fn func(versions []s3.ObjectVersion)) error {
+	// the versions of keys directly under the prefix are listed with the shards
+	shards := []string{}
+	var keyMarker, versionIDMarker *string
+	for {
+		listing, err := s3svc.ListVersionPrefix(ctx, bucket, prefix, keyMarker, versionIDMarker)
+		if err != nil {
+			return err
+		}
+		shards = append(shards, listing.Prefixes...)
+		if len(listing.Versions) > 0 {
+			fn(listing.Versions)
+		}
+		if listing.NextKeyMarker == nil && listing.NextVersionIDMarker == nil {
+			break
+		}
+		keyMarker, versionIDMarker = listing.NextKeyMarker, listing.NextVersionIDMarker
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(concurrency, 1))
+	for _, shard := range shards {
+		g.Go(func() error {
+			var keyMarker, versionIDMarker *string
+			for {
+				versions, nextKeyMarker, nextVersionIDMarker, err := s3svc.ListObjectVersions(ctx, bucket, keyMarker, versionIDMarker, &shard)
+				if err != nil {
+					return err
+				}
+				if len(versions) > 0 {
+					fn(versions)
+				}
+				if nextKeyMarker == nil && nextVersionIDMarker == nil {
+					return nil
+				}
+				keyMarker, versionIDMarker = nextKeyMarker, nextVersionIDMarker
+			}
+		})
+	}
+	return g.Wait()
+}
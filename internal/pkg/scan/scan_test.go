@@ -0,0 +1,170 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func version(key string, versionID string, latest bool, size int64, storageClass string) s3.ObjectVersion {
+	return s3.ObjectVersion{
+		ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key), VersionID: aws.String(versionID)},
+		IsLatest:         latest,
+		Size:             size,
+		StorageClass:     storageClass,
+	}
+}
+
+func deleteMarker(key string, versionID string) s3.ObjectVersion {
+	return s3.ObjectVersion{
+		ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key), VersionID: aws.String(versionID)},
+		IsDeleteMarker:   true,
+		IsLatest:         true,
+	}
+}
+
+var bucketVersions = []s3.ObjectVersion{
+	version("index.html", "1", true, 10, "STANDARD"),
+	deleteMarker("old.html", "2"),
+	version("old.html", "1", false, 20, "STANDARD"),
+	version("logs/a", "1", true, 100, "STANDARD"),
+	version("logs/a", "0", false, 100, "GLACIER"),
+	version("logs/b", "1", true, 300, "GLACIER"),
+	version("logs/2024/c", "1", true, 1000, "STANDARD"),
+	deleteMarker("images/x", "2"),
+	version("images/x", "1", false, 5000, "DEEP_ARCHIVE"),
+}
+
+// s3ServiceMock lists bucketVersions one version per page, the embedded Service is nil
+type s3ServiceMock struct {
+	s3.Service
+	failShard string
+}
+
+// page returns the version at `marker` (an index) in `versions`, and the marker of the next page
+func page(versions []s3.ObjectVersion, marker *string) ([]s3.ObjectVersion, *string) {
+	i := 0
+	if marker != nil {
+		i, _ = strconv.Atoi(*marker)
+	}
+	if i >= len(versions) {
+		return []s3.ObjectVersion{}, nil
+	}
+	if i+1 < len(versions) {
+		return versions[i : i+1], aws.String(strconv.Itoa(i + 1))
+	}
+	return versions[i : i+1], nil
+}
+
+func (s s3ServiceMock) ListVersionPrefix(ctx context.Context, bucketName string, prefix string, keyMarker *string, versionIDMarker *string) (*s3.VersionListing, error) {
+	if prefix != "" {
+		return nil, errors.New("unexpected prefix")
+	}
+	root := []s3.ObjectVersion{}
+	prefixes := map[string]bool{}
+	for _, v := range bucketVersions {
+		if i := strings.Index(*v.Key, "/"); i >= 0 {
+			prefixes[(*v.Key)[:i+1]] = true
+		} else {
+			root = append(root, v)
+		}
+	}
+	listing := &s3.VersionListing{Prefixes: []string{}}
+	// every prefix is returned on the first page
+	if keyMarker == nil {
+		for p := range prefixes {
+			listing.Prefixes = append(listing.Prefixes, p)
+		}
+		sort.Strings(listing.Prefixes)
+	}
+	listing.Versions, listing.NextKeyMarker = page(root, keyMarker)
+	return listing, nil
+}
+
+func (s s3ServiceMock) ListObjectVersions(ctx context.Context, bucketName string, keyMarker *string, versionIDMarker *string, prefix *string) ([]s3.ObjectVersion, *string, *string, error) {
+	if *prefix == s.failShard {
+		return nil, nil, nil, errors.New("AccessDenied")
+	}
+	versions := []s3.ObjectVersion{}
+	for _, v := range bucketVersions {
+		if strings.HasPrefix(*v.Key, *prefix) {
+			versions = append(versions, v)
+		}
+	}
+	versions, next := page(versions, keyMarker)
+	return versions, next, nil, nil
+}
+
+func TestWalk(t *testing.T) {
+	var mu sync.Mutex
+	tally := NewTally()
+	seen := map[string]bool{}
+	err := Walk(context.Background(), s3ServiceMock{}, "bucket", "", 2, func(versions []s3.ObjectVersion) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, v := range versions {
+			id := *v.Key + "@" + *v.VersionID
+			if seen[id] {
+				t.Errorf("Walk() listed %s twice", id)
+			}
+			seen[id] = true
+			tally.Add(v)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if len(seen) != len(bucketVersions) {
+		t.Errorf("Walk() listed %d versions, want %d", len(seen), len(bucketVersions))
+	}
+
+	want := &Tally{
+		Current:       Counts{Objects: 4, Bytes: 1410},
+		Noncurrent:    Counts{Objects: 3, Bytes: 5120},
+		DeleteMarkers: 2,
+		StorageClasses: map[string]Counts{
+			"STANDARD":     {Objects: 4, Bytes: 1130},
+			"GLACIER":      {Objects: 2, Bytes: 400},
+			"DEEP_ARCHIVE": {Objects: 1, Bytes: 5000},
+		},
+	}
+	if !reflect.DeepEqual(tally, want) {
+		t.Errorf("Walk() tally = %+v, want %+v", tally, want)
+	}
+	if tally.Versions() != 9 || tally.Bytes() != 6530 {
+		t.Errorf("Tally.Versions(), Tally.Bytes() = %d, %d", tally.Versions(), tally.Bytes())
+	}
+	if got := tally.SortedStorageClasses(); !reflect.DeepEqual(got, []string{"DEEP_ARCHIVE", "STANDARD", "GLACIER"}) {
+		t.Errorf("Tally.SortedStorageClasses() = %v", got)
+	}
+
+	if err := Walk(context.Background(), s3ServiceMock{failShard: "logs/"}, "bucket", "", 2, func([]s3.ObjectVersion) {}); err == nil {
+		t.Errorf("Walk() error = nil, want error")
+	}
+}
+
+func TestTally_Merge(t *testing.T) {
+	a, b := NewTally(), NewTally()
+	a.Add(version("a", "1", true, 10, "STANDARD"))
+	b.Add(version("b", "1", false, 20, "STANDARD"))
+	b.Add(deleteMarker("b", "2"))
+	a.Merge(b)
+
+	want := &Tally{
+		Current:        Counts{Objects: 1, Bytes: 10},
+		Noncurrent:     Counts{Objects: 1, Bytes: 20},
+		DeleteMarkers:  1,
+		StorageClasses: map[string]Counts{"STANDARD": {Objects: 2, Bytes: 30}},
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("Tally.Merge() = %+v, want %+v", a, want)
+	}
+}
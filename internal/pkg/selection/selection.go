@@ -0,0 +1,108 @@
+package selection
+
+import (
+	"sort"
+	"strings"
+)
+
+// Set is a set of key prefixes and individual keys of a bucket, such as those marked for deletion in the prefix
+// browser. An empty Set selects nothing.
+type Set struct {
+	// Prefixes selects every key starting with one of the prefixes
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Keys selects individual keys
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Empty returns true if nothing is selected
+func (s Set) Empty() bool {
+	return len(s.Prefixes) == 0 && len(s.Keys) == 0
+}
+
+// Len returns the number of prefixes and keys selected
+func (s Set) Len() int {
+	return len(s.Prefixes) + len(s.Keys)
+}
+
+// HasPrefix returns true if `prefix` itself is selected
+func (s Set) HasPrefix(prefix string) bool {
+	return contains(s.Prefixes, prefix)
+}
+
+// HasKey returns true if `key` itself is selected
+func (s Set) HasKey(key string) bool {
+	return contains(s.Keys, key)
+}
+
+// Covers returns true if `key` (or every key starting with `key`, if it is a prefix) is selected by one of the
+// selected prefixes
+func (s Set) Covers(key string) bool {
+	for _, prefix := range s.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if `key` is selected
+func (s Set) Matches(key string) bool {
+	return s.HasKey(key) || s.Covers(key)
+}
+
+// TogglePrefix selects `prefix` if it is not selected, and deselects it otherwise
+func (s *Set) TogglePrefix(prefix string) {
+	s.Prefixes = toggle(s.Prefixes, prefix)
+}
+
+// ToggleKey selects `key` if it is not selected, and deselects it otherwise
+func (s *Set) ToggleKey(key string) {
+	s.Keys = toggle(s.Keys, key)
+}
+
+// Normalized returns the set sorted, without prefixes and keys already covered by another selected prefix, so each
+// selected key is only listed once
+func (s Set) Normalized() Set {
+	prefixes := append([]string{}, s.Prefixes...)
+	sort.Strings(prefixes)
+
+	// a prefix sorts directly before the prefixes it covers
+	result := Set{}
+	for _, prefix := range prefixes {
+		if n := len(result.Prefixes); n > 0 && strings.HasPrefix(prefix, result.Prefixes[n-1]) {
+			continue
+		}
+		result.Prefixes = append(result.Prefixes, prefix)
+	}
+	for _, key := range s.Keys {
+		if !result.Covers(key) && !result.HasKey(key) {
+			result.Keys = append(result.Keys, key)
+		}
+	}
+	sort.Strings(result.Keys)
+
+	return result
+}
+
+// String returns the selected prefixes and keys, separated by commas
+func (s Set) String() string {
+	return strings.Join(append(append([]string{}, s.Prefixes...), s.Keys...), ", ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func toggle(values []string, value string) []string {
+	for i, v := range values {
+		if v == value {
+			return append(values[:i:i], values[i+1:]...)
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,60 @@
+package selection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSet_Toggle(t *testing.T) {
+	var s Set
+	if !s.Empty() {
+		t.Errorf("zero Set is not empty")
+	}
+
+	s.TogglePrefix("logs/")
+	s.ToggleKey("index.html")
+	s.TogglePrefix("tmp/")
+	if s.Len() != 3 || !s.HasPrefix("logs/") || !s.HasKey("index.html") {
+		t.Errorf("Set = %+v after toggling on", s)
+	}
+
+	s.TogglePrefix("logs/")
+	s.ToggleKey("index.html")
+	if want := (Set{Prefixes: []string{"tmp/"}, Keys: []string{}}); !reflect.DeepEqual(s, want) {
+		t.Errorf("Set = %+v after toggling off, want %+v", s, want)
+	}
+}
+
+func TestSet_Matches(t *testing.T) {
+	s := Set{Prefixes: []string{"logs/2024/"}, Keys: []string{"index.html"}}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "index.html", want: true},
+		{key: "index.html.bak", want: false},
+		{key: "logs/2024/01/app.log", want: true},
+		{key: "logs/2023/12/app.log", want: false},
+		{key: "logs/", want: false},
+	}
+	for _, tt := range tests {
+		if got := s.Matches(tt.key); got != tt.want {
+			t.Errorf("Set.Matches(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSet_Normalized(t *testing.T) {
+	s := Set{
+		Prefixes: []string{"logs/2024/", "tmp/", "logs/", "logs/2024/01/"},
+		Keys:     []string{"logs/app.log", "z.txt", "a.txt", "tmp/x"},
+	}
+	want := Set{Prefixes: []string{"logs/", "tmp/"}, Keys: []string{"a.txt", "z.txt"}}
+	if got := s.Normalized(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Set.Normalized() = %+v, want %+v", got, want)
+	}
+	if got := want.String(); got != "logs/, tmp/, a.txt, z.txt" {
+		t.Errorf("Set.String() = %q", got)
+	}
+}
@@ -0,0 +1,268 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectPath is the configuration file of the current directory
+const ProjectPath = ".s3-nuke.yaml"
+
+// DefaultPaths are the configuration files loaded by s3-nuke, in order. Settings in later files override earlier ones.
+var DefaultPaths = []string{
+	"~/.config/s3-nuke/config.yaml",
+	ProjectPath,
+}
+
+// ProfileFlag is the name of the command line flag used to select a named profile
+const ProfileFlag = "config-profile"
+
+// SafetyFlags are the flags which weaken or choose the safety checks of a nuke. They cannot be given a default in
+// a configuration file, so that they are only ever in effect when passed on the command line.
+var SafetyFlags = []string{
+	"override-protection",
+	"protection-config",
+	"project-protection",
+	"confirm-account",
+}
+
+// Config contains the settings loaded from s3-nuke configuration files.
+//
+// Any command line flag except the SafetyFlags can be given a default value by using the flag name as a key, e.g.
+//
+//	concurrency: 10
+//	aws-endpoint: http://localhost:4566
+//	protection:
+//	  deny_patterns: ["prod-*"]
+//	challenges:
+//	  rules:
+//	    - challenge: totp
+//	      tags: {env: prod}
+//	profiles:
+//	  prod:
+//	    profile: prod-admin
+//	    concurrency: 2
+type Config struct {
+	// Flags contains default flag values keyed by flag name
+	Flags map[string]interface{}
+	// Protection contains the protection policy settings, in the order they should be applied
+	Protection []*yaml.Node
+	// ProtectionPaths contains the path of the file each of the Protection settings was loaded from
+	ProtectionPaths []string
+	// Challenges contains the confirmation challenge settings, in the order they should be applied
+	Challenges []*yaml.Node
+	// Profiles contains named sets of settings which override the top level settings when selected
+	Profiles map[string]*Config
+
+	// values contains every value given to each flag, in the order they were applied
+	values map[string][]interface{}
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	raw := map[string]yaml.Node{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	c.Flags = map[string]interface{}{}
+	c.values = map[string][]interface{}{}
+	for key, node := range raw {
+		switch key {
+		case "profiles":
+			profiles := map[string]*Config{}
+			if err := node.Decode(&profiles); err != nil {
+				return err
+			}
+			for name, profile := range profiles {
+				if len(profile.Profiles) > 0 {
+					return fmt.Errorf("profile %s: profiles cannot be nested", name)
+				}
+			}
+			c.Profiles = profiles
+		case "protection":
+			n := node
+			c.Protection = []*yaml.Node{&n}
+		case "challenges":
+			n := node
+			c.Challenges = []*yaml.Node{&n}
+		default:
+			var v interface{}
+			if err := node.Decode(&v); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			c.Flags[key] = v
+			c.values[key] = []interface{}{v}
+		}
+	}
+
+	return nil
+}
+
+// Load reads and merges the configuration files at `paths`. Files which do not exist are skipped.
+func Load(paths ...string) (*Config, error) {
+	config := &Config{
+		Flags:    map[string]interface{}{},
+		Profiles: map[string]*Config{},
+		values:   map[string][]interface{}{},
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(kong.ExpandPath(path))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file := &Config{}
+		if err := yaml.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("could not parse config file %s: %w", path, err)
+		}
+		file.setPath(path)
+		config.merge(file)
+	}
+
+	return config, nil
+}
+
+// setPath records `path` as the file the protection settings of c and its profiles were loaded from
+func (c *Config) setPath(path string) {
+	c.ProtectionPaths = make([]string, len(c.Protection))
+	for i := range c.Protection {
+		c.ProtectionPaths[i] = path
+	}
+	for _, profile := range c.Profiles {
+		profile.setPath(path)
+	}
+}
+
+// merge applies the settings from `other` on top of c
+func (c *Config) merge(other *Config) {
+	for key, value := range other.Flags {
+		c.Flags[key] = value
+	}
+	for key, values := range other.values {
+		c.values[key] = append(c.values[key], values...)
+	}
+	c.Protection = append(c.Protection, other.Protection...)
+	c.ProtectionPaths = append(c.ProtectionPaths, other.ProtectionPaths...)
+	c.Challenges = append(c.Challenges, other.Challenges...)
+	for name, profile := range other.Profiles {
+		existing, ok := c.Profiles[name]
+		if !ok {
+			existing = &Config{Flags: map[string]interface{}{}, values: map[string][]interface{}{}}
+			c.Profiles[name] = existing
+		}
+		existing.merge(profile)
+	}
+}
+
+// Values returns every value given to `flag` by the configuration files, including those overridden by a later file
+// or by the selected profile, in the order they were applied
+func (c *Config) Values(flag string) []interface{} {
+	return c.values[flag]
+}
+
+// ProfileNames returns the sorted names of all profiles
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the settings for the named profile layered on top of the top level settings.
+// An empty name returns the top level settings.
+func (c *Config) Profile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown config profile %q (available profiles: %v)", name, c.ProfileNames())
+	}
+
+	result := &Config{
+		Flags:    map[string]interface{}{},
+		Profiles: map[string]*Config{},
+		values:   map[string][]interface{}{},
+	}
+	result.merge(&Config{Flags: c.Flags, values: c.values, Protection: c.Protection, ProtectionPaths: c.ProtectionPaths, Challenges: c.Challenges})
+	result.merge(profile)
+
+	return result, nil
+}
+
+// DecodeProtection decodes the protection settings into `policy`, leaving any settings not present in the configuration untouched
+func (c *Config) DecodeProtection(policy interface{}) error {
+	for _, node := range c.Protection {
+		if err := node.Decode(policy); err != nil {
+			return fmt.Errorf("could not parse protection settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// DecodeChallenges decodes the confirmation challenge settings into `policy`, leaving any settings not present in the configuration untouched
+func (c *Config) DecodeChallenges(policy interface{}) error {
+	for _, node := range c.Challenges {
+		if err := node.Decode(policy); err != nil {
+			return fmt.Errorf("could not parse challenges settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// Resolver returns a kong.Resolver which provides flag values from the configuration.
+//
+// The profile selected with the ProfileFlag flag is applied on top of the top level settings. Values from
+// the configuration are only used for flags which were not set on the command line or through an environment
+// variable, giving the precedence: flags, then environment, then configuration file.
+//
+// Setting any of the SafetyFlags in the configuration is an error.
+func (c *Config) Resolver() kong.Resolver {
+	return kong.ResolverFunc(func(kctx *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) {
+		profile, err := c.Profile(selectedProfile(kctx))
+		if err != nil {
+			return nil, err
+		}
+
+		value, ok := profile.Flags[flag.Name]
+		if !ok {
+			return nil, nil
+		}
+		if slices.Contains(SafetyFlags, flag.Name) {
+			return nil, fmt.Errorf("%s cannot be set in a config file, pass --%s on the command line instead", flag.Name, flag.Name)
+		}
+
+		for _, env := range flag.Tag.Envs {
+			if _, ok := os.LookupEnv(env); ok {
+				return nil, nil
+			}
+		}
+		return value, nil
+	})
+}
+
+// selectedProfile returns the value of the ProfileFlag flag
+func selectedProfile(kctx *kong.Context) string {
+	for _, flag := range kctx.Flags() {
+		if flag.Name == ProfileFlag {
+			if name, ok := kctx.FlagValue(flag).(string); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
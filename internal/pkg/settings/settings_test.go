@@ -0,0 +1,419 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/protection"
+)
+
+const globalConfig = `
+concurrency: 10
+aws-endpoint: http://global:4566
+protection:
+  deny_patterns: ["prod-*"]
+  protect_object_lock: false
+challenges:
+  rules:
+    - challenge: arithmetic
+      min_objects: 1000
+profiles:
+  prod:
+    profile: prod-admin
+    protection:
+      deny_patterns: ["prod-*", "billing-*"]
+  dev:
+    concurrency: 50
+`
+
+const localConfig = `
+aws-endpoint: http://local:4566
+profiles:
+  prod:
+    concurrency: 2
+    challenges:
+      rules:
+        - challenge: totp
+          tags: {env: prod}
+`
+
+func writeConfigs(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	global := filepath.Join(dir, "config.yaml")
+	local := filepath.Join(dir, ".s3-nuke.yaml")
+	if err := os.WriteFile(global, []byte(globalConfig), 0600); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	if err := os.WriteFile(local, []byte(localConfig), 0600); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	return global, local
+}
+
+func TestLoad(t *testing.T) {
+	global, local := writeConfigs(t)
+
+	t.Run("merged", func(t *testing.T) {
+		config, err := Load(global, local, filepath.Join(t.TempDir(), "missing.yaml"))
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if config.Flags["aws-endpoint"] != "http://local:4566" {
+			t.Errorf("Load() aws-endpoint = %v, want local file to override global file", config.Flags["aws-endpoint"])
+		}
+		if config.Flags["concurrency"] != 10 {
+			t.Errorf("Load() concurrency = %v, want 10", config.Flags["concurrency"])
+		}
+		if !reflect.DeepEqual(config.ProfileNames(), []string{"dev", "prod"}) {
+			t.Errorf("Load() profiles = %v", config.ProfileNames())
+		}
+		if config.Profiles["prod"].Flags["concurrency"] != 2 || config.Profiles["prod"].Flags["profile"] != "prod-admin" {
+			t.Errorf("Load() prod profile = %v, want merged profile", config.Profiles["prod"].Flags)
+		}
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+		if err := os.WriteFile(invalid, []byte("concurrency: [1"), 0600); err != nil {
+			t.Fatalf("could not write config: %v", err)
+		}
+		if _, err := Load(invalid); err == nil {
+			t.Errorf("Load() expected error")
+		}
+	})
+
+	t.Run("nested profiles", func(t *testing.T) {
+		nested := filepath.Join(t.TempDir(), "nested.yaml")
+		if err := os.WriteFile(nested, []byte("profiles:\n  a:\n    profiles:\n      b: {}\n"), 0600); err != nil {
+			t.Fatalf("could not write config: %v", err)
+		}
+		if _, err := Load(nested); err == nil {
+			t.Errorf("Load() expected error for nested profiles")
+		}
+	})
+}
+
+func TestConfig_DecodeProtection(t *testing.T) {
+	global, local := writeConfigs(t)
+	config, err := Load(global, local)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	type policy struct {
+		DenyPatterns []string `yaml:"deny_patterns"`
+		ObjectLock   bool     `yaml:"protect_object_lock"`
+		ProtectTag   string   `yaml:"protect_tag"`
+	}
+
+	tests := []struct {
+		name    string
+		profile string
+		want    policy
+	}{
+		{
+			name:    "top level",
+			profile: "",
+			want:    policy{DenyPatterns: []string{"prod-*"}, ObjectLock: false, ProtectTag: "default-tag"},
+		},
+		{
+			name:    "profile overrides",
+			profile: "prod",
+			want:    policy{DenyPatterns: []string{"prod-*", "billing-*"}, ObjectLock: false, ProtectTag: "default-tag"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := config.Profile(tt.profile)
+			if err != nil {
+				t.Fatalf("Config.Profile() error = %v", err)
+			}
+			got := policy{ObjectLock: true, ProtectTag: "default-tag"}
+			if err := profile.DecodeProtection(&got); err != nil {
+				t.Fatalf("Config.DecodeProtection() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Config.DecodeProtection() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_DecodeProtection_project(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, ".s3-nuke.yaml")
+
+	tests := []struct {
+		name    string
+		config  string
+		profile string
+		want    protection.Policy
+		wantErr bool
+	}{
+		{
+			name:   "add deny patterns",
+			config: "protection:\n  deny_patterns: [\"billing-*\"]\n  protect_object_lock: true\n",
+			want:   protection.Policy{DenyPatterns: []string{"prod-*", "billing-*"}, ProtectTag: protection.DefaultProtectTag, ReplicationSource: true, ObjectLock: true},
+		},
+		{name: "clear the protect tag", config: "protection:\n  protect_tag: \"\"\n", wantErr: true},
+		{name: "change the protect tag", config: "protection:\n  protect_tag: keep\n", wantErr: true},
+		{name: "turn off replication source protection", config: "protection:\n  protect_replication_source: false\n", wantErr: true},
+		{name: "turn off Object Lock protection in a profile", config: "profiles:\n  dev:\n    protection:\n      protect_object_lock: false\n", profile: "dev", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(project, []byte(tt.config), 0600); err != nil {
+				t.Fatalf("could not write config: %v", err)
+			}
+			config, err := Load(project)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			profile, err := config.Profile(tt.profile)
+			if err != nil {
+				t.Fatalf("Config.Profile() error = %v", err)
+			}
+			if !reflect.DeepEqual(profile.ProtectionPaths, []string{project}) {
+				t.Errorf("Config.ProtectionPaths = %v, want %v", profile.ProtectionPaths, []string{project})
+			}
+
+			got := protection.DefaultPolicy()
+			got.DenyPatterns = []string{"prod-*"}
+			err = profile.DecodeProtection(&protection.ConfigPolicy{Policy: &got})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config.DecodeProtection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Config.DecodeProtection() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Values(t *testing.T) {
+	global, local := writeConfigs(t)
+	if err := os.WriteFile(local, []byte(localConfig+"confirmation: phrase\n"), 0600); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	if err := os.WriteFile(global, []byte(globalConfig+"confirmation: arithmetic\n"), 0600); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	config, err := Load(global, local)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// a later file overrides the flag value, but every value is kept
+	if config.Flags["confirmation"] != "phrase" {
+		t.Errorf("Load() confirmation = %v, want phrase", config.Flags["confirmation"])
+	}
+	if got, want := config.Values("confirmation"), []interface{}{"arithmetic", "phrase"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Config.Values() = %v, want %v", got, want)
+	}
+	profile, err := config.Profile("prod")
+	if err != nil {
+		t.Fatalf("Config.Profile() error = %v", err)
+	}
+	if got, want := profile.Values("concurrency"), []interface{}{10, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Config.Values() for profile = %v, want %v", got, want)
+	}
+}
+
+func TestConfig_DecodeChallenges(t *testing.T) {
+	global, local := writeConfigs(t)
+	config, err := Load(global, local)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	type rule struct {
+		Challenge  string            `yaml:"challenge"`
+		MinObjects int64             `yaml:"min_objects"`
+		Tags       map[string]string `yaml:"tags"`
+	}
+	type policy struct {
+		Rules []rule `yaml:"rules"`
+	}
+
+	tests := []struct {
+		name    string
+		profile string
+		want    policy
+	}{
+		{
+			name:    "top level",
+			profile: "",
+			want:    policy{Rules: []rule{{Challenge: "arithmetic", MinObjects: 1000}}},
+		},
+		{
+			name:    "profile overrides",
+			profile: "prod",
+			want:    policy{Rules: []rule{{Challenge: "totp", Tags: map[string]string{"env": "prod"}}}},
+		},
+		{
+			name:    "profile without challenges",
+			profile: "dev",
+			want:    policy{Rules: []rule{{Challenge: "arithmetic", MinObjects: 1000}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := config.Profile(tt.profile)
+			if err != nil {
+				t.Fatalf("Config.Profile() error = %v", err)
+			}
+			var got policy
+			if err := profile.DecodeChallenges(&got); err != nil {
+				t.Fatalf("Config.DecodeChallenges() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Config.DecodeChallenges() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Resolver(t *testing.T) {
+	global, local := writeConfigs(t)
+	config, err := Load(global, local)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	type cli struct {
+		ConfigProfile string `optional:"" env:"TEST_S3_NUKE_CONFIG_PROFILE"`
+		AWSEndpoint   string `optional:"" env:"TEST_S3_NUKE_AWS_ENDPOINT"`
+		Profile       string `optional:""`
+		Concurrency   int    `optional:"" default:"5"`
+		Confirmation  string `optional:"" default:"phrase"`
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    cli
+		wantErr bool
+	}{
+		{
+			name: "config file",
+			args: []string{},
+			want: cli{AWSEndpoint: "http://local:4566", Concurrency: 10, Confirmation: "phrase"},
+		},
+		{
+			name: "flags override config file",
+			args: []string{"--concurrency=3", "--aws-endpoint=http://flag:4566"},
+			want: cli{AWSEndpoint: "http://flag:4566", Concurrency: 3, Confirmation: "phrase"},
+		},
+		{
+			name: "env overrides config file",
+			args: []string{},
+			env:  map[string]string{"TEST_S3_NUKE_AWS_ENDPOINT": "http://env:4566"},
+			want: cli{AWSEndpoint: "http://env:4566", Concurrency: 10, Confirmation: "phrase"},
+		},
+		{
+			name: "flags override env",
+			args: []string{"--aws-endpoint=http://flag:4566"},
+			env:  map[string]string{"TEST_S3_NUKE_AWS_ENDPOINT": "http://env:4566"},
+			want: cli{AWSEndpoint: "http://flag:4566", Concurrency: 10, Confirmation: "phrase"},
+		},
+		{
+			name: "profile",
+			args: []string{"--config-profile=prod"},
+			want: cli{ConfigProfile: "prod", AWSEndpoint: "http://local:4566", Profile: "prod-admin", Concurrency: 2, Confirmation: "phrase"},
+		},
+		{
+			name: "profile from env",
+			args: []string{},
+			env:  map[string]string{"TEST_S3_NUKE_CONFIG_PROFILE": "dev"},
+			want: cli{ConfigProfile: "dev", AWSEndpoint: "http://local:4566", Concurrency: 50, Confirmation: "phrase"},
+		},
+		{
+			name:    "unknown profile",
+			args:    []string{"--config-profile=staging"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got := cli{}
+			parser, err := kong.New(&got, kong.Resolvers(config.Resolver()))
+			if err != nil {
+				t.Fatalf("kong.New() error = %v", err)
+			}
+			_, err = parser.Parse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Resolver_SafetyFlags(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	config := `
+concurrency: 10
+profiles:
+  prod:
+    confirmation: bucket-name
+  unsafe:
+    override-protection: true
+  project:
+    project-protection: true
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+
+	type cli struct {
+		ConfigProfile      string `optional:""`
+		Concurrency        int    `optional:"" default:"5"`
+		Confirmation       string `optional:"" default:"phrase"`
+		OverrideProtection bool   `optional:""`
+		ProjectProtection  bool   `optional:""`
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "not selected", args: []string{}},
+		// the confirmation challenge can be raised by a config file, callers use its Values as a minimum
+		{name: "confirmation", args: []string{"--config-profile=prod"}},
+		{name: "override protection", args: []string{"--config-profile=unsafe"}, wantErr: true},
+		{name: "project protection", args: []string{"--config-profile=project"}, wantErr: true},
+		// the config file is not consulted for flags given on the command line
+		{name: "also set on the command line", args: []string{"--config-profile=unsafe", "--override-protection"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			got := cli{}
+			parser, err := kong.New(&got, kong.Resolvers(loaded.Resolver()))
+			if err != nil {
+				t.Fatalf("kong.New() error = %v", err)
+			}
+			_, err = parser.Parse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the s3-nuke tracer
+const instrumentationName = "github.com/soapiestwaffles/s3-nuke"
+
+// Options configures where traces are exported to
+type Options struct {
+	// OTLPEndpoint is the URL of an OTLP/HTTP collector, e.g. http://localhost:4318
+	OTLPEndpoint string
+	// File is the path of a file spans are written to as JSON, for offline use
+	File string
+	// ServiceVersion is recorded as the service.version resource attribute
+	ServiceVersion string
+}
+
+// Enabled returns true if any trace exporter is configured
+func (o Options) Enabled() bool {
+	return o.OTLPEndpoint != "" || o.File != ""
+}
+
+// Setup installs a global tracer provider exporting spans as configured by `opts`.
+// If no exporter is configured, tracing stays disabled and spans are not recorded.
+//
+// returns a function which flushes any buffered spans and shuts the exporters down
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if !opts.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "s3-nuke"),
+			attribute.String("service.version", opts.ServiceVersion),
+		)),
+	}
+
+	var file *os.File
+	if opts.File != "" {
+		var err error
+		file, err = os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+
+	if opts.OTLPEndpoint != "" {
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		if err != nil {
+			if file != nil {
+				_ = file.Close()
+			}
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Tracer returns the tracer used for all s3-nuke spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span called `name` as a child of any span in `ctx`
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records `err` (if any) on `span` and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
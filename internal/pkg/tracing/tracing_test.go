@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		shutdown, err := Setup(context.TODO(), Options{})
+		if err != nil {
+			t.Fatalf("Setup() error = %v", err)
+		}
+		_, span := Start(context.TODO(), "disabled")
+		if span.IsRecording() {
+			t.Errorf("Setup() spans should not be recorded when tracing is disabled")
+		}
+		End(span, nil)
+		if err := shutdown(context.TODO()); err != nil {
+			t.Errorf("shutdown() error = %v", err)
+		}
+	})
+
+	t.Run("file exporter", func(t *testing.T) {
+		defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+		path := filepath.Join(t.TempDir(), "trace.json")
+		shutdown, err := Setup(context.TODO(), Options{File: path, ServiceVersion: "test"})
+		if err != nil {
+			t.Fatalf("Setup() error = %v", err)
+		}
+
+		ctx, root := Start(context.TODO(), "run", attribute.String("bucket", "scratch"))
+		_, child := Start(ctx, "DeleteObjects", attribute.Int("batch.size", 1000))
+		End(child, errors.New("simulated failure"))
+		End(root, nil)
+
+		if err := shutdown(context.TODO()); err != nil {
+			t.Fatalf("shutdown() error = %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("could not read trace file: %v", err)
+		}
+		for _, want := range []string{`"Name":"run"`, `"Name":"DeleteObjects"`, "scratch", "simulated failure", "s3-nuke"} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("trace file does not contain %s", want)
+			}
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		if _, err := Setup(context.TODO(), Options{File: filepath.Join(t.TempDir(), "missing", "trace.json")}); err == nil {
+			t.Errorf("Setup() expected error")
+		}
+	})
+}
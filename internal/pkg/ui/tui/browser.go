@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/manifoldco/promptui"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/browse"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+)
+
+// PrefixSource lists the prefixes of a bucket for BrowsePrefixes. It is implemented by browse.Source.
+type PrefixSource interface {
+	// List lists the prefixes and objects directly under `prefix`
+	List(prefix string) (browse.Listing, error)
+	// Estimate returns the estimated number of objects under `prefix` found so far, it must not block
+	Estimate(prefix string) browse.Estimate
+}
+
+// Kinds of items shown in the prefix browser
+const (
+	browseDone = iota
+	browseCancel
+	browseUp
+	browseMarkAll
+	browsePrefix
+	browseObject
+	browseTruncated
+)
+
+// browserItem is a line of the prefix browser
+type browserItem struct {
+	kind int
+	// name is the prefix or key relative to the prefix being browsed
+	name string
+	// path is the full prefix or key
+	path   string
+	size   int64
+	marked bool
+	// covered is set if the item is selected by a marked parent prefix
+	covered bool
+	count   int
+
+	estimate func(prefix string) browse.Estimate
+}
+
+// Label returns the text shown for the item
+func (i browserItem) Label() string {
+	mark := "[ ]"
+	switch {
+	case i.covered:
+		mark = "[~]"
+	case i.marked:
+		mark = "[x]"
+	}
+
+	switch i.kind {
+	case browseDone:
+		return fmt.Sprintf("✅ Done (%d marked)", i.count)
+	case browseCancel:
+		return "❌ Cancel"
+	case browseUp:
+		return "⬆️  .."
+	case browseMarkAll:
+		if i.path == "" {
+			return mark + " everything in the bucket"
+		}
+		return fmt.Sprintf("%s everything under %s", mark, i.path)
+	case browsePrefix:
+		return fmt.Sprintf("%s 📁 %s  (%s)", mark, i.name, formatEstimate(i.estimate(i.path)))
+	case browseObject:
+		return fmt.Sprintf("%s    %s  (%s)", mark, i.name, humanize.IBytes(uint64(i.size)))
+	}
+	return "   ... more entries not shown"
+}
+
+// formatEstimate describes the estimated number of objects under a prefix
+func formatEstimate(e browse.Estimate) string {
+	switch {
+	case !e.Loaded:
+		return "counting..."
+	case e.Err != nil:
+		return "count unavailable"
+	case e.More:
+		return fmt.Sprintf("~%s+ objects", humanize.Comma(int64(e.Objects)))
+	}
+	return fmt.Sprintf("%s objects", humanize.Comma(int64(e.Objects)))
+}
+
+// browserItems returns the items of the prefix browser for the listing of `prefix`
+func browserItems(prefix string, listing browse.Listing, set selection.Set, estimate func(prefix string) browse.Estimate) []browserItem {
+	items := []browserItem{
+		{kind: browseDone, count: set.Len()},
+		{kind: browseCancel},
+	}
+	if prefix != "" {
+		items = append(items, browserItem{kind: browseUp})
+	}
+	items = append(items, browserItem{
+		kind:    browseMarkAll,
+		path:    prefix,
+		marked:  set.HasPrefix(prefix),
+		covered: !set.HasPrefix(prefix) && set.Covers(prefix),
+	})
+
+	for _, p := range listing.Prefixes {
+		items = append(items, browserItem{
+			kind:     browsePrefix,
+			name:     strings.TrimPrefix(p, prefix),
+			path:     p,
+			marked:   set.HasPrefix(p),
+			covered:  !set.HasPrefix(p) && set.Covers(p),
+			estimate: estimate,
+		})
+	}
+	for _, o := range listing.Objects {
+		items = append(items, browserItem{
+			kind:    browseObject,
+			name:    strings.TrimPrefix(o.Key, prefix),
+			path:    o.Key,
+			size:    o.Size,
+			marked:  set.HasKey(o.Key),
+			covered: !set.HasKey(o.Key) && set.Covers(o.Key),
+		})
+	}
+	if listing.Truncated {
+		items = append(items, browserItem{kind: browseTruncated})
+	}
+
+	return items
+}
+
+// BrowsePrefixes lets the user browse the prefixes of `bucket` listed by `source` and mark prefixes and objects.
+// Entering a prefix opens it, and entering an object marks or unmarks it; a whole prefix is marked from inside it.
+//
+// returns:
+//   `selection.Set` - the marked prefixes and objects, empty if the user canceled
+//   `error` - not nil if a prefix could not be listed
+func BrowsePrefixes(bucket string, source PrefixSource) (selection.Set, error) {
+	set := selection.Set{}
+	prefix := ""
+	listings := map[string]browse.Listing{}
+	cursor := 0
+
+	for {
+		listing, ok := listings[prefix]
+		if !ok {
+			var err error
+			listing, err = source.List(prefix)
+			if err != nil {
+				return selection.Set{}, fmt.Errorf("could not list s3://%s/%s: %w", bucket, prefix, err)
+			}
+			listings[prefix] = listing
+		}
+
+		items := browserItems(prefix, listing, set, source.Estimate)
+		prompt := promptui.Select{
+			Label: fmt.Sprintf("s3://%s/%s", bucket, prefix),
+			Items: items,
+			Templates: &promptui.SelectTemplates{
+				Label:    "{{ \"---\" | faint }} {{ . | blue | bold }} {{ \"---\" | faint }}",
+				Active:   "▸ {{ .Label | cyan }}",
+				Inactive: "  {{ .Label }}",
+				Selected: "▸ {{ .Label | bold | green }}",
+			},
+			Size: 15,
+			Searcher: func(input string, index int) bool {
+				return strings.Contains(strings.ToLower(items[index].name), strings.ToLower(input))
+			},
+			CursorPos: cursor,
+			Stdout:    &bellSkipper{},
+		}
+
+		i, _, err := prompt.Run()
+		if err != nil {
+			return selection.Set{}, nil
+		}
+
+		item := items[i]
+		cursor = i
+		switch item.kind {
+		case browseDone:
+			return set.Normalized(), nil
+		case browseCancel:
+			return selection.Set{}, nil
+		case browseUp:
+			prefix = parentPrefix(prefix)
+			cursor = 0
+		case browseMarkAll:
+			set.TogglePrefix(item.path)
+		case browsePrefix:
+			prefix = item.path
+			cursor = 0
+		case browseObject:
+			set.ToggleKey(item.path)
+		}
+	}
+}
+
+// parentPrefix returns the prefix one level above `prefix`
+func parentPrefix(prefix string) string {
+	trimmed := strings.TrimSuffix(prefix, "/")
+	i := strings.LastIndex(trimmed, "/")
+	if i < 0 {
+		return ""
+	}
+	return trimmed[:i+1]
+}
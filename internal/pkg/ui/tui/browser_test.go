@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/browse"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func TestBrowserItems(t *testing.T) {
+	listing := browse.Listing{
+		Prefixes:  []string{"logs/2024/", "logs/old/"},
+		Objects:   []s3.ObjectSummary{{Key: "logs/app.log", Size: 2048}, {Key: "logs/app.log.1", Size: 1}},
+		Truncated: true,
+	}
+	set := selection.Set{Prefixes: []string{"logs/old/"}, Keys: []string{"logs/app.log"}}
+	estimates := map[string]browse.Estimate{
+		"logs/2024/": {Loaded: true, Objects: 1000, More: true},
+		"logs/old/":  {},
+	}
+	estimate := func(prefix string) browse.Estimate { return estimates[prefix] }
+
+	got := []string{}
+	for _, item := range browserItems("logs/", listing, set, estimate) {
+		got = append(got, item.Label())
+	}
+	want := []string{
+		"✅ Done (2 marked)",
+		"❌ Cancel",
+		"⬆️  ..",
+		"[ ] everything under logs/",
+		"[ ] 📁 2024/  (~1,000+ objects)",
+		"[x] 📁 old/  (counting...)",
+		"[x]    app.log  (2.0 KiB)",
+		"[ ]    app.log.1  (1 B)",
+		"   ... more entries not shown",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("browserItems() labels = %q, want %q", got, want)
+	}
+
+	covered := browserItems("logs/old/", browse.Listing{}, selection.Set{Prefixes: []string{"logs/"}}, estimate)
+	if label := covered[3].Label(); label != "[~] everything under logs/old/" {
+		t.Errorf("browserItems() covered prefix label = %q", label)
+	}
+}
+
+func TestFormatEstimate(t *testing.T) {
+	tests := []struct {
+		estimate browse.Estimate
+		want     string
+	}{
+		{estimate: browse.Estimate{}, want: "counting..."},
+		{estimate: browse.Estimate{Loaded: true, Err: errors.New("AccessDenied")}, want: "count unavailable"},
+		{estimate: browse.Estimate{Loaded: true, Objects: 12}, want: "12 objects"},
+		{estimate: browse.Estimate{Loaded: true, Objects: 1000, More: true}, want: "~1,000+ objects"},
+	}
+	for _, tt := range tests {
+		if got := formatEstimate(tt.estimate); got != tt.want {
+			t.Errorf("formatEstimate(%+v) = %q, want %q", tt.estimate, got, tt.want)
+		}
+	}
+}
+
+func TestParentPrefix(t *testing.T) {
+	tests := map[string]string{
+		"":              "",
+		"logs/":         "",
+		"logs/2024/":    "logs/",
+		"logs/2024/01/": "logs/2024/",
+	}
+	for prefix, want := range tests {
+		if got := parentPrefix(prefix); got != want {
+			t.Errorf("parentPrefix(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
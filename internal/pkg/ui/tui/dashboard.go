@@ -0,0 +1,414 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/dustin/go-humanize"
+	"github.com/guptarohit/asciigraph"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"golang.org/x/term"
+)
+
+const (
+	// dashboardHistory is the number of throughput samples shown in the sparkline, one per second
+	dashboardHistory = 60
+	// dashboardRecentFailures is the number of recent delete failures listed
+	dashboardRecentFailures = 8
+	// dashboardMaxWorkerRows is the number of workers listed before the rest are summarized
+	dashboardMaxWorkerRows = 16
+)
+
+// DashboardQueue is a queue of the nuke pipeline shown on the dashboard
+type DashboardQueue struct {
+	Name     string
+	Depth    func() int
+	Capacity int
+}
+
+// DashboardControl pauses and resumes the delete workers and changes how many run at once. It is implemented by
+// workers.Gate.
+type DashboardControl interface {
+	Pause()
+	Resume()
+	Paused() bool
+	SetLimit(limit int)
+	Limit() int
+	Active() int
+}
+
+// DashboardOptions configures a Dashboard
+type DashboardOptions struct {
+	Bucket string
+	// Progress supplies the listed and deleted counts, its progress bar should be written to io.Discard
+	Progress *NukeProgress
+	// Workers is the number of delete workers started, the most the concurrency can be raised to
+	Workers int
+	Queues  []DashboardQueue
+	Control DashboardControl
+	// Interrupt is called when Ctrl-C or q is pressed
+	Interrupt func()
+}
+
+// Dashboard is a full-screen view of a running nuke: per-worker status, listing and deleting throughput, queue
+// depths and delete failures by error code. Keys pause and resume the delete workers and change the concurrency.
+type Dashboard struct {
+	w    io.Writer
+	opts DashboardOptions
+
+	mu       sync.Mutex
+	start    time.Time
+	workers  []*DashboardWorker
+	listing  []float64
+	deleting []float64
+	sampled  time.Time
+	listed   int64
+	deleted  int64
+	failures map[string]int64
+	recent   []dashboardFailure
+	message  string
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	restore func() error
+}
+
+type dashboardFailure struct {
+	at      time.Time
+	worker  int
+	failure s3.DeleteError
+}
+
+// NewDashboard returns a Dashboard writing to `w`
+func NewDashboard(w io.Writer, opts DashboardOptions) *Dashboard {
+	now := time.Now()
+	d := &Dashboard{
+		w:        w,
+		opts:     opts,
+		start:    now,
+		sampled:  now,
+		failures: map[string]int64{},
+		stop:     make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		d.workers = append(d.workers, &DashboardWorker{d: d, index: i})
+	}
+	return d
+}
+
+// DashboardAvailable returns true if `in` and `out` are terminals the dashboard can take over
+func DashboardAvailable(in *os.File, out *os.File) bool {
+	return term.IsTerminal(int(in.Fd())) && term.IsTerminal(int(out.Fd()))
+}
+
+// Worker returns the recorder of delete worker `index`, pass it to workers.S3DeleteFromChannel
+func (d *Dashboard) Worker(index int) *DashboardWorker {
+	return d.workers[index]
+}
+
+// Start puts the terminal `in` into raw mode to read keys, switches to the alternate screen and redraws the dashboard
+// every second until Close is called
+func (d *Dashboard) Start(in *os.File) error {
+	fd := int(in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	d.restore = func() error { return term.Restore(fd, state) }
+
+	// switch to the alternate screen and hide the cursor
+	fmt.Fprint(d.w, "\x1b[?1049h\x1b[?25l")
+	d.draw(time.Now())
+
+	// the key reader is left blocked on `in` once the dashboard is closed
+	go d.readKeys(in)
+
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				d.sample(now)
+				d.draw(now)
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops redrawing the dashboard and gives the terminal back
+func (d *Dashboard) Close() error {
+	if d.restore == nil {
+		return nil
+	}
+	close(d.stop)
+	d.stopped.Wait()
+	fmt.Fprint(d.w, "\x1b[?25h\x1b[?1049l")
+	restore := d.restore
+	d.restore = nil
+	return restore()
+}
+
+// readKeys handles the keys typed on `in`
+func (d *Dashboard) readKeys(in io.Reader) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range buf[:n] {
+			d.handleKey(key)
+		}
+		select {
+		case <-d.stop:
+			return
+		default:
+			d.draw(time.Now())
+		}
+	}
+}
+
+// handleKey applies the action bound to `key`
+func (d *Dashboard) handleKey(key byte) {
+	control := d.opts.Control
+	message := ""
+	switch key {
+	case 'p':
+		control.Pause()
+		message = "paused, in-flight requests will finish"
+	case 'r':
+		control.Resume()
+		message = "resumed"
+	case '+', '=':
+		limit := control.Limit() + 1
+		if limit > d.opts.Workers {
+			limit = d.opts.Workers
+		}
+		control.SetLimit(limit)
+		message = fmt.Sprintf("concurrency set to %d", limit)
+	case '-', '_':
+		control.SetLimit(control.Limit() - 1)
+		message = fmt.Sprintf("concurrency set to %d", control.Limit())
+	case 'q', 3: // 3 is Ctrl-C in raw mode
+		message = "stopping..."
+		if d.opts.Interrupt != nil {
+			d.opts.Interrupt()
+		}
+	default:
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.message = message
+}
+
+// sample records the listing and deleting throughput since the last sample
+func (d *Dashboard) sample(now time.Time) {
+	listed, deleted := d.opts.Progress.Counts()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elapsed := now.Sub(d.sampled).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	d.listing = appendSample(d.listing, float64(listed-d.listed)/elapsed)
+	d.deleting = appendSample(d.deleting, float64(deleted-d.deleted)/elapsed)
+	d.listed, d.deleted, d.sampled = listed, deleted, now
+}
+
+// appendSample appends `value` to `samples`, keeping the last dashboardHistory samples
+func appendSample(samples []float64, value float64) []float64 {
+	samples = append(samples, value)
+	if len(samples) > dashboardHistory {
+		samples = samples[len(samples)-dashboardHistory:]
+	}
+	return samples
+}
+
+// draw redraws the whole screen
+func (d *Dashboard) draw(now time.Time) {
+	// raw mode turns off translating "\n" to "\r\n", and each line clears what was left of the previous frame
+	frame := strings.ReplaceAll(d.render(now), "\n", "\x1b[K\r\n")
+	fmt.Fprint(d.w, "\x1b[H"+frame+"\x1b[K\x1b[J")
+}
+
+// render returns the dashboard as text
+func (d *Dashboard) render(now time.Time) string {
+	listed, deleted, listingDone, estimate := d.opts.Progress.state()
+	control := d.opts.Control
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "💣 s3-nuke dashboard: s3://%s    elapsed %s\n", d.opts.Bucket, now.Sub(d.start).Round(time.Second))
+	fmt.Fprintln(&b, "")
+
+	listing := "still listing"
+	switch {
+	case listingDone:
+		listing = "listing done"
+	case estimate > listed:
+		listing = fmt.Sprintf("of ~%s estimated", humanize.Comma(estimate))
+	}
+	var failed int64
+	for _, count := range d.failures {
+		failed += count
+	}
+	fmt.Fprintf(&b, "listed %s (%s)    deleted %s    failed %s\n", humanize.Comma(listed), listing, humanize.Comma(deleted), humanize.Comma(failed))
+
+	status := "running"
+	if control.Paused() {
+		status = "PAUSED"
+	}
+	fmt.Fprintf(&b, "status %s    concurrency %d of %d workers (%d deleting)\n", status, control.Limit(), d.opts.Workers, control.Active())
+	fmt.Fprintln(&b, "keys: [p] pause  [r] resume  [+/-] concurrency  [q] stop")
+	if d.message != "" {
+		fmt.Fprintln(&b, "»", d.message)
+	}
+
+	fmt.Fprintln(&b, "")
+	fmt.Fprintln(&b, "throughput (objects/s, last minute)")
+	if len(d.listing) < 2 {
+		fmt.Fprintln(&b, "  collecting...")
+	} else {
+		fmt.Fprintln(&b, asciigraph.PlotMany([][]float64{d.listing, d.deleting},
+			asciigraph.Height(6),
+			asciigraph.Width(dashboardHistory),
+			asciigraph.LowerBound(0),
+			asciigraph.SeriesColors(asciigraph.Cyan, asciigraph.Red),
+			asciigraph.SeriesLegends("listing", "deleting")))
+	}
+
+	fmt.Fprintln(&b, "")
+	fmt.Fprintln(&b, "queues")
+	for _, queue := range d.opts.Queues {
+		depth := queue.Depth()
+		fmt.Fprintf(&b, "  %-16s %s %s / %s\n", queue.Name, queueBar(depth, queue.Capacity), humanize.Comma(int64(depth)), humanize.Comma(int64(queue.Capacity)))
+	}
+
+	fmt.Fprintln(&b, "")
+	fmt.Fprintln(&b, "workers")
+	for i, w := range d.workers {
+		if i == dashboardMaxWorkerRows {
+			fmt.Fprintf(&b, "  ... %d more\n", len(d.workers)-i)
+			break
+		}
+		fmt.Fprintln(&b, " ", w.status(now, control.Paused()))
+	}
+
+	fmt.Fprintln(&b, "")
+	fmt.Fprintln(&b, "delete failures by code")
+	if len(d.failures) == 0 {
+		fmt.Fprintln(&b, "  none")
+	}
+	codes := make([]string, 0, len(d.failures))
+	for code := range d.failures {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if d.failures[codes[i]] != d.failures[codes[j]] {
+			return d.failures[codes[i]] > d.failures[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	for _, code := range codes {
+		fmt.Fprintf(&b, "  %-24s %s\n", code, humanize.Comma(d.failures[code]))
+	}
+	for _, f := range d.recent {
+		fmt.Fprintf(&b, "  %s #%d %s %s (%s) %s\n", f.at.Format(time.TimeOnly), f.worker, f.failure.Code,
+			aws.ToString(f.failure.Key), aws.ToString(f.failure.VersionID), f.failure.Message)
+	}
+
+	return b.String()
+}
+
+// queueBar draws how full a queue is
+func queueBar(depth int, capacity int) string {
+	const width = 20
+	filled := 0
+	if capacity > 0 {
+		filled = depth * width / capacity
+	}
+	if filled > width {
+		filled = width
+	}
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("·", width-filled) + "]"
+}
+
+// DashboardWorker records the DeleteObjects requests of one delete worker for the dashboard. It implements
+// workers.DeleteRecorder.
+type DashboardWorker struct {
+	d     *Dashboard
+	index int
+
+	busy     bool
+	since    time.Time
+	batches  int64
+	deleted  int64
+	failed   int64
+	duration time.Duration
+}
+
+// DeleteStarted records the start of a DeleteObjects request
+func (w *DashboardWorker) DeleteStarted() {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	w.busy = true
+	w.since = time.Now()
+}
+
+// DeleteFinished records the outcome of a DeleteObjects request
+func (w *DashboardWorker) DeleteFinished(deleted []s3.ObjectIdentifier, failed []s3.DeleteError) {
+	now := time.Now()
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+
+	w.busy = false
+	w.duration = now.Sub(w.since)
+	w.since = now
+	w.batches++
+	w.deleted += int64(len(deleted))
+	w.failed += int64(len(failed))
+
+	for _, f := range failed {
+		w.d.failures[f.Code]++
+		w.d.recent = append(w.d.recent, dashboardFailure{at: now, worker: w.index, failure: f})
+	}
+	if len(w.d.recent) > dashboardRecentFailures {
+		w.d.recent = w.d.recent[len(w.d.recent)-dashboardRecentFailures:]
+	}
+}
+
+// status describes the worker, the caller must hold the dashboard lock
+func (w *DashboardWorker) status(now time.Time, paused bool) string {
+	state := "idle"
+	switch {
+	case w.busy:
+		state = fmt.Sprintf("deleting %s", now.Sub(w.since).Round(100*time.Millisecond))
+	case paused:
+		state = "paused"
+	}
+	last := "-"
+	if w.batches > 0 {
+		last = w.duration.Round(10 * time.Millisecond).String()
+	}
+	return fmt.Sprintf("#%-3d %-16s batches %-6s deleted %-10s failed %-8s last request %s",
+		w.index, state, humanize.Comma(w.batches), humanize.Comma(w.deleted), humanize.Comma(w.failed), last)
+}
@@ -0,0 +1,125 @@
+package tui
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// dashboardControlMock records the actions taken by dashboard keys
+type dashboardControlMock struct {
+	paused bool
+	limit  int
+}
+
+func (c *dashboardControlMock) Pause()             { c.paused = true }
+func (c *dashboardControlMock) Resume()            { c.paused = false }
+func (c *dashboardControlMock) Paused() bool       { return c.paused }
+func (c *dashboardControlMock) SetLimit(limit int) { c.limit = max(limit, 1) }
+func (c *dashboardControlMock) Limit() int         { return c.limit }
+func (c *dashboardControlMock) Active() int        { return 1 }
+
+func newTestDashboard() (*Dashboard, *dashboardControlMock, *NukeProgress, *bool) {
+	control := &dashboardControlMock{limit: 2}
+	progress := NewNukeProgress(io.Discard, 5000)
+	interrupted := false
+	d := NewDashboard(io.Discard, DashboardOptions{
+		Bucket:    "test-bucket",
+		Progress:  progress,
+		Workers:   3,
+		Queues:    []DashboardQueue{{Name: "delete queue", Depth: func() int { return 50 }, Capacity: 100}},
+		Control:   control,
+		Interrupt: func() { interrupted = true },
+	})
+	return d, control, progress, &interrupted
+}
+
+func TestDashboard_HandleKey(t *testing.T) {
+	d, control, _, interrupted := newTestDashboard()
+
+	tests := []struct {
+		key        byte
+		wantPaused bool
+		wantLimit  int
+	}{
+		{key: 'p', wantPaused: true, wantLimit: 2},
+		{key: 'r', wantPaused: false, wantLimit: 2},
+		{key: '+', wantLimit: 3},
+		{key: '+', wantLimit: 3}, // never more than the workers started
+		{key: '-', wantLimit: 2},
+		{key: '-', wantLimit: 1},
+		{key: '-', wantLimit: 1},
+		{key: 'x', wantLimit: 1},
+	}
+	for _, tt := range tests {
+		d.handleKey(tt.key)
+		if control.paused != tt.wantPaused || control.limit != tt.wantLimit {
+			t.Errorf("after key %q: paused = %v, limit = %d, want %v, %d", tt.key, control.paused, control.limit, tt.wantPaused, tt.wantLimit)
+		}
+	}
+
+	d.handleKey(3)
+	if !*interrupted {
+		t.Errorf("Ctrl-C did not interrupt the nuke")
+	}
+}
+
+func TestDashboard_Render(t *testing.T) {
+	d, control, progress, _ := newTestDashboard()
+	start := d.start
+
+	progress.Listed(2000)
+	d.sample(start.Add(time.Second))
+	progress.Listed(1000)
+	progress.Deleted(1000)
+	d.sample(start.Add(2 * time.Second))
+
+	worker := d.Worker(1)
+	worker.DeleteStarted()
+	worker.DeleteFinished(make([]s3.ObjectIdentifier, 998), []s3.DeleteError{
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("locked"), VersionID: aws.String("v1")}, Code: "AccessDenied", Message: "Access Denied"},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("gone")}, Code: "Unknown"},
+	})
+	d.Worker(2).DeleteStarted()
+	control.paused = true
+
+	got := d.render(start.Add(3 * time.Second))
+	for _, want := range []string{
+		"s3://test-bucket    elapsed 3s",
+		"listed 3,000 (of ~5,000 estimated)    deleted 1,000    failed 2",
+		"status PAUSED    concurrency 2 of 3 workers (1 deleting)",
+		"deleting",
+		"delete queue     [██████████··········] 50 / 100",
+		"#0   paused",
+		"#1   paused           batches 1      deleted 998",
+		"AccessDenied             1",
+		"AccessDenied locked (v1) Access Denied",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Dashboard.render() is missing %q:\n%s", want, got)
+		}
+	}
+	if len(d.listing) != 2 || d.listing[0] != 2000 || d.deleting[1] != 1000 {
+		t.Errorf("Dashboard samples = %v / %v", d.listing, d.deleting)
+	}
+}
+
+func TestQueueBar(t *testing.T) {
+	tests := []struct {
+		depth, capacity int
+		want            string
+	}{
+		{depth: 0, capacity: 100, want: "[····················]"},
+		{depth: 100, capacity: 100, want: "[████████████████████]"},
+		{depth: 5, capacity: 0, want: "[····················]"},
+	}
+	for _, tt := range tests {
+		if got := queueBar(tt.depth, tt.capacity); got != tt.want {
+			t.Errorf("queueBar(%d, %d) = %q, want %q", tt.depth, tt.capacity, got, tt.want)
+		}
+	}
+}
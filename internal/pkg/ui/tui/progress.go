@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/schollz/progressbar/v3"
+)
+
+// NukeProgress displays a progress bar for a nuke, counting listed and deleted object versions separately.
+//
+// The total starts out as an estimate (e.g. from CloudWatch metrics) and is corrected as listing runs ahead of it.
+// Once listing has finished, the total is the exact number of object versions listed.
+type NukeProgress struct {
+	mu          sync.Mutex
+	bar         *progressbar.ProgressBar
+	estimate    int64
+	listed      int64
+	deleted     int64
+	listingDone bool
+}
+
+// NewNukeProgress returns a NukeProgress writing to `w`. `estimate` is the estimated number of object versions
+// to delete, or 0 if no estimate is available.
+func NewNukeProgress(w io.Writer, estimate int64) *NukeProgress {
+	p := &NukeProgress{estimate: estimate}
+	p.bar = progressbar.NewOptions64(
+		p.total(),
+		progressbar.OptionSetDescription(p.description()),
+		progressbar.OptionSetWriter(w),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("objects"),
+		progressbar.OptionSetPredictTime(true),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(w, "\n")
+		}),
+	)
+	return p
+}
+
+// Listed records `n` more object versions listed
+func (p *NukeProgress) Listed(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.listed += int64(n)
+	p.update()
+}
+
+// ListingDone records that every object version has been listed, making the total exact
+func (p *NukeProgress) ListingDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.listingDone = true
+	p.update()
+}
+
+// Deleted records `n` more object versions deleted
+func (p *NukeProgress) Deleted(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deleted += int64(n)
+	_ = p.bar.Add(n)
+}
+
+// Counts returns the number of object versions listed and deleted so far
+func (p *NukeProgress) Counts() (int64, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.listed, p.deleted
+}
+
+// state returns the number of object versions listed and deleted so far, whether listing has finished, and the
+// estimated number of object versions to delete
+func (p *NukeProgress) state() (int64, int64, bool, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.listed, p.deleted, p.listingDone, p.estimate
+}
+
+// Close stops the progress bar, leaving it showing the final counts
+func (p *NukeProgress) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bar.IsFinished() {
+		return nil
+	}
+	return p.bar.Exit()
+}
+
+// total returns the current best guess of the number of object versions to delete.
+//
+// While listing is running the total is kept above the number listed, so the bar never completes early.
+func (p *NukeProgress) total() int64 {
+	if p.listingDone {
+		if p.listed == 0 {
+			// the progress bar requires a positive total
+			return 1
+		}
+		return p.listed
+	}
+	if p.estimate > p.listed {
+		return p.estimate
+	}
+	return p.listed + 1
+}
+
+// description returns the progress bar description showing the listing progress
+func (p *NukeProgress) description() string {
+	switch {
+	case p.listingDone:
+		return fmt.Sprintf("deleting objects... (listed %s)", humanize.Comma(p.listed))
+	case p.estimate > p.listed:
+		return fmt.Sprintf("deleting objects... (listed %s of ~%s estimated)", humanize.Comma(p.listed), humanize.Comma(p.estimate))
+	default:
+		return fmt.Sprintf("deleting objects... (listed %s, still listing)", humanize.Comma(p.listed))
+	}
+}
+
+// update applies the current listing progress to the progress bar
+func (p *NukeProgress) update() {
+	p.bar.Describe(p.description())
+	if total := p.total(); total != p.bar.GetMax64() {
+		p.bar.ChangeMax64(total)
+	}
+}
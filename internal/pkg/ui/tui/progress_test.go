@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNukeProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		estimate  int64
+		listed    []int
+		wantTotal []int64
+	}{
+		{
+			name:      "estimate above listing",
+			estimate:  5000,
+			listed:    []int{1000, 1000},
+			wantTotal: []int64{5000, 5000},
+		},
+		{
+			name:      "listing runs ahead of estimate",
+			estimate:  1500,
+			listed:    []int{1000, 1000},
+			wantTotal: []int64{1500, 2001},
+		},
+		{
+			name:      "no estimate",
+			estimate:  0,
+			listed:    []int{1000, 1000},
+			wantTotal: []int64{1001, 2001},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			p := NewNukeProgress(out, tt.estimate)
+			for i, n := range tt.listed {
+				p.Listed(n)
+				p.Deleted(n / 2)
+				if got := p.bar.GetMax64(); got != tt.wantTotal[i] {
+					t.Errorf("NukeProgress total after listing %d = %d, want %d", i, got, tt.wantTotal[i])
+				}
+			}
+
+			p.ListingDone()
+			if got := p.bar.GetMax64(); got != 2000 {
+				t.Errorf("NukeProgress total after listing done = %d, want 2000", got)
+			}
+
+			p.Deleted(1000)
+			listed, deleted := p.Counts()
+			if listed != 2000 || deleted != 2000 {
+				t.Errorf("NukeProgress.Counts() = %d, %d, want 2000, 2000", listed, deleted)
+			}
+			if !p.bar.IsFinished() {
+				t.Errorf("NukeProgress should be finished once everything listed was deleted")
+			}
+			if err := p.Close(); err != nil {
+				t.Errorf("NukeProgress.Close() error = %v", err)
+			}
+			if !strings.Contains(out.String(), "listed 2,000") {
+				t.Errorf("NukeProgress output %q does not contain listed count", out.String())
+			}
+		})
+	}
+
+	t.Run("estimate label", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		p := NewNukeProgress(out, 1000000)
+		p.Listed(1000)
+		if !strings.Contains(out.String(), "~1,000,000 estimated") {
+			t.Errorf("NukeProgress output %q does not label the estimate", out.String())
+		}
+		_ = p.Close()
+	})
+
+	t.Run("empty bucket", func(t *testing.T) {
+		p := NewNukeProgress(&bytes.Buffer{}, 0)
+		p.ListingDone()
+		if err := p.Close(); err != nil {
+			t.Errorf("NukeProgress.Close() error = %v", err)
+		}
+	})
+}
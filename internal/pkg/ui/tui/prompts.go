@@ -1,41 +1,49 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/manifoldco/promptui"
-	"github.com/soapiestwaffles/s3-nuke/internal/pkg/generators"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/bucketinfo"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/confirm"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
 )
 
 // SelectBucketsPrompt will create the UI select element for the user to select a bucket from a list
 func SelectBucketsPrompt(buckets []s3.Bucket) (string, error) {
-	// This is a nasty hack just to dereference the `Name` field.
-	// TODO investigate more to see if we can dereference right in the template OR find a different UI library
-	derefBucket := []struct {
-		Name         string
-		CreationDate *time.Time
-	}{}
+	return SelectBucketsPromptWithProtection(buckets, nil, false)
+}
+
+// SelectBucketsPromptWithProtection works like SelectBucketsPrompt, but shows buckets found in `protected` as locked
+// along with the reasons they are protected. Locked buckets cannot be selected unless `allowProtected` is set.
+func SelectBucketsPromptWithProtection(buckets []s3.Bucket, protected map[string][]string, allowProtected bool) (string, error) {
+	return SelectBucketsPromptWithDetails(buckets, protected, allowProtected, nil)
+}
+
+// SelectBucketsPromptWithDetails works like SelectBucketsPromptWithProtection, and also shows the bucket details
+// returned by `details` for the highlighted bucket. `details` must not block: details which are still being looked up
+// are shown as loading, and appear once the selection is next redrawn. No details are shown if `details` is nil.
+func SelectBucketsPromptWithDetails(buckets []s3.Bucket, protected map[string][]string, allowProtected bool, details func(bucket string) bucketinfo.Details) (string, error) {
+	derefBucket := []derefBucketItem{}
 	for _, b := range buckets {
-		derefBucket = append(derefBucket, struct {
-			Name         string
-			CreationDate *time.Time
-		}{*b.Name, b.CreationDate})
+		reasons := protected[*b.Name]
+		derefBucket = append(derefBucket, derefBucketItem{
+			Name:         *b.Name,
+			CreationDate: b.CreationDate,
+			Protected:    len(reasons) > 0,
+			Protection:   strings.Join(reasons, ", "),
+			details:      details,
+		})
 	}
 
-	templates := &promptui.SelectTemplates{
-		Label:    "{{ \"---\" | faint }} {{ . | blue | bold }} {{ \"---\" | faint }}",
-		Active:   "\U0001FAA3  {{ .Name | cyan }}",
-		Inactive: "   {{ .Name | cyan }}",
-		Selected: "\U0001FAA3  {{ .Name | bold | green }}",
-		Details: `
------- S3 Bucket Info ------
-{{ "Name............:" | faint }} {{ .Name }}
-{{ "Creation Date...:" | faint }} {{ .CreationDate }}`,
-	}
+	templates := bucketSelectTemplates()
 
 	searcher := func(input string, index int) bool {
 		bucket := derefBucket[index]
@@ -54,21 +62,116 @@ func SelectBucketsPrompt(buckets []s3.Bucket) (string, error) {
 		Stdout:    &bellSkipper{},
 	}
 
-	i, _, err := prompt.Run()
-	if err != nil {
-		return "", nil
+	for {
+		i, _, err := prompt.Run()
+		if err != nil {
+			return "", nil
+		}
+
+		if derefBucket[i].Protected && !allowProtected {
+			fmt.Printf("🔒 %s is protected (%s), select another bucket\n", derefBucket[i].Name, derefBucket[i].Protection)
+			prompt.CursorPos = i
+			continue
+		}
+
+		return *buckets[i].Name, nil
 	}
+}
 
-	return *buckets[i].Name, nil
+// bucketSelectTemplates returns the templates of the bucket picker, which renders derefBucketItem items
+func bucketSelectTemplates() *promptui.SelectTemplates {
+	funcMap := template.FuncMap{}
+	for name, f := range promptui.FuncMap {
+		funcMap[name] = f
+	}
+	funcMap["ibytes"] = func(n int64) string { return humanize.IBytes(uint64(n)) }
+	funcMap["comma"] = humanize.Comma
+	funcMap["tags"] = formatTags
+
+	return &promptui.SelectTemplates{
+		Label:    "{{ \"---\" | faint }} {{ . | blue | bold }} {{ \"---\" | faint }}",
+		Active:   "{{ if .Protected }}\U0001F512{{ else }}\U0001FAA3{{ end }}  {{ .Name | cyan }}",
+		Inactive: "   {{ if .Protected }}{{ .Name | faint }}{{ else }}{{ .Name | cyan }}{{ end }}",
+		Selected: "{{ if .Protected }}\U0001F512{{ else }}\U0001FAA3{{ end }}  {{ .Name | bold | green }}",
+		Details: `
+------ S3 Bucket Info ------
+{{ "Name............:" | faint }} {{ .Name }}
+{{ "Creation Date...:" | faint }} {{ .CreationDate }}
+{{- if .Protected }}
+{{ "Protected.......:" | faint }} {{ .Protection | red }}
+{{- end }}
+{{- with .Details }}
+{{ "Region..........:" | faint }} {{ if .Region }}{{ .Region }}{{ else if .Loaded }}{{ "unknown" | faint }}{{ else }}{{ "loading..." | faint }}{{ end }}
+{{- if .Loaded }}
+{{ "Versioning......:" | faint }} {{ if .Versioning }}{{ .Versioning }}{{ else }}Disabled{{ end }}{{ if .MFADelete }} {{ "(MFA Delete)" | yellow }}{{ end }}
+{{ "Object Lock.....:" | faint }} {{ if .ObjectLock }}{{ "Enabled" | yellow }}{{ else }}Disabled{{ end }}
+{{ "Tags............:" | faint }} {{ tags .Tags }}
+{{- if .MetricsAvailable }}
+{{ "Objects.........:" | faint }} {{ comma .Objects }}
+{{ "Size............:" | faint }} {{ ibytes .Bytes }}
+{{- else }}
+{{ "Objects / Size..:" | faint }} {{ "no CloudWatch metrics" | faint }}
+{{- end }}
+{{- range .Errors }}
+{{ "Error...........:" | faint }} {{ . | red }}
+{{- end }}
+{{- end }}
+{{- end }}`,
+		FuncMap: funcMap,
+	}
+}
+
+// derefBucketItem is a bucket as shown in the bucket picker, with the `Name` field dereferenced.
+// TODO investigate more to see if we can dereference right in the template OR find a different UI library
+type derefBucketItem struct {
+	Name         string
+	CreationDate *time.Time
+	Protected    bool
+	Protection   string
+
+	details func(bucket string) bucketinfo.Details
+}
+
+// Details returns the details of the bucket found so far, or nil if details are not shown
+func (b derefBucketItem) Details() *bucketinfo.Details {
+	if b.details == nil {
+		return nil
+	}
+	details := b.details(b.Name)
+	return &details
+}
+
+// formatTags formats bucket tags as sorted key=value pairs
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "none"
+	}
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
 }
 
 // TypeMatchingPhrase presents the user with a randomized "fakelish" phrase which they have to retype to continue
 func TypeMatchingPhrase() bool {
-	phrase := generators.GeneratePhrase(4)
+	challenge, _ := confirm.New(confirm.Phrase, confirm.Target{}, confirm.Options{})
+	return AnswerChallenge(challenge)
+}
+
+// TypeBucketName asks the user to retype the name of the bucket to continue
+func TypeBucketName(bucket string) bool {
+	challenge, _ := confirm.New(confirm.BucketName, confirm.Target{Bucket: bucket}, confirm.Options{})
+	return AnswerChallenge(challenge)
+}
 
-	fmt.Println("Please enter the following phrase to continue:", phrase)
+// AnswerChallenge presents the user with a confirmation challenge which they have to answer correctly to continue
+func AnswerChallenge(challenge confirm.Challenge) bool {
+	fmt.Println(challenge.Instruction)
 	prompt := promptui.Prompt{
-		Label: "Enter phrase",
+		Label:  challenge.Label,
+		Stdout: os.Stdout,
 	}
 
 	result, err := prompt.Run()
@@ -76,11 +179,100 @@ func TypeMatchingPhrase() bool {
 		return false
 	}
 
-	if strings.ToLower(result) != phrase {
+	return challenge.Check(result)
+}
+
+// TypeAccountDigits asks the user to type the last four digits of the AWS account ID `accountID` to continue
+func TypeAccountDigits(accountID string) bool {
+	if len(accountID) < 4 {
+		return false
+	}
+
+	fmt.Println("Please enter the last four digits of the AWS account ID to continue")
+	prompt := promptui.Prompt{
+		Label:  "Enter last four digits of account ID",
+		Stdout: os.Stdout,
+	}
+
+	result, err := prompt.Run()
+	if err != nil {
 		return false
 	}
 
-	return true
+	return strings.TrimSpace(result) == accountID[len(accountID)-4:]
+}
+
+// PromptMFAToken asks the user for the current code of the MFA device `serial`
+func PromptMFAToken(serial string) (string, error) {
+	prompt := promptui.Prompt{
+		Label:    fmt.Sprintf("MFA code for %s", serial),
+		Validate: validateMFAToken,
+		Stdout:   os.Stdout,
+	}
+
+	return prompt.Run()
+}
+
+// PromptMFASerial asks the user for the serial number or ARN of their MFA device
+func PromptMFASerial() (string, error) {
+	prompt := promptui.Prompt{
+		Label: "MFA device serial number or ARN",
+		Validate: func(serial string) error {
+			if strings.TrimSpace(serial) == "" {
+				return errors.New("MFA device serial number is required")
+			}
+			return nil
+		},
+		Stdout: os.Stdout,
+	}
+
+	serial, err := prompt.Run()
+	return strings.TrimSpace(serial), err
+}
+
+// validateMFAToken returns an error unless `token` is a 6 digit code
+func validateMFAToken(token string) error {
+	if len(token) != 6 {
+		return errors.New("MFA code must be 6 digits")
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return errors.New("MFA code must be 6 digits")
+		}
+	}
+	return nil
+}
+
+// Actions for object versions which are still inside their minimum storage duration
+const (
+	// EarlyDeletionDelete deletes them anyway, paying the early deletion charge
+	EarlyDeletionDelete = "delete"
+	// EarlyDeletionSkip leaves them in the bucket
+	EarlyDeletionSkip = "skip"
+	// EarlyDeletionPostpone leaves them in the bucket and records them so they can be deleted later
+	EarlyDeletionPostpone = "postpone"
+)
+
+// SelectEarlyDeletionAction asks the user what to do with object versions which would be charged for early deletion
+//
+// returns one of EarlyDeletionDelete, EarlyDeletionSkip or EarlyDeletionPostpone
+func SelectEarlyDeletionAction() (string, error) {
+	actions := []string{EarlyDeletionDelete, EarlyDeletionSkip, EarlyDeletionPostpone}
+	prompt := promptui.Select{
+		Label: "What should happen to these object versions?",
+		Items: []string{
+			"Delete them anyway (pay the early deletion charge)",
+			"Skip them (leave them in the bucket)",
+			"Postpone them (leave them in the bucket and save a list to delete later)",
+		},
+		Stdout: &bellSkipper{},
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return actions[i], nil
 }
 
 // ---
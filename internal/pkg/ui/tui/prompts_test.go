@@ -1,10 +1,15 @@
 package tui
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/bucketinfo"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
 )
 
@@ -79,6 +84,33 @@ func TestSelectBucketsPrompt(t *testing.T) {
 	}
 }
 
+func TestSelectBucketsPromptWithProtection(t *testing.T) {
+	now := time.Now()
+	buckets := []s3.Bucket{
+		{Name: aws.String("scratch-bucket"), CreationDate: &now},
+		{Name: aws.String("prod-bucket"), CreationDate: &now},
+	}
+	protected := map[string][]string{
+		"prod-bucket": {"matches deny pattern \"prod-*\"", "Object Lock is enabled"},
+	}
+
+	for _, allowProtected := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allowProtected=%v", allowProtected), func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("SelectBucketsPromptWithProtection() panicked with: %v", r)
+				}
+			}()
+
+			// The prompt cannot run without an interactive terminal, so no bucket is selected
+			got, _ := SelectBucketsPromptWithProtection(buckets, protected, allowProtected)
+			if got != "" {
+				t.Logf("SelectBucketsPromptWithProtection() selected %s (unexpected in test env)", got)
+			}
+		})
+	}
+}
+
 func TestTypeMatchingPhrase(t *testing.T) {
 	// This function generates a random phrase and prompts for input
 	// We can't easily test the interactive part, but we can test it doesn't panic
@@ -100,6 +132,21 @@ func TestTypeMatchingPhrase(t *testing.T) {
 	})
 }
 
+func TestTypeBucketName(t *testing.T) {
+	t.Run("no terminal", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("TypeBucketName() panicked with: %v", r)
+			}
+		}()
+
+		// In test environment, we expect false since there's no terminal input
+		if TypeBucketName("test-bucket") {
+			t.Log("TypeBucketName() returned true (unexpected in test env)")
+		}
+	})
+}
+
 func TestBellSkipper_Write(t *testing.T) {
 	bs := &bellSkipper{}
 	
@@ -179,4 +226,76 @@ func TestBellSkipper_Close(t *testing.T) {
 			t.Logf("bellSkipper.Close() returned error: %v", err)
 		}
 	})
-}
\ No newline at end of file
+}
+func TestValidateMFAToken(t *testing.T) {
+	tests := []struct {
+		token   string
+		wantErr bool
+	}{
+		{token: "123456", wantErr: false},
+		{token: "012345", wantErr: false},
+		{token: "12345", wantErr: true},
+		{token: "1234567", wantErr: true},
+		{token: "12a456", wantErr: true},
+		{token: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			if err := validateMFAToken(tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("validateMFAToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBucketSelectTemplates_Details(t *testing.T) {
+	templates := bucketSelectTemplates()
+	details, err := template.New("details").Funcs(templates.FuncMap).Parse(templates.Details)
+	if err != nil {
+		t.Fatalf("could not parse details template: %v", err)
+	}
+
+	loaded := bucketinfo.Details{
+		Loaded: true, Region: "eu-west-1", Versioning: "Enabled", MFADelete: true, ObjectLock: true,
+		Tags: map[string]string{"team": "data", "env": "prod"}, MetricsAvailable: true, Objects: 1234567, Bytes: 3 << 30,
+		Errors: []string{"size: AccessDenied"},
+	}
+	tests := []struct {
+		name    string
+		details func(string) bucketinfo.Details
+		want    []string
+		notWant []string
+	}{
+		{name: "no details", notWant: []string{"Region"}},
+		{name: "loading", details: func(string) bucketinfo.Details { return bucketinfo.Details{} }, want: []string{"loading..."}, notWant: []string{"Versioning"}},
+		{
+			name:    "loaded",
+			details: func(string) bucketinfo.Details { return loaded },
+			want:    []string{"eu-west-1", "Enabled", "MFA Delete", "env=prod, team=data", "1,234,567", "3.0 GiB", "size: AccessDenied"},
+		},
+		{
+			name:    "no metrics",
+			details: func(string) bucketinfo.Details { return bucketinfo.Details{Loaded: true, Region: "us-east-1"} },
+			want:    []string{"us-east-1", "Disabled", "none", "no CloudWatch metrics"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			item := derefBucketItem{Name: "test-bucket", details: tt.details}
+			if err := details.Execute(&out, item); err != nil {
+				t.Fatalf("could not render details template: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("details = %q, want it to contain %q", out.String(), want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("details = %q, want it not to contain %q", out.String(), notWant)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package workers
+
+import (
+	"context"
+	"sync"
+)
+
+// Gate limits how many delete workers send DeleteObjects requests at once, and can pause them all. The limit can be
+// changed while the workers are running, but never lets more workers through than were started. A nil Gate lets
+// every worker through.
+type Gate struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	paused bool
+	// wake is closed (and replaced) whenever a waiting worker may be able to go through
+	wake chan struct{}
+}
+
+// NewGate returns a Gate letting `limit` workers through at a time
+func NewGate(limit int) *Gate {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Gate{limit: limit, wake: make(chan struct{})}
+}
+
+type gateKey struct{}
+
+// WithGate returns a copy of `ctx` making the workers it is passed to wait for `gate` before each DeleteObjects request
+func WithGate(ctx context.Context, gate *Gate) context.Context {
+	return context.WithValue(ctx, gateKey{}, gate)
+}
+
+// gateFrom returns the Gate set on `ctx` with WithGate, or nil
+func gateFrom(ctx context.Context) *Gate {
+	gate, _ := ctx.Value(gateKey{}).(*Gate)
+	return gate
+}
+
+// Acquire waits until the gate is not paused and fewer than the limit of workers are through, then lets the caller
+// through. Callers must call Release once done.
+//
+// returns an error if `ctx` is canceled while waiting
+func (g *Gate) Acquire(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	for {
+		g.mu.Lock()
+		if !g.paused && g.active < g.limit {
+			g.active++
+			g.mu.Unlock()
+			return nil
+		}
+		wake := g.wake
+		g.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release lets the next waiting worker through
+func (g *Gate) Release() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.active--
+	g.broadcast()
+}
+
+// SetLimit changes the number of workers let through at a time, at least 1. Workers already through finish their
+// current request.
+func (g *Gate) SetLimit(limit int) {
+	if g == nil {
+		return
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limit = limit
+	g.broadcast()
+}
+
+// Limit returns the number of workers let through at a time
+func (g *Gate) Limit() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.limit
+}
+
+// Active returns the number of workers currently through the gate
+func (g *Gate) Active() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active
+}
+
+// Pause stops letting workers through until Resume is called. Workers already through finish their current request.
+func (g *Gate) Pause() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = true
+}
+
+// Resume lets workers through again after Pause
+func (g *Gate) Resume() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = false
+	g.broadcast()
+}
+
+// Paused returns true if the gate is paused
+func (g *Gate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// broadcast wakes every waiting worker, the caller must hold g.mu
+func (g *Gate) broadcast() {
+	close(g.wake)
+	g.wake = make(chan struct{})
+}
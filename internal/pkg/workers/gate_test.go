@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func TestGate(t *testing.T) {
+	ctx := context.Background()
+	gate := NewGate(2)
+
+	for i := 0; i < 2; i++ {
+		if err := gate.Acquire(ctx); err != nil {
+			t.Fatalf("Gate.Acquire() error = %v", err)
+		}
+	}
+	if gate.Active() != 2 {
+		t.Errorf("Gate.Active() = %d, want 2", gate.Active())
+	}
+
+	// a third worker waits until the limit is raised
+	acquired := make(chan error)
+	go func() { acquired <- gate.Acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatalf("Gate.Acquire() went through over the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate.SetLimit(3)
+	if err := <-acquired; err != nil {
+		t.Fatalf("Gate.Acquire() error = %v", err)
+	}
+
+	// paused gates let nobody through, even below the limit
+	gate.Release()
+	gate.Pause()
+	if !gate.Paused() {
+		t.Errorf("Gate.Paused() = false after Pause()")
+	}
+	go func() { acquired <- gate.Acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatalf("Gate.Acquire() went through a paused gate")
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate.Resume()
+	if err := <-acquired; err != nil {
+		t.Fatalf("Gate.Acquire() error = %v", err)
+	}
+
+	// waiting stops when the context is canceled
+	gate.Pause()
+	canceled, cancel := context.WithCancel(ctx)
+	go func() { acquired <- gate.Acquire(canceled) }()
+	cancel()
+	if err := <-acquired; !errors.Is(err, context.Canceled) {
+		t.Errorf("Gate.Acquire() error = %v, want context.Canceled", err)
+	}
+
+	gate.SetLimit(0)
+	if gate.Limit() != 1 {
+		t.Errorf("Gate.Limit() = %d after SetLimit(0), want 1", gate.Limit())
+	}
+}
+
+func TestGate_Nil(t *testing.T) {
+	var gate *Gate
+	if err := gate.Acquire(context.Background()); err != nil {
+		t.Errorf("nil Gate.Acquire() error = %v", err)
+	}
+	gate.Release()
+	gate.Pause()
+	gate.SetLimit(3)
+	if gate.Paused() || gate.Limit() != 0 || gate.Active() != 0 {
+		t.Errorf("nil Gate should be a no-op")
+	}
+}
+
+func TestS3DeleteFromChannel_Gate(t *testing.T) {
+	gate := NewGate(1)
+	gate.Pause()
+	ctx, cancel := context.WithCancel(WithGate(context.Background(), gate))
+	defer cancel()
+
+	input := make(chan s3.ObjectIdentifier, 10)
+	for i := 0; i < 10; i++ {
+		k := "key" + strconv.Itoa(i)
+		input <- s3.ObjectIdentifier{Key: &k, VersionID: &version}
+	}
+	close(input)
+
+	done := make(chan int)
+	go func() {
+		count, _ := S3DeleteFromChannel(ctx, s3svc, "randombucket", input, nil, nil, nil)
+		done <- count
+	}()
+	select {
+	case <-done:
+		t.Fatalf("S3DeleteFromChannel() deleted through a paused gate")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	gate.Resume()
+	if count := <-done; count != 10 {
+		t.Errorf("S3DeleteFromChannel() deleted %d objects after resuming, want 10", count)
+	}
+}
@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace prefixes the names of all worker metrics
+const metricsNamespace = "s3nuke"
+
+// Prometheus metrics updated by the workers. They are always collected, use RegisterMetrics to expose them.
+var (
+	objectsListed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "objects_listed_total",
+		Help:      "Number of object versions (including delete markers) listed.",
+	})
+	objectsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "objects_deleted_total",
+		Help:      "Number of object versions (including delete markers) deleted.",
+	})
+	deleteFailuresByCode = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "delete_failures_total",
+		Help:      "Number of object versions which could not be deleted, by AWS error code.",
+	}, []string{"code"})
+	deleteLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "delete_objects_duration_seconds",
+		Help:      "Latency of DeleteObjects requests, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	deleteQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "delete_queue_depth",
+		Help:      "Number of object versions waiting in the delete queue, sampled before each DeleteObjects request.",
+	})
+	activeWorkers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_workers",
+		Help:      "Number of running workers, by pipeline stage.",
+	}, []string{"stage"})
+	throttleEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "throttle_events_total",
+		Help:      "Number of S3 requests which were throttled.",
+	})
+)
+
+// Pipeline stage labels used by the active_workers metric
+const (
+	stageDelete  = "delete"
+	stageArchive = "archive"
+	stageCopy    = "copy"
+)
+
+// RegisterMetrics registers the worker metrics with `registerer`
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		objectsListed,
+		objectsDeleted,
+		deleteFailuresByCode,
+		deleteLatency,
+		deleteQueueDepth,
+		activeWorkers,
+		throttleEvents,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics() error = %v", err)
+	}
+	if err := RegisterMetrics(registry); err == nil {
+		t.Errorf("RegisterMetrics() expected error registering twice")
+	}
+}
+
+func TestS3DeleteFromChannel_Metrics(t *testing.T) {
+	queue := func(count int) chan s3.ObjectIdentifier {
+		input := make(chan s3.ObjectIdentifier, count)
+		for i := 0; i < count; i++ {
+			k := "key" + strconv.Itoa(i)
+			input <- s3.ObjectIdentifier{Key: &k, VersionID: &version}
+		}
+		close(input)
+		return input
+	}
+
+	t.Run("deleted and failures by code", func(t *testing.T) {
+		deleted := testutil.ToFloat64(objectsDeleted)
+		denied := testutil.ToFloat64(deleteFailuresByCode.WithLabelValues("AccessDenied"))
+		unknown := testutil.ToFloat64(deleteFailuresByCode.WithLabelValues("Unknown"))
+		observations := histogramSampleCount(t, deleteLatency)
+
+		_, err := S3DeleteFromChannel(context.TODO(), s3svc, "failurechanbucket", queue(10), nil, nil, nil)
+		if err != nil {
+			t.Fatalf("S3DeleteFromChannel() error = %v", err)
+		}
+
+		if got := testutil.ToFloat64(objectsDeleted) - deleted; got != 5 {
+			t.Errorf("objects deleted metric increased by %v, want 5", got)
+		}
+		if got := testutil.ToFloat64(deleteFailuresByCode.WithLabelValues("AccessDenied")) - denied; got != 3 {
+			t.Errorf("AccessDenied failures metric increased by %v, want 3", got)
+		}
+		if got := testutil.ToFloat64(deleteFailuresByCode.WithLabelValues("Unknown")) - unknown; got != 2 {
+			t.Errorf("Unknown failures metric increased by %v, want 2", got)
+		}
+		if got := histogramSampleCount(t, deleteLatency) - observations; got != 1 {
+			t.Errorf("delete latency histogram observed %d requests, want 1", got)
+		}
+		if got := testutil.ToFloat64(activeWorkers.WithLabelValues(stageDelete)); got != 0 {
+			t.Errorf("active delete workers = %v after worker finished, want 0", got)
+		}
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		throttled := testutil.ToFloat64(throttleEvents)
+		slowDown := testutil.ToFloat64(deleteFailuresByCode.WithLabelValues("SlowDown"))
+
+		_, err := S3DeleteFromChannel(context.TODO(), s3svc, "throttledbucket", queue(10), nil, nil, nil)
+		if err == nil {
+			t.Fatalf("S3DeleteFromChannel() expected error")
+		}
+
+		if got := testutil.ToFloat64(throttleEvents) - throttled; got != 1 {
+			t.Errorf("throttle events metric increased by %v, want 1", got)
+		}
+		if got := testutil.ToFloat64(deleteFailuresByCode.WithLabelValues("SlowDown")) - slowDown; got != 10 {
+			t.Errorf("SlowDown failures metric increased by %v, want 10", got)
+		}
+	})
+
+	t.Run("listed", func(t *testing.T) {
+		listed := testutil.ToFloat64(objectsListed)
+		output := make(chan s3.ObjectVersion, 5000)
+		if _, err := S3QueueObjectVersionDetails(context.TODO(), s3svc, "randombucket", "", output); err != nil {
+			t.Fatalf("S3QueueObjectVersionDetails() error = %v", err)
+		}
+		if got := testutil.ToFloat64(objectsListed) - listed; got != 4000 {
+			t.Errorf("objects listed metric increased by %v, want 4000", got)
+		}
+	})
+}
+
+func histogramSampleCount(t *testing.T, histogram prometheus.Histogram) uint64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := histogram.Write(m); err != nil {
+		t.Fatalf("could not read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
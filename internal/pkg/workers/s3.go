@@ -2,11 +2,30 @@ package workers
 
 import (
 	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
 	"reflect"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rs/zerolog/log"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/tracing"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Archiver persists object contents before they are deleted (see internal/pkg/archive)
+type Archiver interface {
+	// Add writes an entry called `name` containing exactly `size` bytes read from `body`
+	Add(name string, size int64, modTime time.Time, body io.Reader) error
+	// Sync commits all entries added so far to stable storage
+	Sync() error
+}
+
 type objectStack struct {
 	Queue []s3.ObjectIdentifier
 }
@@ -43,35 +62,114 @@ OUTER:
 	return result
 }
 
+// DeleteRecorder is told about every DeleteObjects request made by S3DeleteFromChannel (see internal/pkg/report)
+type DeleteRecorder interface {
+	// DeleteStarted is called before each DeleteObjects request
+	DeleteStarted()
+	// DeleteFinished is called after each DeleteObjects request with the object versions which were deleted, and
+	// the object versions which were not along with the reason
+	DeleteFinished(deleted []s3.ObjectIdentifier, failed []s3.DeleteError)
+}
+
+// TeeRecorder returns a DeleteRecorder telling each of `recorders` about every DeleteObjects request, in order
+func TeeRecorder(recorders ...DeleteRecorder) DeleteRecorder {
+	return teeRecorder(recorders)
+}
+
+type teeRecorder []DeleteRecorder
+
+func (t teeRecorder) DeleteStarted() {
+	for _, recorder := range t {
+		recorder.DeleteStarted()
+	}
+}
+
+func (t teeRecorder) DeleteFinished(deleted []s3.ObjectIdentifier, failed []s3.DeleteError) {
+	for _, recorder := range t {
+		recorder.DeleteFinished(deleted, failed)
+	}
+}
+
 // S3DeleteFromChannel deletes object versions (s3.ObjectIdentifier) from `input` channel.
 // if `progress` channel is available, it will be sent counts of deleted items
+// if `recorder` is not nil, it will be told about every DeleteObjects request
+// if `ctx` carries a Gate (see WithGate), each DeleteObjects request waits for it
 //
 // returns:
 //   `int` - total number of objects deleted during `input` channel lifetime
 //   `[]s3.ObjectIdentifier` - object list of items that were queued but didn't get deleted via s3svc.DeleteObjects
 //   `error` - non-nil if errors were encountered
-func S3DeleteFromChannel(ctx context.Context, s3svc s3.Service, bucket string, input <-chan s3.ObjectIdentifier, progress chan<- int, failures chan<- []s3.ObjectIdentifier) (int, error) {
+func S3DeleteFromChannel(ctx context.Context, s3svc s3.Service, bucket string, input <-chan s3.ObjectIdentifier, progress chan<- int, failures chan<- []s3.ObjectIdentifier, recorder DeleteRecorder) (int, error) {
+	activeWorkers.WithLabelValues(stageDelete).Inc()
+	defer activeWorkers.WithLabelValues(stageDelete).Dec()
+
 	deleteCounter := 0
 	objs := objectStack{}
+	gate := gateFrom(ctx)
 
 	// returns
 	// `[]s3.ObjectIdentifier`` - objects that were queued but didn't actually get deleted
 	// `error`` - error message if an unrecoverable error occured
 	flush := func() error {
+		if err := gate.Acquire(ctx); err != nil {
+			return err
+		}
+		defer gate.Release()
+
 		queueCount := objs.Len()
-		deleteResult, err := s3svc.DeleteObjects(ctx, bucket, objs.Queue)
+		deleteQueueDepth.Set(float64(len(input)))
+
+		spanCtx, span := tracing.Start(ctx, "DeleteObjects", append(spanAttributes(ctx, bucket), attribute.Int("batch.size", queueCount))...)
+		start := time.Now()
+		if recorder != nil {
+			recorder.DeleteStarted()
+		}
+		result, err := s3svc.DeleteObjectsDetailed(spanCtx, bucket, objs.Queue)
+		deleteLatency.Observe(time.Since(start).Seconds())
+		if recorder != nil {
+			recordDelete(recorder, objs, result, err)
+		}
 		if err != nil {
+			deleteFailuresByCode.WithLabelValues(s3.ErrorCode(err)).Add(float64(queueCount))
+			if s3.IsThrottleError(err) {
+				throttleEvents.Inc()
+			}
+			tracing.End(span, err)
 			return err
 		}
+		span.SetAttributes(
+			attribute.Int("objects.deleted", len(result.Deleted)),
+			attribute.Int("objects.failed", queueCount-len(result.Deleted)),
+			attribute.Int("throttled_attempts", result.ThrottledAttempts),
+		)
+		tracing.End(span, nil)
+		deleteResult := result.Deleted
 		deleteCount := len(deleteResult)
 
 		deleteCounter += deleteCount
+		objectsDeleted.Add(float64(deleteCount))
+		throttleEvents.Add(float64(result.ThrottledAttempts))
+		for _, deleteErr := range result.Errors {
+			deleteFailuresByCode.WithLabelValues(deleteErr.Code).Inc()
+		}
+		if unreported := queueCount - deleteCount - len(result.Errors); unreported > 0 {
+			deleteFailuresByCode.WithLabelValues("Unknown").Add(float64(unreported))
+		}
+
 		if progress != nil {
-			progress <- deleteCount
+			select {
+			case progress <- deleteCount:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 		if deleteCount != queueCount && failures != nil {
 			deleteFailures := objs.FindMissingFrom(deleteResult)
-			failures <- deleteFailures
+			select {
+			case failures <- deleteFailures:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 		objs.Reset()
 
@@ -100,6 +198,33 @@ func S3DeleteFromChannel(ctx context.Context, s3svc s3.Service, bucket string, i
 	return deleteCounter, nil
 }
 
+// recordDelete tells `recorder` the outcome of deleting the objects in `objs`. Objects which were neither deleted nor
+// reported as errors are recorded as failed with the code "Unknown".
+func recordDelete(recorder DeleteRecorder, objs objectStack, result *s3.DeleteResult, err error) {
+	if err != nil {
+		code := s3.ErrorCode(err)
+		failed := make([]s3.DeleteError, 0, objs.Len())
+		for _, object := range objs.Queue {
+			failed = append(failed, s3.DeleteError{ObjectIdentifier: object, Code: code, Message: err.Error()})
+		}
+		recorder.DeleteFinished(nil, failed)
+		return
+	}
+
+	failed := result.Errors
+	if len(result.Deleted)+len(result.Errors) < objs.Len() {
+		reported := append([]s3.ObjectIdentifier{}, result.Deleted...)
+		for _, deleteErr := range result.Errors {
+			reported = append(reported, deleteErr.ObjectIdentifier)
+		}
+		failed = append([]s3.DeleteError{}, result.Errors...)
+		for _, object := range objs.FindMissingFrom(reported) {
+			failed = append(failed, s3.DeleteError{ObjectIdentifier: object, Code: "Unknown"})
+		}
+	}
+	recorder.DeleteFinished(result.Deleted, failed)
+}
+
 // S3QueueObjectVersions loads s3 object versions and queues them into the `output` channel
 //
 // returns:
@@ -110,12 +235,94 @@ func S3QueueObjectVersions(ctx context.Context, s3svc s3.Service, bucket string,
 	queueCounter := 0
 
 	for {
-		objectVersions, keyMarker, versionMarker, err := s3svc.ListObjectVersions(ctx, bucket, keyMarkerState, versionMarkerState, nil)
+		objectVersions, keyMarker, versionMarker, err := listObjectVersionsPage(ctx, s3svc, bucket, keyMarkerState, versionMarkerState, nil)
+		if err != nil {
+			return queueCounter, err
+		}
+		for _, version := range objectVersions {
+			select {
+			case output <- version.ObjectIdentifier:
+			case <-ctx.Done():
+				return queueCounter, ctx.Err()
+			}
+			queueCounter++
+		}
+
+		if keyMarker == nil && versionMarker == nil {
+			break
+		}
+		keyMarkerState = keyMarker
+		versionMarkerState = versionMarker
+	}
+
+	return queueCounter, nil
+}
+
+// S3QueueObjectVersionDetails works like S3QueueObjectVersions, but queues the full s3.ObjectVersion
+// (including delete marker and latest version information) into the `output` channel.
+// If `prefix` is not empty, only keys starting with `prefix` are queued.
+//
+// returns:
+//   `int` - total number of objects queued
+//   `error` - not-nil if errors were encountered while retrieving object version list
+func S3QueueObjectVersionDetails(ctx context.Context, s3svc s3.Service, bucket string, prefix string, output chan<- s3.ObjectVersion) (int, error) {
+	return queueObjectVersionDetails(ctx, s3svc, bucket, prefix, nil, output)
+}
+
+// S3QueueSelectedVersionDetails works like S3QueueObjectVersionDetails, but only queues the object versions of the
+// prefixes and keys in `set`. The versions of a key are listed using the key as the prefix, skipping versions of
+// other keys which start with it. Prefixes and keys covered by another selected prefix are only listed once.
+//
+// returns:
+//   `int` - total number of objects queued
+//   `error` - not-nil if errors were encountered while retrieving object version list
+func S3QueueSelectedVersionDetails(ctx context.Context, s3svc s3.Service, bucket string, set selection.Set, output chan<- s3.ObjectVersion) (int, error) {
+	set = set.Normalized()
+	queueCounter := 0
+
+	for _, prefix := range set.Prefixes {
+		c, err := queueObjectVersionDetails(ctx, s3svc, bucket, prefix, nil, output)
+		queueCounter += c
+		if err != nil {
+			return queueCounter, err
+		}
+	}
+	for _, key := range set.Keys {
+		c, err := queueObjectVersionDetails(ctx, s3svc, bucket, key, func(version s3.ObjectVersion) bool {
+			return aws.ToString(version.Key) == key
+		}, output)
+		queueCounter += c
+		if err != nil {
+			return queueCounter, err
+		}
+	}
+
+	return queueCounter, nil
+}
+
+// queueObjectVersionDetails queues the object versions under `prefix` for which `keep` returns true (or all of them,
+// if `keep` is nil) into the `output` channel, returning the number queued
+func queueObjectVersionDetails(ctx context.Context, s3svc s3.Service, bucket string, prefix string, keep func(s3.ObjectVersion) bool, output chan<- s3.ObjectVersion) (int, error) {
+	var keyMarkerState, versionMarkerState, prefixFilter *string
+	queueCounter := 0
+	if prefix != "" {
+		prefixFilter = &prefix
+	}
+
+	for {
+		objectVersions, keyMarker, versionMarker, err := listObjectVersionsPage(ctx, s3svc, bucket, keyMarkerState, versionMarkerState, prefixFilter)
 		if err != nil {
 			return queueCounter, err
 		}
 		for _, version := range objectVersions {
-			output <- version.ObjectIdentifier
+			if keep != nil && !keep(version) {
+				continue
+			}
+			select {
+			case output <- version:
+			case <-ctx.Done():
+				return queueCounter, ctx.Err()
+			}
 			queueCounter++
 		}
 
@@ -128,3 +335,260 @@ func S3QueueObjectVersions(ctx context.Context, s3svc s3.Service, bucket string,
 
 	return queueCounter, nil
 }
+
+// listObjectVersionsPage lists one page of object versions, recording it in a trace span and the metrics
+func listObjectVersionsPage(ctx context.Context, s3svc s3.Service, bucket string, keyMarker *string, versionIDMarker *string, prefix *string) ([]s3.ObjectVersion, *string, *string, error) {
+	ctx, span := tracing.Start(ctx, "ListObjectVersions", append(spanAttributes(ctx, bucket), attribute.String("prefix", aws.ToString(prefix)))...)
+	objectVersions, nextKeyMarker, nextVersionIDMarker, err := s3svc.ListObjectVersions(ctx, bucket, keyMarker, versionIDMarker, prefix)
+	if err == nil {
+		objectsListed.Add(float64(len(objectVersions)))
+		span.SetAttributes(attribute.Int("batch.size", len(objectVersions)))
+	}
+	tracing.End(span, err)
+
+	return objectVersions, nextKeyMarker, nextVersionIDMarker, err
+}
+
+// S3ArchiveFromChannel downloads object versions from the `input` channel and writes them to `archive`.
+// Object versions are only sent on to the `output` channel (usually the delete queue) once their contents
+// have been written to the archive and the archive has been synced to disk.
+//
+// Delete markers are passed straight through to `output`. Noncurrent versions are also passed straight
+// through unless `allVersions` is set, in which case they are archived as `.versions/<key>/<versionID>`.
+//
+// Object versions that could not be downloaded, and those whose keys are not safe tar entry names (an absolute
+// path or a `..` segment), are never sent to `output`. If the `failures` channel is available, it will be sent
+// the list of these object versions.
+//
+// returns:
+//   `int` - total number of objects written to the archive
+//   `error` - non-nil if the archive could not be written
+func S3ArchiveFromChannel(ctx context.Context, s3svc s3.Service, bucket string, archive Archiver, allVersions bool, input <-chan s3.ObjectVersion, output chan<- s3.ObjectVersion, failures chan<- []s3.ObjectIdentifier) (int, error) {
+	activeWorkers.WithLabelValues(stageArchive).Inc()
+	defer activeWorkers.WithLabelValues(stageArchive).Dec()
+
+	archiveCounter := 0
+	archived := []s3.ObjectVersion{}
+	failed := objectStack{}
+
+	// sync the archive to disk and release archived objects for deletion
+	commit := func() error {
+		if len(archived) > 0 {
+			if err := archive.Sync(); err != nil {
+				return err
+			}
+			for _, version := range archived {
+				select {
+				case output <- version:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			archiveCounter += len(archived)
+			archived = archived[:0]
+		}
+		if failed.Len() > 0 && failures != nil {
+			select {
+			case failures <- failed.Queue:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		failed.Reset()
+
+		return nil
+	}
+
+	for version := range input {
+		if version.IsDeleteMarker || (!version.IsLatest && !allVersions) {
+			select {
+			case output <- version:
+			case <-ctx.Done():
+				return archiveCounter, ctx.Err()
+			}
+			continue
+		}
+
+		name := aws.ToString(version.Key)
+		if !archiveSafeName(name) {
+			log.Warn().Str("key", name).Msg("key is not a safe archive entry name, not archiving or deleting it")
+			failed.Push(version.ObjectIdentifier)
+			continue
+		}
+		if !version.IsLatest {
+			name = path.Join(".versions", name, aws.ToString(version.VersionID))
+		}
+
+		err := s3ArchiveObject(ctx, s3svc, bucket, archive, name, version.ObjectIdentifier)
+		if err != nil {
+			var writeErr archiveWriteError
+			if errors.As(err, &writeErr) {
+				return archiveCounter, err
+			}
+			if ctx.Err() != nil {
+				return archiveCounter, ctx.Err()
+			}
+			log.Warn().Err(err).Str("key", aws.ToString(version.Key)).Msg("could not download object for archiving")
+			failed.Push(version.ObjectIdentifier)
+			continue
+		}
+		archived = append(archived, version)
+
+		if len(archived) == 1000 {
+			if err := commit(); err != nil {
+				return archiveCounter, err
+			}
+		}
+	}
+
+	if err := commit(); err != nil {
+		return archiveCounter, err
+	}
+
+	return archiveCounter, nil
+}
+
+// archiveWriteError wraps errors from writing to the archive, which are not recoverable
+type archiveWriteError struct {
+	error
+}
+
+// archiveWriter wraps the errors of `Writer` in archiveWriteError, so that io.Copy failures on the local side can be
+// told apart from download failures
+type archiveWriter struct {
+	io.Writer
+}
+
+func (w archiveWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if err != nil {
+		return n, archiveWriteError{err}
+	}
+	return n, nil
+}
+
+// archiveSafeName returns whether `key` can be used as a tar entry name, i.e. it would not be extracted outside of
+// the target directory
+func archiveSafeName(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// s3ArchiveObject downloads a single object version into a temporary file, then copies it into the archive.
+// Downloading to a temporary file first allows multiple workers to download concurrently while entries are
+// written to the archive one at a time.
+func s3ArchiveObject(ctx context.Context, s3svc s3.Service, bucket string, archive Archiver, name string, object s3.ObjectIdentifier) error {
+	obj, err := s3svc.GetObject(ctx, bucket, aws.ToString(object.Key), object.VersionID)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	tmp, err := os.CreateTemp("", "s3-nuke-archive-*")
+	if err != nil {
+		return archiveWriteError{err}
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(archiveWriter{tmp}, obj.Body)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return archiveWriteError{err}
+	}
+
+	modTime := time.Now()
+	if obj.LastModified != nil {
+		modTime = *obj.LastModified
+	}
+
+	if err := archive.Add(name, size, modTime, tmp); err != nil {
+		return archiveWriteError{err}
+	}
+
+	return nil
+}
+
+// S3CopyFromChannel performs a server-side copy of object versions from the `input` channel into `backupBucket`,
+// with each key prefixed by `backupPrefix`. Object versions are only sent on to the `output` channel (usually the
+// delete queue) once they have been copied successfully.
+//
+// `s3svc` must be configured for the region (and credentials) of the backup bucket.
+//
+// Delete markers are passed straight through to `output`. Noncurrent versions are also passed straight
+// through unless `allVersions` is set, in which case they are copied to `<backupPrefix>.versions/<key>/<versionID>`.
+//
+// Object versions that could not be copied are never sent to `output`. If the `failures` channel is
+// available, it will be sent the list of these object versions.
+//
+// returns:
+//   `int` - total number of objects copied
+//   `error` - non-nil if errors were encountered
+func S3CopyFromChannel(ctx context.Context, s3svc s3.Service, bucket string, backupBucket string, backupPrefix string, allVersions bool, input <-chan s3.ObjectVersion, output chan<- s3.ObjectVersion, failures chan<- []s3.ObjectIdentifier) (int, error) {
+	activeWorkers.WithLabelValues(stageCopy).Inc()
+	defer activeWorkers.WithLabelValues(stageCopy).Dec()
+
+	copyCounter := 0
+	failed := objectStack{}
+
+	for version := range input {
+		if version.IsDeleteMarker || (!version.IsLatest && !allVersions) {
+			select {
+			case output <- version:
+			case <-ctx.Done():
+				return copyCounter, ctx.Err()
+			}
+			continue
+		}
+
+		key := aws.ToString(version.Key)
+		dstKey := backupPrefix + key
+		if !version.IsLatest {
+			dstKey = backupPrefix + ".versions/" + key + "/" + aws.ToString(version.VersionID)
+		}
+
+		err := s3svc.CopyObject(ctx, bucket, key, version.VersionID, version.Size, backupBucket, dstKey)
+		if err != nil {
+			if ctx.Err() != nil {
+				return copyCounter, ctx.Err()
+			}
+			log.Warn().Err(err).Str("key", key).Msg("could not copy object to backup bucket")
+			failed.Push(version.ObjectIdentifier)
+			if failed.Len() == 1000 && failures != nil {
+				select {
+				case failures <- failed.Queue:
+				case <-ctx.Done():
+					return copyCounter, ctx.Err()
+				}
+				failed = objectStack{}
+			}
+			continue
+		}
+
+		copyCounter++
+		select {
+		case output <- version:
+		case <-ctx.Done():
+			return copyCounter, ctx.Err()
+		}
+	}
+
+	if failed.Len() > 0 && failures != nil {
+		select {
+		case failures <- failed.Queue:
+		case <-ctx.Done():
+			return copyCounter, ctx.Err()
+		}
+	}
+
+	return copyCounter, nil
+}
@@ -9,8 +9,12 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/smithy-go"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
 )
 
@@ -316,7 +320,7 @@ func Test_s3DeleteFromChannel(t *testing.T) {
 				close(testChannel)
 			}()
 
-			got, err := S3DeleteFromChannel(context.TODO(), s3svc, tt.bucket, testChannel, tt.progressChan, tt.failuresChan)
+			got, err := S3DeleteFromChannel(context.TODO(), s3svc, tt.bucket, testChannel, tt.progressChan, tt.failuresChan, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("s3DeleteFromQueue() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -373,6 +377,79 @@ func Test_s3DeleteFromChannel(t *testing.T) {
 	}
 }
 
+type deleteRecorderMock struct {
+	started int
+	deleted int
+	failed  map[string]int
+}
+
+func (r *deleteRecorderMock) DeleteStarted() {
+	r.started++
+}
+
+func (r *deleteRecorderMock) DeleteFinished(deleted []s3.ObjectIdentifier, failed []s3.DeleteError) {
+	r.deleted += len(deleted)
+	for _, f := range failed {
+		r.failed[f.Code]++
+	}
+}
+
+func TestS3DeleteFromChannel_Recorder(t *testing.T) {
+	queue := func(count int) chan s3.ObjectIdentifier {
+		input := make(chan s3.ObjectIdentifier, count)
+		for i := 0; i < count; i++ {
+			k := "key" + strconv.Itoa(i)
+			input <- s3.ObjectIdentifier{Key: &k, VersionID: &version}
+		}
+		close(input)
+		return input
+	}
+
+	tests := []struct {
+		name        string
+		bucket      string
+		wantErr     bool
+		wantDeleted int
+		wantFailed  map[string]int
+	}{
+		{name: "deleted", bucket: "randombucket", wantDeleted: 10, wantFailed: map[string]int{}},
+		{name: "failures by code", bucket: "failurechanbucket", wantDeleted: 5, wantFailed: map[string]int{"AccessDenied": 3, "Unknown": 2}},
+		{name: "request failed", bucket: "throttledbucket", wantErr: true, wantFailed: map[string]int{"SlowDown": 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &deleteRecorderMock{failed: map[string]int{}}
+			_, err := S3DeleteFromChannel(context.TODO(), s3svc, tt.bucket, queue(10), nil, nil, recorder)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("S3DeleteFromChannel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if recorder.started != 1 {
+				t.Errorf("DeleteRecorder.DeleteStarted() called %d times, want 1", recorder.started)
+			}
+			if recorder.deleted != tt.wantDeleted {
+				t.Errorf("DeleteRecorder deleted = %d, want %d", recorder.deleted, tt.wantDeleted)
+			}
+			if !reflect.DeepEqual(recorder.failed, tt.wantFailed) {
+				t.Errorf("DeleteRecorder failed = %v, want %v", recorder.failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestTeeRecorder(t *testing.T) {
+	first := &deleteRecorderMock{failed: map[string]int{}}
+	second := &deleteRecorderMock{failed: map[string]int{}}
+	recorder := TeeRecorder(first, second)
+
+	recorder.DeleteStarted()
+	recorder.DeleteFinished(make([]s3.ObjectIdentifier, 3), []s3.DeleteError{{Code: "AccessDenied"}})
+	for _, r := range []*deleteRecorderMock{first, second} {
+		if r.started != 1 || r.deleted != 3 || r.failed["AccessDenied"] != 1 {
+			t.Errorf("TeeRecorder() recorded %+v", r)
+		}
+	}
+}
+
 func TestS3QueueObjectVersions(t *testing.T) {
 	type args struct {
 		bucket string
@@ -429,11 +506,365 @@ func TestS3QueueObjectVersions(t *testing.T) {
 	}
 }
 
+func TestS3QueueObjectVersionDetails(t *testing.T) {
+	t.Run("list object versions", func(t *testing.T) {
+		output := make(chan s3.ObjectVersion, 5000)
+		count, err := S3QueueObjectVersionDetails(context.TODO(), s3svc, "randombucket", "", output)
+		if err != nil {
+			t.Errorf("S3QueueObjectVersionDetails() error = %v", err)
+			return
+		}
+		close(output)
+
+		objCount := 0
+		for range output {
+			objCount++
+		}
+		if objCount != count || objCount != 4000 {
+			t.Errorf("S3QueueObjectVersionDetails() queued %d objects, returned count %d, want 4000", objCount, count)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		output := make(chan s3.ObjectVersion, 5000)
+		count, err := S3QueueObjectVersionDetails(context.TODO(), s3svc, "randombucket", "empty/", output)
+		if err != nil || count != 0 {
+			t.Errorf("S3QueueObjectVersionDetails() = %d, %v, want no objects under prefix", count, err)
+		}
+	})
+
+	t.Run("failure on list object versions", func(t *testing.T) {
+		output := make(chan s3.ObjectVersion, 5000)
+		_, err := S3QueueObjectVersionDetails(context.TODO(), s3svc, "failbucket", "", output)
+		if err == nil {
+			t.Errorf("S3QueueObjectVersionDetails() expected error")
+		}
+	})
+
+	t.Run("canceled while the queue is full", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		output := make(chan s3.ObjectVersion, 10)
+		done := make(chan error)
+		go func() {
+			_, err := S3QueueObjectVersionDetails(ctx, s3svc, "randombucket", "", output)
+			done <- err
+		}()
+		for len(output) < cap(output) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("S3QueueObjectVersionDetails() error = %v, want %v", err, context.Canceled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("S3QueueObjectVersionDetails() is still blocked on the full queue after being canceled")
+		}
+	})
+}
+
+func TestS3QueueSelectedVersionDetails(t *testing.T) {
+	set := selection.Set{
+		Prefixes: []string{"selected/b/"},
+		Keys:     []string{"selected/a", "selected/b/c"},
+	}
+	output := make(chan s3.ObjectVersion, 10)
+	count, err := S3QueueSelectedVersionDetails(context.TODO(), s3svc, "randombucket", set, output)
+	if err != nil {
+		t.Fatalf("S3QueueSelectedVersionDetails() error = %v", err)
+	}
+	close(output)
+
+	got := []string{}
+	for v := range output {
+		got = append(got, *v.Key)
+	}
+	want := []string{"selected/b/c", "selected/b/d", "selected/a"}
+	if count != len(want) || !reflect.DeepEqual(got, want) {
+		t.Errorf("S3QueueSelectedVersionDetails() queued %v (count %d), want %v", got, count, want)
+	}
+
+	if _, err := S3QueueSelectedVersionDetails(context.TODO(), s3svc, "failbucket", set, make(chan s3.ObjectVersion, 10)); err == nil {
+		t.Errorf("S3QueueSelectedVersionDetails() expected error")
+	}
+}
+
+func TestS3ArchiveFromChannel(t *testing.T) {
+	versions := []s3.ObjectVersion{
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("current"), VersionID: ptrString("v2")}, IsLatest: true},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("current"), VersionID: ptrString("v1")}, IsLatest: false},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("deleted"), VersionID: ptrString("v3")}, IsDeleteMarker: true, IsLatest: true},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("getfailure"), VersionID: ptrString("v4")}, IsLatest: true},
+	}
+
+	tests := []struct {
+		name         string
+		allVersions  bool
+		archiver     *archiverMock
+		wantArchived []string
+		wantOutput   int
+		wantFailures int
+		wantErr      bool
+	}{
+		{
+			name:         "current versions only",
+			archiver:     &archiverMock{entries: map[string]string{}},
+			wantArchived: []string{"current"},
+			wantOutput:   3,
+			wantFailures: 1,
+		},
+		{
+			name:         "all versions",
+			allVersions:  true,
+			archiver:     &archiverMock{entries: map[string]string{}},
+			wantArchived: []string{"current", ".versions/current/v1"},
+			wantOutput:   3,
+			wantFailures: 1,
+		},
+		{
+			name:        "archive sync failure blocks deletion",
+			allVersions: true,
+			archiver:    &archiverMock{entries: map[string]string{}, failSync: true},
+			wantOutput:  1,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := make(chan s3.ObjectVersion, len(versions))
+			for _, v := range versions {
+				input <- v
+			}
+			close(input)
+			output := make(chan s3.ObjectVersion, len(versions))
+			failures := make(chan []s3.ObjectIdentifier, len(versions))
+
+			got, err := S3ArchiveFromChannel(context.TODO(), s3svc, "testbucket", tt.archiver, tt.allVersions, input, output, failures)
+			close(output)
+			close(failures)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("S3ArchiveFromChannel() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			outputCount := 0
+			for object := range output {
+				outputCount++
+				if *object.Key == "getfailure" {
+					t.Errorf("S3ArchiveFromChannel() released object that failed to download")
+				}
+			}
+			if outputCount != tt.wantOutput {
+				t.Errorf("S3ArchiveFromChannel() released %d objects, want %d", outputCount, tt.wantOutput)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got != len(tt.wantArchived) {
+				t.Errorf("S3ArchiveFromChannel() = %d, want %d", got, len(tt.wantArchived))
+			}
+			for _, name := range tt.wantArchived {
+				if _, ok := tt.archiver.entries[name]; !ok {
+					t.Errorf("S3ArchiveFromChannel() archive missing entry %s", name)
+				}
+			}
+			if !tt.archiver.synced {
+				t.Errorf("S3ArchiveFromChannel() archive was never synced")
+			}
+
+			failureCount := 0
+			for f := range failures {
+				failureCount += len(f)
+			}
+			if failureCount != tt.wantFailures {
+				t.Errorf("S3ArchiveFromChannel() failures = %d, want %d", failureCount, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestS3ArchiveFromChannel_unsafeKeys(t *testing.T) {
+	keys := []string{"../escape", "/absolute", "a/../../escape", "safe/..name"}
+	input := make(chan s3.ObjectVersion, len(keys))
+	for _, k := range keys {
+		input <- s3.ObjectVersion{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString(k), VersionID: ptrString("v1")}, IsLatest: true}
+	}
+	close(input)
+	output := make(chan s3.ObjectVersion, len(keys))
+	failures := make(chan []s3.ObjectIdentifier, len(keys))
+	archiver := &archiverMock{entries: map[string]string{}}
+
+	got, err := S3ArchiveFromChannel(context.TODO(), s3svc, "testbucket", archiver, true, input, output, failures)
+	close(output)
+	close(failures)
+	if err != nil {
+		t.Fatalf("S3ArchiveFromChannel() error = %v", err)
+	}
+	if got != 1 || len(archiver.entries) != 1 || archiver.entries["safe/..name"] == "" {
+		t.Errorf("S3ArchiveFromChannel() archived %v, want only safe/..name", archiver.entries)
+	}
+	if len(output) != 1 {
+		t.Errorf("S3ArchiveFromChannel() released %d objects, want 1", len(output))
+	}
+	failureCount := 0
+	for f := range failures {
+		failureCount += len(f)
+	}
+	if failureCount != 3 {
+		t.Errorf("S3ArchiveFromChannel() failures = %d, want 3", failureCount)
+	}
+}
+
+func TestArchiveWriter(t *testing.T) {
+	// local write failures stop the archive
+	_, err := io.Copy(archiveWriter{failingWriter{}}, strings.NewReader("contents"))
+	var writeErr archiveWriteError
+	if !errors.As(err, &writeErr) {
+		t.Errorf("io.Copy() to archiveWriter error = %v, want archiveWriteError", err)
+	}
+
+	// download failures are left to be retried
+	_, err = io.Copy(archiveWriter{io.Discard}, io.MultiReader(strings.NewReader("contents"), failingReader{}))
+	if err == nil || errors.As(err, &writeErr) {
+		t.Errorf("io.Copy() from failing body error = %v, want a download error", err)
+	}
+}
+
+func TestS3CopyFromChannel(t *testing.T) {
+	versions := []s3.ObjectVersion{
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("current"), VersionID: ptrString("v2")}, IsLatest: true, Size: 10},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("current"), VersionID: ptrString("v1")}, IsLatest: false, Size: 5},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("deleted"), VersionID: ptrString("v3")}, IsDeleteMarker: true, IsLatest: true},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString("copyfailure"), VersionID: ptrString("v4")}, IsLatest: true, Size: 1},
+	}
+
+	tests := []struct {
+		name         string
+		allVersions  bool
+		wantCopied   int
+		wantOutput   int
+		wantFailures int
+	}{
+		{
+			name:         "current versions only",
+			wantCopied:   1,
+			wantOutput:   3,
+			wantFailures: 1,
+		},
+		{
+			name:         "all versions",
+			allVersions:  true,
+			wantCopied:   2,
+			wantOutput:   3,
+			wantFailures: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := make(chan s3.ObjectVersion, len(versions))
+			for _, v := range versions {
+				input <- v
+			}
+			close(input)
+			output := make(chan s3.ObjectVersion, len(versions))
+			failures := make(chan []s3.ObjectIdentifier, len(versions))
+
+			got, err := S3CopyFromChannel(context.TODO(), s3svc, "testbucket", "backupbucket", "backup/", tt.allVersions, input, output, failures)
+			close(output)
+			close(failures)
+			if err != nil {
+				t.Errorf("S3CopyFromChannel() error = %v", err)
+				return
+			}
+			if got != tt.wantCopied {
+				t.Errorf("S3CopyFromChannel() = %d, want %d", got, tt.wantCopied)
+			}
+
+			outputCount := 0
+			for version := range output {
+				outputCount++
+				if *version.Key == "copyfailure" {
+					t.Errorf("S3CopyFromChannel() released object that failed to copy")
+				}
+			}
+			if outputCount != tt.wantOutput {
+				t.Errorf("S3CopyFromChannel() released %d objects, want %d", outputCount, tt.wantOutput)
+			}
+
+			failureCount := 0
+			for f := range failures {
+				failureCount += len(f)
+			}
+			if failureCount != tt.wantFailures {
+				t.Errorf("S3CopyFromChannel() failures = %d, want %d", failureCount, tt.wantFailures)
+			}
+		})
+	}
+}
+
 // ====
 
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+type archiverMock struct {
+	entries  map[string]string
+	synced   bool
+	failSync bool
+}
+
+func (a *archiverMock) Add(name string, size int64, modTime time.Time, body io.Reader) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) != size {
+		return errors.New("size mismatch")
+	}
+	a.entries[name] = string(b)
+	return nil
+}
+
+func (a *archiverMock) Sync() error {
+	if a.failSync {
+		return errors.New("simulated sync failure")
+	}
+	a.synced = true
+	return nil
+}
+
 type S3ServiceMock struct {
 }
 
+func (s S3ServiceMock) DeleteObjectsDetailed(ctx context.Context, bucketName string, objects []s3.ObjectIdentifier) (*s3.DeleteResult, error) {
+	if bucketName == "throttledbucket" {
+		return nil, &smithy.GenericAPIError{Code: "SlowDown"}
+	}
+	deleted, err := s.DeleteObjects(ctx, bucketName, objects)
+	if err != nil {
+		return nil, err
+	}
+	result := &s3.DeleteResult{Deleted: deleted, Errors: []s3.DeleteError{}}
+	if bucketName == "failurechanbucket" {
+		for _, object := range objects[:3] {
+			result.Errors = append(result.Errors, s3.DeleteError{ObjectIdentifier: object, Code: "AccessDenied"})
+		}
+	}
+	return result, nil
+}
+
 func (s S3ServiceMock) DeleteObjects(ctx context.Context, bucketName string, objects []s3.ObjectIdentifier) ([]s3.ObjectIdentifier, error) {
 	switch bucketName {
 	case "failbucket":
@@ -482,6 +913,18 @@ func (s S3ServiceMock) ListObjectVersions(ctx context.Context, bucketName string
 	if bucketName == "failbucket" {
 		return nil, nil, nil, errors.New("simulated failure")
 	}
+	if prefix != nil && *prefix == "empty/" {
+		return []s3.ObjectVersion{}, nil, nil, nil
+	}
+	if prefix != nil && strings.HasPrefix(*prefix, "selected/") {
+		o := []s3.ObjectVersion{}
+		for _, k := range []string{"selected/a", "selected/a.bak", "selected/b/c", "selected/b/d"} {
+			if strings.HasPrefix(k, *prefix) {
+				o = append(o, s3.ObjectVersion{ObjectIdentifier: s3.ObjectIdentifier{Key: ptrString(k), VersionID: &version}})
+			}
+		}
+		return o, nil, nil, nil
+	}
 
 	keyMarkerStates := []string{
 		"firstKey",
@@ -522,6 +965,53 @@ func (s S3ServiceMock) ListObjectVersions(ctx context.Context, bucketName string
 
 }
 
+func (s S3ServiceMock) GetObject(ctx context.Context, bucketName string, keyName string, versionID *string) (*s3.Object, error) {
+	if keyName == "getfailure" {
+		return nil, errors.New("simulated failure")
+	}
+
+	body := "contents of " + keyName
+	return &s3.Object{
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		VersionID:     versionID,
+	}, nil
+}
+
+func (s S3ServiceMock) CopyObject(ctx context.Context, srcBucket string, srcKey string, srcVersionID *string, size int64, dstBucket string, dstKey string) error {
+	if srcKey == "copyfailure" {
+		return errors.New("simulated failure")
+	}
+	if dstBucket != "backupbucket" || !strings.HasPrefix(dstKey, "backup/") {
+		return fmt.Errorf("unexpected copy destination %s/%s", dstBucket, dstKey)
+	}
+	return nil
+}
+
+func (s S3ServiceMock) GetBucketTags(ctx context.Context, bucketName string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (s S3ServiceMock) IsReplicationSource(ctx context.Context, bucketName string) (bool, error) {
+	return false, nil
+}
+
+func (s S3ServiceMock) IsObjectLockEnabled(ctx context.Context, bucketName string) (bool, error) {
+	return false, nil
+}
+
+func (s S3ServiceMock) ListPrefix(ctx context.Context, bucketName string, prefix string, continuationToken *string) (*s3.PrefixListing, error) {
+	return &s3.PrefixListing{Prefixes: []string{}, Objects: []s3.ObjectSummary{}}, nil
+}
+
+func (s S3ServiceMock) ListVersionPrefix(ctx context.Context, bucketName string, prefix string, keyMarker *string, versionIDMarker *string) (*s3.VersionListing, error) {
+	return &s3.VersionListing{Prefixes: []string{}, Versions: []s3.ObjectVersion{}}, nil
+}
+
+func (s S3ServiceMock) GetBucketVersioning(ctx context.Context, bucketName string) (*s3.BucketVersioning, error) {
+	return &s3.BucketVersioning{Status: "Enabled"}, nil
+}
+
 func ptrString(s string) *string {
 	return &s
 }
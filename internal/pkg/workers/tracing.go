@@ -0,0 +1,24 @@
+package workers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type workerIndexKey struct{}
+
+// WithWorkerIndex returns a copy of `ctx` identifying the worker it is passed to.
+// The index is recorded on the trace spans created by that worker.
+func WithWorkerIndex(ctx context.Context, index int) context.Context {
+	return context.WithValue(ctx, workerIndexKey{}, index)
+}
+
+// spanAttributes returns the attributes common to all spans created by a worker
+func spanAttributes(ctx context.Context, bucket string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("bucket", bucket)}
+	if index, ok := ctx.Value(workerIndexKey{}).(int); ok {
+		attrs = append(attrs, attribute.Int("worker.index", index))
+	}
+	return attrs
+}
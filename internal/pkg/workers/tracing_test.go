@@ -0,0 +1,59 @@
+package workers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWorkerSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	ctx := WithWorkerIndex(context.TODO(), 3)
+
+	input := make(chan s3.ObjectIdentifier, 1500)
+	for i := 0; i < 1500; i++ {
+		k := "key" + strconv.Itoa(i)
+		input <- s3.ObjectIdentifier{Key: &k, VersionID: &version}
+	}
+	close(input)
+	if _, err := S3DeleteFromChannel(ctx, s3svc, "randombucket", input, nil, nil, nil); err != nil {
+		t.Fatalf("S3DeleteFromChannel() error = %v", err)
+	}
+
+	output := make(chan s3.ObjectVersion, 5000)
+	if _, err := S3QueueObjectVersionDetails(context.TODO(), s3svc, "randombucket", "", output); err != nil {
+		t.Fatalf("S3QueueObjectVersionDetails() error = %v", err)
+	}
+
+	batchSizes := map[string][]int64{}
+	for _, span := range recorder.Ended() {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, attr := range span.Attributes() {
+			attrs[attr.Key] = attr.Value
+		}
+		if attrs["bucket"].AsString() != "randombucket" {
+			t.Errorf("span %s bucket = %v, want randombucket", span.Name(), attrs["bucket"])
+		}
+		if span.Name() == "DeleteObjects" && attrs["worker.index"].AsInt64() != 3 {
+			t.Errorf("span %s worker.index = %v, want 3", span.Name(), attrs["worker.index"])
+		}
+		batchSizes[span.Name()] = append(batchSizes[span.Name()], attrs["batch.size"].AsInt64())
+	}
+
+	if got := batchSizes["DeleteObjects"]; len(got) != 2 || got[0] != 1000 || got[1] != 500 {
+		t.Errorf("DeleteObjects span batch sizes = %v, want [1000 500]", got)
+	}
+	if got := batchSizes["ListObjectVersions"]; len(got) != 4 {
+		t.Errorf("ListObjectVersions spans = %d, want one per page (4)", len(got))
+	}
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"time"
 
@@ -14,14 +21,34 @@ import (
 	"github.com/briandowns/spinner"
 	"github.com/dustin/go-humanize"
 	"github.com/manifoldco/promptui"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"github.com/schollz/progressbar/v3"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/archive"
 	"github.com/soapiestwaffles/s3-nuke/internal/pkg/assets"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/audit"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/browse"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/bucketinfo"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/confirm"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/output"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/plan"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/pricing"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/protection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/report"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/settings"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/tracing"
 	"github.com/soapiestwaffles/s3-nuke/internal/pkg/ui/tui"
 	"github.com/soapiestwaffles/s3-nuke/internal/pkg/workers"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	awsconfig "github.com/soapiestwaffles/s3-nuke/pkg/aws/config"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/sts"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -37,16 +64,73 @@ var (
 		Version     bool   `help:"display version information" optional:""`
 		AWSEndpoint string `help:"override AWS endpoint address" short:"e" optional:"" env:"AWS_ENDPOINT"`
 		Profile     string `help:"AWS profile to use for authentication" short:"p" optional:"" env:"AWS_PROFILE"`
+
+		RoleARN         string `help:"IAM role to assume with the profile's credentials (e.g. to nuke buckets in another account)" optional:"" name:"role-arn"`
+		ExternalID      string `help:"external ID required to assume --role-arn" optional:""`
+		RoleSessionName string `help:"session name used when assuming --role-arn (default: s3-nuke)" optional:""`
+		MFASerial       string `help:"serial number or ARN of the MFA device required to assume --role-arn, the MFA code is asked for" optional:"" name:"mfa-serial"`
+		MFADeleteSerial string `help:"serial number or ARN of the bucket owner's MFA device, for buckets with MFA Delete enabled (asked for if needed)" optional:"" name:"mfa-delete-serial"`
+		MFADeleteCode   string `help:"current MFA code for buckets with MFA Delete enabled, a new code is asked for once it expires" optional:"" name:"mfa-delete-code"`
+		ExpectedOwner   string `help:"account ID the bucket must be owned by, sent with every request to the bucket (default: the caller's account)" optional:""`
+
 		Concurrency int    `help:"amount of concurrency used during delete operations" optional:"" default:"5"`
 		Debug       bool   `help:"enable debugging output (warning: this is very verbose)" optional:""`
 		Warn        bool   `help:"display warning messages" optional:""`
+		MetricsAddr string `help:"serve Prometheus metrics at /metrics on this address (e.g. :9090)" optional:""`
+		Output      string `help:"output format (text, json). json writes versioned events to stdout, one JSON object per line" optional:"" enum:"text,json" default:"text"`
+
+		TraceOTLPEndpoint string `help:"send OpenTelemetry traces to this OTLP/HTTP endpoint (e.g. http://localhost:4318)" optional:"" name:"trace-otlp-endpoint"`
+		TraceFile         string `help:"write OpenTelemetry traces to this file as JSON" optional:"" type:"path"`
+
+		ConfigProfile  string `help:"named profile of settings to use from the s3-nuke config file" optional:"" env:"S3_NUKE_CONFIG_PROFILE"`
+		AuditLog       string `help:"append an audit record of every nuke to this file" optional:"" type:"path"`
+		Report         string `help:"write a detailed report of the nuke to this file (.md or .html)" optional:"" type:"path"`
+		PricingFile    string `help:"YAML file of S3 prices overriding the built-in pricing table used for cost estimates" optional:"" type:"path"`
+		Confirmation   string `help:"confirmation challenge to present before nuking (phrase, bucket-name, bucket-name-reversed, object-count, arithmetic, totp), rules in the config file can require a stronger one" optional:"" enum:"phrase,bucket-name,bucket-name-reversed,object-count,arithmetic,totp" default:"phrase"`
+		ConfirmAccount bool   `help:"also require typing the last four digits of the AWS account ID to confirm a nuke" optional:""`
+
+		ConfirmationTOTPSecret string `help:"base32 secret shared by the team for the totp confirmation challenge" optional:"" name:"confirmation-totp-secret" env:"S3_NUKE_CONFIRMATION_TOTP_SECRET"`
+
+		EarlyDeletion string `help:"what to do with object versions still inside the minimum storage duration of their storage class (ask, delete, skip, postpone)" optional:"" enum:"ask,delete,skip,postpone" default:"ask"`
+		PostponeFile  string `help:"file listing the object versions postponed by --early-deletion=postpone" optional:"" type:"path" default:"s3-nuke.postponed.jsonl"`
+
+		Archive            string `help:"archive objects to a local .tar.gz or .tar.zst file before deleting them" optional:"" type:"path"`
+		ArchiveAllVersions bool   `help:"include noncurrent object versions in the archive (without it, noncurrent versions, including every version of an object whose latest version is a delete marker, are deleted without being archived)" optional:""`
+
+		BackupBucket      string `help:"copy objects into this bucket before deleting them" optional:""`
+		BackupPrefix      string `help:"key prefix for objects copied into the backup bucket" optional:""`
+		BackupRegion      string `help:"region of the backup bucket (auto-detected if not set)" optional:""`
+		BackupProfile     string `help:"AWS profile to use for the backup bucket (defaults to --profile)" optional:""`
+		BackupAllVersions bool   `help:"include noncurrent object versions in the backup" optional:""`
+
+		ProtectionConfig   string `help:"protection policy file listing buckets that must never be nuked" optional:"" type:"path" default:"~/.config/s3-nuke/protection.yaml"`
+		OverrideProtection bool   `help:"allow nuking buckets that are protected by the protection policy (dangerous!)" optional:""`
+		ProjectProtection  bool   `help:"use the protection settings of the .s3-nuke.yaml in the current directory, which can only add to the protection policy" optional:""`
+
+		Prefix      string `help:"only nuke objects whose keys start with this prefix" optional:""`
+		Browse      bool   `help:"browse the prefixes of the selected bucket and mark the prefixes and objects to nuke" optional:""`
+		SortBuckets string `help:"order of buckets in the bucket picker (name, age: newest first, size: largest first)" optional:"" enum:"name,age,size" default:"name"`
+		Dashboard   bool   `help:"show a full-screen dashboard while nuking, with keys to pause, resume and change the concurrency" optional:""`
+
+		Nuke  struct{} `cmd:"" default:"1" help:"select a bucket and nuke it (default)"`
+		Plan  planCmd  `cmd:"" help:"list a bucket and write a plan file which can be reviewed and applied later"`
+		Apply applyCmd `cmd:"" help:"nuke the bucket described by a plan file"`
+		Du    duCmd    `cmd:"" help:"show how much space the prefixes of a bucket use, like du"`
 	}
 )
 
 func main() {
+	config, err := settings.Load(settings.DefaultPaths...)
+	if err != nil {
+		fmt.Println("Error loading config file!", err)
+		exit(1)
+	}
+
 	kongCtx := kong.Parse(&cli,
 		kong.Name("s3-nuke"),
-		kong.Description("Quickly destroy all objects and versions in an AWS S3 bucket."))
+		kong.Description("Quickly destroy all objects and versions in an AWS S3 bucket."),
+		kong.Resolvers(config.Resolver()),
+		kong.Exit(exit))
 
 	if _, regionEnv := os.LookupEnv("AWS_REGION"); !regionEnv {
 		if err := os.Setenv("AWS_REGION", "us-east-1"); err != nil {
@@ -54,6 +138,14 @@ func main() {
 		}
 	}
 
+	events, err = output.New(os.Stdout, cli.Output)
+	kongCtx.FatalIfErrorf(err)
+	if events.Enabled() {
+		// stdout is reserved for JSON events, so everything meant for people (including prompts, which write to
+		// os.Stdout as it is when they are shown) is written to stderr instead
+		os.Stdout = os.Stderr
+	}
+
 	fmt.Println(assets.Logo)
 
 	//  Show version information and exit
@@ -63,15 +155,25 @@ func main() {
 		fmt.Println("version....:", version)
 		fmt.Println("commit.....:", commit)
 		fmt.Println("date.......:", date)
-		os.Exit(0)
+		exit(0)
 	}
 
 	if cli.AWSEndpoint != "" {
 		fmt.Println("Using AWS endpoint:", cli.AWSEndpoint)
 	}
+	if cli.ConfigProfile != "" {
+		fmt.Println("Using config profile:", cli.ConfigProfile)
+	}
 
 	ctx := context.Background()
 
+	auditLog, err := audit.Open(cli.AuditLog)
+	if err != nil {
+		fmt.Println("Error opening audit log!", err)
+		exit(1)
+	}
+	cleanups = append(cleanups, func(int) { _ = auditLog.Close() })
+
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, NoColor: false})
 	if cli.Debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -82,17 +184,314 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
 	}
 
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		OTLPEndpoint:   cli.TraceOTLPEndpoint,
+		File:           cli.TraceFile,
+		ServiceVersion: version,
+	})
+	if err != nil {
+		fmt.Println("Error setting up tracing!", err)
+		exit(1)
+	}
+	cleanups = append(cleanups, func(int) {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Warn().Err(err).Msg("could not flush traces")
+		}
+	})
+
+	// Each run is traced as a single root span
+	ctx, rootSpan := tracing.Start(ctx, "s3-nuke "+strings.Fields(kongCtx.Command())[0])
+	cleanups = append(cleanups, func(code int) {
+		if code != 0 {
+			rootSpan.SetStatus(codes.Error, fmt.Sprintf("exit code %d", code))
+		}
+		rootSpan.End()
+	})
+
+	if cli.Report != "" {
+		if _, err := report.FormatFromPath(cli.Report); err != nil {
+			fmt.Println("error:", err)
+			exit(1)
+		}
+		if _, err := os.Stat(cli.Report); err == nil {
+			fmt.Println("error: report file", cli.Report, "already exists")
+			exit(1)
+		}
+	}
+
+	if cli.Browse {
+		if command := strings.Fields(kongCtx.Command())[0]; command != "nuke" {
+			fmt.Printf("error: --browse cannot be used with %s\n", command)
+			exit(1)
+		}
+		if cli.Prefix != "" {
+			fmt.Println("error: --browse and --prefix cannot be used together")
+			exit(1)
+		}
+	}
+
+	if cli.MetricsAddr != "" {
+		metricsAddr, err := serveMetrics(cli.MetricsAddr)
+		if err != nil {
+			fmt.Println("Error starting metrics server!", err)
+			exit(1)
+		}
+		fmt.Printf("Serving metrics at http://%s/metrics\n", metricsAddr)
+	}
+
+	// Load the protection policy. Protection settings from the config file are applied first, and can only add to
+	// the default policy, then the protection policy file.
+	configProfile, err := config.Profile(cli.ConfigProfile)
+	kongCtx.FatalIfErrorf(err)
+	if !cli.ProjectProtection && slices.Contains(configProfile.ProtectionPaths, settings.ProjectPath) {
+		fmt.Printf("error: %s in the current directory has protection settings, pass --project-protection to use them\n", settings.ProjectPath)
+		exit(1)
+	}
+	policy := protection.DefaultPolicy()
+	kongCtx.FatalIfErrorf(configProfile.DecodeProtection(&protection.ConfigPolicy{Policy: &policy}))
+	policy, err = protection.LoadPolicyFile(cli.ProtectionConfig, policy)
+	if err != nil {
+		fmt.Println("Error loading protection policy!", err)
+		exit(1)
+	}
+	kongCtx.FatalIfErrorf(configProfile.DecodeChallenges(&challenges))
+	// a confirmation challenge from the config file is a minimum, the command line can only ask for a stronger one
+	for _, value := range configProfile.Values("confirmation") {
+		name, _ := value.(string)
+		if !slices.Contains(confirm.Names, name) {
+			fmt.Printf("error: unknown confirmation challenge %q in the config file (available challenges: %v)\n", value, confirm.Names)
+			exit(1)
+		}
+		cli.Confirmation = confirm.Stronger(cli.Confirmation, name)
+	}
+	if err := checkChallenges(); err != nil {
+		fmt.Println("Error loading confirmation challenges!", err)
+		exit(1)
+	}
+
+	prices, err := pricing.LoadFile(cli.PricingFile, pricing.Default())
+	if err != nil {
+		fmt.Println("Error loading pricing file!", err)
+		exit(1)
+	}
+
+	assumeRole = setupAssumeRole(ctx)
+
 	// Set up S3 client
-	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile))
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole))
 
-	// Get list of buckets
+	switch kongCtx.Command() {
+	case "plan", "plan <bucket>":
+		runPlan(ctx, kongCtx, s3svc, policy, auditLog)
+	case "apply <plan-file>":
+		runApply(ctx, kongCtx, s3svc, policy, prices, auditLog)
+	case "du", "du <bucket>":
+		runDu(ctx, kongCtx, s3svc, policy)
+	default:
+		runNuke(ctx, kongCtx, s3svc, policy, prices, auditLog)
+	}
+
+	exit(0)
+}
+
+// cleanups are run in reverse order by exit(), and are passed the exit code
+var cleanups []func(code int)
+
+// events receives machine-readable output when --output=json is used, and is nil otherwise
+var events *output.Writer
+
+// assumeRole is the role assumed by every AWS client when --role-arn is used, and is nil otherwise
+var assumeRole *awsconfig.AssumeRole
+
+// expectedOwner is the account ID the nuked bucket must be owned by, set from --expected-owner or the caller identity
+var expectedOwner string
+
+// challenges selects the confirmation challenge for the bucket being nuked, from the challenges in the config file
+var challenges confirm.Policy
+
+// exit runs the registered cleanups, such as flushing traces, then exits the program with `code`
+func exit(code int) {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i](code)
+	}
+	os.Exit(code)
+}
+
+// setupAssumeRole returns the role to assume from --role-arn, or nil if no role is used. The role is assumed straight
+// away, so the MFA code prompt is shown before any spinner and a role which cannot be assumed is reported early.
+func setupAssumeRole(ctx context.Context) *awsconfig.AssumeRole {
+	role, err := awsconfig.NewAssumeRole(cli.RoleARN, cli.ExternalID, cli.RoleSessionName, cli.MFASerial, func() (string, error) {
+		return tui.PromptMFAToken(cli.MFASerial)
+	})
+	if err != nil {
+		fmt.Println("error:", err)
+		exit(1)
+	}
+	if role == nil {
+		return nil
+	}
+
+	log.Debug().Str("role", cli.RoleARN).Msg("sts: assume role")
+	cfg, err := awsconfig.NewWithProfile(os.Getenv("AWS_REGION"), cli.Profile, awsconfig.WithAssumeRole(role), awsconfig.WithAWSEndpoint(cli.AWSEndpoint))
+	if err == nil {
+		_, err = cfg.Credentials.Retrieve(ctx)
+	}
+	if err != nil {
+		fmt.Println("Error assuming role!", err)
+		exit(1)
+	}
+	fmt.Println("🔑 assumed role", cli.RoleARN)
+	fmt.Println("")
+
+	return role
+}
+
+// bucketOwner returns the account ID the bucket must be owned by: --expected-owner, or the account of `identity`.
+// The program exits if --expected-owner is not an account ID.
+func bucketOwner(identity *sts.CallerIdentity) string {
+	if cli.ExpectedOwner == "" {
+		return identity.AccountID
+	}
+	if !accountIDPattern.MatchString(cli.ExpectedOwner) {
+		fmt.Printf("error: --expected-owner %q is not a 12 digit AWS account ID\n", cli.ExpectedOwner)
+		exit(1)
+	}
+	if cli.ExpectedOwner != identity.AccountID {
+		fmt.Println("🛡️  the bucket must be owned by account", cli.ExpectedOwner)
+		fmt.Println("")
+	}
+	return cli.ExpectedOwner
+}
+
+// accountIDPattern matches AWS account IDs
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// backupAssumeRole returns the role to assume for the backup bucket. The backup bucket is accessed with --role-arn
+// unless a separate --backup-profile was given.
+func backupAssumeRole() *awsconfig.AssumeRole {
+	if cli.BackupProfile != "" {
+		return nil
+	}
+	return assumeRole
+}
+
+// runNuke interactively selects a bucket and nukes it
+func runNuke(ctx context.Context, kongCtx *kong.Context, s3svc s3.Service, policy protection.Policy, prices *pricing.Table, auditLog *audit.Log) {
+	// the expected owner is sent by the bucket picker and protection checks too
+	identity := callerIdentity(ctx, kongCtx)
+	expectedOwner = bucketOwner(identity)
+	selectedBucket, protectionReasons := selectBucket(ctx, kongCtx, s3svc, policy)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("bucket", selectedBucket))
+	alias := accountAlias(ctx)
+	bucketRegion := detectBucketRegion(ctx, kongCtx, selectedBucket)
+	set := nukeSelection(ctx, selectedBucket, bucketRegion)
+	mfa := checkMFADelete(ctx, kongCtx, selectedBucket, bucketRegion)
+	objectCount := showObjectCount(ctx, kongCtx, selectedBucket, bucketRegion)
+	estimate := showCostEstimate(ctx, kongCtx, prices, selectedBucket, bucketRegion, objectCount)
+	earlyDeletion := checkEarlyDeletion(ctx, kongCtx, prices, selectedBucket, bucketRegion, set, estimate)
+
+	// Warning message
+	fmt.Println("⚠️   !!! WARNING !!!  ⚠️")
+	switch {
+	case cli.Browse:
+		fmt.Println("This will destroy all versions of the marked objects and of all objects under the marked prefixes in the selected bucket:")
+		for _, prefix := range set.Prefixes {
+			fmt.Printf("   📁 %s\n", prefixLabel(prefix))
+		}
+		for _, key := range set.Keys {
+			fmt.Printf("      %s\n", key)
+		}
+	case cli.Prefix != "":
+		fmt.Printf("This will destroy all versions of all objects under the prefix %q in the selected bucket\n", cli.Prefix)
+	default:
+		fmt.Println("This will destroy all versions of all objects in the selected bucket")
+	}
+	fmt.Println("")
+	backupRegion, backupProfile := preparePreservation(ctx, selectedBucket, set)
+
+	target := confirmationTarget(ctx, selectedBucket, bucketRegion, objectCount, estimate)
+	if !confirmNuke(target, bucketRegion, identity, alias, auditLog) {
+		return
+	}
+
+	// the object count of the bucket says little about how many of its objects were marked
+	estimatedTotal := objectCount
+	if cli.Browse {
+		estimatedTotal = 0
+	}
+
+	runAudited(ctx, auditLog, map[string]interface{}{
+		"bucket":        selectedBucket,
+		"region":        bucketRegion,
+		"accountID":     identity.AccountID,
+		"accountAlias":  alias,
+		"prefix":        cli.Prefix,
+		"selection":     set,
+		"profile":       cli.Profile,
+		"endpoint":      cli.AWSEndpoint,
+		"configProfile": cli.ConfigProfile,
+		"protected":     len(protectionReasons) > 0,
+		"earlyDeletion": earlyDeletion,
+		"roleARN":       cli.RoleARN,
+		"mfaDelete":     mfa != nil,
+		"expectedOwner": expectedOwner,
+	}, nukeOptions{
+		awsEndpoint:        cli.AWSEndpoint,
+		profile:            cli.Profile,
+		assumeRole:         assumeRole,
+		expectedOwner:      expectedOwner,
+		mfa:                mfa,
+		bucket:             selectedBucket,
+		bucketRegion:       bucketRegion,
+		selection:          set,
+		estimatedTotal:     estimatedTotal,
+		reportPath:         cli.Report,
+		prices:             prices,
+		earlyDeletion:      earlyDeletion,
+		postponePath:       cli.PostponeFile,
+		concurrency:        cli.Concurrency,
+		dashboard:          cli.Dashboard,
+		archivePath:        cli.Archive,
+		archiveAllVersions: cli.ArchiveAllVersions,
+		backupBucket:       cli.BackupBucket,
+		backupPrefix:       cli.BackupPrefix,
+		backupRegion:       backupRegion,
+		backupProfile:      backupProfile,
+		backupAssumeRole:   backupAssumeRole(),
+		backupAllVersions:  cli.BackupAllVersions,
+	})
+}
+
+// startSpinner starts a loading spinner displaying `message`. The spinner is not started when debug output or
+// JSON output is enabled.
+func startSpinner(kongCtx *kong.Context, message string) *spinner.Spinner {
 	loadingSpinner := spinner.New(spinner.CharSets[13], 100*time.Millisecond)
-	loadingSpinner.Suffix = " fetching bucket list..."
-	err := loadingSpinner.Color("blue", "bold")
-	kongCtx.FatalIfErrorf(err)
-	if !cli.Debug {
+	loadingSpinner.Suffix = " " + message
+	kongCtx.FatalIfErrorf(loadingSpinner.Color("blue", "bold"))
+	if !cli.Debug && !events.Enabled() {
 		loadingSpinner.Start()
 	}
+	return loadingSpinner
+}
+
+// selectBucket lets the user pick a bucket from the bucket picker, exiting if the selected bucket is protected.
+// The reasons the selected bucket is protected (if protection was overridden) are returned along with its name.
+func selectBucket(ctx context.Context, kongCtx *kong.Context, s3svc s3.Service, policy protection.Policy) (string, []string) {
+	selectedBucket, reasons := pickBucket(ctx, kongCtx, s3svc, policy, cli.OverrideProtection)
+	if !protectionAllows(selectedBucket, reasons, cli.OverrideProtection) {
+		exit(1)
+	}
+	return selectedBucket, reasons
+}
+
+// pickBucket lets the user pick a bucket from the bucket picker, showing protected buckets as locked. Protected buckets
+// can only be picked if `allowProtected` is set. The reasons the picked bucket is protected are returned along with
+// its name.
+func pickBucket(ctx context.Context, kongCtx *kong.Context, s3svc s3.Service, policy protection.Policy, allowProtected bool) (string, []string) {
+	// Get list of buckets
+	loadingSpinner := startSpinner(kongCtx, "fetching bucket list...")
 	log.Debug().Msg("s3: get all buckets")
 	buckets, err := s3svc.GetAllBuckets(ctx)
 	kongCtx.FatalIfErrorf(err)
@@ -101,98 +500,669 @@ func main() {
 	// Exit if there are no buckets to nuke
 	if len(buckets) == 0 {
 		fmt.Println("No buckets found! Exiting.")
-		os.Exit(0)
+		exit(0)
+	}
+
+	// Look up bucket details for the picker in the background
+	detailsCtx, stopDetails := context.WithCancel(ctx)
+	defer stopDetails()
+	details := newBucketDetailsLoader(detailsCtx)
+	names := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		names = append(names, *b.Name)
 	}
+	details.Start(names)
+
+	// Check which buckets are protected
+	loadingSpinner = startSpinner(kongCtx, "checking bucket protection...")
+	protectedBuckets := checkProtection(ctx, policy, buckets)
+	loadingSpinner.Stop()
+
+	if cli.SortBuckets == bucketinfo.SortSize {
+		loadingSpinner = startSpinner(kongCtx, "fetching bucket sizes...")
+	}
+	bucketinfo.Sort(buckets, cli.SortBuckets, details)
+	loadingSpinner.Stop()
+
+	bucketList := output.Buckets{Buckets: make([]output.Bucket, 0, len(buckets))}
+	for _, b := range buckets {
+		bucketList.Buckets = append(bucketList.Buckets, output.Bucket{Name: *b.Name, CreatedAt: b.CreationDate, Protected: protectedBuckets[*b.Name]})
+	}
+	_ = events.Emit(output.EventBuckets, bucketList)
 
 	// User select bucket
 	fmt.Println("")
-	selectedBucket, err := tui.SelectBucketsPrompt(buckets)
+	selectedBucket, err := tui.SelectBucketsPromptWithDetails(buckets, protectedBuckets, allowProtected, details.Get)
 	if err != nil {
 		fmt.Println("Error selecting bucket! Exiting.")
-		os.Exit(1)
+		exit(1)
 	}
 	fmt.Println("")
 
-	// autodetect bucket region
-	loadingSpinner.Suffix = " fetching bucket region..."
-	if !cli.Debug {
-		loadingSpinner.Start()
+	return selectedBucket, protectedBuckets[selectedBucket]
+}
+
+// newBucketDetailsLoader returns a loader looking up the details shown in the bucket picker, 10 buckets at a time
+func newBucketDetailsLoader(ctx context.Context) *bucketinfo.Loader {
+	return bucketinfo.NewLoader(ctx, bucketinfo.Services{
+		S3: func(region string) s3.Service {
+			if region == "" {
+				return s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+			}
+			return s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(region), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+		},
+		CloudWatch: func(region string) cloudwatch.Service {
+			return cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(region), cloudwatch.WithProfile(cli.Profile), cloudwatch.WithAssumeRole(assumeRole))
+		},
+	}, 10)
+}
+
+// checkBucketProtection checks a single bucket against the protection policy, exiting if the bucket is protected.
+// The reasons the bucket is protected (if protection was overridden) are returned.
+func checkBucketProtection(ctx context.Context, kongCtx *kong.Context, policy protection.Policy, bucket string) []string {
+	loadingSpinner := startSpinner(kongCtx, "checking bucket protection...")
+	reasons := checkProtection(ctx, policy, []s3.Bucket{{Name: &bucket}})[bucket]
+	loadingSpinner.Stop()
+
+	if !protectionAllows(bucket, reasons, cli.OverrideProtection) {
+		exit(1)
 	}
+	return reasons
+}
+
+// detectBucketRegion looks up the region of `bucket`, exiting if it cannot be found
+func detectBucketRegion(ctx context.Context, kongCtx *kong.Context, bucket string) string {
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+
+	loadingSpinner := startSpinner(kongCtx, "fetching bucket region...")
 	log.Debug().Msg("s3: get bucket region")
-	bucketRegion, err := s3svc.GetBucketRegion(ctx, selectedBucket)
+	spanCtx, span := tracing.Start(ctx, "detect bucket region", attribute.String("bucket", bucket))
+	bucketRegion, err := s3svc.GetBucketRegion(spanCtx, bucket)
+	span.SetAttributes(attribute.String("region", bucketRegion))
+	tracing.End(span, err)
 	loadingSpinner.Stop()
 	if err != nil {
 		fmt.Println("Error detecting bucket region!", err)
-		os.Exit(1)
+		exit(1)
 	}
 	fmt.Println("🌎 bucket located in", bucketRegion)
 	fmt.Println("")
+	_ = events.Emit(output.EventRegion, output.Region{Bucket: bucket, Region: bucketRegion})
+
+	return bucketRegion
+}
+
+// nukeSelection returns the prefixes and keys of `bucket` to nuke: those marked in the prefix browser with --browse,
+// or else --prefix. The program exits if nothing was marked.
+func nukeSelection(ctx context.Context, bucket string, bucketRegion string) selection.Set {
+	if !cli.Browse {
+		return prefixSelection(cli.Prefix)
+	}
+
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+	set, err := tui.BrowsePrefixes(bucket, browse.NewSource(ctx, s3svc, bucket, 5))
+	if err != nil {
+		fmt.Println("Error browsing bucket!", err)
+		exit(1)
+	}
+	fmt.Println("")
+	if set.Empty() {
+		fmt.Println("Nothing was marked. Exiting.")
+		exit(0)
+	}
+	fmt.Printf("🔖 %d prefixes and %d objects marked\n", len(set.Prefixes), len(set.Keys))
+	fmt.Println("")
+
+	return set
+}
+
+// prefixSelection returns the selection of every key starting with `prefix`, the whole bucket if it is empty
+func prefixSelection(prefix string) selection.Set {
+	return selection.Set{Prefixes: []string{prefix}}
+}
+
+// prefixLabel returns `prefix` as shown to the user
+func prefixLabel(prefix string) string {
+	if prefix == "" {
+		return "(entire bucket)"
+	}
+	return prefix
+}
+
+// checkMFADelete checks whether MFA Delete is enabled on `bucket`. If it is, the MFA device serial number is asked for
+// (unless given with --mfa-delete-serial) and the returned MFA asks for a new code whenever the current one expires.
+//
+// returns the MFA to send with delete requests, or nil if MFA Delete is not enabled
+func checkMFADelete(ctx context.Context, kongCtx *kong.Context, bucket string, bucketRegion string) *s3.MFA {
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+
+	loadingSpinner := startSpinner(kongCtx, "checking bucket versioning...")
+	versioning, err := s3svc.GetBucketVersioning(ctx, bucket)
+	loadingSpinner.Stop()
+	if err != nil {
+		log.Warn().Err(err).Str("bucket", bucket).Msg("could not check whether MFA Delete is enabled")
+		return nil
+	}
+	if !versioning.MFADelete {
+		return nil
+	}
+
+	fmt.Println("🔐 MFA Delete is enabled on this bucket, every delete request needs a code from the bucket owner's MFA device")
+	serial := cli.MFADeleteSerial
+	if serial == "" {
+		serial, err = tui.PromptMFASerial()
+		if err != nil {
+			fmt.Println("Command aborted!")
+			exit(1)
+		}
+	}
+	fmt.Println("")
+
+	code := cli.MFADeleteCode
+	return &s3.MFA{
+		Serial: serial,
+		TokenProvider: func() (string, error) {
+			// the code given on the command line is only used once, later codes are asked for
+			if code != "" {
+				first := code
+				code = ""
+				return first, nil
+			}
+			return tui.PromptMFAToken(serial)
+		},
+	}
+}
 
+// showObjectCount prints the bucket object count from CloudWatch metrics, if available
+//
+// returns the object count, or 0 if the metrics are not available
+func showObjectCount(ctx context.Context, kongCtx *kong.Context, bucket string, bucketRegion string) int64 {
 	// create cloudwatch svc
-	cloudwatchSvc := cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(bucketRegion), cloudwatch.WithProfile(cli.Profile))
+	cloudwatchSvc := cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(bucketRegion), cloudwatch.WithProfile(cli.Profile), cloudwatch.WithAssumeRole(assumeRole))
 
 	// Fetch bucket metrics
-	loadingSpinner.Suffix = " fetching bucket metrics..."
-	if !cli.Debug {
-		loadingSpinner.Start()
-	}
-	log.Debug().Str("bucket", selectedBucket).Msg("fetching cloudwatch bucket metrics")
-	objectCountResults, _ := cloudwatchSvc.GetS3ObjectCount(ctx, selectedBucket, 720, 60)
+	loadingSpinner := startSpinner(kongCtx, "fetching bucket metrics...")
+	log.Debug().Str("bucket", bucket).Msg("fetching cloudwatch bucket metrics")
+	spanCtx, span := tracing.Start(ctx, "fetch bucket metrics", attribute.String("bucket", bucket), attribute.String("region", bucketRegion))
+	objectCountResults, err := cloudwatchSvc.GetS3ObjectCount(spanCtx, bucket, 720, 60)
+	tracing.End(span, err)
 	loadingSpinner.Stop()
 
+	if objectCountResults != nil {
+		_ = events.Emit(output.EventMetrics, output.Metrics{
+			Bucket:  bucket,
+			Region:  bucketRegion,
+			Metrics: []output.Metric{output.NewMetric("NumberOfObjects", "AllStorageTypes", objectCountResults.Timestamps, objectCountResults.Values)},
+		})
+	}
+
 	if objectCountResults != nil && len(objectCountResults.Values) > 0 {
 		fmt.Printf("Bucket object count: %s\n", humanize.Comma(int64(objectCountResults.Values[0])))
 		fmt.Printf("(object count metric last updated %s @ %s)\n", humanize.Time(objectCountResults.Timestamps[0].Local()), objectCountResults.Timestamps[0].Local())
 		fmt.Println("")
-	} else {
-		log.Debug().Str("bucket", selectedBucket).Msg("bucket metrics were not available")
+		return int64(objectCountResults.Values[0])
 	}
 
-	// Warning message
-	fmt.Println("⚠️   !!! WARNING !!!  ⚠️")
-	fmt.Println("This will destroy all versions of all objects in the selected bucket")
-	fmt.Println("")
+	log.Debug().Str("bucket", bucket).Msg("bucket metrics were not available")
+	return 0
+}
+
+// preparePreservation validates the archive and backup settings for nuking `set` from `bucket` and prints what will
+// be preserved before deletion
+//
+// returns:
+//   `string` - region of the backup bucket
+//   `string` - AWS profile used for the backup bucket
+func preparePreservation(ctx context.Context, bucket string, set selection.Set) (string, string) {
+	if cli.Archive != "" {
+		if _, err := archive.FormatFromPath(cli.Archive); err != nil {
+			fmt.Println("error:", err)
+			exit(1)
+		}
+		if cli.ArchiveAllVersions {
+			fmt.Println("📦 all object versions will be archived to", cli.Archive, "before deletion")
+		} else {
+			fmt.Println("📦 current object versions will be archived to", cli.Archive, "before deletion")
+			fmt.Println("⚠️  noncurrent versions will be deleted without being archived, including every version of an object whose latest version is a delete marker. Use --archive-all-versions to keep them.")
+		}
+		fmt.Println("")
+	}
+	backupRegion := cli.BackupRegion
+	backupProfile := cli.BackupProfile
+	if backupProfile == "" {
+		backupProfile = cli.Profile
+	}
+	if cli.BackupBucket != "" {
+		if cli.BackupBucket == bucket && backupOverlaps(set, cli.BackupPrefix) {
+			fmt.Printf("error: the backup prefix %q overlaps the objects being nuked from s3://%s, the backups would be deleted\n", cli.BackupPrefix, bucket)
+			exit(1)
+		}
+		if backupRegion == "" {
+			log.Debug().Str("bucket", cli.BackupBucket).Msg("s3: get backup bucket region")
+			backupSvc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(backupProfile), s3.WithAssumeRole(backupAssumeRole()))
+			var err error
+			backupRegion, err = backupSvc.GetBucketRegion(ctx, cli.BackupBucket)
+			if err != nil {
+				fmt.Println("Error detecting backup bucket region!", err)
+				exit(1)
+			}
+		}
+		fmt.Printf("📦 objects will be copied to s3://%s/%s (%s) before deletion\n", cli.BackupBucket, cli.BackupPrefix, backupRegion)
+		fmt.Println("")
+	}
+
+	return backupRegion, backupProfile
+}
+
+// backupOverlaps returns true if objects copied under `backupPrefix` of the bucket being nuked could be nuked
+// themselves, because the backup prefix and one of the prefixes or keys of `set` start with one another
+func backupOverlaps(set selection.Set, backupPrefix string) bool {
+	for _, selected := range append(append([]string{}, set.Prefixes...), set.Keys...) {
+		if strings.HasPrefix(backupPrefix, selected) || strings.HasPrefix(selected, backupPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmNuke shows the bucket and AWS account about to be nuked and asks the user to confirm. The program exits if
+// the confirmation challenge is failed, false is returned if the user declines.
+func confirmNuke(target confirm.Target, bucketRegion string, identity *sts.CallerIdentity, alias string, auditLog *audit.Log) bool {
+	bucket := target.Bucket
+	printTarget(bucket, bucketRegion, identity, alias)
 
 	// Confirmation 1
-	if !tui.TypeMatchingPhrase() {
+	name := challenges.Select(cli.Confirmation, target)
+	if name != cli.Confirmation {
+		fmt.Printf("🔐 a confirmation rule requires the %s challenge for this bucket\n", name)
+	}
+	challenge, err := confirm.New(name, target, confirm.Options{TOTPSecret: cli.ConfirmationTOTPSecret})
+	if err != nil {
+		fmt.Println("error:", err)
+		exit(1)
+	}
+	confirmed := tui.AnswerChallenge(challenge)
+	if confirmed && cli.ConfirmAccount {
+		confirmed = tui.TypeAccountDigits(identity.AccountID)
+	}
+	if !confirmed {
 		fmt.Println("")
-		fmt.Println("Phrase did not match. Exiting!")
-		os.Exit(1)
+		fmt.Println("Confirmation did not match. Exiting!")
+		_ = auditLog.Write("nuke aborted", map[string]interface{}{"bucket": bucket, "reason": "confirmation did not match", "challenge": challenge.Name})
+		exit(1)
 	}
 
 	// Confirmation 2
 	prompt := promptui.Prompt{
-		Label:     fmt.Sprintf("[bucket: %s] Are you sure, this operation cannot be undone", selectedBucket),
+		Label:     fmt.Sprintf("[bucket: %s] Are you sure, this operation cannot be undone", bucket),
 		IsConfirm: true,
+		Stdout:    os.Stdout,
 	}
 	result, err := prompt.Run()
 	if err != nil || strings.ToLower(result) != "y" {
 		fmt.Println("Command aborted!")
-		return
+		_ = auditLog.Write("nuke aborted", map[string]interface{}{"bucket": bucket, "reason": "not confirmed"})
+		return false
 	}
 
 	println("")
+	return true
+}
 
-	log.Debug().Str("bucket", selectedBucket).Int("concurrency", cli.Concurrency).Msg("starting nuke")
-	err = nuke(ctx, cli.AWSEndpoint, cli.Profile, selectedBucket, bucketRegion, cli.Concurrency)
+// checkChallenges returns an error if the confirmation challenges from the config file are invalid, or if the totp
+// challenge could be required without a shared secret
+func checkChallenges() error {
+	if err := challenges.Validate(); err != nil {
+		return err
+	}
+	if cli.ConfirmationTOTPSecret != "" {
+		return nil
+	}
+	if cli.Confirmation == confirm.TOTP {
+		return errors.New("--confirmation=totp requires --confirmation-totp-secret")
+	}
+	for _, rule := range challenges.Rules {
+		if rule.Challenge == confirm.TOTP {
+			return errors.New("a confirmation rule requires the totp challenge, but --confirmation-totp-secret is not set")
+		}
+	}
+	return nil
+}
+
+// confirmationTarget describes `bucket` for selecting and creating its confirmation challenge. The bucket tags are only
+// looked up when the config file has confirmation rules.
+func confirmationTarget(ctx context.Context, bucket string, bucketRegion string, objectCount int64, estimate *pricing.Estimate) confirm.Target {
+	target := confirm.Target{Bucket: bucket, ObjectCount: objectCount}
+	if estimate != nil {
+		for _, storage := range estimate.Storage {
+			target.Bytes += storage.Bytes
+		}
+	}
+	// without metrics, rules on the object count and size apply
+	target.ObjectCountUnknown = target.ObjectCount == 0
+	target.BytesUnknown = target.Bytes == 0
+	if len(challenges.Rules) == 0 {
+		return target
+	}
+
+	log.Debug().Str("bucket", bucket).Msg("s3: get bucket tags")
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+	tags, err := s3svc.GetBucketTags(ctx, bucket)
 	if err != nil {
+		// the tags stay nil, so rules matching tags apply
+		log.Warn().Err(err).Str("bucket", bucket).Msg("could not read bucket tags for confirmation rules")
+		return target
+	}
+	target.Tags = tags
+	return target
+}
+
+// printTarget prints the bucket and the AWS account and identity it will be nuked with
+func printTarget(bucket string, bucketRegion string, identity *sts.CallerIdentity, alias string) {
+	account := identity.AccountID
+	if alias != "" {
+		account = fmt.Sprintf("%s (%s)", identity.AccountID, alias)
+	}
+
+	fmt.Println("🎯 target")
+	fmt.Println("   bucket....:", bucket)
+	fmt.Println("   region....:", bucketRegion)
+	fmt.Println("   account...:", account)
+	fmt.Println("   identity..:", identity.ARN)
+	fmt.Println("")
+}
+
+// runAudited runs nuke() with `opts`, recording the start and outcome in the audit log along with `auditFields`.
+// A summary event is written when JSON output is enabled. The program exits if the nuke fails.
+func runAudited(ctx context.Context, auditLog *audit.Log, auditFields map[string]interface{}, opts nukeOptions) {
+	if err := auditLog.Write("nuke started", auditFields); err != nil {
+		fmt.Println("Error writing audit log!", err)
+		exit(1)
+	}
+
+	log.Debug().Str("bucket", opts.bucket).Int("concurrency", opts.concurrency).Msg("starting nuke")
+	result, err := nuke(ctx, opts)
+	auditFields["deleted"] = result.deleted
+	if opts.manifest != nil {
+		auditFields["manifestDigest"] = opts.manifest.Digest()
+	}
+
+	summary := output.NewSummary(opts.bucket, opts.bucketRegion, opts.selection.String(), result.listed, result.deleted, result.failed, result.duration)
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	_ = events.Emit(output.EventSummary, summary)
+
+	if err != nil {
+		auditFields["error"] = err.Error()
+		_ = auditLog.Write("nuke failed", auditFields)
 		fmt.Println("error:", err)
-		os.Exit(1)
+		exit(1)
+	}
+	_ = auditLog.Write("nuke completed", auditFields)
+}
+
+// serveMetrics starts serving the worker metrics at /metrics on `addr` in the background
+//
+// returns the address the metrics server is listening on
+func serveMetrics(addr string) (string, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if err := workers.RegisterMetrics(registry); err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Error().Err(err).Msg("metrics server stopped")
+		}
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+// checkProtection evaluates the protection policy against every bucket and returns the reasons each protected bucket
+// is protected, keyed by bucket name. Bucket settings are looked up concurrently in each bucket's own region.
+func checkProtection(ctx context.Context, policy protection.Policy, buckets []s3.Bucket) map[string][]string {
+	var mu sync.Mutex
+	protected := map[string][]string{}
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+	regionalServices := map[string]s3.Service{}
+
+	g := new(errgroup.Group)
+	g.SetLimit(10)
+	for _, b := range buckets {
+		bucket := *b.Name
+		g.Go(func() error {
+			var info protection.BucketInfo
+			region, err := s3svc.GetBucketRegion(ctx, bucket)
+			if err != nil {
+				info = protection.BucketInfo{Name: bucket, InspectError: err}
+			} else {
+				mu.Lock()
+				regionalSvc, ok := regionalServices[region]
+				if !ok {
+					regionalSvc = s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(region), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+					regionalServices[region] = regionalSvc
+				}
+				mu.Unlock()
+				info = protection.Inspect(ctx, regionalSvc, bucket)
+			}
+
+			if reasons := policy.Evaluate(info); len(reasons) > 0 {
+				log.Debug().Str("bucket", bucket).Strs("reasons", reasons).Msg("bucket is protected")
+				mu.Lock()
+				protected[bucket] = reasons
+				mu.Unlock()
+			}
+			return nil
+		})
 	}
+	_ = g.Wait()
 
+	return protected
+}
+
+// protectionAllows returns true if `bucket` may be nuked. Protected buckets are refused unless `override` is set,
+// in which case a warning listing the protection reasons is printed instead.
+func protectionAllows(bucket string, reasons []string, override bool) bool {
+	if len(reasons) == 0 {
+		return true
+	}
+
+	if !override {
+		fmt.Printf("🔒 bucket %s is protected and will not be nuked:\n", bucket)
+		for _, reason := range reasons {
+			fmt.Println("   -", reason)
+		}
+		fmt.Println("")
+		fmt.Println("(use --override-protection to nuke it anyway)")
+		return false
+	}
+
+	fmt.Printf("🔓 bucket %s is protected, but protection has been overridden:\n", bucket)
+	for _, reason := range reasons {
+		fmt.Println("   -", reason)
+	}
+	fmt.Println("")
+	return true
+}
+
+// dashboardMaxConcurrency is the number of delete workers started when the dashboard is shown, the most the
+// concurrency can be raised to while nuking
+const dashboardMaxConcurrency = 32
+
+// nukeOptions configures a nuke() run
+type nukeOptions struct {
+	awsEndpoint  string
+	profile      string
+	assumeRole   *awsconfig.AssumeRole
+	bucket       string
+	bucketRegion string
+	concurrency  int
+
+	// dashboard shows the full-screen dashboard instead of the progress bar, when stdin and stderr are terminals
+	dashboard bool
+
+	// expectedOwner, if set, is the account ID the bucket must be owned by
+	expectedOwner string
+
+	// mfa, if set, supplies the MFA codes required to delete from a bucket with MFA Delete enabled
+	mfa *s3.MFA
+
+	// archivePath, if set, is the local tarball every object is written to before it is deleted
+	archivePath        string
+	archiveAllVersions bool
+
+	// backupBucket, if set, is the bucket every object is copied to before it is deleted
+	backupBucket      string
+	backupPrefix      string
+	backupRegion      string
+	backupProfile     string
+	backupAssumeRole  *awsconfig.AssumeRole
+	backupAllVersions bool
+
+	// selection limits the nuke to the selected prefixes and keys. Selecting the empty prefix nukes every object.
+	selection selection.Set
+	// manifest, if set, records every object version listed during the nuke
+	manifest *plan.Manifest
+	// estimatedTotal is the estimated number of object versions to delete, used until listing has finished
+	estimatedTotal int64
+	// reportPath, if set, is the file a detailed report of the nuke is written to
+	reportPath string
+	// prices, if set, are used to estimate the savings of the nuke
+	prices *pricing.Table
+	// earlyDeletion is what to do with object versions still inside the minimum storage duration of their storage
+	// class, one of the tui.EarlyDeletion actions. Skipping or postponing them requires prices.
+	earlyDeletion string
+	// postponePath is the file object versions are listed in when their deletion is postponed
+	postponePath string
+}
+
+// nukeResult contains the outcome of a nuke() run
+type nukeResult struct {
+	listed   int64
+	deleted  int64
+	failed   int64
+	duration time.Duration
+}
+
+// startStage starts `concurrency` workers for a pre-delete pipeline stage reading from `input`.
+// The returned channel receives everything the workers output, and is closed once all workers have finished.
+func startStage(g *errgroup.Group, concurrency int, input <-chan s3.ObjectVersion, worker func(input <-chan s3.ObjectVersion, output chan<- s3.ObjectVersion) error) <-chan s3.ObjectVersion {
+	output := make(chan s3.ObjectVersion, 100000)
+
+	var stageWG sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		stageWG.Add(1)
+		g.Go(func() error {
+			defer stageWG.Done()
+			return worker(input, output)
+		})
+	}
+
+	g.Go(func() error {
+		stageWG.Wait()
+		close(output)
+		return nil
+	})
+
+	return output
 }
 
 // Delete operation w/progress bar
-func nuke(ctx context.Context, awsEndpoint, profile, bucket, bucketRegion string, concurrency int) error {
+//
+// returns the number of object versions listed, deleted and failed, and how long the nuke took
+func nuke(ctx context.Context, opts nukeOptions) (nukeResult, error) {
+	awsEndpoint, profile, bucket, bucketRegion, concurrency := opts.awsEndpoint, opts.profile, opts.bucket, opts.bucketRegion, opts.concurrency
 	fmt.Println("")
+	start := time.Now()
+
+	var arc *archive.Writer
+	if opts.archivePath != "" {
+		var err error
+		arc, err = archive.Create(opts.archivePath)
+		if err != nil {
+			return nukeResult{}, err
+		}
+	}
+
+	// Object versions inside their minimum storage duration are counted in `early` and left in the bucket when
+	// skipping or postponing them, postponed object versions are also listed in `postponed`
+	var early *pricing.EarlyDeletionScan
+	var postponed *postponeFile
+	if opts.earlyDeletion == tui.EarlyDeletionSkip || opts.earlyDeletion == tui.EarlyDeletionPostpone {
+		early = opts.prices.NewEarlyDeletionScan(bucketRegion, start)
+	}
+	if opts.earlyDeletion == tui.EarlyDeletionPostpone {
+		var err error
+		postponed, err = createPostponeFile(opts.postponePath)
+		if err != nil {
+			if arc != nil {
+				_ = arc.Close()
+			}
+			return nukeResult{}, err
+		}
+	}
 
 	c := counter.New()
-	bar := progressbar.Default(-1, "deleting objects...")
-	err := bar.RenderBlank()
-	if err != nil {
-		return err
+	failed := counter.New()
+	stats := report.NewCollector(bucket, bucketRegion, opts.selection.String())
+	var listingDone atomic.Bool
+
+	// The dashboard replaces the progress bar, and runs more delete workers than --concurrency behind a gate so the
+	// concurrency can be raised while nuking
+	showDashboard := opts.dashboard
+	if showDashboard && (events.Enabled() || !tui.DashboardAvailable(os.Stdin, os.Stderr)) {
+		fmt.Println("the dashboard needs an interactive terminal, showing the progress bar instead")
+		showDashboard = false
+	}
+	// MFA codes are prompted for on the terminal while nuking (MFA Delete, and refreshing the credentials of a role
+	// assumed with --mfa-serial), which the dashboard would be reading keys from
+	mfaPrompts := opts.mfa != nil || (opts.assumeRole != nil && opts.assumeRole.MFASerial != "") ||
+		(opts.backupAssumeRole != nil && opts.backupAssumeRole.MFASerial != "")
+	if showDashboard && mfaPrompts {
+		fmt.Println("the dashboard cannot be used while MFA codes may be asked for, showing the progress bar instead")
+		showDashboard = false
+	}
+	deleteWorkers := concurrency
+	var gate *workers.Gate
+	progressOutput := io.Writer(os.Stderr)
+	ctx, interrupt := context.WithCancel(ctx)
+	defer interrupt()
+	if showDashboard {
+		deleteWorkers = max(concurrency, dashboardMaxConcurrency)
+		gate = workers.NewGate(concurrency)
+		ctx = workers.WithGate(ctx, gate)
+		progressOutput = io.Discard
 	}
 
+	progress := tui.NewNukeProgress(progressOutput, opts.estimatedTotal)
+	result := func() nukeResult {
+		listed, _ := progress.Counts()
+		return nukeResult{listed: listed, deleted: c.Get(), failed: failed.Get(), duration: time.Since(start)}
+	}
+	stopProgressEvents := emitProgressEvents(func() output.Progress {
+		listed, deleted := progress.Counts()
+		return output.Progress{
+			Bucket:      bucket,
+			Listed:      listed,
+			Deleted:     deleted,
+			Failed:      failed.Get(),
+			ListingDone: listingDone.Load(),
+			Estimated:   opts.estimatedTotal,
+		}
+	})
+	defer stopProgressEvents()
+
 	g, ctx := errgroup.WithContext(ctx)
 	s3DeleteQueue := make(chan s3.ObjectIdentifier, 100000)
 	deleteProgress := make(chan int, concurrency*2)
@@ -201,7 +1171,7 @@ func nuke(ctx context.Context, awsEndpoint, profile, bucket, bucketRegion string
 	progressWG.Add(1)
 	go func() {
 		for progressUpdate := range deleteProgress {
-			_ = bar.Add(progressUpdate)
+			progress.Deleted(progressUpdate)
 		}
 		progressWG.Done()
 	}()
@@ -210,6 +1180,7 @@ func nuke(ctx context.Context, awsEndpoint, profile, bucket, bucketRegion string
 	go func() {
 		for deleteFailureGroup := range deleteFailures {
 			count := len(deleteFailureGroup)
+			failed.Add(int64(count))
 			type humanDF struct {
 				key       string
 				versionID string
@@ -227,13 +1198,46 @@ func nuke(ctx context.Context, awsEndpoint, profile, bucket, bucketRegion string
 		progressWG.Done()
 	}()
 
+	// Objects are listed into a version queue and pass through each pre-delete stage (archive, then
+	// backup copy) before reaching the delete queue. A stage only passes an object on once it has
+	// been preserved, so a failure in any stage keeps that object from being deleted.
+	var queue <-chan s3.ObjectVersion
+	s3VersionQueue := make(chan s3.ObjectVersion, 100000)
+	queue = s3VersionQueue
+
+	var dashboard *tui.Dashboard
+	closeDashboard := func() {}
+	if showDashboard {
+		dashboard = tui.NewDashboard(os.Stderr, tui.DashboardOptions{
+			Bucket:   bucket,
+			Progress: progress,
+			Workers:  deleteWorkers,
+			Queues: []tui.DashboardQueue{
+				{Name: "listed versions", Depth: func() int { return len(s3VersionQueue) }, Capacity: cap(s3VersionQueue)},
+				{Name: "delete queue", Depth: func() int { return len(s3DeleteQueue) }, Capacity: cap(s3DeleteQueue)},
+			},
+			Control:   gate,
+			Interrupt: interrupt,
+		})
+		if err := dashboard.Start(os.Stdin); err != nil {
+			fmt.Println("Could not start the dashboard!", err)
+			dashboard = nil
+		} else {
+			closeDashboard = func() {
+				if err := dashboard.Close(); err != nil {
+					log.Warn().Err(err).Msg("could not restore the terminal")
+				}
+			}
+		}
+	}
+
 	g.Go(func() error {
-		defer close(s3DeleteQueue)
+		defer close(s3VersionQueue)
 
 		// Create new S3 service for queueing objects.
-		s3svc := s3.NewService(s3.WithAWSEndpoint(awsEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(profile))
+		s3svc := s3.NewService(s3.WithAWSEndpoint(awsEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(profile), s3.WithAssumeRole(opts.assumeRole), s3.WithExpectedOwner(opts.expectedOwner))
 
-		c, err := workers.S3QueueObjectVersions(ctx, s3svc, bucket, s3DeleteQueue)
+		c, err := workers.S3QueueSelectedVersionDetails(ctx, s3svc, bucket, opts.selection, s3VersionQueue)
 		if err != nil {
 			return err
 		}
@@ -242,13 +1246,96 @@ func nuke(ctx context.Context, awsEndpoint, profile, bucket, bucketRegion string
 		return nil
 	})
 
-	for i := 0; i < concurrency; i++ {
+	// Count listed versions (and record them in the manifest, if any) in listing order, before any concurrent
+	// stage can reorder them. Object versions being skipped to avoid early deletion charges stop here.
+	listedQueue := queue
+	countedQueue := make(chan s3.ObjectVersion, 100000)
+	queue = countedQueue
+	g.Go(func() error {
+		defer close(countedQueue)
+		pending := 0
+		for version := range listedQueue {
+			if opts.manifest != nil {
+				opts.manifest.Add(version)
+			}
+			if early != nil && early.Add(version) {
+				if err := postponed.Add(bucket, version, opts.prices.MinimumDurationEnd(version)); err != nil {
+					return err
+				}
+				continue
+			}
+			select {
+			case countedQueue <- version:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			pending++
+			if pending == 1000 {
+				progress.Listed(pending)
+				pending = 0
+			}
+		}
+		progress.Listed(pending)
+		if ctx.Err() == nil {
+			progress.ListingDone()
+			listingDone.Store(true)
+		}
+		return nil
+	})
+
+	if arc != nil {
+		queue = startStage(g, concurrency, queue, func(input <-chan s3.ObjectVersion, output chan<- s3.ObjectVersion) error {
+			s3svc := s3.NewService(s3.WithAWSEndpoint(awsEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(profile), s3.WithAssumeRole(opts.assumeRole), s3.WithExpectedOwner(opts.expectedOwner))
+
+			archiveCount, err := workers.S3ArchiveFromChannel(ctx, s3svc, bucket, arc, opts.archiveAllVersions, input, output, deleteFailures)
+			if err != nil {
+				return err
+			}
+			log.Debug().Int("objectsArchived", archiveCount).Msg("archive worker finished")
+			return nil
+		})
+	}
+
+	if opts.backupBucket != "" {
+		queue = startStage(g, concurrency, queue, func(input <-chan s3.ObjectVersion, output chan<- s3.ObjectVersion) error {
+			// Copies are requested from the backup bucket's region, using the backup profile if one was given. The
+			// bucket being nuked is the source of every copy, so it must still be owned by the expected owner.
+			s3svc := s3.NewService(s3.WithAWSEndpoint(awsEndpoint), s3.WithRegion(opts.backupRegion), s3.WithProfile(opts.backupProfile), s3.WithAssumeRole(opts.backupAssumeRole), s3.WithExpectedSourceOwner(opts.expectedOwner))
+
+			copyCount, err := workers.S3CopyFromChannel(ctx, s3svc, bucket, opts.backupBucket, opts.backupPrefix, opts.backupAllVersions, input, output, deleteFailures)
+			if err != nil {
+				return err
+			}
+			log.Debug().Int("objectsCopied", copyCount).Msg("backup worker finished")
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(s3DeleteQueue)
+		for version := range queue {
+			stats.Queued(version)
+			select {
+			case s3DeleteQueue <- version.ObjectIdentifier:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < deleteWorkers; i++ {
+		workerCtx := workers.WithWorkerIndex(ctx, i)
+		recorder := workers.DeleteRecorder(stats)
+		if dashboard != nil {
+			recorder = workers.TeeRecorder(stats, dashboard.Worker(i))
+		}
 		g.Go(func() error {
 			// Create new S3 service for each worker. This is necessary to avoid a global rate limit bucket
 			// being shared between all service clients.
-			s3svc := s3.NewService(s3.WithAWSEndpoint(awsEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(profile))
+			s3svc := s3.NewService(s3.WithAWSEndpoint(awsEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(profile), s3.WithAssumeRole(opts.assumeRole), s3.WithExpectedOwner(opts.expectedOwner), s3.WithMFA(opts.mfa))
 
-			deleteCount, err := workers.S3DeleteFromChannel(ctx, s3svc, bucket, s3DeleteQueue, deleteProgress, deleteFailures)
+			deleteCount, err := workers.S3DeleteFromChannel(workerCtx, s3svc, bucket, s3DeleteQueue, deleteProgress, deleteFailures, recorder)
 			if err != nil {
 				return err
 			}
@@ -258,20 +1345,118 @@ func nuke(ctx context.Context, awsEndpoint, profile, bucket, bucketRegion string
 		})
 	}
 
-	if err := g.Wait(); err != nil {
-		fmt.Println("error:", err)
-		os.Exit(1)
+	err := g.Wait()
+	closeDashboard()
+	if err != nil {
+		_ = progress.Close()
+		if arc != nil {
+			_ = arc.Close()
+		}
+		_ = postponed.Close()
+		writeReport(stats.Report(), opts.reportPath)
+		return result(), err
+	}
+
+	if arc != nil {
+		if err := arc.Close(); err != nil {
+			return result(), err
+		}
+	}
+	if err := postponed.Close(); err != nil {
+		return result(), err
 	}
 
 	close(deleteProgress)
 	close(deleteFailures)
 	progressWG.Wait()
+	_ = progress.Close()
+	stopProgressEvents()
+	listed, _ := progress.Counts()
 
 	fmt.Println("")
 	fmt.Println("")
 	fmt.Println("💣  --- Nuke complete! ---  💣")
 	fmt.Println("")
 	fmt.Printf("Removed %s objects\n", humanize.Comma(c.Get()))
+	if notDeleted := listed - c.Get(); notDeleted > 0 {
+		fmt.Printf("%s listed object versions were not deleted (use --warn to see which)\n", humanize.Comma(notDeleted))
+	}
+	if early != nil {
+		if skipped := early.Total(); skipped.Objects > 0 {
+			fmt.Printf("Skipped %s object versions (%s) inside their minimum storage duration, which can be deleted without early deletion charges after %s\n",
+				humanize.Comma(skipped.Objects), humanize.IBytes(uint64(skipped.Bytes)), skipped.FreeAfter.Local().Format(time.DateOnly))
+		}
+		if postponed != nil {
+			fmt.Println("Postponed object versions listed in", opts.postponePath)
+		}
+	}
+	if opts.archivePath != "" {
+		fmt.Println("Archive written to", opts.archivePath)
+	}
+	if opts.backupBucket != "" {
+		fmt.Printf("Backup copied to s3://%s/%s\n", opts.backupBucket, opts.backupPrefix)
+	}
 
-	return nil
+	runReport := stats.Report()
+	fmt.Println("")
+	if err := runReport.WriteText(os.Stdout); err != nil {
+		log.Warn().Err(err).Msg("could not print report")
+	}
+	if opts.prices != nil {
+		fmt.Println("")
+		showCostSavings(opts.prices, runReport, listed)
+	}
+	writeReport(runReport, opts.reportPath)
+
+	return result(), nil
+}
+
+// writeReport writes `runReport` to `path`, if set. Errors are printed rather than returned, so a report which
+// cannot be written does not hide the outcome of the nuke.
+func writeReport(runReport *report.Report, path string) {
+	if path == "" {
+		return
+	}
+	if err := runReport.WriteFile(path); err != nil {
+		fmt.Println("Error writing report!", err)
+		return
+	}
+	fmt.Println("Report written to", path)
+}
+
+// progressEventInterval is how often progress events are written during a nuke
+const progressEventInterval = time.Second
+
+// emitProgressEvents writes a progress event from `progress` every progressEventInterval while JSON output is enabled.
+//
+// returns a function which stops the events after writing a final progress event, it is safe to call more than once
+func emitProgressEvents(progress func() output.Progress) func() {
+	if !events.Enabled() {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(progressEventInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = events.Emit(output.EventProgress, progress())
+			case <-done:
+				_ = events.Emit(output.EventProgress, progress())
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
 }
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/output"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
 )
 
 // Test the CLI struct initialization
@@ -109,4 +121,174 @@ func TestMainPackageComponents(t *testing.T) {
 		
 		t.Log("Main package imports are accessible")
 	})
-}
\ No newline at end of file
+}
+
+// Test protected buckets are refused unless protection is overridden
+func TestProtectionAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		reasons  []string
+		override bool
+		want     bool
+	}{
+		{name: "unprotected", reasons: nil, override: false, want: true},
+		{name: "protected", reasons: []string{"Object Lock is enabled"}, override: false, want: false},
+		{name: "protected with override", reasons: []string{"Object Lock is enabled"}, override: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protectionAllows("bucket", tt.reasons, tt.override); got != tt.want {
+				t.Errorf("protectionAllows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackupOverlaps(t *testing.T) {
+	tests := []struct {
+		name         string
+		set          selection.Set
+		backupPrefix string
+		want         bool
+	}{
+		{name: "entire bucket", set: prefixSelection(""), backupPrefix: "backup/", want: true},
+		{name: "backup inside the prefix", set: prefixSelection("logs/"), backupPrefix: "logs/backup/", want: true},
+		{name: "prefix inside the backup", set: prefixSelection("logs/"), backupPrefix: "", want: true},
+		{name: "separate prefixes", set: prefixSelection("logs/"), backupPrefix: "backup/", want: false},
+		{name: "marked key inside the backup", set: selection.Set{Keys: []string{"backup/index.json"}}, backupPrefix: "backup/", want: true},
+		{name: "separate marked prefixes and keys", set: selection.Set{Prefixes: []string{"logs/"}, Keys: []string{"index.json"}}, backupPrefix: "backup/", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backupOverlaps(tt.set, tt.backupPrefix); got != tt.want {
+				t.Errorf("backupOverlaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test the metrics endpoint serves the worker metrics
+func TestServeMetrics(t *testing.T) {
+	addr, err := serveMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("serveMetrics() error = %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("could not fetch metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("could not read metrics: %v", err)
+	}
+
+	for _, metric := range []string{"s3nuke_objects_listed_total", "s3nuke_delete_objects_duration_seconds", "s3nuke_throttle_events_total"} {
+		if !strings.Contains(string(body), metric) {
+			t.Errorf("metrics response does not contain %s", metric)
+		}
+	}
+
+	if _, err := serveMetrics(addr); err == nil {
+		t.Errorf("serveMetrics() expected error for address in use")
+	}
+}
+
+// Test progress events are only written when JSON output is enabled, ending with a final event
+func TestEmitProgressEvents(t *testing.T) {
+	defer func() { events = nil }()
+
+	progress := func() output.Progress {
+		return output.Progress{Bucket: "scratch", Listed: 10, Deleted: 10, ListingDone: true}
+	}
+
+	events = nil
+	emitProgressEvents(progress)()
+
+	var buf bytes.Buffer
+	var err error
+	events, err = output.New(&buf, output.FormatJSON)
+	if err != nil {
+		t.Fatalf("output.New() error = %v", err)
+	}
+	stop := emitProgressEvents(progress)
+	stop()
+	stop()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("emitProgressEvents() wrote %d events, want 1 final event", len(lines))
+	}
+	if !strings.Contains(lines[0], `"type":"progress"`) || !strings.Contains(lines[0], `"listing_done":true`) {
+		t.Errorf("emitProgressEvents() event = %s", lines[0])
+	}
+}
+
+// Test amounts of money are formatted with their currency
+func TestFormatCost(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{amount: 1234.5, currency: "USD", want: "$1,234.50"},
+		{amount: 0.004, currency: "USD", want: "$0.00"},
+		{amount: 12, currency: "EUR", want: "12.00 EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatCost(tt.amount, tt.currency); got != tt.want {
+				t.Errorf("formatCost() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test postponed object versions are written one JSON object per line, without overwriting an existing file
+func TestPostponeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "postponed.jsonl")
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	postponed, err := createPostponeFile(path)
+	if err != nil {
+		t.Fatalf("createPostponeFile() error = %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		version := s3.ObjectVersion{
+			ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String(key), VersionID: aws.String("v1")},
+			Size:             10,
+			StorageClass:     "GLACIER",
+			LastModified:     aws.Time(lastModified),
+		}
+		if err := postponed.Add("scratch", version, lastModified.AddDate(0, 0, 90)); err != nil {
+			t.Fatalf("postponeFile.Add() error = %v", err)
+		}
+	}
+	if err := postponed.Close(); err != nil {
+		t.Fatalf("postponeFile.Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read postpone file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("postpone file has %d lines, want 2:\n%s", len(lines), data)
+	}
+	want := `{"bucket":"scratch","key":"a","version_id":"v1","storage_class":"GLACIER","size":10,"last_modified":"2024-05-01T12:00:00Z","free_after":"2024-07-30T12:00:00Z"}`
+	if lines[0] != want {
+		t.Errorf("postpone file line = %s, want %s", lines[0], want)
+	}
+
+	if _, err := createPostponeFile(path); err == nil {
+		t.Errorf("createPostponeFile() should refuse to overwrite an existing file")
+	}
+
+	// a nil postpone file is used when nothing is postponed
+	var none *postponeFile
+	if err := none.Add("scratch", s3.ObjectVersion{}, time.Time{}); err != nil || none.Close() != nil {
+		t.Errorf("nil postponeFile should be a no-op")
+	}
+}
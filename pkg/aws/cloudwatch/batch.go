@@ -0,0 +1,136 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// MetricName defines the name of an S3 storage metric
+type MetricName string
+
+// S3 storage metrics, reported daily for each bucket
+const (
+	// NumberOfObjects is the number of objects (including noncurrent versions and delete markers) in a bucket. It is
+	// only reported for AllStorageTypes.
+	NumberOfObjects MetricName = "NumberOfObjects"
+	// BucketSizeBytes is the number of bytes stored in a bucket, for each storage type
+	BucketSizeBytes MetricName = "BucketSizeBytes"
+)
+
+// AllStorageTypes is the storage type of the NumberOfObjects metric
+const AllStorageTypes StorageType = "AllStorageTypes"
+
+// maxMetricDataQueries is the most queries a single GetMetricData request may contain
+const maxMetricDataQueries = 500
+
+// MetricQuery identifies one S3 storage metric of a bucket
+type MetricQuery struct {
+	Bucket      string
+	Metric      MetricName
+	StorageType StorageType
+}
+
+// MetricResults contains the datapoints of a MetricQuery returned by GetS3Metrics()
+//
+// Timestamps/values are ordered newest first at the 0th index and ordered descending
+type MetricResults struct {
+	Timestamps []time.Time
+	Values     []float64
+}
+
+// metricQueryID returns the ID of the query at `index` in a GetS3Metrics call. IDs must start with a lowercase letter.
+func metricQueryID(index int) string {
+	return fmt.Sprintf("q%d", index)
+}
+
+// metricDataQuery returns the GetMetricData query of `q` with the ID `id`
+func (q MetricQuery) metricDataQuery(id string, period int32) types.MetricDataQuery {
+	return types.MetricDataQuery{
+		Id:    aws.String(id),
+		Label: aws.String(fmt.Sprintf("%s %s %s", q.Bucket, q.Metric, q.StorageType)),
+		MetricStat: &types.MetricStat{
+			Metric: &types.Metric{
+				Namespace:  aws.String("AWS/S3"),
+				MetricName: aws.String(string(q.Metric)),
+				Dimensions: []types.Dimension{
+					{
+						Name:  aws.String("BucketName"),
+						Value: aws.String(q.Bucket),
+					},
+					{
+						Name:  aws.String("StorageType"),
+						Value: aws.String(string(q.StorageType)),
+					},
+				},
+			},
+			Period: aws.Int32(period),
+			Stat:   aws.String("Average"),
+		},
+	}
+}
+
+func (s *service) GetS3Metrics(ctx context.Context, queries []MetricQuery, startTimeDiff int, period int32) (map[MetricQuery]*MetricResults, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+
+	// every query is sent once, in the order given, so IDs are the same for the same queries
+	returnValues := map[MetricQuery]*MetricResults{}
+	unique := make([]MetricQuery, 0, len(queries))
+	for _, q := range queries {
+		if _, ok := returnValues[q]; ok {
+			continue
+		}
+		returnValues[q] = &MetricResults{}
+		unique = append(unique, q)
+	}
+
+	endTime := time.Unix(time.Now().Unix(), 0)
+	startTime := time.Unix(time.Now().Add(time.Duration(-startTimeDiff)*time.Hour).Unix(), 0)
+	for first := 0; first < len(unique); first += maxMetricDataQueries {
+		batch := unique[first:min(first+maxMetricDataQueries, len(unique))]
+		ids := make(map[string]MetricQuery, len(batch))
+		dataQueries := make([]types.MetricDataQuery, 0, len(batch))
+		for i, q := range batch {
+			id := metricQueryID(first + i)
+			ids[id] = q
+			dataQueries = append(dataQueries, q.metricDataQuery(id, period))
+		}
+
+		var nextToken *string
+		for {
+			result, err := s.client.GetMetricData(ctx, &cloudwatch.GetMetricDataInput{
+				EndTime:           aws.Time(endTime),
+				StartTime:         aws.Time(startTime),
+				NextToken:         nextToken,
+				MetricDataQueries: dataQueries,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			// Copy this set of results into the results of each query, a query may have results on several pages
+			for _, r := range result.MetricDataResults {
+				q, ok := ids[aws.ToString(r.Id)]
+				if !ok {
+					continue
+				}
+				returnValues[q].Values = append(returnValues[q].Values, r.Values...)
+				returnValues[q].Timestamps = append(returnValues[q].Timestamps, r.Timestamps...)
+			}
+
+			// Check if we have another set to load, if not, move on to the next batch
+			if result.NextToken == nil {
+				break
+			}
+			nextToken = result.NextToken
+		}
+	}
+
+	return returnValues, nil
+}
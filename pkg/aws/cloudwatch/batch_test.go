@@ -0,0 +1,105 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// CloudwatchAPIBatchMock answers every query with two datapoints, split over two pages: the value of the query's
+// bucket number (from its name) on the first page, and ten times that on the second
+type CloudwatchAPIBatchMock struct {
+	requests *[]*cloudwatch.GetMetricDataInput
+}
+
+func (s CloudwatchAPIBatchMock) GetMetricData(ctx context.Context,
+	params *cloudwatch.GetMetricDataInput,
+	optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+
+	*s.requests = append(*s.requests, params)
+	output := &cloudwatch.GetMetricDataOutput{}
+	for _, q := range params.MetricDataQueries {
+		bucket := aws.ToString(q.MetricStat.Metric.Dimensions[0].Value)
+		if bucket == "failbucket" {
+			return nil, fmt.Errorf("simulated error case")
+		}
+		value, _ := strconv.Atoi(strings.TrimPrefix(bucket, "bucket"))
+		result := types.MetricDataResult{Id: q.Id, Timestamps: []time.Time{cloudwatchTimestamps[0]}, Values: []float64{float64(value)}}
+		if params.NextToken != nil {
+			result.Timestamps, result.Values = []time.Time{cloudwatchTimestamps[1]}, []float64{float64(value * 10)}
+		}
+		output.MetricDataResults = append(output.MetricDataResults, result)
+	}
+	if params.NextToken == nil {
+		output.NextToken = aws.String("page2")
+	}
+	return output, nil
+}
+
+func Test_service_GetS3Metrics(t *testing.T) {
+	requests := []*cloudwatch.GetMetricDataInput{}
+	s := &service{client: CloudwatchAPIBatchMock{requests: &requests}}
+
+	queries := []MetricQuery{}
+	for i := 0; i < 600; i++ {
+		bucket := fmt.Sprintf("bucket%d", i)
+		queries = append(queries,
+			MetricQuery{Bucket: bucket, Metric: NumberOfObjects, StorageType: AllStorageTypes},
+			MetricQuery{Bucket: bucket, Metric: BucketSizeBytes, StorageType: StandardStorage},
+		)
+	}
+	// repeated queries are only sent once
+	queries = append(queries, queries[0], queries[1])
+
+	got, err := s.GetS3Metrics(context.TODO(), queries, 72, 86400)
+	if err != nil {
+		t.Fatalf("service.GetS3Metrics() error = %v", err)
+	}
+
+	if len(got) != 1200 {
+		t.Errorf("service.GetS3Metrics() returned %d results, want 1200", len(got))
+	}
+	q := MetricQuery{Bucket: "bucket512", Metric: BucketSizeBytes, StorageType: StandardStorage}
+	want := &MetricResults{Timestamps: cloudwatchTimestamps[:2], Values: []float64{512, 5120}}
+	if !reflect.DeepEqual(got[q], want) {
+		t.Errorf("service.GetS3Metrics()[%v] = %+v, want %+v", q, got[q], want)
+	}
+
+	// 1200 queries are sent in 3 batches, each read in 2 pages
+	sizes := []int{}
+	ids := map[string]bool{}
+	for _, request := range requests {
+		sizes = append(sizes, len(request.MetricDataQueries))
+		for _, dataQuery := range request.MetricDataQueries {
+			ids[aws.ToString(dataQuery.Id)] = true
+		}
+	}
+	if !reflect.DeepEqual(sizes, []int{500, 500, 500, 500, 200, 200}) {
+		t.Errorf("service.GetS3Metrics() request sizes = %v", sizes)
+	}
+	if len(ids) != 1200 || !ids["q0"] || !ids["q1199"] {
+		t.Errorf("service.GetS3Metrics() sent %d distinct query IDs, want q0 to q1199", len(ids))
+	}
+}
+
+func Test_service_GetS3Metrics_Fail(t *testing.T) {
+	requests := []*cloudwatch.GetMetricDataInput{}
+	s := &service{client: CloudwatchAPIBatchMock{requests: &requests}}
+	queries := []MetricQuery{{Bucket: "failbucket", Metric: NumberOfObjects, StorageType: AllStorageTypes}}
+	if _, err := s.GetS3Metrics(context.TODO(), queries, 72, 86400); err == nil {
+		t.Errorf("service.GetS3Metrics() expected error")
+	}
+
+	s = &service{initError: fmt.Errorf("no credentials")}
+	if _, err := s.GetS3Metrics(context.TODO(), queries, 72, 86400); err == nil {
+		t.Errorf("service.GetS3Metrics() expected init error")
+	}
+}
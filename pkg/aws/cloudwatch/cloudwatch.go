@@ -40,6 +40,31 @@ const (
 	DeepArchiveStagingStorage      StorageType = "DeepArchiveStagingStorage"
 )
 
+// StorageTypes lists every storage type reported by the BucketSizeBytes metric
+var StorageTypes = []StorageType{
+	StandardStorage,
+	IntelligentTieringFAStorage,
+	IntelligentTieringIAStorage,
+	IntelligentTieringAAStorage,
+	IntelligentTieringAIAStorage,
+	IntelligentTieringDAAStorage,
+	StandardIAStorage,
+	StandardIASizeOverhead,
+	StandardIAObjectOverhead,
+	OneZoneIAStorage,
+	OneZoneIASizeOverhead,
+	ReducedRedundancyStorage,
+	GlacierInstantRetrievalStorage,
+	GlacierStorage,
+	GlacierStagingStorage,
+	GlacierObjectOverhead,
+	GlacierS3ObjectOverhead,
+	DeepArchiveStorage,
+	DeepArchiveObjectOverhead,
+	DeepArchiveS3ObjectOverhead,
+	DeepArchiveStagingStorage,
+}
+
 // Service defines functions related to Cloudwatch operations
 type Service interface {
 	// GetS3ObjectCount returns the amount of objects in an S3 bucket at the time of the last cloudwatch metric for ALL storage types
@@ -53,6 +78,14 @@ type Service interface {
 	//
 	// see StorageType constants for type
 	GetS3ByteCount(ctx context.Context, bucketName string, storageType StorageType, startTimeDiff int, period int32) (*S3ByteCountResults, error)
+
+	// GetS3Metrics returns the datapoints of many S3 storage metrics, possibly of many buckets, sending up to 500 queries
+	// in each GetMetricData request. Queries asked for more than once are only sent once.
+	//
+	// returns:
+	//   `map[MetricQuery]*MetricResults` - the datapoints of every query, empty if the metric was not found
+	//   `error` - error, if any
+	GetS3Metrics(ctx context.Context, queries []MetricQuery, startTimeDiff int, period int32) (map[MetricQuery]*MetricResults, error)
 }
 
 // S3ObjectCountResults contains the results from GetS3ObjectCount()
@@ -79,6 +112,7 @@ type service struct {
 	awsEndpoint string
 	region      string
 	profile     string
+	assumeRole  *config.AssumeRole
 	initError   error
 }
 
@@ -93,9 +127,9 @@ func NewService(opts ...ServiceOption) Service {
 		var client CloudwatchAPI
 		var err error
 		if svc.region == "" {
-			client, err = newClient(os.Getenv("AWS_REGION"), svc.awsEndpoint, svc.profile)
+			client, err = newClient(os.Getenv("AWS_REGION"), svc.awsEndpoint, svc.profile, svc.assumeRole)
 		} else {
-			client, err = newClient(svc.region, svc.awsEndpoint, svc.profile)
+			client, err = newClient(svc.region, svc.awsEndpoint, svc.profile, svc.assumeRole)
 		}
 		if err != nil {
 			svc.initError = err
@@ -137,14 +171,22 @@ func WithProfile(profile string) ServiceOption {
 	}
 }
 
-func newClient(region string, awsEndpoint string, profile string) (*cloudwatch.Client, error) {
+// WithAssumeRole assumes `role` using the credentials of the profile. Share the same role between services so the
+// temporary credentials are cached for all of them.
+func WithAssumeRole(role *config.AssumeRole) ServiceOption {
+	return func(s *service) {
+		s.assumeRole = role
+	}
+}
+
+func newClient(region string, awsEndpoint string, profile string, assumeRole *config.AssumeRole) (*cloudwatch.Client, error) {
 	// Initialize AWS S3 Client
 	var cfg aws.Config
 	var err error
 	if profile != "" {
-		cfg, err = config.NewWithProfile(region, profile)
+		cfg, err = config.NewWithProfile(region, profile, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
 	} else {
-		cfg, err = config.New(region)
+		cfg, err = config.New(region, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize AWS config: %w", err)
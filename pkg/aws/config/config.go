@@ -2,35 +2,158 @@ package config
 
 import (
 	"context"
+	"errors"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-// New creates a new aws.Config with custom endpoint resolver and region set
-func New(region string) (aws.Config, error) {
-	retrier := func() aws.Retryer {
-		return retry.NewAdaptiveMode()
+// DefaultRoleSessionName is the session name used when assuming a role without a session name
+const DefaultRoleSessionName = "s3-nuke"
+
+// AssumeRole describes an IAM role to assume using the credentials loaded from the environment or profile.
+//
+// The same *AssumeRole should be passed to every client: the role is assumed once and its temporary credentials
+// are cached and refreshed for all of them together, so the MFA token is only asked for when they expire.
+type AssumeRole struct {
+	// RoleARN is the ARN of the role to assume
+	RoleARN string
+	// ExternalID is the external ID required by the role's trust policy, if any
+	ExternalID string
+	// SessionName identifies the role session in CloudTrail, DefaultRoleSessionName is used if empty
+	SessionName string
+	// MFASerial is the serial number or ARN of the MFA device required by the role's trust policy, if any
+	MFASerial string
+	// TokenProvider returns the current code of the MFA device, it is required if MFASerial is set
+	TokenProvider func() (string, error)
+
+	once        sync.Once
+	credentials aws.CredentialsProvider
+}
+
+// NewAssumeRole returns the role to assume described by the role settings of s3-nuke and s3-metrics, or nil if
+// `roleARN` is empty. `tokenProvider` is only used if `mfaSerial` is set.
+//
+// An error is returned if an external ID, session name or MFA serial is given without `roleARN`, since it would
+// otherwise be silently ignored.
+func NewAssumeRole(roleARN string, externalID string, sessionName string, mfaSerial string, tokenProvider func() (string, error)) (*AssumeRole, error) {
+	if roleARN == "" {
+		if externalID != "" || sessionName != "" || mfaSerial != "" {
+			return nil, errors.New("--external-id, --role-session-name and --mfa-serial can only be used with --role-arn")
+		}
+		return nil, nil
 	}
 
-	return config.LoadDefaultConfig(context.TODO(), config.WithRegion(region), config.WithRetryer(retrier))
+	role := &AssumeRole{
+		RoleARN:     roleARN,
+		ExternalID:  externalID,
+		SessionName: sessionName,
+		MFASerial:   mfaSerial,
+	}
+	if mfaSerial != "" {
+		role.TokenProvider = tokenProvider
+	}
+	return role, nil
+}
+
+// provider returns the cached credentials of the assumed role, using `base` to assume it the first time. The role is
+// assumed through `awsEndpoint` if it is set.
+func (r *AssumeRole) provider(base aws.Config, awsEndpoint string) aws.CredentialsProvider {
+	r.once.Do(func() {
+		client := sts.NewFromConfig(base, func(o *sts.Options) {
+			if awsEndpoint != "" {
+				o.BaseEndpoint = &awsEndpoint
+			}
+		})
+		r.credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, r.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = r.SessionName
+			if o.RoleSessionName == "" {
+				o.RoleSessionName = DefaultRoleSessionName
+			}
+			if r.ExternalID != "" {
+				o.ExternalID = aws.String(r.ExternalID)
+			}
+			if r.MFASerial != "" {
+				o.SerialNumber = aws.String(r.MFASerial)
+				o.TokenProvider = r.TokenProvider
+			}
+		}))
+	})
+	return r.credentials
+}
+
+// validate returns an error if the role cannot be assumed as configured
+func (r *AssumeRole) validate() error {
+	if r.RoleARN == "" {
+		return errors.New("a role ARN is required to assume a role")
+	}
+	if r.MFASerial != "" && r.TokenProvider == nil {
+		return errors.New("an MFA token provider is required when an MFA serial is set")
+	}
+	return nil
+}
+
+// Option configures the aws.Config created by New and NewWithProfile
+type Option func(o *options)
+
+type options struct {
+	assumeRole  *AssumeRole
+	awsEndpoint string
+}
+
+// WithAssumeRole assumes `role` with the loaded credentials. Nothing is assumed if `role` is nil.
+func WithAssumeRole(role *AssumeRole) Option {
+	return func(o *options) {
+		o.assumeRole = role
+	}
+}
+
+// WithAWSEndpoint sets the endpoint used to assume the role given with WithAssumeRole, for the same endpoint
+// override as the clients using the config
+func WithAWSEndpoint(awsEndpoint string) Option {
+	return func(o *options) {
+		o.awsEndpoint = awsEndpoint
+	}
+}
+
+// New creates a new aws.Config with custom endpoint resolver and region set
+func New(region string, opts ...Option) (aws.Config, error) {
+	return NewWithProfile(region, "", opts...)
 }
 
 // NewWithProfile creates a new aws.Config with custom endpoint resolver, region, and profile set
-func NewWithProfile(region string, profile string) (aws.Config, error) {
+func NewWithProfile(region string, profile string, opts ...Option) (aws.Config, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	retrier := func() aws.Retryer {
 		return retry.NewAdaptiveMode()
 	}
 
-	opts := []func(*config.LoadOptions) error{
+	loadOpts := []func(*config.LoadOptions) error{
 		config.WithRegion(region),
 		config.WithRetryer(retrier),
 	}
 
 	if profile != "" {
-		opts = append(opts, config.WithSharedConfigProfile(profile))
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOpts...)
+	if err != nil || o.assumeRole == nil {
+		return cfg, err
+	}
+
+	if err := o.assumeRole.validate(); err != nil {
+		return cfg, err
 	}
+	cfg.Credentials = o.assumeRole.provider(cfg, o.awsEndpoint)
 
-	return config.LoadDefaultConfig(context.TODO(), opts...)
+	return cfg, nil
 }
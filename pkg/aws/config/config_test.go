@@ -1,6 +1,10 @@
 package config
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 )
 
@@ -70,3 +74,115 @@ func TestNewWithProfile(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWithAssumeRole(t *testing.T) {
+	t.Run("credentials are shared between configs", func(t *testing.T) {
+		role := &AssumeRole{RoleARN: "arn:aws:iam::123456789012:role/nuker", ExternalID: "external"}
+		first, err := New("us-west-2", WithAssumeRole(role))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		second, err := New("eu-west-1", WithAssumeRole(role))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if first.Credentials == nil || first.Credentials != second.Credentials {
+			t.Errorf("New() should share the assumed role credentials between configs")
+		}
+		if second.Region != "eu-west-1" {
+			t.Errorf("New() got region = %v, want eu-west-1", second.Region)
+		}
+	})
+
+	t.Run("no role", func(t *testing.T) {
+		if _, err := New("us-west-2", WithAssumeRole(nil)); err != nil {
+			t.Errorf("New() error = %v", err)
+		}
+	})
+
+	tests := []struct {
+		name string
+		role *AssumeRole
+	}{
+		{name: "missing role ARN", role: &AssumeRole{}},
+		{name: "MFA serial without token provider", role: &AssumeRole{RoleARN: "arn:aws:iam::123456789012:role/nuker", MFASerial: "arn:aws:iam::123456789012:mfa/me"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("us-west-2", WithAssumeRole(tt.role)); err == nil {
+				t.Errorf("New() should fail")
+			}
+		})
+	}
+}
+
+func TestNewWithAssumeRole_AWSEndpoint(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>assumed</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2100-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+	}))
+	defer server.Close()
+
+	role := &AssumeRole{RoleARN: "arn:aws:iam::123456789012:role/nuker"}
+	cfg, err := New("us-west-2", WithAssumeRole(role), WithAWSEndpoint(server.URL))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	credentials, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if requests.Load() != 1 || credentials.AccessKeyID != "ASIAEXAMPLE" {
+		t.Errorf("role was not assumed through the endpoint: %d requests, credentials %s", requests.Load(), credentials.AccessKeyID)
+	}
+}
+
+func TestNewAssumeRole(t *testing.T) {
+	token := func() (string, error) { return "123456", nil }
+
+	tests := []struct {
+		name        string
+		roleARN     string
+		externalID  string
+		sessionName string
+		mfaSerial   string
+		wantRole    bool
+		wantToken   bool
+		wantErr     bool
+	}{
+		{name: "no role"},
+		{name: "role", roleARN: "arn:aws:iam::111122223333:role/s3-nuke", externalID: "nuke-2024", wantRole: true},
+		{name: "role with MFA", roleARN: "arn:aws:iam::111122223333:role/s3-nuke", mfaSerial: "arn:aws:iam::444455556666:mfa/me", wantRole: true, wantToken: true},
+		{name: "external ID without role", externalID: "nuke-2024", wantErr: true},
+		{name: "session name without role", sessionName: "me", wantErr: true},
+		{name: "MFA serial without role", mfaSerial: "arn:aws:iam::444455556666:mfa/me", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAssumeRole(tt.roleARN, tt.externalID, tt.sessionName, tt.mfaSerial, token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAssumeRole() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != nil) != tt.wantRole {
+				t.Fatalf("NewAssumeRole() = %v, want a role %v", got, tt.wantRole)
+			}
+			if got != nil && (got.TokenProvider != nil) != tt.wantToken {
+				t.Errorf("NewAssumeRole() token provider set = %v, want %v", got.TokenProvider != nil, tt.wantToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package iam
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/config"
+)
+
+// Service defines functions related to IAM operations
+type Service interface {
+	// GetAccountAlias returns the alias of the AWS account, or an empty string if the account has no alias
+	GetAccountAlias(ctx context.Context) (string, error)
+}
+
+// ServiceOption is used with NewService and configures the newly created iamService
+type ServiceOption func(s *service)
+
+type service struct {
+	client      IAMAPI
+	awsEndpoint string
+	region      string
+	profile     string
+	assumeRole  *config.AssumeRole
+	initError   error
+}
+
+// NewService returns an initialized IAM service
+func NewService(opts ...ServiceOption) Service {
+	svc := &service{}
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	if svc.client == nil {
+		var client IAMAPI
+		var err error
+		if svc.region == "" {
+			client, err = newClient(os.Getenv("AWS_REGION"), svc.awsEndpoint, svc.profile, svc.assumeRole)
+		} else {
+			client, err = newClient(svc.region, svc.awsEndpoint, svc.profile, svc.assumeRole)
+		}
+		if err != nil {
+			svc.initError = err
+		} else {
+			svc.client = client
+		}
+	}
+
+	return svc
+}
+
+// WithAPI should be used if you want to initialize your own IAM client (such as in cases of a mock IAM client for testing)
+// This cannot be used with WithAWSEndpoint
+func WithAPI(client IAMAPI) ServiceOption {
+	return func(s *service) {
+		s.client = client
+	}
+}
+
+// WithAWSEndpoint sets endpoint to be used by the AWS client
+// This cannot be used with WithAPI
+func WithAWSEndpoint(awsEndpoint string) ServiceOption {
+	return func(s *service) {
+		s.awsEndpoint = awsEndpoint
+	}
+}
+
+// WithRegion sets the AWS client region
+func WithRegion(region string) ServiceOption {
+	return func(s *service) {
+		s.region = region
+	}
+}
+
+// WithProfile sets the AWS profile to use for authentication
+func WithProfile(profile string) ServiceOption {
+	return func(s *service) {
+		s.profile = profile
+	}
+}
+
+// WithAssumeRole assumes `role` using the credentials of the profile. Share the same role between services so the
+// temporary credentials are cached for all of them.
+func WithAssumeRole(role *config.AssumeRole) ServiceOption {
+	return func(s *service) {
+		s.assumeRole = role
+	}
+}
+
+func newClient(region string, awsEndpoint string, profile string, assumeRole *config.AssumeRole) (*iam.Client, error) {
+	// Initialize AWS IAM Client
+	var cfg aws.Config
+	var err error
+	if profile != "" {
+		cfg, err = config.NewWithProfile(region, profile, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
+	} else {
+		cfg, err = config.New(region, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize AWS config: %w", err)
+	}
+
+	return iam.NewFromConfig(cfg, func(o *iam.Options) {
+		if awsEndpoint != "" {
+			o.BaseEndpoint = &awsEndpoint
+		}
+	}), nil
+}
+
+func (s *service) GetAccountAlias(ctx context.Context) (string, error) {
+	if s.initError != nil {
+		return "", s.initError
+	}
+
+	// An account has at most one alias
+	result, err := s.client.ListAccountAliases(ctx, &iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+	if len(result.AccountAliases) == 0 {
+		return "", nil
+	}
+
+	return result.AccountAliases[0], nil
+}
+
+// =====
+
+// IAMAPI defines the interface for AWS IAM SDK functions
+type IAMAPI interface {
+	ListAccountAliases(ctx context.Context,
+		params *iam.ListAccountAliasesInput,
+		optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error)
+}
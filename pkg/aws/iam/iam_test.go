@@ -0,0 +1,105 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+type IAMAPIMock struct {
+	aliases []string
+}
+
+type IAMAPIMockFail struct{}
+
+func TestNewService(t *testing.T) {
+	tests := []struct {
+		name   string
+		client IAMAPI
+	}{
+		{
+			name:   "iam API mock",
+			client: IAMAPIMock{},
+		},
+		{
+			name:   "nil test",
+			client: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewService(WithAPI(tt.client), WithRegion("us-east-1"))
+			if got == nil {
+				t.Errorf("iam.NewService() returned nil when it wasn't supposed to")
+			} else {
+				val := reflect.ValueOf(got).Elem()
+
+				if val.Type().Field(0).Name != "client" {
+					t.Errorf("iam.NewService() did not return service struct containing field `client`")
+				}
+			}
+		})
+	}
+}
+
+func Test_service_GetAccountAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  IAMAPI
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "alias",
+			client: IAMAPIMock{aliases: []string{"prod-data"}},
+			want:   "prod-data",
+		},
+		{
+			name:   "no alias",
+			client: IAMAPIMock{},
+			want:   "",
+		},
+		{
+			name:    "failure",
+			client:  IAMAPIMockFail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(WithAPI(tt.client))
+			got, err := s.GetAccountAlias(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetAccountAlias() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("service.GetAccountAlias() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("init error", func(t *testing.T) {
+		s := &service{initError: errors.New("no credentials")}
+		if _, err := s.GetAccountAlias(context.TODO()); err == nil {
+			t.Errorf("service.GetAccountAlias() expected init error")
+		}
+	})
+}
+
+// =====
+
+func (s IAMAPIMock) ListAccountAliases(ctx context.Context,
+	params *iam.ListAccountAliasesInput,
+	optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error) {
+	return &iam.ListAccountAliasesOutput{AccountAliases: s.aliases}, nil
+}
+
+func (s IAMAPIMockFail) ListAccountAliases(ctx context.Context,
+	params *iam.ListAccountAliasesInput,
+	optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error) {
+	return nil, errors.New("access denied")
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMFACodeValidity is how long an MFA code is reused before a new one is asked for. TOTP codes change every
+// 30 seconds.
+const DefaultMFACodeValidity = 30 * time.Second
+
+// MFA supplies the MFA device serial number and code sent with DeleteObjects requests to buckets with MFA Delete
+// enabled. A code is reused until it expires or S3 rejects it, then TokenProvider is asked for a new one.
+//
+// The same *MFA can be shared by services used concurrently, only one new code is asked for at a time.
+type MFA struct {
+	// Serial is the serial number or ARN of the MFA device
+	Serial string
+	// TokenProvider returns the current code of the MFA device
+	TokenProvider func() (string, error)
+	// Validity is how long a code is reused for, DefaultMFACodeValidity if zero
+	Validity time.Duration
+
+	mu      sync.Mutex
+	code    string
+	expires time.Time
+	now     func() time.Time
+}
+
+// value returns the MFA request parameter, the device serial number and current code separated by a space
+func (m *MFA) value() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now
+	if m.now != nil {
+		now = m.now
+	}
+	if m.code == "" || !now().Before(m.expires) {
+		code, err := m.TokenProvider()
+		if err != nil {
+			return "", err
+		}
+		validity := m.Validity
+		if validity <= 0 {
+			validity = DefaultMFACodeValidity
+		}
+		m.code = code
+		m.expires = now().Add(validity)
+	}
+
+	return m.Serial + " " + m.code, nil
+}
+
+// reject discards the code in `value` so the next request asks for a new one. Nothing is discarded if another
+// request has already replaced the code.
+func (m *MFA) reject(value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.code != "" && m.Serial+" "+m.code == value {
+		m.code = ""
+	}
+}
@@ -2,14 +2,19 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/rs/zerolog/log"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/config"
 )
@@ -45,6 +50,14 @@ type Service interface {
 	// `error` is returned not nil if an error has occurred requesting the list
 	ListObjects(ctx context.Context, bucketName string, continuationToken *string, prefix *string) ([]string, *string, error)
 
+	// ListPrefix will return one page of the prefixes and objects directly under `prefix`, using "/" as the delimiter
+	// like a directory listing. Use continuationToken to list the next page, for the first call set it to nil.
+	//
+	// returns:
+	// `*PrefixListing` contains the prefixes and objects listed, and the continuation token of the next page, if any
+	// `error` is returned not nil if an error has occurred requesting the list
+	ListPrefix(ctx context.Context, bucketName string, prefix string, continuationToken *string) (*PrefixListing, error)
+
 	// ListObjectVersions will return version information
 	//
 	// returns:
@@ -54,14 +67,68 @@ type Service interface {
 	// `error` is returned not nil if an error has occurred requesting the object version list
 	ListObjectVersions(ctx context.Context, bucketName string, keyMarker *string, versionIDMarker *string, prefix *string) ([]ObjectVersion, *string, *string, error)
 
+	// ListVersionPrefix will return one page of the prefixes directly under `prefix`, and the versions and delete markers
+	// of the keys directly under it, using "/" as the delimiter. Use keyMarker and versionIDMarker from the previous page
+	// to list the next page, for the first call set them to nil.
+	//
+	// returns:
+	// `*VersionListing` contains the prefixes and versions listed, and the markers of the next page, if any
+	// `error` is returned not nil if an error has occurred requesting the object version list
+	ListVersionPrefix(ctx context.Context, bucketName string, prefix string, keyMarker *string, versionIDMarker *string) (*VersionListing, error)
+
 	// DeleteObjects will bulk delete up to 1000 objects in one call
 	//
 	// returns:
 	// `[]ObjectIdentifier` contains list of objects deleted
 	// `error` is returned not nil if an error has occurred requesting the object deletion
 	DeleteObjects(ctx context.Context, bucketName string, objects []ObjectIdentifier) ([]ObjectIdentifier, error)
+
+	// DeleteObjectsDetailed works like DeleteObjects, but also returns the per-object errors reported by S3 and
+	// the number of throttled attempts which were retried
+	DeleteObjectsDetailed(ctx context.Context, bucketName string, objects []ObjectIdentifier) (*DeleteResult, error)
+
+	// GetObject will retrieve an object (or a specific version of an object) from a bucket.
+	// Set versionID to nil to retrieve the current version.
+	//
+	// The caller is responsible for closing the returned Object's Body.
+	//
+	// returns:
+	// `*Object` contains the object body and metadata
+	// `error` is returned not nil if an error has occurred requesting the object
+	GetObject(ctx context.Context, bucketName string, keyName string, versionID *string) (*Object, error)
+
+	// CopyObject will perform a server-side copy of an object version into another bucket and key.
+	// Set srcVersionID to nil to copy the current version.
+	//
+	// Objects larger than MaxCopyObjectSize are copied using a multipart upload (UploadPartCopy),
+	// so `size` must be set to the size of the source object version. The metadata, tags and encryption
+	// settings of these objects are read from the source and set on the upload.
+	//
+	// returns:
+	// `error` is returned not nil if the object could not be copied
+	CopyObject(ctx context.Context, srcBucket string, srcKey string, srcVersionID *string, size int64, dstBucket string, dstKey string) error
+
+	// GetBucketTags will return the tags set on a bucket. A bucket without tags returns an empty map.
+	GetBucketTags(ctx context.Context, bucketName string) (map[string]string, error)
+
+	// IsReplicationSource will return true if the bucket has a replication configuration (i.e. is the
+	// source of replication to another bucket)
+	IsReplicationSource(ctx context.Context, bucketName string) (bool, error)
+
+	// IsObjectLockEnabled will return true if Object Lock is enabled on the bucket
+	IsObjectLockEnabled(ctx context.Context, bucketName string) (bool, error)
+
+	// GetBucketVersioning will return the versioning configuration of a bucket, including whether MFA Delete is enabled
+	GetBucketVersioning(ctx context.Context, bucketName string) (*BucketVersioning, error)
 }
 
+// MaxCopyObjectSize is the largest object (5 GiB) that can be copied with a single CopyObject call
+const MaxCopyObjectSize int64 = 5 * 1024 * 1024 * 1024
+
+// minCopyPartSize is the part size used for multipart copies, it is increased for very large objects
+// so the copy always fits in the 10,000 part limit
+const minCopyPartSize int64 = 512 * 1024 * 1024
+
 // Bucket contains information about an S3 bucket
 type Bucket struct {
 	CreationDate *time.Time
@@ -72,6 +139,39 @@ type Bucket struct {
 type ObjectVersion struct {
 	ObjectIdentifier
 	IsDeleteMarker bool
+	IsLatest       bool
+	Size           int64
+	// StorageClass is the storage class of the object version, e.g. STANDARD. It is empty for delete markers.
+	StorageClass string
+	// LastModified is when the object version was created
+	LastModified *time.Time
+}
+
+// ObjectSummary describes the current version of an object returned by ListPrefix
+type ObjectSummary struct {
+	Key          string
+	Size         int64
+	StorageClass string
+	LastModified *time.Time
+}
+
+// PrefixListing contains the results from ListPrefix()
+type PrefixListing struct {
+	// Prefixes are the common prefixes directly under the listed prefix, including the trailing "/"
+	Prefixes []string
+	Objects  []ObjectSummary
+	// NextContinuationToken is set if there are more results to list
+	NextContinuationToken *string
+}
+
+// VersionListing contains the results from ListVersionPrefix()
+type VersionListing struct {
+	// Prefixes are the common prefixes directly under the listed prefix, including the trailing "/"
+	Prefixes []string
+	Versions []ObjectVersion
+	// NextKeyMarker and NextVersionIDMarker are set if there are more results to list
+	NextKeyMarker       *string
+	NextVersionIDMarker *string
 }
 
 // ObjectIdentifier is used to identify a specific S3 object and version
@@ -80,6 +180,37 @@ type ObjectIdentifier struct {
 	VersionID *string
 }
 
+// Object contains the body and metadata of an S3 object returned by GetObject
+type Object struct {
+	Body          io.ReadCloser
+	ContentLength int64
+	LastModified  *time.Time
+	VersionID     *string
+}
+
+// BucketVersioning contains the results from GetBucketVersioning()
+type BucketVersioning struct {
+	// Status is Enabled or Suspended, or empty if versioning has never been enabled on the bucket
+	Status string
+	// MFADelete is true if deleting object versions requires an MFA code (see WithMFA)
+	MFADelete bool
+}
+
+// DeleteResult contains the results from DeleteObjectsDetailed()
+type DeleteResult struct {
+	Deleted []ObjectIdentifier
+	Errors  []DeleteError
+	// ThrottledAttempts is the number of request attempts which were throttled before the request succeeded
+	ThrottledAttempts int
+}
+
+// DeleteError describes an object which S3 failed to delete
+type DeleteError struct {
+	ObjectIdentifier
+	Code    string
+	Message string
+}
+
 // ServiceOption is used with NewS3Service and configures the newly created s3Service
 type ServiceOption func(s *service)
 
@@ -88,7 +219,13 @@ type service struct {
 	awsEndpoint string
 	region      string
 	profile     string
-	initError   error
+	assumeRole  *config.AssumeRole
+	mfa         *MFA
+	// expectedOwner is the account ID the buckets must be owned by, if set
+	expectedOwner string
+	// expectedSourceOwner is the account ID the source buckets of copies must be owned by, if set
+	expectedSourceOwner string
+	initError           error
 }
 
 // NewService returns an initialized S3Service
@@ -102,9 +239,9 @@ func NewService(opts ...ServiceOption) Service {
 		var client S3API
 		var err error
 		if svc.region == "" {
-			client, err = newS3Client(os.Getenv("AWS_REGION"), svc.awsEndpoint, svc.profile)
+			client, err = newS3Client(os.Getenv("AWS_REGION"), svc.awsEndpoint, svc.profile, svc.assumeRole)
 		} else {
-			client, err = newS3Client(svc.region, svc.awsEndpoint, svc.profile)
+			client, err = newS3Client(svc.region, svc.awsEndpoint, svc.profile, svc.assumeRole)
 		}
 		if err != nil {
 			svc.initError = err
@@ -146,6 +283,41 @@ func WithProfile(profile string) ServiceOption {
 	}
 }
 
+// WithMFA sends an MFA code from `mfa` with every DeleteObjects request, which is required by buckets with MFA Delete
+// enabled. Share the same *MFA between services so a code is only asked for once.
+func WithMFA(mfa *MFA) ServiceOption {
+	return func(s *service) {
+		s.mfa = mfa
+	}
+}
+
+// WithExpectedOwner sends `accountID` as the expected bucket owner with every request made to a bucket (listing,
+// reading, copying to and deleting from it, and looking up its location, tags and settings), so they fail with
+// AccessDenied instead of acting on a bucket owned by another account.
+// No expected owner is sent if `accountID` is empty.
+func WithExpectedOwner(accountID string) ServiceOption {
+	return func(s *service) {
+		s.expectedOwner = accountID
+	}
+}
+
+// WithExpectedSourceOwner sends `accountID` as the expected owner of the source bucket of copies (CopyObject and
+// UploadPartCopy, and reading the metadata and tags of the source object), so objects are never copied from a bucket
+// owned by another account. No expected source owner is sent if `accountID` is empty.
+func WithExpectedSourceOwner(accountID string) ServiceOption {
+	return func(s *service) {
+		s.expectedSourceOwner = accountID
+	}
+}
+
+// WithAssumeRole assumes `role` using the credentials of the profile. Share the same role between services so the
+// temporary credentials are cached for all of them.
+func WithAssumeRole(role *config.AssumeRole) ServiceOption {
+	return func(s *service) {
+		s.assumeRole = role
+	}
+}
+
 func (s *service) GetAllBuckets(ctx context.Context) ([]Bucket, error) {
 	if s.initError != nil {
 		return nil, s.initError
@@ -186,7 +358,8 @@ func (s *service) CreateBucketSimple(ctx context.Context, bucketName string, reg
 
 	if versioned {
 		_, err := s.client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
-			Bucket: &bucketName,
+			Bucket:              &bucketName,
+			ExpectedBucketOwner: s.expectedBucketOwner(),
 			VersioningConfiguration: &types.VersioningConfiguration{
 				Status: "Enabled",
 			},
@@ -204,9 +377,10 @@ func (s *service) PutObjectSimple(ctx context.Context, bucketName string, keyNam
 		return nil, nil, s.initError
 	}
 	result, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &bucketName,
-		Key:    &keyName,
-		Body:   body,
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		Key:                 &keyName,
+		Body:                body,
 	})
 
 	if err != nil {
@@ -222,7 +396,8 @@ func (s *service) GetBucketRegion(ctx context.Context, bucketName string) (strin
 	}
 	log.Debug().Str("bucket", bucketName).Msg("s3: looking up bucket region")
 	result, err := s.client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
-		Bucket: &bucketName,
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
 	})
 
 	if err != nil {
@@ -243,10 +418,11 @@ func (s *service) ListObjects(ctx context.Context, bucketName string, continuati
 	}
 	log.Debug().Str("bucket", bucketName).Msg("s3: list objects")
 	result, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
-		Bucket:            &bucketName,
-		ContinuationToken: continuationToken,
-		MaxKeys:           aws.Int32(1000),
-		Prefix:            prefix,
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		ContinuationToken:   continuationToken,
+		MaxKeys:             aws.Int32(1000),
+		Prefix:              prefix,
 	})
 
 	if err != nil {
@@ -265,6 +441,42 @@ func (s *service) ListObjects(ctx context.Context, bucketName string, continuati
 	return keys, nil, nil
 }
 
+func (s *service) ListPrefix(ctx context.Context, bucketName string, prefix string, continuationToken *string) (*PrefixListing, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).Str("prefix", prefix).Msg("s3: list prefix")
+	result, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		ContinuationToken:   continuationToken,
+		Delimiter:           aws.String("/"),
+		MaxKeys:             aws.Int32(1000),
+		Prefix:              aws.String(prefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &PrefixListing{Prefixes: []string{}, Objects: []ObjectSummary{}}
+	for _, commonPrefix := range result.CommonPrefixes {
+		listing.Prefixes = append(listing.Prefixes, aws.ToString(commonPrefix.Prefix))
+	}
+	for _, object := range result.Contents {
+		listing.Objects = append(listing.Objects, ObjectSummary{
+			Key:          aws.ToString(object.Key),
+			Size:         aws.ToInt64(object.Size),
+			StorageClass: string(object.StorageClass),
+			LastModified: object.LastModified,
+		})
+	}
+	if aws.ToBool(result.IsTruncated) {
+		listing.NextContinuationToken = result.NextContinuationToken
+	}
+
+	return listing, nil
+}
+
 func (s *service) ListObjectVersions(ctx context.Context, bucketName string, keyMarker *string, versionIDMarker *string, prefix *string) ([]ObjectVersion, *string, *string, error) {
 	if s.initError != nil {
 		return nil, nil, nil, s.initError
@@ -275,16 +487,56 @@ func (s *service) ListObjectVersions(ctx context.Context, bucketName string, key
 		Interface("prefix", prefix).
 		Msg("s3: list object versions")
 	result, err := s.client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
-		Bucket:          &bucketName,
-		KeyMarker:       keyMarker,
-		MaxKeys:         aws.Int32(1000),
-		Prefix:          prefix,
-		VersionIdMarker: versionIDMarker,
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		KeyMarker:           keyMarker,
+		MaxKeys:             aws.Int32(1000),
+		Prefix:              prefix,
+		VersionIdMarker:     versionIDMarker,
 	})
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	return objectVersions(result), result.NextKeyMarker, result.NextVersionIdMarker, nil
+}
+
+func (s *service) ListVersionPrefix(ctx context.Context, bucketName string, prefix string, keyMarker *string, versionIDMarker *string) (*VersionListing, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).
+		Str("prefix", prefix).
+		Interface("keyMarker", keyMarker).
+		Interface("versionIDMarker", versionIDMarker).
+		Msg("s3: list version prefix")
+	result, err := s.client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket:              &bucketName,
+		Delimiter:           aws.String("/"),
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		KeyMarker:           keyMarker,
+		MaxKeys:             aws.Int32(1000),
+		Prefix:              aws.String(prefix),
+		VersionIdMarker:     versionIDMarker,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &VersionListing{Prefixes: []string{}, Versions: objectVersions(result)}
+	for _, commonPrefix := range result.CommonPrefixes {
+		listing.Prefixes = append(listing.Prefixes, aws.ToString(commonPrefix.Prefix))
+	}
+	if aws.ToBool(result.IsTruncated) {
+		listing.NextKeyMarker = result.NextKeyMarker
+		listing.NextVersionIDMarker = result.NextVersionIdMarker
+	}
+
+	return listing, nil
+}
+
+// objectVersions returns the versions and delete markers of a ListObjectVersions response
+func objectVersions(result *s3.ListObjectVersionsOutput) []ObjectVersion {
 	versions := []ObjectVersion{}
 	for _, version := range result.Versions {
 		versions = append(versions, ObjectVersion{
@@ -293,6 +545,10 @@ func (s *service) ListObjectVersions(ctx context.Context, bucketName string, key
 				VersionID: version.VersionId,
 			},
 			IsDeleteMarker: false,
+			IsLatest:       aws.ToBool(version.IsLatest),
+			Size:           aws.ToInt64(version.Size),
+			StorageClass:   string(version.StorageClass),
+			LastModified:   version.LastModified,
 		})
 	}
 
@@ -303,13 +559,24 @@ func (s *service) ListObjectVersions(ctx context.Context, bucketName string, key
 				VersionID: deleteMarker.VersionId,
 			},
 			IsDeleteMarker: true,
+			IsLatest:       aws.ToBool(deleteMarker.IsLatest),
+			LastModified:   deleteMarker.LastModified,
 		})
 	}
 
-	return versions, result.NextKeyMarker, result.NextVersionIdMarker, nil
+	return versions
 }
 
 func (s *service) DeleteObjects(ctx context.Context, bucketName string, objects []ObjectIdentifier) ([]ObjectIdentifier, error) {
+	result, err := s.DeleteObjectsDetailed(ctx, bucketName, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Deleted, nil
+}
+
+func (s *service) DeleteObjectsDetailed(ctx context.Context, bucketName string, objects []ObjectIdentifier) (*DeleteResult, error) {
 	if s.initError != nil {
 		return nil, s.initError
 	}
@@ -322,29 +589,382 @@ func (s *service) DeleteObjects(ctx context.Context, bucketName string, objects
 		})
 	}
 
-	result, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+	input := &s3.DeleteObjectsInput{
 		Bucket: &bucketName,
 		Delete: &types.Delete{
 			Objects: deleteObjects,
 			Quiet:   aws.Bool(false),
 		},
-	})
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+	}
+	var result *s3.DeleteObjectsOutput
+	var err error
+	for attempt := 0; ; attempt++ {
+		if s.mfa != nil {
+			mfa, err := s.mfa.value()
+			if err != nil {
+				return nil, fmt.Errorf("could not get MFA code: %w", err)
+			}
+			input.MFA = &mfa
+		}
+		result, err = s.client.DeleteObjects(ctx, input)
+		if err != nil && s.mfa != nil && attempt == 0 && isErrorCode(err, "AccessDenied") {
+			// the MFA code may have expired since it was entered, so try once more with a new code
+			log.Debug().Err(err).Str("bucket", bucketName).Msg("s3: delete objects denied, asking for a new MFA code")
+			s.mfa.reject(*input.MFA)
+			continue
+		}
+		break
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	returnValue := []ObjectIdentifier{}
+	returnValue := &DeleteResult{
+		Deleted: []ObjectIdentifier{},
+		Errors:  []DeleteError{},
+	}
 	for _, object := range result.Deleted {
-		returnValue = append(returnValue, ObjectIdentifier{
+		returnValue.Deleted = append(returnValue.Deleted, ObjectIdentifier{
 			Key:       object.Key,
 			VersionID: object.VersionId,
 		})
 	}
+	for _, deleteErr := range result.Errors {
+		returnValue.Errors = append(returnValue.Errors, DeleteError{
+			ObjectIdentifier: ObjectIdentifier{
+				Key:       deleteErr.Key,
+				VersionID: deleteErr.VersionId,
+			},
+			Code:    aws.ToString(deleteErr.Code),
+			Message: aws.ToString(deleteErr.Message),
+		})
+	}
+	if attempts, ok := retry.GetAttemptResults(result.ResultMetadata); ok {
+		for _, attempt := range attempts.Results {
+			if attempt.Err != nil && IsThrottleError(attempt.Err) {
+				returnValue.ThrottledAttempts++
+			}
+		}
+	}
 
 	return returnValue, nil
 }
 
-func newS3Client(region string, awsEndpoint string, profile string) (*s3.Client, error) {
+func (s *service) GetObject(ctx context.Context, bucketName string, keyName string, versionID *string) (*Object, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).Str("key", keyName).Interface("versionID", versionID).Msg("s3: get object")
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		Key:                 &keyName,
+		VersionId:           versionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Body:          result.Body,
+		ContentLength: aws.ToInt64(result.ContentLength),
+		LastModified:  result.LastModified,
+		VersionID:     result.VersionId,
+	}, nil
+}
+
+func (s *service) CopyObject(ctx context.Context, srcBucket string, srcKey string, srcVersionID *string, size int64, dstBucket string, dstKey string) error {
+	if s.initError != nil {
+		return s.initError
+	}
+	log.Debug().Str("srcBucket", srcBucket).Str("srcKey", srcKey).Interface("srcVersionID", srcVersionID).
+		Str("dstBucket", dstBucket).Str("dstKey", dstKey).Int64("size", size).Msg("s3: copy object")
+
+	source := copySource(srcBucket, srcKey, srcVersionID)
+	if size <= MaxCopyObjectSize {
+		_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:                    &dstBucket,
+			ExpectedBucketOwner:       s.expectedBucketOwner(),
+			ExpectedSourceBucketOwner: s.expectedSourceBucketOwner(),
+			Key:                       &dstKey,
+			CopySource:                &source,
+		})
+		return err
+	}
+
+	// unlike CopyObject, a multipart upload does not copy the metadata, tags and encryption settings of the source
+	input, err := s.multipartCopyInput(ctx, srcBucket, srcKey, srcVersionID)
+	if err != nil {
+		return err
+	}
+	input.Bucket = &dstBucket
+	input.ExpectedBucketOwner = s.expectedBucketOwner()
+	input.Key = &dstKey
+
+	upload, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	if err := s.copyParts(ctx, source, size, dstBucket, dstKey, upload.UploadId); err != nil {
+		s.abortMultipartUpload(dstBucket, dstKey, upload.UploadId)
+		return err
+	}
+
+	return nil
+}
+
+// multipartCopyInput returns the CreateMultipartUploadInput for copying an object version, carrying over its user
+// metadata, content headers, tags and server-side encryption settings
+func (s *service) multipartCopyInput(ctx context.Context, srcBucket string, srcKey string, srcVersionID *string) (*s3.CreateMultipartUploadInput, error) {
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:              &srcBucket,
+		ExpectedBucketOwner: s.expectedSourceBucketOwner(),
+		Key:                 &srcKey,
+		VersionId:           srcVersionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tagging, err := s.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket:              &srcBucket,
+		ExpectedBucketOwner: s.expectedSourceBucketOwner(),
+		Key:                 &srcKey,
+		VersionId:           srcVersionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Metadata:                head.Metadata,
+		CacheControl:            head.CacheControl,
+		ContentDisposition:      head.ContentDisposition,
+		ContentEncoding:         head.ContentEncoding,
+		ContentLanguage:         head.ContentLanguage,
+		ContentType:             head.ContentType,
+		Expires:                 head.Expires,
+		WebsiteRedirectLocation: head.WebsiteRedirectLocation,
+		ServerSideEncryption:    head.ServerSideEncryption,
+		SSEKMSKeyId:             head.SSEKMSKeyId,
+		BucketKeyEnabled:        head.BucketKeyEnabled,
+	}
+	if len(tagging.TagSet) > 0 {
+		tags := url.Values{}
+		for _, tag := range tagging.TagSet {
+			tags.Set(aws.ToString(tag.Key), aws.ToString(tag.Value))
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+
+	return input, nil
+}
+
+// copyParts copies an object version into a multipart upload with UploadPartCopy and completes the upload.
+// The caller is responsible for aborting the upload if an error is returned.
+func (s *service) copyParts(ctx context.Context, source string, size int64, dstBucket string, dstKey string, uploadID *string) error {
+	partSize := minCopyPartSize
+	if size/10000 >= partSize {
+		partSize = size/10000 + 1
+	}
+
+	parts := []types.CompletedPart{}
+	for start, partNumber := int64(0), int32(1); start < size; start, partNumber = start+partSize, partNumber+1 {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		result, err := s.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:                    &dstBucket,
+			ExpectedBucketOwner:       s.expectedBucketOwner(),
+			ExpectedSourceBucketOwner: s.expectedSourceBucketOwner(),
+			Key:                       &dstKey,
+			UploadId:                  uploadID,
+			PartNumber:                aws.Int32(partNumber),
+			CopySource:                &source,
+			CopySourceRange:           aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		})
+		if err != nil {
+			return err
+		}
+		if result.CopyPartResult == nil {
+			return fmt.Errorf("no copy result for part %d", partNumber)
+		}
+
+		parts = append(parts, types.CompletedPart{
+			ETag:       result.CopyPartResult.ETag,
+			PartNumber: aws.Int32(partNumber),
+		})
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:              &dstBucket,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		Key:                 &dstKey,
+		UploadId:            uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: parts,
+		},
+	})
+
+	return err
+}
+
+func (s *service) GetBucketTags(ctx context.Context, bucketName string) (map[string]string, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).Msg("s3: get bucket tags")
+	result, err := s.client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+	})
+	if err != nil {
+		if isErrorCode(err, "NoSuchTagSet") {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(result.TagSet))
+	for _, tag := range result.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return tags, nil
+}
+
+func (s *service) IsReplicationSource(ctx context.Context, bucketName string) (bool, error) {
+	if s.initError != nil {
+		return false, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).Msg("s3: get bucket replication")
+	result, err := s.client.GetBucketReplication(ctx, &s3.GetBucketReplicationInput{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+	})
+	if err != nil {
+		if isErrorCode(err, "ReplicationConfigurationNotFoundError") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return result.ReplicationConfiguration != nil && len(result.ReplicationConfiguration.Rules) > 0, nil
+}
+
+func (s *service) IsObjectLockEnabled(ctx context.Context, bucketName string) (bool, error) {
+	if s.initError != nil {
+		return false, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).Msg("s3: get object lock configuration")
+	result, err := s.client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+	})
+	if err != nil {
+		if isErrorCode(err, "ObjectLockConfigurationNotFoundError") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return result.ObjectLockConfiguration != nil &&
+		result.ObjectLockConfiguration.ObjectLockEnabled == types.ObjectLockEnabledEnabled, nil
+}
+
+func (s *service) GetBucketVersioning(ctx context.Context, bucketName string) (*BucketVersioning, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+	log.Debug().Str("bucket", bucketName).Msg("s3: get bucket versioning")
+	result, err := s.client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BucketVersioning{
+		Status:    string(result.Status),
+		MFADelete: result.MFADelete == types.MFADeleteStatusEnabled,
+	}, nil
+}
+
+// ErrorCode returns the AWS API error code of `err`, or "Unknown" if it is not an AWS API error
+func ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return apiErr.ErrorCode()
+	}
+	return "Unknown"
+}
+
+// IsThrottleError returns true if `err` is an AWS API error caused by request throttling
+func IsThrottleError(err error) bool {
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+// isErrorCode returns true if err is an AWS API error with the given error code
+func isErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() == code
+	}
+	return false
+}
+
+// expectedBucketOwner returns the ExpectedBucketOwner parameter for requests, nil if no expected owner is set
+func (s *service) expectedBucketOwner() *string {
+	if s.expectedOwner == "" {
+		return nil
+	}
+	return aws.String(s.expectedOwner)
+}
+
+// expectedSourceBucketOwner returns the ExpectedSourceBucketOwner parameter for copies, nil if no expected source
+// owner is set
+func (s *service) expectedSourceBucketOwner() *string {
+	if s.expectedSourceOwner == "" {
+		return nil
+	}
+	return aws.String(s.expectedSourceOwner)
+}
+
+// abortMultipartUpload cleans up a failed multipart copy so the uploaded parts are not billed.
+// A fresh context is used since the failure may have been caused by the original context being canceled.
+func (s *service) abortMultipartUpload(bucketName string, keyName string, uploadID *string) {
+	_, err := s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:              &bucketName,
+		ExpectedBucketOwner: s.expectedBucketOwner(),
+		Key:                 &keyName,
+		UploadId:            uploadID,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("bucket", bucketName).Str("key", keyName).Msg("s3: could not abort multipart upload")
+	}
+}
+
+// copySource returns the URL-encoded CopySource value for an object version
+func copySource(bucketName string, keyName string, versionID *string) string {
+	segments := strings.Split(keyName, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	source := bucketName + "/" + strings.Join(segments, "/")
+	if versionID != nil {
+		source += "?versionId=" + url.QueryEscape(*versionID)
+	}
+
+	return source
+}
+
+func newS3Client(region string, awsEndpoint string, profile string, assumeRole *config.AssumeRole) (*s3.Client, error) {
 	// Default to us-east-1 if no region is provided
 	if region == "" {
 		region = "us-east-1"
@@ -354,9 +974,9 @@ func newS3Client(region string, awsEndpoint string, profile string) (*s3.Client,
 	var cfg aws.Config
 	var err error
 	if profile != "" {
-		cfg, err = config.NewWithProfile(region, profile)
+		cfg, err = config.NewWithProfile(region, profile, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
 	} else {
-		cfg, err = config.New(region)
+		cfg, err = config.New(region, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize AWS config: %w", err)
@@ -404,4 +1024,52 @@ type S3API interface {
 	DeleteObjects(ctx context.Context,
 		params *s3.DeleteObjectsInput,
 		optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+
+	GetObject(ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+
+	CopyObject(ctx context.Context,
+		params *s3.CopyObjectInput,
+		optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+
+	HeadObject(ctx context.Context,
+		params *s3.HeadObjectInput,
+		optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+
+	GetObjectTagging(ctx context.Context,
+		params *s3.GetObjectTaggingInput,
+		optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+
+	CreateMultipartUpload(ctx context.Context,
+		params *s3.CreateMultipartUploadInput,
+		optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+
+	UploadPartCopy(ctx context.Context,
+		params *s3.UploadPartCopyInput,
+		optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+
+	CompleteMultipartUpload(ctx context.Context,
+		params *s3.CompleteMultipartUploadInput,
+		optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+
+	AbortMultipartUpload(ctx context.Context,
+		params *s3.AbortMultipartUploadInput,
+		optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+
+	GetBucketTagging(ctx context.Context,
+		params *s3.GetBucketTaggingInput,
+		optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+
+	GetBucketReplication(ctx context.Context,
+		params *s3.GetBucketReplicationInput,
+		optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error)
+
+	GetObjectLockConfiguration(ctx context.Context,
+		params *s3.GetObjectLockConfigurationInput,
+		optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error)
+
+	GetBucketVersioning(ctx context.Context,
+		params *s3.GetBucketVersioningInput,
+		optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error)
 }
@@ -3,6 +3,7 @@ package s3
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"reflect"
@@ -14,6 +15,7 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -75,7 +77,7 @@ func Test_newS3Client(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newS3Client(tt.args.region, tt.args.awsEndpoint, tt.args.profile)
+			got, err := newS3Client(tt.args.region, tt.args.awsEndpoint, tt.args.profile, nil)
 			
 			// Special handling for tests with invalid profiles
 			if tt.args.profile != "" && err != nil {
@@ -593,6 +595,64 @@ func Test_service_ListObjects(t *testing.T) {
 	}
 }
 
+func Test_service_ListPrefix(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	s := NewService(WithS3API(S3APIPrefixMock{S3APIMock: S3APIMock{t: t}}))
+
+	got, err := s.ListPrefix(context.TODO(), "test-bucket", "logs/", nil)
+	if err != nil {
+		t.Fatalf("service.ListPrefix() error = %v", err)
+	}
+	want := &PrefixListing{
+		Prefixes:              []string{"logs/2023/", "logs/2024/"},
+		Objects:               []ObjectSummary{{Key: "logs/index.json", Size: 42, StorageClass: "STANDARD"}},
+		NextContinuationToken: aws.String("next"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("service.ListPrefix() = %+v, want %+v", got, want)
+	}
+
+	got, err = s.ListPrefix(context.TODO(), "test-bucket", "logs/", aws.String("next"))
+	if err != nil || got.NextContinuationToken != nil || len(got.Prefixes) != 0 || len(got.Objects) != 0 {
+		t.Errorf("service.ListPrefix() last page = %+v, %v", got, err)
+	}
+
+	if _, err := NewService(WithS3API(S3APIMockFail{t: t})).ListPrefix(context.TODO(), "test-bucket", "", nil); err == nil {
+		t.Errorf("service.ListPrefix() error = nil, want error")
+	}
+}
+
+func Test_service_ListVersionPrefix(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	s := NewService(WithS3API(S3APIVersionPrefixMock{S3APIMock: S3APIMock{t: t}}))
+
+	got, err := s.ListVersionPrefix(context.TODO(), "test-bucket", "logs/", nil, nil)
+	if err != nil {
+		t.Fatalf("service.ListVersionPrefix() error = %v", err)
+	}
+	want := &VersionListing{
+		Prefixes: []string{"logs/2023/"},
+		Versions: []ObjectVersion{
+			{ObjectIdentifier: ObjectIdentifier{Key: aws.String("logs/index.json"), VersionID: aws.String("v2")}, IsLatest: true, Size: 42, StorageClass: "STANDARD"},
+			{ObjectIdentifier: ObjectIdentifier{Key: aws.String("logs/old.json"), VersionID: aws.String("v3")}, IsDeleteMarker: true, IsLatest: true},
+		},
+		NextKeyMarker:       aws.String("logs/index.json"),
+		NextVersionIDMarker: aws.String("v2"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("service.ListVersionPrefix() = %+v, want %+v", got, want)
+	}
+
+	got, err = s.ListVersionPrefix(context.TODO(), "test-bucket", "logs/", got.NextKeyMarker, got.NextVersionIDMarker)
+	if err != nil || got.NextKeyMarker != nil || got.NextVersionIDMarker != nil || len(got.Prefixes) != 0 || len(got.Versions) != 0 {
+		t.Errorf("service.ListVersionPrefix() last page = %+v, %v", got, err)
+	}
+
+	if _, err := NewService(WithS3API(S3APIMockFail{t: t})).ListVersionPrefix(context.TODO(), "test-bucket", "", nil, nil); err == nil {
+		t.Errorf("service.ListVersionPrefix() error = nil, want error")
+	}
+}
+
 func Test_service_ListObjectVersions(t *testing.T) {
 	log.Logger = log.Output(zerolog.TestWriter{T: t})
 	s3Mock := S3APIMock{
@@ -720,6 +780,10 @@ func Test_service_ListObjectVersions(t *testing.T) {
 				}
 				if len(versions) < 1 {
 					t.Errorf("service.ListObjectVersions() error, versions is empty")
+				} else if versions[0].StorageClass != "StandardStorage" {
+					t.Errorf("service.ListObjectVersions() StorageClass = %q, want StandardStorage", versions[0].StorageClass)
+				} else if versions[0].LastModified == nil {
+					t.Errorf("service.ListObjectVersions() LastModified is nil")
 				}
 
 				if keyMarker != nil {
@@ -846,6 +910,526 @@ func Test_service_DeleteObjects(t *testing.T) {
 	}
 }
 
+func Test_service_GetObject(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	s3Mock := S3APIMock{
+		options: s3.Options{},
+		t:       t,
+	}
+	s3MockFail := S3APIMockFail{
+		options: s3.Options{},
+		t:       t,
+	}
+
+	tests := []struct {
+		name      string
+		client    S3API
+		key       string
+		versionID *string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "current version",
+			client:    s3Mock,
+			key:       "file1",
+			versionID: nil,
+			want:      "contents of file1",
+		},
+		{
+			name:      "specific version",
+			client:    s3Mock,
+			key:       "file2",
+			versionID: aws.String("version2"),
+			want:      "contents of file2",
+		},
+		{
+			name:    "fail",
+			client:  s3MockFail,
+			key:     "file1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{
+				client: tt.client,
+			}
+			got, err := s.GetObject(context.TODO(), "testbucket", tt.key, tt.versionID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetObject() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			defer got.Body.Close()
+
+			body, err := io.ReadAll(got.Body)
+			if err != nil {
+				t.Errorf("service.GetObject() error reading body: %v", err)
+				return
+			}
+			if string(body) != tt.want {
+				t.Errorf("service.GetObject() body = %s, want %s", string(body), tt.want)
+			}
+			if got.ContentLength != int64(len(tt.want)) {
+				t.Errorf("service.GetObject() ContentLength = %d, want %d", got.ContentLength, len(tt.want))
+			}
+			if tt.versionID != nil && aws.ToString(got.VersionID) != *tt.versionID {
+				t.Errorf("service.GetObject() VersionID = %s, want %s", aws.ToString(got.VersionID), *tt.versionID)
+			}
+		})
+	}
+}
+
+func Test_service_CopyObject(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+
+	tests := []struct {
+		name         string
+		size         int64
+		failHead     bool
+		failPart     int32
+		failComplete bool
+		wantParts    int
+		wantCreated  bool
+		wantAborted  bool
+		wantErr      bool
+	}{
+		{
+			name:      "single copy",
+			size:      1024,
+			wantParts: 0,
+		},
+		{
+			name:      "exactly max copy size",
+			size:      MaxCopyObjectSize,
+			wantParts: 0,
+		},
+		{
+			name:        "multipart copy",
+			size:        MaxCopyObjectSize + 1,
+			wantParts:   11,
+			wantCreated: true,
+		},
+		{
+			name:        "multipart copy of a very large object",
+			size:        5 * 1024 * 1024 * 1024 * 1024,
+			wantParts:   10000,
+			wantCreated: true,
+		},
+		{
+			name:        "multipart copy part failure",
+			size:        MaxCopyObjectSize * 2,
+			failPart:    3,
+			wantParts:   2,
+			wantCreated: true,
+			wantAborted: true,
+			wantErr:     true,
+		},
+		{
+			name:         "multipart copy complete failure",
+			size:         MaxCopyObjectSize + 1,
+			failComplete: true,
+			wantParts:    11,
+			wantCreated:  true,
+			wantAborted:  true,
+			wantErr:      true,
+		},
+		{
+			name:     "multipart copy source head failure",
+			size:     MaxCopyObjectSize + 1,
+			failHead: true,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &S3APICopyRecorder{
+				S3APIMock:    S3APIMock{options: s3.Options{}, t: t},
+				failHead:     tt.failHead,
+				failPart:     tt.failPart,
+				failComplete: tt.failComplete,
+			}
+			s := &service{
+				client: recorder,
+			}
+			err := s.CopyObject(context.TODO(), "srcbucket", "dir/file 1", aws.String("version1"), tt.size, "dstbucket", "backup/dir/file 1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.CopyObject() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(recorder.ranges) != tt.wantParts {
+				t.Errorf("service.CopyObject() copied %d parts, want %d", len(recorder.ranges), tt.wantParts)
+			}
+			if recorder.aborted != tt.wantAborted {
+				t.Errorf("service.CopyObject() aborted = %v, want %v", recorder.aborted, tt.wantAborted)
+			}
+			if (recorder.created != nil) != tt.wantCreated {
+				t.Errorf("service.CopyObject() created a multipart upload = %v, want %v", recorder.created != nil, tt.wantCreated)
+			}
+			if recorder.created != nil {
+				created := recorder.created
+				if !reflect.DeepEqual(created.Metadata, map[string]string{"owner": "data-team"}) {
+					t.Errorf("CreateMultipartUpload() Metadata = %v, want the source metadata", created.Metadata)
+				}
+				if aws.ToString(created.ContentType) != "application/json" || aws.ToString(created.ContentEncoding) != "gzip" ||
+					aws.ToString(created.ContentDisposition) != "attachment" || aws.ToString(created.CacheControl) != "max-age=3600" {
+					t.Errorf("CreateMultipartUpload() content headers = %s, %s, %s, %s, want the source headers",
+						aws.ToString(created.ContentType), aws.ToString(created.ContentEncoding),
+						aws.ToString(created.ContentDisposition), aws.ToString(created.CacheControl))
+				}
+				if want := "cost+center=a%26b&env=prod"; aws.ToString(created.Tagging) != want {
+					t.Errorf("CreateMultipartUpload() Tagging = %s, want %s", aws.ToString(created.Tagging), want)
+				}
+				if created.ServerSideEncryption != types.ServerSideEncryptionAwsKms ||
+					aws.ToString(created.SSEKMSKeyId) != "arn:aws:kms:us-east-1:123456789012:key/example" || !aws.ToBool(created.BucketKeyEnabled) {
+					t.Errorf("CreateMultipartUpload() encryption = %s, %s, %v, want the source encryption",
+						created.ServerSideEncryption, aws.ToString(created.SSEKMSKeyId), aws.ToBool(created.BucketKeyEnabled))
+				}
+			}
+			if tt.wantParts > 0 && !tt.wantErr {
+				last := recorder.ranges[len(recorder.ranges)-1]
+				if !strings.HasSuffix(last, fmt.Sprintf("-%d", tt.size-1)) {
+					t.Errorf("service.CopyObject() last part range = %s, want to end at %d", last, tt.size-1)
+				}
+				if recorder.completedParts != tt.wantParts {
+					t.Errorf("service.CopyObject() completed %d parts, want %d", recorder.completedParts, tt.wantParts)
+				}
+			}
+		})
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		s := &service{
+			client: S3APIMockFail{options: s3.Options{}, t: t},
+		}
+		if err := s.CopyObject(context.TODO(), "srcbucket", "file1", nil, 1024, "dstbucket", "file1"); err == nil {
+			t.Errorf("service.CopyObject() expected error")
+		}
+		if err := s.CopyObject(context.TODO(), "srcbucket", "file1", nil, MaxCopyObjectSize*2, "dstbucket", "file1"); err == nil {
+			t.Errorf("service.CopyObject() expected error for multipart copy")
+		}
+	})
+}
+
+func Test_copySource(t *testing.T) {
+	tests := []struct {
+		name      string
+		bucket    string
+		key       string
+		versionID *string
+		want      string
+	}{
+		{name: "simple", bucket: "bucket", key: "file", want: "bucket/file"},
+		{name: "nested key", bucket: "bucket", key: "a/b/c.txt", want: "bucket/a/b/c.txt"},
+		{name: "special characters", bucket: "bucket", key: "a b/c+d?.txt", want: "bucket/a%20b/c+d%3F.txt"},
+		{name: "version", bucket: "bucket", key: "file", versionID: aws.String("abc+123"), want: "bucket/file?versionId=abc%2B123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := copySource(tt.bucket, tt.key, tt.versionID); got != tt.want {
+				t.Errorf("copySource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_GetBucketTags(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	tests := []struct {
+		name    string
+		client  S3API
+		bucket  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "tagged bucket",
+			client: S3APIMock{t: t},
+			bucket: "protected-bucket",
+			want:   map[string]string{"s3-nuke:protect": "true", "env": "prod"},
+		},
+		{
+			name:   "no tags",
+			client: S3APIMock{t: t},
+			bucket: "testbucket",
+			want:   map[string]string{},
+		},
+		{
+			name:    "fail",
+			client:  S3APIMockFail{t: t},
+			bucket:  "testbucket",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{client: tt.client}
+			got, err := s.GetBucketTags(context.TODO(), tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetBucketTags() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetBucketTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_IsReplicationSource(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	tests := []struct {
+		name    string
+		client  S3API
+		bucket  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "replicated", client: S3APIMock{t: t}, bucket: "replicated-bucket", want: true},
+		{name: "not replicated", client: S3APIMock{t: t}, bucket: "testbucket", want: false},
+		{name: "fail", client: S3APIMockFail{t: t}, bucket: "testbucket", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{client: tt.client}
+			got, err := s.IsReplicationSource(context.TODO(), tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.IsReplicationSource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("service.IsReplicationSource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_IsObjectLockEnabled(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	tests := []struct {
+		name    string
+		client  S3API
+		bucket  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "object lock enabled", client: S3APIMock{t: t}, bucket: "locked-bucket", want: true},
+		{name: "no object lock", client: S3APIMock{t: t}, bucket: "testbucket", want: false},
+		{name: "fail", client: S3APIMockFail{t: t}, bucket: "testbucket", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{client: tt.client}
+			got, err := s.IsObjectLockEnabled(context.TODO(), tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.IsObjectLockEnabled() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("service.IsObjectLockEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_DeleteObjectsDetailed(t *testing.T) {
+	s := &service{client: S3APIDeleteErrorsMock{S3APIMock: S3APIMock{options: s3.Options{}, t: t}}}
+	objects := []ObjectIdentifier{
+		{Key: aws.String("file1"), VersionID: aws.String("version1")},
+		{Key: aws.String("denied/file2"), VersionID: aws.String("version2")},
+	}
+
+	got, err := s.DeleteObjectsDetailed(context.TODO(), "testbucket", objects)
+	if err != nil {
+		t.Fatalf("service.DeleteObjectsDetailed() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Deleted, objects[:1]) {
+		t.Errorf("service.DeleteObjectsDetailed() deleted = %v, want %v", got.Deleted, objects[:1])
+	}
+	wantErrors := []DeleteError{{ObjectIdentifier: objects[1], Code: "AccessDenied", Message: "Access Denied"}}
+	if !reflect.DeepEqual(got.Errors, wantErrors) {
+		t.Errorf("service.DeleteObjectsDetailed() errors = %+v, want %+v", got.Errors, wantErrors)
+	}
+
+	failing := &service{client: S3APIMockFail{options: s3.Options{}, t: t}}
+	if _, err := failing.DeleteObjectsDetailed(context.TODO(), "testbucket", objects); err == nil {
+		t.Errorf("service.DeleteObjectsDetailed() expected error")
+	}
+}
+
+func Test_service_GetBucketVersioning(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	tests := []struct {
+		name    string
+		client  S3API
+		bucket  string
+		want    *BucketVersioning
+		wantErr bool
+	}{
+		{name: "mfa delete", client: S3APIMock{t: t}, bucket: "mfa-bucket", want: &BucketVersioning{Status: "Enabled", MFADelete: true}},
+		{name: "versioned", client: S3APIMock{t: t}, bucket: "versioned-bucket", want: &BucketVersioning{Status: "Enabled"}},
+		{name: "never versioned", client: S3APIMock{t: t}, bucket: "testbucket", want: &BucketVersioning{}},
+		{name: "fail", client: S3APIMockFail{t: t}, bucket: "testbucket", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{client: tt.client}
+			got, err := s.GetBucketVersioning(context.TODO(), tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetBucketVersioning() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetBucketVersioning() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_DeleteObjectsDetailed_MFA(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	codes := []string{"111111", "222222", "333333", "444444"}
+	asked := 0
+	mfa := &MFA{
+		Serial: "arn:aws:iam::123456789012:mfa/root-account-mfa-device",
+		TokenProvider: func() (string, error) {
+			code := codes[asked]
+			asked++
+			return code, nil
+		},
+		now: func() time.Time { return now },
+	}
+	client := &S3APIMFAMock{S3APIMock: S3APIMock{t: t}, code: "222222"}
+	s := &service{client: client, mfa: mfa}
+	objects := []ObjectIdentifier{{Key: aws.String("file1"), VersionID: aws.String("version1")}}
+
+	// the first code is rejected, so a new code is asked for and the request is retried
+	got, err := s.DeleteObjectsDetailed(context.TODO(), "mfa-bucket", objects)
+	if err != nil {
+		t.Fatalf("service.DeleteObjectsDetailed() error = %v", err)
+	}
+	if len(got.Deleted) != 1 || asked != 2 {
+		t.Errorf("service.DeleteObjectsDetailed() deleted %d objects after asking for %d codes, want 1 and 2", len(got.Deleted), asked)
+	}
+
+	// the accepted code is reused until it expires
+	if _, err := s.DeleteObjectsDetailed(context.TODO(), "mfa-bucket", objects); err != nil || asked != 2 {
+		t.Errorf("service.DeleteObjectsDetailed() error = %v, asked for %d codes, want the code to be reused", err, asked)
+	}
+	now = now.Add(DefaultMFACodeValidity)
+	if _, err := s.DeleteObjectsDetailed(context.TODO(), "mfa-bucket", objects); err == nil {
+		t.Errorf("service.DeleteObjectsDetailed() should fail when every new code is rejected")
+	}
+	if asked != 4 {
+		t.Errorf("asked for %d MFA codes, want a new code after the previous one expired and once more when it was rejected", asked)
+	}
+
+	wantRequests := []string{
+		mfa.Serial + " 111111",
+		mfa.Serial + " 222222",
+		mfa.Serial + " 222222",
+		mfa.Serial + " 333333",
+		mfa.Serial + " 444444",
+	}
+	if !reflect.DeepEqual(client.requests, wantRequests) {
+		t.Errorf("DeleteObjects MFA parameters = %v, want %v", client.requests, wantRequests)
+	}
+}
+
+func Test_service_WithExpectedOwner(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+	objects := []ObjectIdentifier{{Key: aws.String("file1"), VersionID: aws.String("version1")}}
+
+	for _, owner := range []string{"", "123456789012"} {
+		client := &S3APIOwnerRecorder{S3APIMock: S3APIMock{t: t}}
+		s := NewService(WithS3API(client), WithExpectedOwner(owner))
+
+		if _, err := s.GetBucketRegion(context.TODO(), "test-bucket"); err != nil {
+			t.Fatalf("service.GetBucketRegion() error = %v", err)
+		}
+		if _, _, _, err := s.ListObjectVersions(context.TODO(), "versioned-bucket", nil, nil, nil); err != nil {
+			t.Fatalf("service.ListObjectVersions() error = %v", err)
+		}
+		if _, err := s.DeleteObjects(context.TODO(), "test-bucket", objects); err != nil {
+			t.Fatalf("service.DeleteObjects() error = %v", err)
+		}
+		if _, err := s.ListPrefix(context.TODO(), "test-bucket", "", nil); err != nil {
+			t.Fatalf("service.ListPrefix() error = %v", err)
+		}
+		if _, err := s.GetObject(context.TODO(), "test-bucket", "file1", nil); err != nil {
+			t.Fatalf("service.GetObject() error = %v", err)
+		}
+		if _, err := s.GetBucketTags(context.TODO(), "protected-bucket"); err != nil {
+			t.Fatalf("service.GetBucketTags() error = %v", err)
+		}
+		if _, err := s.GetBucketVersioning(context.TODO(), "versioned-bucket"); err != nil {
+			t.Fatalf("service.GetBucketVersioning() error = %v", err)
+		}
+
+		want := []string{owner, owner, owner, owner, owner, owner, owner}
+		if !reflect.DeepEqual(client.owners, want) {
+			t.Errorf("ExpectedBucketOwner parameters = %q, want %q", client.owners, want)
+		}
+	}
+}
+
+func Test_service_WithExpectedSourceOwner(t *testing.T) {
+	log.Logger = log.Output(zerolog.TestWriter{T: t})
+
+	for _, owner := range []string{"", "123456789012"} {
+		client := &S3APISourceOwnerRecorder{S3APIMock: S3APIMock{t: t}}
+		s := NewService(WithS3API(client), WithExpectedSourceOwner(owner))
+
+		if err := s.CopyObject(context.TODO(), "srcbucket", "file1", aws.String("version1"), 1024, "dstbucket", "backup/file1"); err != nil {
+			t.Fatalf("service.CopyObject() error = %v", err)
+		}
+		if err := s.CopyObject(context.TODO(), "srcbucket", "file2", aws.String("version1"), MaxCopyObjectSize+1, "dstbucket", "backup/file2"); err != nil {
+			t.Fatalf("service.CopyObject() multipart error = %v", err)
+		}
+
+		// CopyObject, then HeadObject, GetObjectTagging and the 11 UploadPartCopy calls of the multipart copy
+		want := make([]string, 14)
+		for i := range want {
+			want[i] = owner
+		}
+		if !reflect.DeepEqual(client.owners, want) {
+			t.Errorf("expected source bucket owners = %q, want %q", client.owners, want)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "api error", err: &smithy.GenericAPIError{Code: "SlowDown"}, want: "SlowDown"},
+		{name: "wrapped api error", err: fmt.Errorf("delete: %w", &smithy.GenericAPIError{Code: "AccessDenied"}), want: "AccessDenied"},
+		{name: "other error", err: errors.New("connection reset"), want: "Unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCode(tt.err); got != tt.want {
+				t.Errorf("ErrorCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsThrottleError(t *testing.T) {
+	if !IsThrottleError(&smithy.GenericAPIError{Code: "SlowDown"}) {
+		t.Errorf("IsThrottleError() = false for SlowDown")
+	}
+	if IsThrottleError(&smithy.GenericAPIError{Code: "AccessDenied"}) {
+		t.Errorf("IsThrottleError() = true for AccessDenied")
+	}
+}
+
 // =================
 
 func (s S3APIMock) ListBuckets(ctx context.Context,
@@ -1161,6 +1745,458 @@ func (s S3APIMockFail) DeleteObjects(ctx context.Context,
 	return nil, errors.New("simulated error case")
 }
 
+func (s S3APIMock) GetObject(ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+
+	s.t.Logf("get object bucket [%s], key [%s]", *params.Bucket, *params.Key)
+
+	body := "contents of " + *params.Key
+	lastModified := time.Now()
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: aws.Int64(int64(len(body))),
+		LastModified:  &lastModified,
+		VersionId:     params.VersionId,
+	}, nil
+}
+
+func (s S3APIMockFail) GetObject(ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+
+	s.t.Logf("get object bucket [%s], key [%s]", *params.Bucket, *params.Key)
+
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) CopyObject(ctx context.Context,
+	params *s3.CopyObjectInput,
+	optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	s.t.Logf("copy object [%s] to bucket [%s], key [%s]", *params.CopySource, *params.Bucket, *params.Key)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (s S3APIMockFail) CopyObject(ctx context.Context,
+	params *s3.CopyObjectInput,
+	optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) HeadObject(ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{
+		Metadata:             map[string]string{"owner": "data-team"},
+		CacheControl:         aws.String("max-age=3600"),
+		ContentDisposition:   aws.String("attachment"),
+		ContentEncoding:      aws.String("gzip"),
+		ContentType:          aws.String("application/json"),
+		ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String("arn:aws:kms:us-east-1:123456789012:key/example"),
+		BucketKeyEnabled:     aws.Bool(true),
+	}, nil
+}
+
+func (s S3APIMockFail) HeadObject(ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) GetObjectTagging(ctx context.Context,
+	params *s3.GetObjectTaggingInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return &s3.GetObjectTaggingOutput{
+		TagSet: []types.Tag{
+			{Key: aws.String("env"), Value: aws.String("prod")},
+			{Key: aws.String("cost center"), Value: aws.String("a&b")},
+		},
+	}, nil
+}
+
+func (s S3APIMockFail) GetObjectTagging(ctx context.Context,
+	params *s3.GetObjectTaggingInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) CreateMultipartUpload(ctx context.Context,
+	params *s3.CreateMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   params.Bucket,
+		Key:      params.Key,
+		UploadId: aws.String(uuid.NewString()),
+	}, nil
+}
+
+func (s S3APIMockFail) CreateMultipartUpload(ctx context.Context,
+	params *s3.CreateMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) UploadPartCopy(ctx context.Context,
+	params *s3.UploadPartCopyInput,
+	optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	return &s3.UploadPartCopyOutput{
+		CopyPartResult: &types.CopyPartResult{
+			ETag: aws.String(uuid.NewString()),
+		},
+	}, nil
+}
+
+func (s S3APIMockFail) UploadPartCopy(ctx context.Context,
+	params *s3.UploadPartCopyInput,
+	optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) CompleteMultipartUpload(ctx context.Context,
+	params *s3.CompleteMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (s S3APIMockFail) CompleteMultipartUpload(ctx context.Context,
+	params *s3.CompleteMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) AbortMultipartUpload(ctx context.Context,
+	params *s3.AbortMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (s S3APIMockFail) AbortMultipartUpload(ctx context.Context,
+	params *s3.AbortMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) GetBucketTagging(ctx context.Context,
+	params *s3.GetBucketTaggingInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if *params.Bucket == "protected-bucket" {
+		return &s3.GetBucketTaggingOutput{
+			TagSet: []types.Tag{
+				{Key: aws.String("s3-nuke:protect"), Value: aws.String("true")},
+				{Key: aws.String("env"), Value: aws.String("prod")},
+			},
+		}, nil
+	}
+
+	return nil, &smithy.GenericAPIError{Code: "NoSuchTagSet", Message: "The TagSet does not exist"}
+}
+
+func (s S3APIMockFail) GetBucketTagging(ctx context.Context,
+	params *s3.GetBucketTaggingInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) GetBucketReplication(ctx context.Context,
+	params *s3.GetBucketReplicationInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error) {
+	if *params.Bucket == "replicated-bucket" {
+		return &s3.GetBucketReplicationOutput{
+			ReplicationConfiguration: &types.ReplicationConfiguration{
+				Role:  aws.String("arn:aws:iam::123456789012:role/replication"),
+				Rules: []types.ReplicationRule{{Status: types.ReplicationRuleStatusEnabled}},
+			},
+		}, nil
+	}
+
+	return nil, &smithy.GenericAPIError{Code: "ReplicationConfigurationNotFoundError", Message: "The replication configuration was not found"}
+}
+
+func (s S3APIMockFail) GetBucketReplication(ctx context.Context,
+	params *s3.GetBucketReplicationInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) GetObjectLockConfiguration(ctx context.Context,
+	params *s3.GetObjectLockConfigurationInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	if *params.Bucket == "locked-bucket" {
+		return &s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &types.ObjectLockConfiguration{
+				ObjectLockEnabled: types.ObjectLockEnabledEnabled,
+			},
+		}, nil
+	}
+
+	return nil, &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError", Message: "Object Lock configuration does not exist for this bucket"}
+}
+
+func (s S3APIMockFail) GetObjectLockConfiguration(ctx context.Context,
+	params *s3.GetObjectLockConfigurationInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+func (s S3APIMock) GetBucketVersioning(ctx context.Context,
+	params *s3.GetBucketVersioningInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	switch *params.Bucket {
+	case "mfa-bucket":
+		return &s3.GetBucketVersioningOutput{Status: types.BucketVersioningStatusEnabled, MFADelete: types.MFADeleteStatusEnabled}, nil
+	case "versioned-bucket":
+		return &s3.GetBucketVersioningOutput{Status: types.BucketVersioningStatusEnabled, MFADelete: types.MFADeleteStatusDisabled}, nil
+	}
+
+	return &s3.GetBucketVersioningOutput{}, nil
+}
+
+func (s S3APIMockFail) GetBucketVersioning(ctx context.Context,
+	params *s3.GetBucketVersioningInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	return nil, errors.New("simulated error case")
+}
+
+// S3APIMFAMock denies DeleteObjects requests unless they have the MFA code in `code`, and records the MFA
+// parameter of every request
+type S3APIMFAMock struct {
+	S3APIMock
+	code     string
+	requests []string
+}
+
+func (s *S3APIMFAMock) DeleteObjects(ctx context.Context,
+	params *s3.DeleteObjectsInput,
+	optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	s.requests = append(s.requests, aws.ToString(params.MFA))
+	if aws.ToString(params.MFA) != "arn:aws:iam::123456789012:mfa/root-account-mfa-device "+s.code {
+		return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "Mfa Authentication must be used for this request"}
+	}
+	return s.S3APIMock.DeleteObjects(ctx, params, optFns...)
+}
+
+// S3APIOwnerRecorder records the ExpectedBucketOwner parameter of GetBucketLocation, ListObjectVersions,
+// DeleteObjects, ListObjectsV2, GetObject, GetBucketTagging and GetBucketVersioning requests
+type S3APIOwnerRecorder struct {
+	S3APIMock
+	owners []string
+}
+
+func (s *S3APIOwnerRecorder) GetBucketLocation(ctx context.Context,
+	params *s3.GetBucketLocationInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.GetBucketLocation(ctx, params, optFns...)
+}
+
+func (s *S3APIOwnerRecorder) ListObjectVersions(ctx context.Context,
+	params *s3.ListObjectVersionsInput,
+	optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.ListObjectVersions(ctx, params, optFns...)
+}
+
+func (s *S3APIOwnerRecorder) DeleteObjects(ctx context.Context,
+	params *s3.DeleteObjectsInput,
+	optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.DeleteObjects(ctx, params, optFns...)
+}
+
+func (s *S3APIOwnerRecorder) ListObjectsV2(ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (s *S3APIOwnerRecorder) GetObject(ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.GetObject(ctx, params, optFns...)
+}
+
+func (s *S3APIOwnerRecorder) GetBucketTagging(ctx context.Context,
+	params *s3.GetBucketTaggingInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.GetBucketTagging(ctx, params, optFns...)
+}
+
+func (s *S3APIOwnerRecorder) GetBucketVersioning(ctx context.Context,
+	params *s3.GetBucketVersioningInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.GetBucketVersioning(ctx, params, optFns...)
+}
+
+// S3APIPrefixMock lists two prefixes and an object under "logs/" on the first page, and nothing on the second
+type S3APIPrefixMock struct {
+	S3APIMock
+}
+
+func (s S3APIPrefixMock) ListObjectsV2(ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if aws.ToString(params.Delimiter) != "/" || aws.ToString(params.Prefix) != "logs/" {
+		return nil, fmt.Errorf("unexpected delimiter %q or prefix %q", aws.ToString(params.Delimiter), aws.ToString(params.Prefix))
+	}
+	if params.ContinuationToken != nil {
+		return &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}, nil
+	}
+	return &s3.ListObjectsV2Output{
+		CommonPrefixes:        []types.CommonPrefix{{Prefix: aws.String("logs/2023/")}, {Prefix: aws.String("logs/2024/")}},
+		Contents:              []types.Object{{Key: aws.String("logs/index.json"), Size: aws.Int64(42), StorageClass: types.ObjectStorageClassStandard}},
+		IsTruncated:           aws.Bool(true),
+		NextContinuationToken: aws.String("next"),
+	}, nil
+}
+
+// S3APIVersionPrefixMock lists a prefix, a version and a delete marker under "logs/" on the first page, and nothing on
+// the second
+type S3APIVersionPrefixMock struct {
+	S3APIMock
+}
+
+func (s S3APIVersionPrefixMock) ListObjectVersions(ctx context.Context,
+	params *s3.ListObjectVersionsInput,
+	optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if aws.ToString(params.Delimiter) != "/" || aws.ToString(params.Prefix) != "logs/" {
+		return nil, fmt.Errorf("unexpected delimiter %q or prefix %q", aws.ToString(params.Delimiter), aws.ToString(params.Prefix))
+	}
+	if params.KeyMarker != nil {
+		// markers are only returned for truncated responses
+		return &s3.ListObjectVersionsOutput{IsTruncated: aws.Bool(false), NextKeyMarker: aws.String("ignored")}, nil
+	}
+	return &s3.ListObjectVersionsOutput{
+		CommonPrefixes:      []types.CommonPrefix{{Prefix: aws.String("logs/2023/")}},
+		Versions:            []types.ObjectVersion{{Key: aws.String("logs/index.json"), VersionId: aws.String("v2"), IsLatest: aws.Bool(true), Size: aws.Int64(42), StorageClass: types.ObjectVersionStorageClassStandard}},
+		DeleteMarkers:       []types.DeleteMarkerEntry{{Key: aws.String("logs/old.json"), VersionId: aws.String("v3"), IsLatest: aws.Bool(true)}},
+		IsTruncated:         aws.Bool(true),
+		NextKeyMarker:       aws.String("logs/index.json"),
+		NextVersionIdMarker: aws.String("v2"),
+	}, nil
+}
+
+// S3APISourceOwnerRecorder records the expected owner of the source bucket sent with each copy request
+type S3APISourceOwnerRecorder struct {
+	S3APIMock
+	owners []string
+}
+
+func (s *S3APISourceOwnerRecorder) CopyObject(ctx context.Context,
+	params *s3.CopyObjectInput,
+	optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedSourceBucketOwner))
+	return s.S3APIMock.CopyObject(ctx, params, optFns...)
+}
+
+func (s *S3APISourceOwnerRecorder) HeadObject(ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.HeadObject(ctx, params, optFns...)
+}
+
+func (s *S3APISourceOwnerRecorder) GetObjectTagging(ctx context.Context,
+	params *s3.GetObjectTaggingInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedBucketOwner))
+	return s.S3APIMock.GetObjectTagging(ctx, params, optFns...)
+}
+
+func (s *S3APISourceOwnerRecorder) UploadPartCopy(ctx context.Context,
+	params *s3.UploadPartCopyInput,
+	optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	s.owners = append(s.owners, aws.ToString(params.ExpectedSourceBucketOwner))
+	return s.S3APIMock.UploadPartCopy(ctx, params, optFns...)
+}
+
+// S3APICopyRecorder records multipart copy calls
+type S3APICopyRecorder struct {
+	S3APIMock
+	failHead       bool
+	failPart       int32
+	failComplete   bool
+	created        *s3.CreateMultipartUploadInput
+	ranges         []string
+	completedParts int
+	aborted        bool
+}
+
+func (s *S3APICopyRecorder) HeadObject(ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if s.failHead {
+		return nil, errors.New("simulated error case")
+	}
+	return s.S3APIMock.HeadObject(ctx, params, optFns...)
+}
+
+func (s *S3APICopyRecorder) CreateMultipartUpload(ctx context.Context,
+	params *s3.CreateMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	s.created = params
+	return s.S3APIMock.CreateMultipartUpload(ctx, params, optFns...)
+}
+
+func (s *S3APICopyRecorder) UploadPartCopy(ctx context.Context,
+	params *s3.UploadPartCopyInput,
+	optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	if *params.PartNumber == s.failPart {
+		return nil, errors.New("simulated error case")
+	}
+	s.ranges = append(s.ranges, *params.CopySourceRange)
+	return s.S3APIMock.UploadPartCopy(ctx, params, optFns...)
+}
+
+func (s *S3APICopyRecorder) CompleteMultipartUpload(ctx context.Context,
+	params *s3.CompleteMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	s.completedParts = len(params.MultipartUpload.Parts)
+	if s.failComplete {
+		return nil, errors.New("simulated error case")
+	}
+	return s.S3APIMock.CompleteMultipartUpload(ctx, params, optFns...)
+}
+
+func (s *S3APICopyRecorder) AbortMultipartUpload(ctx context.Context,
+	params *s3.AbortMultipartUploadInput,
+	optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	s.aborted = true
+	return s.S3APIMock.AbortMultipartUpload(ctx, params, optFns...)
+}
+
+// S3APIDeleteErrorsMock reports keys starting with "denied/" as failing to delete
+type S3APIDeleteErrorsMock struct {
+	S3APIMock
+}
+
+func (s S3APIDeleteErrorsMock) DeleteObjects(ctx context.Context,
+	params *s3.DeleteObjectsInput,
+	optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	returnValue := &s3.DeleteObjectsOutput{}
+	for _, object := range params.Delete.Objects {
+		if strings.HasPrefix(*object.Key, "denied/") {
+			returnValue.Errors = append(returnValue.Errors, types.Error{
+				Key:       object.Key,
+				VersionId: object.VersionId,
+				Code:      aws.String("AccessDenied"),
+				Message:   aws.String("Access Denied"),
+			})
+			continue
+		}
+		returnValue.Deleted = append(returnValue.Deleted, types.DeletedObject{
+			Key:       object.Key,
+			VersionId: object.VersionId,
+		})
+	}
+	return returnValue, nil
+}
+
 // Test CreateBucketSimple function
 func Test_service_CreateBucketSimple(t *testing.T) {
 	s3Mock := S3APIMock{
@@ -1293,7 +2329,7 @@ func Test_newS3Client_Coverage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newS3Client(tt.region, tt.awsEndpoint, tt.profile)
+			got, err := newS3Client(tt.region, tt.awsEndpoint, tt.profile, nil)
 			
 			// Check if we expect an error but didn't get one
 			if tt.wantNil && err == nil {
@@ -0,0 +1,145 @@
+package sts
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/config"
+)
+
+// Service defines functions related to STS operations
+type Service interface {
+	// GetCallerIdentity returns the identity (account, ARN) of the credentials in use
+	GetCallerIdentity(ctx context.Context) (*CallerIdentity, error)
+}
+
+// CallerIdentity contains the results from GetCallerIdentity()
+type CallerIdentity struct {
+	AccountID string
+	ARN       string
+	UserID    string
+}
+
+// ServiceOption is used with NewService and configures the newly created stsService
+type ServiceOption func(s *service)
+
+type service struct {
+	client      STSAPI
+	awsEndpoint string
+	region      string
+	profile     string
+	assumeRole  *config.AssumeRole
+	initError   error
+}
+
+// NewService returns an initialized STS service
+func NewService(opts ...ServiceOption) Service {
+	svc := &service{}
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	if svc.client == nil {
+		var client STSAPI
+		var err error
+		if svc.region == "" {
+			client, err = newClient(os.Getenv("AWS_REGION"), svc.awsEndpoint, svc.profile, svc.assumeRole)
+		} else {
+			client, err = newClient(svc.region, svc.awsEndpoint, svc.profile, svc.assumeRole)
+		}
+		if err != nil {
+			svc.initError = err
+		} else {
+			svc.client = client
+		}
+	}
+
+	return svc
+}
+
+// WithAPI should be used if you want to initialize your own STS client (such as in cases of a mock STS client for testing)
+// This cannot be used with WithAWSEndpoint
+func WithAPI(client STSAPI) ServiceOption {
+	return func(s *service) {
+		s.client = client
+	}
+}
+
+// WithAWSEndpoint sets endpoint to be used by the AWS client
+// This cannot be used with WithAPI
+func WithAWSEndpoint(awsEndpoint string) ServiceOption {
+	return func(s *service) {
+		s.awsEndpoint = awsEndpoint
+	}
+}
+
+// WithRegion sets the AWS client region
+func WithRegion(region string) ServiceOption {
+	return func(s *service) {
+		s.region = region
+	}
+}
+
+// WithProfile sets the AWS profile to use for authentication
+func WithProfile(profile string) ServiceOption {
+	return func(s *service) {
+		s.profile = profile
+	}
+}
+
+// WithAssumeRole assumes `role` using the credentials of the profile. Share the same role between services so the
+// temporary credentials are cached for all of them.
+func WithAssumeRole(role *config.AssumeRole) ServiceOption {
+	return func(s *service) {
+		s.assumeRole = role
+	}
+}
+
+func newClient(region string, awsEndpoint string, profile string, assumeRole *config.AssumeRole) (*sts.Client, error) {
+	// Initialize AWS STS Client
+	var cfg aws.Config
+	var err error
+	if profile != "" {
+		cfg, err = config.NewWithProfile(region, profile, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
+	} else {
+		cfg, err = config.New(region, config.WithAssumeRole(assumeRole), config.WithAWSEndpoint(awsEndpoint))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize AWS config: %w", err)
+	}
+
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if awsEndpoint != "" {
+			o.BaseEndpoint = &awsEndpoint
+		}
+	}), nil
+}
+
+func (s *service) GetCallerIdentity(ctx context.Context) (*CallerIdentity, error) {
+	if s.initError != nil {
+		return nil, s.initError
+	}
+
+	result, err := s.client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CallerIdentity{
+		AccountID: aws.ToString(result.Account),
+		ARN:       aws.ToString(result.Arn),
+		UserID:    aws.ToString(result.UserId),
+	}, nil
+}
+
+// =====
+
+// STSAPI defines the interface for AWS STS SDK functions
+type STSAPI interface {
+	GetCallerIdentity(ctx context.Context,
+		params *sts.GetCallerIdentityInput,
+		optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
@@ -0,0 +1,111 @@
+package sts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type STSAPIMock struct{}
+
+type STSAPIMockFail struct{}
+
+func TestNewService(t *testing.T) {
+	tests := []struct {
+		name   string
+		client STSAPI
+	}{
+		{
+			name:   "sts API mock",
+			client: STSAPIMock{},
+		},
+		{
+			name:   "nil test",
+			client: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewService(WithAPI(tt.client), WithRegion("us-east-1"))
+			if got == nil {
+				t.Errorf("sts.NewService() returned nil when it wasn't supposed to")
+			} else {
+				val := reflect.ValueOf(got).Elem()
+
+				if val.Type().Field(0).Name != "client" {
+					t.Errorf("sts.NewService() did not return service struct containing field `client`")
+				}
+			}
+		})
+	}
+}
+
+func TestWithAWSEndpoint(t *testing.T) {
+	svc := &service{}
+	WithAWSEndpoint("http://localhost:4566")(svc)
+	if svc.awsEndpoint != "http://localhost:4566" {
+		t.Errorf("WithAWSEndpoint() awsEndpoint = %s", svc.awsEndpoint)
+	}
+}
+
+func Test_service_GetCallerIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  STSAPI
+		want    *CallerIdentity
+		wantErr bool
+	}{
+		{
+			name:   "successful",
+			client: STSAPIMock{},
+			want:   &CallerIdentity{AccountID: "123456789012", ARN: "arn:aws:iam::123456789012:user/nuker", UserID: "AIDAEXAMPLE"},
+		},
+		{
+			name:    "failure",
+			client:  STSAPIMockFail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(WithAPI(tt.client))
+			got, err := s.GetCallerIdentity(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetCallerIdentity() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetCallerIdentity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("init error", func(t *testing.T) {
+		s := &service{initError: errors.New("no credentials")}
+		if _, err := s.GetCallerIdentity(context.TODO()); err == nil {
+			t.Errorf("service.GetCallerIdentity() expected init error")
+		}
+	})
+}
+
+// =====
+
+func (s STSAPIMock) GetCallerIdentity(ctx context.Context,
+	params *sts.GetCallerIdentityInput,
+	optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String("123456789012"),
+		Arn:     aws.String("arn:aws:iam::123456789012:user/nuker"),
+		UserId:  aws.String("AIDAEXAMPLE"),
+	}, nil
+}
+
+func (s STSAPIMockFail) GetCallerIdentity(ctx context.Context,
+	params *sts.GetCallerIdentityInput,
+	optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return nil, errors.New("access denied")
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/briandowns/spinner"
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog/log"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/audit"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/plan"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/pricing"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/protection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/selection"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/workers"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/iam"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/sts"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+type planCmd struct {
+	Bucket string `arg:"" optional:"" help:"bucket to plan a nuke for (selected interactively if not given)"`
+	Out    string `help:"file to write the plan to" short:"o" type:"path" default:"s3-nuke.plan.json"`
+}
+
+type applyCmd struct {
+	PlanFile string        `arg:"" help:"plan file written by 's3-nuke plan'" type:"existingfile"`
+	TTL      time.Duration `help:"refuse to apply plans older than this" default:"24h"`
+}
+
+// runPlan lists the target bucket and writes a plan file describing the nuke
+func runPlan(ctx context.Context, kongCtx *kong.Context, s3svc s3.Service, policy protection.Policy, auditLog *audit.Log) {
+	identity := callerIdentity(ctx, kongCtx)
+	expectedOwner = bucketOwner(identity)
+	bucket := cli.Plan.Bucket
+	if bucket == "" {
+		bucket, _ = selectBucket(ctx, kongCtx, s3svc, policy)
+	} else {
+		checkBucketProtection(ctx, kongCtx, policy, bucket)
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("bucket", bucket))
+
+	bucketCreatedAt, err := bucketCreationDate(ctx, s3svc, bucket)
+	if err != nil {
+		fmt.Println("Error looking up bucket!", err)
+		exit(1)
+	}
+	bucketRegion := detectBucketRegion(ctx, kongCtx, bucket)
+
+	loadingSpinner := startSpinner(kongCtx, "listing object versions...")
+	manifest, err := listManifest(ctx, loadingSpinner, bucket, bucketRegion, cli.Prefix)
+	loadingSpinner.Stop()
+	if err != nil {
+		fmt.Println("Error listing object versions!", err)
+		exit(1)
+	}
+
+	p := &plan.Plan{
+		FormatVersion:   plan.FormatVersion,
+		CreatedAt:       time.Now().UTC().Truncate(time.Second),
+		AccountID:       identity.AccountID,
+		Bucket:          bucket,
+		BucketCreatedAt: bucketCreatedAt,
+		Region:          bucketRegion,
+		Filters:         plan.Filters{Prefix: cli.Prefix},
+		Estimate:        manifest.Estimate(),
+		ManifestDigest:  manifest.Digest(),
+	}
+	printPlan(p)
+
+	if err := p.Write(cli.Plan.Out); err != nil {
+		fmt.Println("Error writing plan file!", err)
+		exit(1)
+	}
+	_ = auditLog.Write("plan created", map[string]interface{}{
+		"bucket":         bucket,
+		"region":         bucketRegion,
+		"accountID":      identity.AccountID,
+		"prefix":         cli.Prefix,
+		"plan":           cli.Plan.Out,
+		"manifestDigest": p.ManifestDigest,
+	})
+
+	fmt.Println("Plan written to", cli.Plan.Out)
+	fmt.Printf("Apply it within %s (see --ttl) with: s3-nuke apply %s\n", plan.DefaultTTL, cli.Plan.Out)
+}
+
+// runApply nukes the bucket described by a plan file, after checking the plan still matches the target
+func runApply(ctx context.Context, kongCtx *kong.Context, s3svc s3.Service, policy protection.Policy, prices *pricing.Table, auditLog *audit.Log) {
+	p, err := plan.Read(cli.Apply.PlanFile)
+	if err != nil {
+		fmt.Println("Error reading plan file!", err)
+		exit(1)
+	}
+	printPlan(p)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("bucket", p.Bucket), attribute.String("plan.manifest_digest", p.ManifestDigest))
+
+	identity := callerIdentity(ctx, kongCtx)
+	expectedOwner = bucketOwner(identity)
+	protectionReasons := checkBucketProtection(ctx, kongCtx, policy, p.Bucket)
+	bucketCreatedAt, err := bucketCreationDate(ctx, s3svc, p.Bucket)
+	if err != nil {
+		fmt.Println("Error looking up bucket!", err)
+		exit(1)
+	}
+	bucketRegion := detectBucketRegion(ctx, kongCtx, p.Bucket)
+	mfa := checkMFADelete(ctx, kongCtx, p.Bucket, bucketRegion)
+
+	err = p.Verify(plan.Target{
+		AccountID:       identity.AccountID,
+		Bucket:          p.Bucket,
+		BucketCreatedAt: bucketCreatedAt,
+		Region:          bucketRegion,
+		Filters:         plan.Filters{Prefix: cli.Prefix},
+	}, cli.Apply.TTL, time.Now())
+	if err != nil {
+		fmt.Println("🛑", err)
+		_ = auditLog.Write("apply refused", map[string]interface{}{"bucket": p.Bucket, "plan": cli.Apply.PlanFile, "reason": err.Error()})
+		exit(1)
+	}
+
+	// list the bucket again, so that nothing is deleted unless it still holds exactly the planned object versions
+	loadingSpinner := startSpinner(kongCtx, "listing object versions...")
+	current, err := listManifest(ctx, loadingSpinner, p.Bucket, bucketRegion, p.Filters.Prefix)
+	loadingSpinner.Stop()
+	if err != nil {
+		fmt.Println("Error listing object versions!", err)
+		exit(1)
+	}
+	if err := p.VerifyManifest(current); err != nil {
+		fmt.Println("🛑", err)
+		fmt.Println("Create a new plan to review the current contents of the bucket")
+		_ = auditLog.Write("apply refused", map[string]interface{}{"bucket": p.Bucket, "plan": cli.Apply.PlanFile, "reason": err.Error()})
+		exit(1)
+	}
+	fmt.Println("✅ the bucket still matches the plan manifest")
+	fmt.Println("")
+
+	estimate := showCostEstimate(ctx, kongCtx, prices, p.Bucket, bucketRegion, p.Estimate.Total())
+	earlyDeletion := checkEarlyDeletion(ctx, kongCtx, prices, p.Bucket, bucketRegion, prefixSelection(p.Filters.Prefix), estimate)
+
+	// Warning message
+	fmt.Println("⚠️   !!! WARNING !!!  ⚠️")
+	fmt.Printf("This will destroy the %s object versions in the plan, and any written to the bucket while it is being nuked\n", humanize.Comma(p.Estimate.Total()))
+	fmt.Println("")
+	backupRegion, backupProfile := preparePreservation(ctx, p.Bucket, prefixSelection(p.Filters.Prefix))
+
+	target := confirmationTarget(ctx, p.Bucket, bucketRegion, p.Estimate.Total(), estimate)
+	if !confirmNuke(target, bucketRegion, identity, accountAlias(ctx), auditLog) {
+		return
+	}
+
+	manifest := plan.NewManifest()
+	runAudited(ctx, auditLog, map[string]interface{}{
+		"bucket":             p.Bucket,
+		"region":             bucketRegion,
+		"accountID":          identity.AccountID,
+		"prefix":             cli.Prefix,
+		"profile":            cli.Profile,
+		"endpoint":           cli.AWSEndpoint,
+		"configProfile":      cli.ConfigProfile,
+		"protected":          len(protectionReasons) > 0,
+		"plan":               cli.Apply.PlanFile,
+		"planManifestDigest": p.ManifestDigest,
+		"earlyDeletion":      earlyDeletion,
+		"roleARN":            cli.RoleARN,
+		"mfaDelete":          mfa != nil,
+		"expectedOwner":      expectedOwner,
+	}, nukeOptions{
+		awsEndpoint:        cli.AWSEndpoint,
+		profile:            cli.Profile,
+		assumeRole:         assumeRole,
+		expectedOwner:      expectedOwner,
+		mfa:                mfa,
+		bucket:             p.Bucket,
+		bucketRegion:       bucketRegion,
+		selection:          prefixSelection(p.Filters.Prefix),
+		manifest:           manifest,
+		estimatedTotal:     p.Estimate.Total(),
+		reportPath:         cli.Report,
+		prices:             prices,
+		earlyDeletion:      earlyDeletion,
+		postponePath:       cli.PostponeFile,
+		concurrency:        cli.Concurrency,
+		dashboard:          cli.Dashboard,
+		archivePath:        cli.Archive,
+		archiveAllVersions: cli.ArchiveAllVersions,
+		backupBucket:       cli.BackupBucket,
+		backupPrefix:       cli.BackupPrefix,
+		backupRegion:       backupRegion,
+		backupProfile:      backupProfile,
+		backupAssumeRole:   backupAssumeRole(),
+		backupAllVersions:  cli.BackupAllVersions,
+	})
+
+	if manifest.Digest() != p.ManifestDigest {
+		fmt.Println("")
+		fmt.Println("⚠️  the bucket contents changed while it was being nuked:")
+		fmt.Printf("   planned %s object versions (%s), deleted listing had %s (%s)\n",
+			humanize.Comma(p.Estimate.Total()), p.ManifestDigest, humanize.Comma(manifest.Estimate().Total()), manifest.Digest())
+	} else {
+		fmt.Println("✅ deleted object versions matched the plan manifest")
+	}
+}
+
+// printPlan prints a summary of `p`
+func printPlan(p *plan.Plan) {
+	fmt.Println("")
+	fmt.Println("📋 nuke plan")
+	fmt.Println("bucket...........:", p.Bucket)
+	fmt.Println("account..........:", p.AccountID)
+	fmt.Println("region...........:", p.Region)
+	fmt.Println("prefix...........:", prefixLabel(p.Filters.Prefix))
+	fmt.Println("current objects..:", humanize.Comma(p.Estimate.Objects))
+	fmt.Println("noncurrent.......:", humanize.Comma(p.Estimate.NoncurrentVersions))
+	fmt.Println("delete markers...:", humanize.Comma(p.Estimate.DeleteMarkers))
+	fmt.Println("total size.......:", humanize.IBytes(uint64(p.Estimate.Bytes)))
+	fmt.Println("manifest digest..:", p.ManifestDigest)
+	fmt.Printf("created..........: %s (%s)\n", p.CreatedAt.Local(), humanize.Time(p.CreatedAt))
+	fmt.Println("")
+}
+
+// callerIdentity looks up the identity of the AWS credentials in use, exiting if it cannot be found
+func callerIdentity(ctx context.Context, kongCtx *kong.Context) *sts.CallerIdentity {
+	stsSvc := sts.NewService(sts.WithAWSEndpoint(cli.AWSEndpoint), sts.WithProfile(cli.Profile), sts.WithAssumeRole(assumeRole))
+
+	loadingSpinner := startSpinner(kongCtx, "fetching account identity...")
+	log.Debug().Msg("sts: get caller identity")
+	identity, err := stsSvc.GetCallerIdentity(ctx)
+	loadingSpinner.Stop()
+	if err != nil {
+		fmt.Println("Error looking up AWS account!", err)
+		exit(1)
+	}
+
+	return identity
+}
+
+// accountAlias looks up the IAM alias of the AWS account in use. An empty string is returned if the account has no
+// alias, or the credentials are not allowed to list it.
+func accountAlias(ctx context.Context) string {
+	iamSvc := iam.NewService(iam.WithAWSEndpoint(cli.AWSEndpoint), iam.WithProfile(cli.Profile), iam.WithAssumeRole(assumeRole))
+
+	log.Debug().Msg("iam: list account aliases")
+	alias, err := iamSvc.GetAccountAlias(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("could not look up account alias")
+		return ""
+	}
+
+	return alias
+}
+
+// bucketCreationDate returns the creation date of `bucket`, which distinguishes it from a bucket that was deleted and
+// recreated with the same name
+func bucketCreationDate(ctx context.Context, s3svc s3.Service, bucket string) (time.Time, error) {
+	buckets, err := s3svc.GetAllBuckets(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, b := range buckets {
+		if b.Name != nil && *b.Name == bucket {
+			if b.CreationDate == nil {
+				return time.Time{}, nil
+			}
+			return b.CreationDate.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bucket %s was not found", bucket)
+}
+
+// listManifest lists every object version under `prefix` in `bucket` into a plan.Manifest,
+// updating `loadingSpinner` with the number of versions listed so far
+func listManifest(ctx context.Context, loadingSpinner *spinner.Spinner, bucket string, bucketRegion string, prefix string) (*plan.Manifest, error) {
+	manifest := plan.NewManifest()
+	err := listVersions(ctx, loadingSpinner, bucket, bucketRegion, prefixSelection(prefix), manifest.Add)
+	return manifest, err
+}
+
+// listVersions lists every object version in `set` in `bucket`, passing each to `visit` in listing order and
+// updating `loadingSpinner` with the number of versions listed so far
+func listVersions(ctx context.Context, loadingSpinner *spinner.Spinner, bucket string, bucketRegion string, set selection.Set, visit func(s3.ObjectVersion)) error {
+	versions := make(chan s3.ObjectVersion, 100000)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(versions)
+		s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole), s3.WithExpectedOwner(expectedOwner))
+		_, err := workers.S3QueueSelectedVersionDetails(ctx, s3svc, bucket, set, versions)
+		return err
+	})
+	g.Go(func() error {
+		listed := 0
+		for version := range versions {
+			visit(version)
+			listed++
+			if listed%1000 == 0 {
+				loadingSpinner.Lock()
+				loadingSpinner.Suffix = fmt.Sprintf(" listing object versions... (%s listed)", humanize.Comma(int64(listed)))
+				loadingSpinner.Unlock()
+			}
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
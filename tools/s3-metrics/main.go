@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -12,8 +13,10 @@ import (
 	"github.com/guptarohit/asciigraph"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/output"
 	"github.com/soapiestwaffles/s3-nuke/internal/pkg/ui/tui"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	awsconfig "github.com/soapiestwaffles/s3-nuke/pkg/aws/config"
 	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
 )
 
@@ -28,7 +31,22 @@ var (
 		Version     bool   `help:"display version information" optional:""`
 		AWSEndpoint string `help:"override AWS endpoint address" short:"e" optional:"" env:"AWS_ENDPOINT"`
 		Profile     string `help:"AWS profile to use for authentication" short:"p" optional:"" env:"AWS_PROFILE"`
+
+		RoleARN         string `help:"IAM role to assume with the profile's credentials" optional:"" name:"role-arn"`
+		ExternalID      string `help:"external ID required to assume --role-arn" optional:""`
+		RoleSessionName string `help:"session name used when assuming --role-arn (default: s3-nuke)" optional:""`
+		MFASerial       string `help:"serial number or ARN of the MFA device required to assume --role-arn, the MFA code is asked for" optional:"" name:"mfa-serial"`
+
 		Debug       bool   `help:"enable debugging output" optional:""`
+		Output      string `help:"output format (text, json). json writes versioned events to stdout, one JSON object per line" optional:"" enum:"text,json" default:"text"`
+		ClassGraph  int    `help:"also graph the bytes stored in the N largest storage types over the past 30 days" optional:"" placeholder:"N"`
+
+		All    bool   `help:"report the size of every bucket in the account, grouped by region, instead of graphing one bucket" optional:""`
+		SortBy string `help:"order of the buckets in the --all report (bytes, objects, growth, name)" optional:"" enum:"bytes,objects,growth,name" default:"bytes"`
+		Export string `help:"also write the --all report to a .csv or .json file" optional:"" type:"path" placeholder:"FILE"`
+
+		Scan            bool `help:"also count every object version in the bucket, to cross-check the CloudWatch metrics" optional:""`
+		ScanConcurrency int  `help:"number of prefixes listed at once by --scan" optional:"" default:"8"`
 	}
 )
 
@@ -54,6 +72,13 @@ func main() {
 		}
 	}
 
+	events, err := output.New(os.Stdout, cli.Output)
+	ctx.FatalIfErrorf(err)
+	if events.Enabled() {
+		// stdout is reserved for JSON events, so everything meant for people is written to stderr instead
+		os.Stdout = os.Stderr
+	}
+
 	if cli.AWSEndpoint != "" {
 		fmt.Println("Using AWS endpoint:", cli.AWSEndpoint)
 	}
@@ -66,25 +91,92 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
 	}
 
+	// Assume the role (asking for the MFA code, if needed) before any spinner is shown
+	assumeRole, err := awsconfig.NewAssumeRole(cli.RoleARN, cli.ExternalID, cli.RoleSessionName, cli.MFASerial, func() (string, error) {
+		return tui.PromptMFAToken(cli.MFASerial)
+	})
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	if assumeRole != nil {
+		cfg, err := awsconfig.NewWithProfile(os.Getenv("AWS_REGION"), cli.Profile, awsconfig.WithAssumeRole(assumeRole), awsconfig.WithAWSEndpoint(cli.AWSEndpoint))
+		if err == nil {
+			_, err = cfg.Credentials.Retrieve(context.TODO())
+		}
+		if err != nil {
+			fmt.Println("Error assuming role!", err)
+			os.Exit(1)
+		}
+	}
+
 	// Set up S3 client
-	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile))
+	s3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole))
 
 	// Get list of buckets
 	loadingSpinner := spinner.New(spinner.CharSets[13], 100*time.Millisecond)
 	loadingSpinner.Suffix = " fetching bucket list..."
-	err := loadingSpinner.Color("blue", "bold")
+	err = loadingSpinner.Color("blue", "bold")
 	ctx.FatalIfErrorf(err)
-	loadingSpinner.Start()
+	startSpinner := func() {
+		if !events.Enabled() {
+			loadingSpinner.Start()
+		}
+	}
+	startSpinner()
 	buckets, err := s3svc.GetAllBuckets(context.TODO())
 	ctx.FatalIfErrorf(err)
 	loadingSpinner.Stop()
 
+	bucketList := output.Buckets{Buckets: make([]output.Bucket, 0, len(buckets))}
+	for _, b := range buckets {
+		bucketList.Buckets = append(bucketList.Buckets, output.Bucket{Name: *b.Name, CreatedAt: b.CreationDate})
+	}
+	_ = events.Emit(output.EventBuckets, bucketList)
+
 	// Exit if there are no buckets to nuke
 	if len(buckets) == 0 {
 		fmt.Println("No buckets found! Exiting.")
 		os.Exit(0)
 	}
 
+	if cli.All {
+		if cli.Scan {
+			fmt.Println("--scan can not be used with --all")
+			os.Exit(1)
+		}
+		if cli.Export != "" {
+			_, err := exportFormat(cli.Export)
+			ctx.FatalIfErrorf(err)
+		}
+
+		names := make([]string, 0, len(buckets))
+		for _, b := range buckets {
+			names = append(names, *b.Name)
+		}
+		loadingSpinner.Suffix = fmt.Sprintf(" fetching metrics of %d buckets...", len(names))
+		startSpinner()
+		report := collectReport(context.TODO(), s3svc, func(region string) cloudwatch.Service {
+			return cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(region), cloudwatch.WithProfile(cli.Profile), cloudwatch.WithAssumeRole(assumeRole))
+		}, names)
+		loadingSpinner.Stop()
+
+		report.sortBuckets(cli.SortBy)
+		fmt.Println("")
+		if err := report.writeTable(os.Stdout, time.Now()); err != nil {
+			log.Warn().Err(err).Msg("could not print report")
+		}
+		if cli.Export != "" {
+			if err := report.export(cli.Export); err != nil {
+				fmt.Println("Error exporting report!", err)
+				os.Exit(1)
+			}
+			fmt.Println("")
+			fmt.Println("Report written to", cli.Export)
+		}
+		os.Exit(0)
+	}
+
 	// User select bucket
 	fmt.Println("")
 	selectedBucket, err := tui.SelectBucketsPrompt(buckets)
@@ -101,27 +193,90 @@ func main() {
 	}
 	fmt.Println("🌎 -> bucket located in", bucketRegion)
 	fmt.Println("")
+	_ = events.Emit(output.EventRegion, output.Region{Bucket: selectedBucket, Region: bucketRegion})
 
-	cloudwatchSvc := cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(bucketRegion), cloudwatch.WithProfile(cli.Profile))
+	cloudwatchSvc := cloudwatch.NewService(cloudwatch.WithAWSEndpoint(cli.AWSEndpoint), cloudwatch.WithRegion(bucketRegion), cloudwatch.WithProfile(cli.Profile), cloudwatch.WithAssumeRole(assumeRole))
 
 	loadingSpinner.Suffix = " fetching bucket metrics..."
-	loadingSpinner.Start()
+	startSpinner()
 	objectCountResults, err := cloudwatchSvc.GetS3ObjectCount(context.TODO(), selectedBucket, 720, 60)
 	if err != nil {
 		fmt.Println("error:", err)
 		os.Exit(1)
 	}
 
-	byteCountResults, err := cloudwatchSvc.GetS3ByteCount(context.TODO(), selectedBucket, cloudwatch.StandardStorage, 720, 60)
+	storageClasses, err := fetchStorageClasses(context.TODO(), cloudwatchSvc, selectedBucket, 720, 60)
 	if err != nil {
 		fmt.Println("error:", err)
 		os.Exit(1)
 	}
 	loadingSpinner.Stop()
 
+	metrics := []output.Metric{
+		output.NewMetric("NumberOfObjects", "AllStorageTypes", objectCountResults.Timestamps, objectCountResults.Values),
+	}
+	for _, class := range storageClasses {
+		metrics = append(metrics, output.NewMetric("BucketSizeBytes", string(class.StorageType), class.Timestamps, class.Values))
+	}
+	_ = events.Emit(output.EventMetrics, output.Metrics{
+		Bucket:  selectedBucket,
+		Region:  bucketRegion,
+		Metrics: metrics,
+	})
+
+	// scanBucketVersions counts every object version in the bucket and prints the counts next to the CloudWatch
+	// metrics, `objects` is the latest CloudWatch object count
+	scanBucketVersions := func(objects float64) {
+		var scanned atomic.Int64
+		loadingSpinner.Suffix = " scanning object versions..."
+		startSpinner()
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					loadingSpinner.Lock()
+					loadingSpinner.Suffix = fmt.Sprintf(" scanning object versions... %s counted", humanize.Comma(scanned.Load()))
+					loadingSpinner.Unlock()
+				}
+			}
+		}()
+		regionalS3svc := s3.NewService(s3.WithAWSEndpoint(cli.AWSEndpoint), s3.WithRegion(bucketRegion), s3.WithProfile(cli.Profile), s3.WithAssumeRole(assumeRole))
+		tally, err := scanBucket(context.TODO(), regionalS3svc, selectedBucket, cli.ScanConcurrency, &scanned)
+		close(done)
+		loadingSpinner.Stop()
+		if err != nil {
+			fmt.Println("error scanning bucket:", err)
+			os.Exit(1)
+		}
+		_ = events.Emit(output.EventScan, output.Scan{Bucket: selectedBucket, Region: bucketRegion, Tally: *tally})
+
+		fmt.Println("")
+		fmt.Println("Exact counts from listing every object version:")
+		fmt.Println("")
+		if err := printScan(os.Stdout, tally, objects, storageClasses); err != nil {
+			log.Warn().Err(err).Msg("could not print scan")
+		}
+	}
+
+	// the byte count of the bucket is the total of every storage type
+	byteCountResults := &cloudwatch.S3ByteCountResults{}
+	byteCountResults.Timestamps, byteCountResults.Values = totalBytes(storageClasses)
+
 	if len(objectCountResults.Values) == 0 || len(byteCountResults.Values) == 0 {
 		fmt.Println("")
 		fmt.Println("no cloudwatch metrics found for bucket!")
+		if cli.Scan {
+			objects := 0.0
+			if len(objectCountResults.Values) > 0 {
+				objects = objectCountResults.Values[0]
+			}
+			scanBucketVersions(objects)
+		}
 		os.Exit(0)
 	}
 
@@ -161,11 +316,30 @@ func main() {
 		byteCountResults.Values[i], byteCountResults.Values[j] = byteCountResults.Values[j], byteCountResults.Values[i]
 	}
 
-	byteGraph := asciigraph.Plot(byteCountResults.Values, asciigraph.Width(60), asciigraph.Height(10), asciigraph.Caption("Byte Count for past 30 Days (Standard Storage)"))
+	byteGraph := asciigraph.Plot(byteCountResults.Values, asciigraph.Width(60), asciigraph.Height(10), asciigraph.Caption("Byte Count for past 30 Days (all storage types)"))
 	fmt.Println(byteGraph)
 	fmt.Println("")
-	fmt.Println("Approx. bytes currently in bucket (standard storage):", humanize.Bytes(uint64(bytesInBucket)))
+	fmt.Println("Approx. bytes currently in bucket:", humanize.Bytes(uint64(bytesInBucket)))
 	fmt.Printf("Metric last updated: %s at %s\n", humanize.Time(bytesLastUpdate.Local()), bytesLastUpdate.Local())
+	fmt.Println("")
+	if err := printStorageClasses(os.Stdout, storageClasses); err != nil {
+		log.Warn().Err(err).Msg("could not print storage types")
+	}
+
+	if cli.ClassGraph > 0 {
+		graphClasses := storageClasses[:min(cli.ClassGraph, len(storageClasses))]
+		legends := make([]string, 0, len(graphClasses))
+		for _, class := range graphClasses {
+			legends = append(legends, string(class.StorageType))
+		}
+		classGraph := asciigraph.PlotMany(alignedSeries(graphClasses), asciigraph.Width(60), asciigraph.Height(10),
+			asciigraph.SeriesColors(seriesColors(len(graphClasses))...),
+			asciigraph.SeriesLegends(legends...),
+			asciigraph.Caption(fmt.Sprintf("Byte Count for past 30 Days (largest %d storage types)", len(graphClasses))))
+		fmt.Println("")
+		fmt.Println("")
+		fmt.Println(classGraph)
+	}
 
 	fmt.Println("")
 	fmt.Println("")
@@ -176,4 +350,22 @@ func main() {
 	fmt.Println("")
 	fmt.Println("Approx. objects currently in bucket:", humanize.Comma(int64(objInBucket)))
 	fmt.Printf("Metric last updated: %s at %s\n", humanize.Time(objLastUpdate.Local()), objLastUpdate.Local())
+
+	if cli.Scan {
+		fmt.Println("")
+		fmt.Println("")
+		scanBucketVersions(objInBucket)
+	}
+}
+
+// graphColors are the colors of the series in graphs of several storage types
+var graphColors = []asciigraph.AnsiColor{asciigraph.Blue, asciigraph.Green, asciigraph.Yellow, asciigraph.Red, asciigraph.Magenta, asciigraph.Cyan}
+
+// seriesColors returns the colors of `n` series, repeating graphColors if needed
+func seriesColors(n int) []asciigraph.AnsiColor {
+	colors := make([]asciigraph.AnsiColor, 0, n)
+	for i := 0; i < n; i++ {
+		colors = append(colors, graphColors[i%len(graphColors)])
+	}
+	return colors
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// Orders the account report can be sorted in, largest first except for name
+const (
+	sortBytes   = "bytes"
+	sortObjects = "objects"
+	sortGrowth  = "growth"
+	sortName    = "name"
+)
+
+// bucketReport is a row of the account report
+type bucketReport struct {
+	Bucket  string `json:"bucket"`
+	Region  string `json:"region"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+	// StorageTypes is the number of bytes stored in each storage type with any data
+	StorageTypes map[cloudwatch.StorageType]int64 `json:"storage_types"`
+	// Growth is the change in bytes over the past 30 days, or since the oldest datapoint if the bucket is younger
+	Growth      int64      `json:"growth_30d_bytes"`
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+	// Error is set if the bucket's region or metrics could not be looked up
+	Error string `json:"error,omitempty"`
+}
+
+// reportTotal adds up the rows of the account report, for a region or the whole account
+type reportTotal struct {
+	Region  string `json:"region,omitempty"`
+	Buckets int    `json:"buckets"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+	Growth  int64  `json:"growth_30d_bytes"`
+}
+
+func (t *reportTotal) add(b bucketReport) {
+	t.Buckets++
+	t.Objects += b.Objects
+	t.Bytes += b.Bytes
+	t.Growth += b.Growth
+}
+
+// accountReport is the size of every bucket in an account, grouped by region
+type accountReport struct {
+	Buckets []bucketReport `json:"buckets"`
+	Regions []reportTotal  `json:"regions"`
+	Total   reportTotal    `json:"total"`
+}
+
+// collectReport looks up the region of every bucket in `buckets`, then fetches the object count and bytes per
+// storage type of the buckets in each region in batched GetMetricData requests using the service returned by
+// `cloudwatchFor`. Buckets whose region or metrics could not be looked up are reported with an error.
+func collectReport(ctx context.Context, s3svc s3.Service, cloudwatchFor func(region string) cloudwatch.Service, buckets []string) accountReport {
+	rows := make([]bucketReport, len(buckets))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(10)
+	for i, bucket := range buckets {
+		g.Go(func() error {
+			rows[i] = bucketReport{Bucket: bucket, StorageTypes: map[cloudwatch.StorageType]int64{}}
+			region, err := s3svc.GetBucketRegion(gctx, bucket)
+			if err != nil {
+				rows[i].Error = fmt.Sprintf("region: %v", err)
+				return nil
+			}
+			rows[i].Region = region
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	byRegion := map[string][]int{}
+	for i, row := range rows {
+		if row.Error == "" {
+			byRegion[row.Region] = append(byRegion[row.Region], i)
+		}
+	}
+
+	// each region fills in its own rows, so no locking is needed
+	g, gctx = errgroup.WithContext(ctx)
+	g.SetLimit(5)
+	for region, indexes := range byRegion {
+		g.Go(func() error {
+			regionRows := make([]*bucketReport, 0, len(indexes))
+			for _, i := range indexes {
+				regionRows = append(regionRows, &rows[i])
+			}
+			err := fetchRegionMetrics(gctx, cloudwatchFor(region), regionRows)
+			if err != nil {
+				for _, row := range regionRows {
+					row.Error = fmt.Sprintf("metrics: %v", err)
+				}
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return newAccountReport(rows)
+}
+
+// fetchRegionMetrics fills in the metrics of `rows`, which must all be buckets in the region of `cloudwatchSvc`
+func fetchRegionMetrics(ctx context.Context, cloudwatchSvc cloudwatch.Service, rows []*bucketReport) error {
+	queries := []cloudwatch.MetricQuery{}
+	for _, row := range rows {
+		queries = append(queries, cloudwatch.MetricQuery{Bucket: row.Bucket, Metric: cloudwatch.NumberOfObjects, StorageType: cloudwatch.AllStorageTypes})
+		for _, storageType := range cloudwatch.StorageTypes {
+			queries = append(queries, cloudwatch.MetricQuery{Bucket: row.Bucket, Metric: cloudwatch.BucketSizeBytes, StorageType: storageType})
+		}
+	}
+
+	results, err := cloudwatchSvc.GetS3Metrics(ctx, queries, 720, 86400)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		objects := results[cloudwatch.MetricQuery{Bucket: row.Bucket, Metric: cloudwatch.NumberOfObjects, StorageType: cloudwatch.AllStorageTypes}]
+		if objects != nil && len(objects.Values) > 0 {
+			row.Objects = int64(objects.Values[0])
+		}
+
+		classes := []storageClass{}
+		for _, storageType := range cloudwatch.StorageTypes {
+			result := results[cloudwatch.MetricQuery{Bucket: row.Bucket, Metric: cloudwatch.BucketSizeBytes, StorageType: storageType}]
+			if result == nil || len(result.Values) == 0 {
+				continue
+			}
+			classes = append(classes, storageClass{StorageType: storageType, Timestamps: result.Timestamps, Values: result.Values})
+			row.StorageTypes[storageType] = int64(result.Values[0])
+		}
+
+		timestamps, totals := totalBytes(classes)
+		if len(totals) > 0 {
+			row.Bytes = int64(totals[0])
+			row.Growth = int64(totals[0] - totals[len(totals)-1])
+			lastUpdated := timestamps[0]
+			row.LastUpdated = &lastUpdated
+		}
+	}
+	return nil
+}
+
+// newAccountReport adds up `rows` by region and for the whole account
+func newAccountReport(rows []bucketReport) accountReport {
+	report := accountReport{Buckets: rows, Regions: []reportTotal{}}
+	regions := map[string]*reportTotal{}
+	for _, row := range rows {
+		report.Total.add(row)
+		if _, ok := regions[row.Region]; !ok {
+			regions[row.Region] = &reportTotal{Region: row.Region}
+		}
+		regions[row.Region].add(row)
+	}
+	for _, total := range regions {
+		report.Regions = append(report.Regions, *total)
+	}
+	sort.Slice(report.Regions, func(i, j int) bool {
+		if report.Regions[i].Bytes != report.Regions[j].Bytes {
+			return report.Regions[i].Bytes > report.Regions[j].Bytes
+		}
+		return report.Regions[i].Region < report.Regions[j].Region
+	})
+	return report
+}
+
+// sortBuckets sorts the buckets of the report in the order `by`, one of the sort constants
+func (r accountReport) sortBuckets(by string) {
+	key := func(b bucketReport) int64 {
+		switch by {
+		case sortObjects:
+			return b.Objects
+		case sortGrowth:
+			return b.Growth
+		}
+		return b.Bytes
+	}
+	sort.SliceStable(r.Buckets, func(i, j int) bool {
+		if by != sortName && key(r.Buckets[i]) != key(r.Buckets[j]) {
+			return key(r.Buckets[i]) > key(r.Buckets[j])
+		}
+		return r.Buckets[i].Bucket < r.Buckets[j].Bucket
+	})
+}
+
+// writeTable writes the report to `w` as a table for each region, largest region first, followed by the totals.
+// Buckets keep their order within each region.
+func (r accountReport) writeTable(w io.Writer, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	for _, region := range r.Regions {
+		name := region.Region
+		if name == "" {
+			name = "unknown region"
+		}
+		fmt.Fprintf(tw, "🌎 %s\t\t\t\t\t\t\n", name)
+		fmt.Fprintln(tw, "Bucket\tObjects\tSize\tLargest storage type\t30-day growth\tLast updated\t")
+		for _, b := range r.Buckets {
+			if b.Region != region.Region {
+				continue
+			}
+			if b.Error != "" {
+				fmt.Fprintf(tw, "%s\t%s\t\t\t\t\t\n", b.Bucket, b.Error)
+				continue
+			}
+			lastUpdated := "no metrics"
+			if b.LastUpdated != nil {
+				lastUpdated = humanize.RelTime(*b.LastUpdated, now, "ago", "from now")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", b.Bucket, humanize.Comma(b.Objects), humanize.IBytes(uint64(b.Bytes)),
+				largestStorageType(b.StorageTypes), formatGrowth(b.Growth, b.Bytes), lastUpdated)
+		}
+		fmt.Fprintf(tw, "subtotal (%d buckets)\t%s\t%s\t\t%s\t\t\n", region.Buckets, humanize.Comma(region.Objects), humanize.IBytes(uint64(region.Bytes)), formatGrowth(region.Growth, region.Bytes))
+		fmt.Fprintln(tw, "\t\t\t\t\t\t")
+	}
+	fmt.Fprintf(tw, "Total (%d buckets, %d regions)\t%s\t%s\t\t%s\t\t\n", r.Total.Buckets, len(r.Regions), humanize.Comma(r.Total.Objects), humanize.IBytes(uint64(r.Total.Bytes)), formatGrowth(r.Total.Growth, r.Total.Bytes))
+	return tw.Flush()
+}
+
+// largestStorageType returns the storage type with the most bytes and its share of the bucket
+func largestStorageType(storageTypes map[cloudwatch.StorageType]int64) string {
+	var largest cloudwatch.StorageType
+	var total int64
+	for storageType, bytes := range storageTypes {
+		total += bytes
+		if largest == "" || bytes > storageTypes[largest] || (bytes == storageTypes[largest] && storageType < largest) {
+			largest = storageType
+		}
+	}
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%.0f%%)", largest, float64(storageTypes[largest])/float64(total)*100)
+}
+
+// formatGrowth describes a change of `growth` bytes in something now `bytes` large
+func formatGrowth(growth int64, bytes int64) string {
+	sign := "+"
+	size := growth
+	if growth < 0 {
+		sign, size = "-", -growth
+	}
+	before := bytes - growth
+	if before <= 0 {
+		return sign + humanize.IBytes(uint64(size))
+	}
+	return fmt.Sprintf("%s%s (%s%.1f%%)", sign, humanize.IBytes(uint64(size)), sign, float64(size)/float64(before)*100)
+}
+
+// writeCSV writes one row per bucket to `w`, with a column for each storage type used by any bucket
+func (r accountReport) writeCSV(w io.Writer) error {
+	used := map[cloudwatch.StorageType]bool{}
+	for _, b := range r.Buckets {
+		for storageType := range b.StorageTypes {
+			used[storageType] = true
+		}
+	}
+	storageTypes := []cloudwatch.StorageType{}
+	for _, storageType := range cloudwatch.StorageTypes {
+		if used[storageType] {
+			storageTypes = append(storageTypes, storageType)
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	header := []string{"bucket", "region", "objects", "bytes", "growth_30d_bytes", "last_updated", "error"}
+	for _, storageType := range storageTypes {
+		header = append(header, string(storageType))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, b := range r.Buckets {
+		lastUpdated := ""
+		if b.LastUpdated != nil {
+			lastUpdated = b.LastUpdated.UTC().Format(time.RFC3339)
+		}
+		record := []string{b.Bucket, b.Region, strconv.FormatInt(b.Objects, 10), strconv.FormatInt(b.Bytes, 10), strconv.FormatInt(b.Growth, 10), lastUpdated, b.Error}
+		for _, storageType := range storageTypes {
+			record = append(record, strconv.FormatInt(b.StorageTypes[storageType], 10))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes the report to `w` as indented JSON
+func (r accountReport) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// exportFormat returns the export format of `path` from its extension: csv or json
+func exportFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv", ".json":
+		return ext[1:], nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q, use .csv or .json", ext)
+	}
+}
+
+// export writes the report to `path`, as CSV or JSON depending on its extension
+func (r accountReport) export(path string) error {
+	format, err := exportFormat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if format == "csv" {
+		err = r.writeCSV(f)
+	} else {
+		err = r.writeJSON(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
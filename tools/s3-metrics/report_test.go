@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// s3RegionMock returns the region of each bucket in `regions`, failing for any other bucket
+type s3RegionMock struct {
+	s3.Service
+	regions map[string]string
+}
+
+func (s s3RegionMock) GetBucketRegion(ctx context.Context, bucketName string) (string, error) {
+	region, ok := s.regions[bucketName]
+	if !ok {
+		return "", errors.New("NoSuchBucket")
+	}
+	return region, nil
+}
+
+// cloudwatchBatchMock answers GetS3Metrics from `bytes`/`objects`, keyed by bucket, and records the buckets of each call
+type cloudwatchBatchMock struct {
+	cloudwatch.Service
+	region  string
+	bytes   map[string]map[cloudwatch.StorageType][]float64
+	objects map[string]float64
+	// calls is shared by the mocks of every region, which are called concurrently
+	mu    *sync.Mutex
+	calls *[][]string
+}
+
+func (c cloudwatchBatchMock) GetS3Metrics(ctx context.Context, queries []cloudwatch.MetricQuery, startTimeDiff int, period int32) (map[cloudwatch.MetricQuery]*cloudwatch.MetricResults, error) {
+	buckets := []string{}
+	results := map[cloudwatch.MetricQuery]*cloudwatch.MetricResults{}
+	for _, q := range queries {
+		if q.Bucket == "failbucket" {
+			return nil, errors.New("AccessDenied")
+		}
+		result := &cloudwatch.MetricResults{}
+		switch q.Metric {
+		case cloudwatch.NumberOfObjects:
+			buckets = append(buckets, q.Bucket)
+			if objects, ok := c.objects[q.Bucket]; ok {
+				result.Timestamps, result.Values = []time.Time{day3}, []float64{objects}
+			}
+		case cloudwatch.BucketSizeBytes:
+			values := c.bytes[q.Bucket][q.StorageType]
+			result.Values = values
+			result.Timestamps = []time.Time{day3, day2, day1}[:len(values)]
+		}
+		results[q] = result
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.calls = append(*c.calls, append([]string{c.region}, buckets...))
+	return results, nil
+}
+
+func TestCollectReport(t *testing.T) {
+	s3svc := s3RegionMock{regions: map[string]string{
+		"logs":       "us-east-1",
+		"archive":    "us-east-1",
+		"images":     "eu-west-1",
+		"failbucket": "ap-south-1",
+	}}
+	var mu sync.Mutex
+	calls := [][]string{}
+	cloudwatchFor := func(region string) cloudwatch.Service {
+		return cloudwatchBatchMock{
+			region: region,
+			mu:     &mu,
+			calls:  &calls,
+			bytes: map[string]map[cloudwatch.StorageType][]float64{
+				"logs":    {cloudwatch.StandardStorage: {3000, 2000, 1000}},
+				"archive": {cloudwatch.StandardStorage: {100, 100, 100}, cloudwatch.GlacierStorage: {9900, 9900, 9900}},
+				"images":  {cloudwatch.StandardStorage: {500, 1000}},
+			},
+			objects: map[string]float64{"logs": 30, "archive": 2, "images": 5},
+		}
+	}
+
+	report := collectReport(context.Background(), s3svc, cloudwatchFor, []string{"logs", "archive", "images", "failbucket", "missing"})
+
+	// one batched request per region
+	if len(calls) != 2 {
+		t.Errorf("collectReport() made %d GetS3Metrics calls, want 2: %v", len(calls), calls)
+	}
+
+	rows := map[string]bucketReport{}
+	for _, row := range report.Buckets {
+		rows[row.Bucket] = row
+	}
+	archive := rows["archive"]
+	if archive.Objects != 2 || archive.Bytes != 10000 || archive.Growth != 0 || archive.LastUpdated == nil || !archive.LastUpdated.Equal(day3) {
+		t.Errorf("collectReport() archive = %+v", archive)
+	}
+	if !reflect.DeepEqual(archive.StorageTypes, map[cloudwatch.StorageType]int64{cloudwatch.StandardStorage: 100, cloudwatch.GlacierStorage: 9900}) {
+		t.Errorf("collectReport() archive storage types = %v", archive.StorageTypes)
+	}
+	if rows["logs"].Growth != 2000 || rows["images"].Growth != -500 {
+		t.Errorf("collectReport() growth = %d, %d", rows["logs"].Growth, rows["images"].Growth)
+	}
+	if !strings.HasPrefix(rows["missing"].Error, "region:") || !strings.HasPrefix(rows["failbucket"].Error, "metrics:") {
+		t.Errorf("collectReport() errors = %q, %q", rows["missing"].Error, rows["failbucket"].Error)
+	}
+
+	if report.Total.Buckets != 5 || report.Total.Bytes != 13500 || report.Total.Objects != 37 {
+		t.Errorf("collectReport() total = %+v", report.Total)
+	}
+	regions := []string{}
+	for _, region := range report.Regions {
+		regions = append(regions, region.Region)
+	}
+	if !reflect.DeepEqual(regions, []string{"us-east-1", "eu-west-1", "", "ap-south-1"}) {
+		t.Errorf("collectReport() regions = %v", regions)
+	}
+
+	report.sortBuckets(sortGrowth)
+	order := []string{}
+	for _, row := range report.Buckets {
+		order = append(order, row.Bucket)
+	}
+	if !reflect.DeepEqual(order, []string{"logs", "archive", "failbucket", "missing", "images"}) {
+		t.Errorf("sortBuckets(growth) = %v", order)
+	}
+
+	var table bytes.Buffer
+	if err := report.writeTable(&table, day3); err != nil {
+		t.Fatalf("writeTable() error = %v", err)
+	}
+	for _, line := range []string{
+		"archive 2 9.8 KiB GlacierStorage (99%) +0 B (+0.0%) now",
+		"logs 30 2.9 KiB StandardStorage (100%) +2.0 KiB (+200.0%) now",
+		"Total (5 buckets, 4 regions) 37 13 KiB +1.5 KiB (+12.5%)",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(table.String()), " "), line) {
+			t.Errorf("writeTable() is missing %q:\n%s", line, table.String())
+		}
+	}
+
+	var csv bytes.Buffer
+	if err := report.writeCSV(&csv); err != nil {
+		t.Fatalf("writeCSV() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if lines[0] != "bucket,region,objects,bytes,growth_30d_bytes,last_updated,error,StandardStorage,GlacierStorage" {
+		t.Errorf("writeCSV() header = %q", lines[0])
+	}
+	if lines[1] != "logs,us-east-1,30,3000,2000,2024-01-03T00:00:00Z,,3000,0" {
+		t.Errorf("writeCSV() first row = %q", lines[1])
+	}
+
+	var out bytes.Buffer
+	if err := report.writeJSON(&out); err != nil {
+		t.Fatalf("writeJSON() error = %v", err)
+	}
+	var decoded accountReport
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("writeJSON() wrote invalid JSON: %v", err)
+	}
+	if len(decoded.Buckets) != 5 || decoded.Total.Bytes != 13500 || decoded.Buckets[1].StorageTypes[cloudwatch.GlacierStorage] != 9900 {
+		t.Errorf("writeJSON() = %s", out.String())
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "report.csv", want: "csv"},
+		{path: "out/Report.JSON", want: "json"},
+		{path: "report.md", wantErr: true},
+		{path: "report", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := exportFormat(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exportFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("exportFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/internal/pkg/scan"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// cloudwatchStorageTypes maps S3 storage classes to the CloudWatch storage types holding their data. Overheads and
+// staging storage are left out, since they are not part of the size of any object version.
+var cloudwatchStorageTypes = map[string][]cloudwatch.StorageType{
+	"STANDARD":           {cloudwatch.StandardStorage},
+	"REDUCED_REDUNDANCY": {cloudwatch.ReducedRedundancyStorage},
+	"STANDARD_IA":        {cloudwatch.StandardIAStorage},
+	"ONEZONE_IA":         {cloudwatch.OneZoneIAStorage},
+	"INTELLIGENT_TIERING": {
+		cloudwatch.IntelligentTieringFAStorage,
+		cloudwatch.IntelligentTieringIAStorage,
+		cloudwatch.IntelligentTieringAAStorage,
+		cloudwatch.IntelligentTieringAIAStorage,
+		cloudwatch.IntelligentTieringDAAStorage,
+	},
+	"GLACIER_IR":   {cloudwatch.GlacierInstantRetrievalStorage},
+	"GLACIER":      {cloudwatch.GlacierStorage},
+	"DEEP_ARCHIVE": {cloudwatch.DeepArchiveStorage},
+}
+
+// scanStorageClassOrder is the order storage classes are listed in when comparing a scan with CloudWatch
+var scanStorageClassOrder = []string{"STANDARD", "REDUCED_REDUNDANCY", "STANDARD_IA", "ONEZONE_IA", "INTELLIGENT_TIERING", "GLACIER_IR", "GLACIER", "DEEP_ARCHIVE"}
+
+// scanBucket counts every object version and delete marker in `bucket`, listing up to `concurrency` prefixes at once.
+// `scanned` is updated with the number of versions counted so far.
+func scanBucket(ctx context.Context, s3svc s3.Service, bucket string, concurrency int, scanned *atomic.Int64) (*scan.Tally, error) {
+	var mu sync.Mutex
+	tally := scan.NewTally()
+	err := scan.Walk(ctx, s3svc, bucket, "", concurrency, func(versions []s3.ObjectVersion) {
+		page := scan.NewTally()
+		for _, version := range versions {
+			page.Add(version)
+		}
+		scanned.Add(int64(len(versions)))
+
+		mu.Lock()
+		defer mu.Unlock()
+		tally.Merge(page)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tally, nil
+}
+
+// cloudwatchClassBytes returns the latest bytes reported by CloudWatch for each S3 storage class in `classes`
+func cloudwatchClassBytes(classes []storageClass) map[string]int64 {
+	latest := map[cloudwatch.StorageType]float64{}
+	for _, class := range classes {
+		latest[class.StorageType] = class.latest()
+	}
+	bytes := map[string]int64{}
+	for storageClass, storageTypes := range cloudwatchStorageTypes {
+		for _, storageType := range storageTypes {
+			if value, ok := latest[storageType]; ok {
+				bytes[storageClass] += int64(value)
+			}
+		}
+	}
+	return bytes
+}
+
+// printScan writes a table of `tally` next to the CloudWatch object count `objects` and storage `classes` to `w`
+func printScan(w io.Writer, tally *scan.Tally, objects float64, classes []storageClass) error {
+	cloudwatchBytes := cloudwatchClassBytes(classes)
+	cloudwatchTotal := int64(0)
+	for _, bytes := range cloudwatchBytes {
+		cloudwatchTotal += bytes
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tScanned objects\tScanned size\tCloudWatch objects\tCloudWatch size\tDifference\t")
+	fmt.Fprintf(tw, "Current versions\t%s\t%s\t\t\t\t\n", humanize.Comma(tally.Current.Objects), humanize.IBytes(uint64(tally.Current.Bytes)))
+	fmt.Fprintf(tw, "Noncurrent versions\t%s\t%s\t\t\t\t\n", humanize.Comma(tally.Noncurrent.Objects), humanize.IBytes(uint64(tally.Noncurrent.Bytes)))
+	fmt.Fprintf(tw, "Delete markers\t%s\t\t\t\t\t\n", humanize.Comma(tally.DeleteMarkers))
+	fmt.Fprintf(tw, "Total\t%s\t%s\t%s\t%s\t%s\t\n", humanize.Comma(tally.Versions()), humanize.IBytes(uint64(tally.Bytes())),
+		humanize.Comma(int64(objects)), humanize.IBytes(uint64(cloudwatchTotal)), formatDifference(tally.Bytes(), cloudwatchTotal))
+	fmt.Fprintln(tw, "\t\t\t\t\t\t")
+
+	fmt.Fprintln(tw, "Storage class\tScanned objects\tScanned size\t\tCloudWatch size\tDifference\t")
+	listed := map[string]bool{}
+	storageClasses := append(append([]string{}, scanStorageClassOrder...), tally.SortedStorageClasses()...)
+	for _, storageClass := range storageClasses {
+		counts, scanned := tally.StorageClasses[storageClass]
+		bytes, reported := cloudwatchBytes[storageClass]
+		if listed[storageClass] || (!scanned && !reported) {
+			continue
+		}
+		listed[storageClass] = true
+		name := storageClass
+		if name == "" {
+			name = "(none)"
+		}
+		cloudwatchSize, difference := "-", "-"
+		if _, ok := cloudwatchStorageTypes[storageClass]; ok {
+			cloudwatchSize, difference = humanize.IBytes(uint64(bytes)), formatDifference(counts.Bytes, bytes)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\t%s\t%s\t\n", name, humanize.Comma(counts.Objects), humanize.IBytes(uint64(counts.Bytes)), cloudwatchSize, difference)
+	}
+	return tw.Flush()
+}
+
+// formatDifference describes how much larger the `scanned` bytes are than the `reported` bytes
+func formatDifference(scanned int64, reported int64) string {
+	difference := scanned - reported
+	if difference == 0 {
+		return "0 B"
+	}
+	sign := "+"
+	if difference < 0 {
+		sign, difference = "-", -difference
+	}
+	return sign + humanize.IBytes(uint64(difference))
+}
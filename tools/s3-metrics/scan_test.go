@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/s3"
+)
+
+// s3VersionsMock lists `versions` directly under the root of the bucket on a single page
+type s3VersionsMock struct {
+	s3.Service
+	versions []s3.ObjectVersion
+}
+
+func (s s3VersionsMock) ListVersionPrefix(ctx context.Context, bucketName string, prefix string, keyMarker *string, versionIDMarker *string) (*s3.VersionListing, error) {
+	return &s3.VersionListing{Prefixes: []string{}, Versions: s.versions}, nil
+}
+
+func TestScanBucket(t *testing.T) {
+	s3svc := s3VersionsMock{versions: []s3.ObjectVersion{
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("a")}, IsLatest: true, Size: 1000, StorageClass: "STANDARD"},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("a")}, Size: 2000, StorageClass: "STANDARD"},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("b")}, IsLatest: true, Size: 5000, StorageClass: "GLACIER"},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("c")}, IsLatest: true, IsDeleteMarker: true},
+		{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("c")}, Size: 100, StorageClass: "EXPRESS_ONEZONE"},
+	}}
+
+	var scanned atomic.Int64
+	tally, err := scanBucket(context.Background(), s3svc, "bucket", 4, &scanned)
+	if err != nil {
+		t.Fatalf("scanBucket() error = %v", err)
+	}
+	if scanned.Load() != 5 || tally.Versions() != 5 || tally.Bytes() != 8100 || tally.DeleteMarkers != 1 {
+		t.Errorf("scanBucket() = %+v, scanned %d", tally, scanned.Load())
+	}
+
+	now := time.Now()
+	classes := []storageClass{
+		{StorageType: cloudwatch.StandardStorage, Timestamps: []time.Time{now}, Values: []float64{2000}},
+		{StorageType: cloudwatch.GlacierStorage, Timestamps: []time.Time{now}, Values: []float64{5000}},
+		// overheads are not compared with the size of object versions
+		{StorageType: cloudwatch.GlacierObjectOverhead, Timestamps: []time.Time{now}, Values: []float64{32768}},
+		{StorageType: cloudwatch.StandardIAStorage, Timestamps: []time.Time{now}, Values: []float64{1024}},
+	}
+	var out bytes.Buffer
+	if err := printScan(&out, tally, 4, classes); err != nil {
+		t.Fatalf("printScan() error = %v", err)
+	}
+	for _, line := range []string{
+		"Current versions 2 5.9 KiB",
+		"Noncurrent versions 2 2.1 KiB",
+		"Delete markers 1",
+		"Total 5 7.9 KiB 4 7.8 KiB +76 B",
+		"STANDARD 2 2.9 KiB 2.0 KiB +1000 B",
+		"STANDARD_IA 0 0 B 1.0 KiB -1.0 KiB",
+		"GLACIER 1 4.9 KiB 4.9 KiB 0 B",
+		"EXPRESS_ONEZONE 1 100 B - -",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(out.String()), " "), line) {
+			t.Errorf("printScan() is missing %q:\n%s", line, out.String())
+		}
+	}
+}
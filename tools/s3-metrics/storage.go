@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+)
+
+// storageClass is the BucketSizeBytes metric of a bucket for one storage type
+//
+// Timestamps/values are ordered newest first at the 0th index and ordered descending
+type storageClass struct {
+	StorageType cloudwatch.StorageType
+	Timestamps  []time.Time
+	Values      []float64
+}
+
+// latest returns the most recent number of bytes stored in the storage class
+func (c storageClass) latest() float64 {
+	if len(c.Values) == 0 {
+		return 0
+	}
+	return c.Values[0]
+}
+
+// fetchStorageClasses fetches the BucketSizeBytes metric of `bucket` for every storage type, batched into as few
+// GetMetricData requests as possible
+//
+// returns:
+//   `[]storageClass` - the storage types with any datapoints, largest (by latest value) first
+//   `error` - error, if any
+func fetchStorageClasses(ctx context.Context, cloudwatchSvc cloudwatch.Service, bucket string, startTimeDiff int, period int32) ([]storageClass, error) {
+	queries := make([]cloudwatch.MetricQuery, 0, len(cloudwatch.StorageTypes))
+	for _, storageType := range cloudwatch.StorageTypes {
+		queries = append(queries, cloudwatch.MetricQuery{Bucket: bucket, Metric: cloudwatch.BucketSizeBytes, StorageType: storageType})
+	}
+
+	results, err := cloudwatchSvc.GetS3Metrics(ctx, queries, startTimeDiff, period)
+	if err != nil {
+		return nil, err
+	}
+
+	classes := []storageClass{}
+	for _, q := range queries {
+		result, ok := results[q]
+		if !ok || len(result.Values) == 0 {
+			continue
+		}
+		classes = append(classes, storageClass{StorageType: q.StorageType, Timestamps: result.Timestamps, Values: result.Values})
+	}
+
+	sortStorageClasses(classes)
+	return classes, nil
+}
+
+// sortStorageClasses sorts `classes` largest first, by their latest value, keeping the order of
+// cloudwatch.StorageTypes between classes of the same size
+func sortStorageClasses(classes []storageClass) {
+	order := map[cloudwatch.StorageType]int{}
+	for i, storageType := range cloudwatch.StorageTypes {
+		order[storageType] = i
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].latest() != classes[j].latest() {
+			return classes[i].latest() > classes[j].latest()
+		}
+		return order[classes[i].StorageType] < order[classes[j].StorageType]
+	})
+}
+
+// totalBytes adds up `classes` for each timestamp
+//
+// returns the timestamps and totals, newest first
+func totalBytes(classes []storageClass) ([]time.Time, []float64) {
+	totals := map[time.Time]float64{}
+	for _, class := range classes {
+		for i, value := range class.Values {
+			if i < len(class.Timestamps) {
+				totals[class.Timestamps[i]] += value
+			}
+		}
+	}
+
+	timestamps := make([]time.Time, 0, len(totals))
+	for timestamp := range totals {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].After(timestamps[j]) })
+	values := make([]float64, 0, len(timestamps))
+	for _, timestamp := range timestamps {
+		values = append(values, totals[timestamp])
+	}
+	return timestamps, values
+}
+
+// alignedSeries returns the values of `classes` oldest first for graphing together, one series per class, lined up
+// on every timestamp found in any class. A class without a datapoint at a timestamp has NaN there, which is not drawn.
+func alignedSeries(classes []storageClass) [][]float64 {
+	timestamps, _ := totalBytes(classes)
+	index := map[time.Time]int{}
+	for i, timestamp := range timestamps {
+		// oldest first
+		index[timestamp] = len(timestamps) - 1 - i
+	}
+
+	series := make([][]float64, 0, len(classes))
+	for _, class := range classes {
+		values := make([]float64, len(timestamps))
+		for i := range values {
+			values[i] = math.NaN()
+		}
+		for i, value := range class.Values {
+			if i < len(class.Timestamps) {
+				values[index[class.Timestamps[i]]] = value
+			}
+		}
+		series = append(series, values)
+	}
+	return series
+}
+
+// printStorageClasses writes a table of the latest bytes stored in each of `classes` to `w`, with their share of the
+// total
+func printStorageClasses(w io.Writer, classes []storageClass) error {
+	total := 0.0
+	for _, class := range classes {
+		total += class.latest()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Storage type\tBytes\tSize\tShare\t")
+	for _, class := range classes {
+		share := 0.0
+		if total > 0 {
+			share = class.latest() / total * 100
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.1f%%\t\n", class.StorageType, humanize.Comma(int64(class.latest())), humanize.IBytes(uint64(class.latest())), share)
+	}
+	fmt.Fprintf(tw, "Total\t%s\t%s\t\t\n", humanize.Comma(int64(total)), humanize.IBytes(uint64(total)))
+	return tw.Flush()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soapiestwaffles/s3-nuke/pkg/aws/cloudwatch"
+)
+
+var (
+	day1 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 = day1.Add(24 * time.Hour)
+	day3 = day2.Add(24 * time.Hour)
+)
+
+// cloudwatchServiceMock returns the datapoints in `bytes` for each storage type, newest first, and counts the
+// GetS3Metrics calls
+type cloudwatchServiceMock struct {
+	cloudwatch.Service
+	bytes map[cloudwatch.StorageType]map[time.Time]float64
+	fail  bool
+	calls *int
+}
+
+func (c cloudwatchServiceMock) GetS3Metrics(ctx context.Context, queries []cloudwatch.MetricQuery, startTimeDiff int, period int32) (map[cloudwatch.MetricQuery]*cloudwatch.MetricResults, error) {
+	*c.calls++
+	if c.fail {
+		return nil, errors.New("AccessDenied")
+	}
+	results := map[cloudwatch.MetricQuery]*cloudwatch.MetricResults{}
+	for _, q := range queries {
+		if q.Bucket != "bucket" || q.Metric != cloudwatch.BucketSizeBytes {
+			return nil, fmt.Errorf("unexpected query %+v", q)
+		}
+		result := &cloudwatch.MetricResults{}
+		for _, timestamp := range []time.Time{day3, day2, day1} {
+			if value, ok := c.bytes[q.StorageType][timestamp]; ok {
+				result.Timestamps = append(result.Timestamps, timestamp)
+				result.Values = append(result.Values, value)
+			}
+		}
+		results[q] = result
+	}
+	return results, nil
+}
+
+func TestFetchStorageClasses(t *testing.T) {
+	calls := 0
+	svc := cloudwatchServiceMock{calls: &calls, bytes: map[cloudwatch.StorageType]map[time.Time]float64{
+		cloudwatch.StandardStorage:             {day3: 100, day2: 300, day1: 300},
+		cloudwatch.GlacierStorage:              {day3: 5000, day2: 4000},
+		cloudwatch.IntelligentTieringFAStorage: {day3: 100},
+	}}
+
+	classes, err := fetchStorageClasses(context.Background(), svc, "bucket", 720, 60)
+	if err != nil {
+		t.Fatalf("fetchStorageClasses() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("fetchStorageClasses() made %d GetS3Metrics calls, want every storage type in 1", calls)
+	}
+	got := []cloudwatch.StorageType{}
+	for _, class := range classes {
+		got = append(got, class.StorageType)
+	}
+	want := []cloudwatch.StorageType{cloudwatch.GlacierStorage, cloudwatch.StandardStorage, cloudwatch.IntelligentTieringFAStorage}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchStorageClasses() = %v, want %v", got, want)
+	}
+
+	timestamps, totals := totalBytes(classes)
+	if !reflect.DeepEqual(timestamps, []time.Time{day3, day2, day1}) || !reflect.DeepEqual(totals, []float64{5200, 4300, 300}) {
+		t.Errorf("totalBytes() = %v, %v", timestamps, totals)
+	}
+
+	series := alignedSeries(classes[:2])
+	if len(series) != 2 || !math.IsNaN(series[0][0]) || series[0][2] != 5000 || !reflect.DeepEqual(series[1], []float64{300, 300, 100}) {
+		t.Errorf("alignedSeries() = %v", series)
+	}
+
+	var out bytes.Buffer
+	if err := printStorageClasses(&out, classes); err != nil {
+		t.Fatalf("printStorageClasses() error = %v", err)
+	}
+	for _, line := range []string{"GlacierStorage   5,000   4.9 KiB   96.2%", "Total   5,200   5.1 KiB"} {
+		if !strings.Contains(strings.Join(strings.Fields(out.String()), " "), strings.Join(strings.Fields(line), " ")) {
+			t.Errorf("printStorageClasses() is missing %q:\n%s", line, out.String())
+		}
+	}
+
+	svc.fail = true
+	if _, err := fetchStorageClasses(context.Background(), svc, "bucket", 720, 60); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("fetchStorageClasses() error = %v, want AccessDenied failure", err)
+	}
+}